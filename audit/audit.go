@@ -0,0 +1,66 @@
+// Package audit records authentication events: logins, failures, logouts, token refreshes,
+// passkey changes and session revocations. There is no password change event: the service
+// only checks passwords at login, and applications that set or change them through the user
+// store record those changes themselves.
+package audit
+
+import (
+	"context"
+	"time"
+)
+
+type Type string
+
+const (
+	Login         Type = "login"
+	Logout        Type = "logout"
+	Refresh       Type = "refresh"
+	MFAChange     Type = "mfa_change"
+	SessionRevoke Type = "session_revoke"
+)
+
+type Outcome string
+
+const (
+	Success Outcome = "success"
+	Failure Outcome = "failure"
+)
+
+// Event is one authentication event. UserID is empty when a failed attempt could not be
+// tied to a user.
+type Event struct {
+	ID        string    `json:"id"`
+	Time      time.Time `json:"time"`
+	Type      Type      `json:"type"`
+	UserID    string    `json:"user_id,omitempty"`
+	Provider  string    `json:"provider,omitempty"` // login method: "password", "otp", "magic", "passkey" or an OAuth provider
+	IP        string    `json:"ip,omitempty"`
+	UserAgent string    `json:"user_agent,omitempty"`
+	Outcome   Outcome   `json:"outcome"`
+	Reason    string    `json:"reason,omitempty"` // why an attempt failed, e.g. "invalid_credentials"
+}
+
+// Sink receives audit events. RecordEvent is called synchronously from the handlers,
+// so slow sinks should buffer.
+type Sink interface {
+	RecordEvent(ctx context.Context, e Event) error
+}
+
+// Querier is implemented by sinks that can read events back.
+type Querier interface {
+	// RecentEvents returns up to limit events of the user, newest first.
+	RecentEvents(ctx context.Context, userID string, limit int) ([]Event, error)
+}
+
+// Eraser is implemented by sinks that can anonymise a user's events for erasure requests.
+type Eraser interface {
+	// EraseUserEvents clears the user ID, IP and user agent of the user's events and keeps
+	// their type, time and outcome.
+	EraseUserEvents(ctx context.Context, userID string) error
+}
+
+type Func func(ctx context.Context, e Event) error
+
+func (f Func) RecordEvent(ctx context.Context, e Event) error {
+	return f(ctx, e)
+}
@@ -0,0 +1,134 @@
+package audit
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"os"
+	"slices"
+	"sync"
+)
+
+// File appends events to a JSON-lines file, one event per line.
+type File struct {
+	mu   sync.Mutex
+	path string
+	f    *os.File
+}
+
+// NewFile opens path for appending, creating it if needed.
+func NewFile(path string) (*File, error) {
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o600)
+	if err != nil {
+		return nil, err
+	}
+	return &File{path: path, f: f}, nil
+}
+
+func (f *File) Close() error {
+	return f.f.Close()
+}
+
+func (f *File) RecordEvent(_ context.Context, e Event) error {
+	line, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	_, err = f.f.Write(append(line, '\n'))
+	return err
+}
+
+// RecentEvents scans the whole file, so it is meant for occasional admin queries.
+// Lines that don't parse are skipped.
+func (f *File) RecentEvents(_ context.Context, userID string, limit int) ([]Event, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	r, err := os.Open(f.path)
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+
+	var events []Event
+	sc := bufio.NewScanner(r)
+	sc.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	for sc.Scan() {
+		var e Event
+		if json.Unmarshal(sc.Bytes(), &e) != nil || e.UserID != userID {
+			continue
+		}
+		events = append(events, e)
+		if len(events) > limit {
+			events = events[1:]
+		}
+	}
+	if err := sc.Err(); err != nil {
+		return nil, err
+	}
+
+	slices.Reverse(events)
+	return events, nil
+}
+
+// EraseUserEvents rewrites the whole file, replacing it atomically. Lines that don't parse
+// are kept as they are.
+func (f *File) EraseUserEvents(_ context.Context, userID string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	r, err := os.Open(f.path)
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+
+	tmp, err := os.OpenFile(f.path+".tmp", os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0o600)
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	w := bufio.NewWriter(tmp)
+	sc := bufio.NewScanner(r)
+	sc.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	for sc.Scan() {
+		line := sc.Bytes()
+		var e Event
+		if json.Unmarshal(line, &e) == nil && e.UserID == userID {
+			e.UserID, e.IP, e.UserAgent = "", "", ""
+			if line, err = json.Marshal(e); err != nil {
+				tmp.Close()
+				return err
+			}
+		}
+		w.Write(line)
+		w.WriteByte('\n')
+	}
+	if err := sc.Err(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := w.Flush(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp.Name(), f.path); err != nil {
+		return err
+	}
+
+	// Keep appending to the new file.
+	next, err := os.OpenFile(f.path, os.O_APPEND|os.O_WRONLY, 0o600)
+	if err != nil {
+		return err
+	}
+	f.f.Close()
+	f.f = next
+	return nil
+}
@@ -0,0 +1,79 @@
+package audit
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestFile_RecentEvents(t *testing.T) {
+	ctx := context.Background()
+	f, err := NewFile(filepath.Join(t.TempDir(), "audit.jsonl"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	now := time.Now()
+	for i, e := range []Event{
+		{ID: "1", UserID: "u1", Type: Login, Outcome: Success},
+		{ID: "2", UserID: "u2", Type: Login, Outcome: Success},
+		{ID: "3", UserID: "u1", Type: Login, Outcome: Failure, Reason: "invalid_credentials"},
+		{ID: "4", UserID: "u1", Type: Logout, Outcome: Success},
+	} {
+		e.Time = now.Add(time.Duration(i) * time.Second)
+		if err := f.RecordEvent(ctx, e); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	events, err := f.RecentEvents(ctx, "u1", 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(events) != 2 || events[0].ID != "4" || events[1].ID != "3" {
+		t.Fatalf("expected events 4 and 3, got %+v", events)
+	}
+	if events[1].Reason != "invalid_credentials" || events[1].Outcome != Failure {
+		t.Errorf("fields not preserved: %+v", events[1])
+	}
+
+	if events, _ := f.RecentEvents(ctx, "nobody", 10); len(events) != 0 {
+		t.Errorf("expected no events, got %+v", events)
+	}
+}
+
+func TestFile_EraseUserEvents(t *testing.T) {
+	ctx := context.Background()
+	f, err := NewFile(filepath.Join(t.TempDir(), "audit.jsonl"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	for _, e := range []Event{
+		{ID: "1", UserID: "u1", Type: Login, Outcome: Success, IP: "10.0.0.1", UserAgent: "curl"},
+		{ID: "2", UserID: "u2", Type: Login, Outcome: Success, IP: "10.0.0.2"},
+	} {
+		if err := f.RecordEvent(ctx, e); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := f.EraseUserEvents(ctx, "u1"); err != nil {
+		t.Fatal(err)
+	}
+	if events, _ := f.RecentEvents(ctx, "u1", 10); len(events) != 0 {
+		t.Errorf("expected u1's events to be anonymised, got %+v", events)
+	}
+	if events, _ := f.RecentEvents(ctx, "", 10); len(events) != 1 || events[0].ID != "1" || events[0].IP != "" || events[0].Type != Login {
+		t.Errorf("expected the anonymised event to be kept, got %+v", events)
+	}
+
+	// Writes after the rewrite go to the new file.
+	f.RecordEvent(ctx, Event{ID: "3", UserID: "u2", Type: Logout, Outcome: Success})
+	if events, _ := f.RecentEvents(ctx, "u2", 10); len(events) != 2 || events[0].ID != "3" || events[1].IP != "10.0.0.2" {
+		t.Errorf("expected u2's events to be untouched, got %+v", events)
+	}
+}
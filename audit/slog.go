@@ -0,0 +1,38 @@
+package audit
+
+import (
+	"context"
+	"log/slog"
+)
+
+// Slog writes events to a structured logger: successes at Info, failures at Warn.
+type Slog struct {
+	Logger *slog.Logger
+}
+
+// NewSlog returns a sink writing to l, or to slog.Default() when l is nil.
+func NewSlog(l *slog.Logger) *Slog {
+	if l == nil {
+		l = slog.Default()
+	}
+	return &Slog{Logger: l}
+}
+
+func (s *Slog) RecordEvent(ctx context.Context, e Event) error {
+	level := slog.LevelInfo
+	if e.Outcome == Failure {
+		level = slog.LevelWarn
+	}
+	s.Logger.LogAttrs(ctx, level, "auth event",
+		slog.String("id", e.ID),
+		slog.Time("time", e.Time),
+		slog.String("type", string(e.Type)),
+		slog.String("user_id", e.UserID),
+		slog.String("provider", e.Provider),
+		slog.String("ip", e.IP),
+		slog.String("user_agent", e.UserAgent),
+		slog.String("outcome", string(e.Outcome)),
+		slog.String("reason", e.Reason),
+	)
+	return nil
+}
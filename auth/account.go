@@ -0,0 +1,79 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"time"
+
+	"auth-go-skd/data"
+)
+
+var (
+	errAccountBlocked = Reject(http.StatusForbidden, "account blocked")
+	errAccountDeleted = Reject(http.StatusForbidden, "account deleted")
+	// errAccountNotFound refuses users removed from Opts.UserStore, such as purged or erased ones.
+	errAccountNotFound = &HookError{Status: http.StatusUnauthorized, Message: "account not found", Err: data.ErrUserNotFound}
+)
+
+// accountError reports why u may not log in, or nil when it may.
+func accountError(u *data.User) error {
+	switch {
+	case !u.DeletedAt.IsZero():
+		return errAccountDeleted
+	case !u.BlockedAt.IsZero():
+		return errAccountBlocked
+	}
+	return nil
+}
+
+// accountUnusable reports whether err means the user can no longer use their tokens: they
+// are gone, blocked or deleted.
+func accountUnusable(err error) bool {
+	return errors.Is(err, data.ErrUserNotFound) || errors.Is(err, errAccountBlocked) || errors.Is(err, errAccountDeleted)
+}
+
+// checkAccount refuses blocked and deleted users, and users Opts.UserStore doesn't know, as
+// refreshes do. Without a UserStore every user passes.
+func (s *Service) checkAccount(ctx context.Context, userID string) error {
+	if s.opts.UserStore == nil {
+		return nil
+	}
+	u, err := s.opts.UserStore.GetUserByID(ctx, userID)
+	if errors.Is(err, data.ErrUserNotFound) {
+		return errAccountNotFound
+	}
+	if err != nil {
+		return err
+	}
+	return accountError(u)
+}
+
+// PurgeDeletedUsers permanently deletes the users soft-deleted more than
+// Opts.DeletedUserRetention ago, with their sessions, identities and memberships.
+func (s *Service) PurgeDeletedUsers(ctx context.Context) (int, error) {
+	if s.opts.UserStore == nil {
+		return 0, nil
+	}
+	return s.opts.UserStore.PurgeDeletedUsers(ctx, time.Now().Add(-s.opts.DeletedUserRetention))
+}
+
+// RunUserPurge calls PurgeDeletedUsers every Opts.UserPurgeInterval until ctx is done.
+// Run it in its own goroutine, on one instance.
+func (s *Service) RunUserPurge(ctx context.Context) {
+	ticker := time.NewTicker(s.opts.UserPurgeInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			n, err := s.PurgeDeletedUsers(ctx)
+			if err != nil {
+				s.logger.Printf("purge deleted users: %v", err)
+			} else if n > 0 {
+				s.logger.Printf("purged %d deleted users", n)
+			}
+		}
+	}
+}
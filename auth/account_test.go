@@ -0,0 +1,85 @@
+package auth
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"auth-go-skd/data"
+	"auth-go-skd/store/memory"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+func TestAccountStatus(t *testing.T) {
+	ctx := context.Background()
+	mem := memory.New()
+	hash, _ := bcrypt.GenerateFromPassword([]byte("password"), bcrypt.MinCost)
+	mem.CreateUser(ctx, &data.User{ID: "u1", Email: "a@example.com", PasswordHash: string(hash), Role: "user"})
+
+	s := New(Opts{URL: "http://localhost:8080", UserStore: mem, SessionStore: mem, CheckAccountStatus: true})
+	h, _ := s.Handlers()
+	protected := s.Middleware().Auth(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	do := func(h http.Handler, method, path, body, bearer string) *httptest.ResponseRecorder {
+		return doJSON(t, h, method, path, []byte(body), nil, bearer)
+	}
+	var tokens struct {
+		Token        string `json:"token"`
+		RefreshToken string `json:"refresh_token"`
+	}
+	json.NewDecoder(do(h, http.MethodPost, "/login", `{"email":"a@example.com","password":"password"}`, "").Body).Decode(&tokens)
+	if rec := do(protected, http.MethodGet, "/", "", tokens.Token); rec.Code != http.StatusOK {
+		t.Fatalf("active account: expected 200, got %d", rec.Code)
+	}
+
+	// Block the user directly in the store, as another instance would
+	u, _ := mem.GetUserByID(ctx, "u1")
+	u.BlockedAt = time.Now()
+	mem.UpdateUser(ctx, u)
+
+	if rec := do(protected, http.MethodGet, "/", "", tokens.Token); rec.Code != http.StatusForbidden {
+		t.Errorf("middleware: expected 403 for a blocked account, got %d", rec.Code)
+	}
+	if rec := do(h, http.MethodPost, "/refresh", `{"refresh_token":"`+tokens.RefreshToken+`"}`, ""); rec.Code != http.StatusForbidden {
+		t.Errorf("refresh: expected 403 for a blocked account, got %d", rec.Code)
+	}
+	if sessions, _ := mem.ListSessionsByUser(ctx, "u1"); len(sessions) != 0 {
+		t.Errorf("a refused refresh should not leave a session behind, got %d", len(sessions))
+	}
+
+	u.BlockedAt, u.DeletedAt = time.Time{}, time.Now()
+	mem.UpdateUser(ctx, u)
+	rec := do(h, http.MethodPost, "/login", `{"email":"a@example.com","password":"password"}`, "")
+	if rec.Code != http.StatusForbidden || rec.Body.String() != "account deleted\n" {
+		t.Errorf("login: expected 403 for a deleted account, got %d %q", rec.Code, rec.Body)
+	}
+
+	// A user removed from the store, as a purge does, can't keep using their token either
+	u.DeletedAt = time.Time{}
+	mem.UpdateUser(ctx, u)
+	mem.DeleteUser(ctx, "u1")
+	if rec := do(protected, http.MethodGet, "/", "", tokens.Token); rec.Code != http.StatusUnauthorized {
+		t.Errorf("middleware: expected 401 for a removed account, got %d", rec.Code)
+	}
+}
+
+func TestPurgeDeletedUsers(t *testing.T) {
+	ctx := context.Background()
+	mem := memory.New()
+	now := time.Now()
+	mem.CreateUser(ctx, &data.User{ID: "recent", Email: "recent@example.com", DeletedAt: now.Add(-time.Hour)})
+	mem.CreateUser(ctx, &data.User{ID: "old", Email: "old@example.com", DeletedAt: now.Add(-31 * 24 * time.Hour)})
+
+	s := New(Opts{UserStore: mem})
+	n, err := s.PurgeDeletedUsers(ctx)
+	if err != nil || n != 1 {
+		t.Fatalf("expected one purged user, got %d (%v)", n, err)
+	}
+	if _, err := mem.GetUserByID(ctx, "recent"); err != nil {
+		t.Errorf("users within the retention window should be kept: %v", err)
+	}
+}
@@ -0,0 +1,285 @@
+package auth
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"slices"
+	"strconv"
+	"time"
+
+	"auth-go-skd/data"
+
+	"github.com/go-chi/chi/v5"
+)
+
+const (
+	defaultUserPageSize = 50
+	maxUserPageSize     = 500
+)
+
+type userListResponse struct {
+	Users  []data.User `json:"users"`
+	Total  int         `json:"total"`
+	Limit  int         `json:"limit"`
+	Offset int         `json:"offset"`
+}
+
+type userDetailResponse struct {
+	User       *data.User      `json:"user"`
+	Identities []data.Identity `json:"identities,omitempty"`
+	Sessions   []data.Session  `json:"sessions,omitempty"`
+}
+
+type roleRequest struct {
+	Role string `json:"role"`
+}
+
+type blockRequest struct {
+	Reason string `json:"reason"`
+}
+
+// userFilter reads the filter and page of GET /admin/users from the query string.
+func userFilter(r *http.Request) (data.UserFilter, error) {
+	q := r.URL.Query()
+	f := data.UserFilter{Email: q.Get("email"), Role: q.Get("role"), Limit: defaultUserPageSize}
+
+	for name, dst := range map[string]**bool{"verified": &f.Verified, "blocked": &f.Blocked, "deleted": &f.Deleted} {
+		if v := q.Get(name); v != "" {
+			b, err := strconv.ParseBool(v)
+			if err != nil {
+				return f, errors.New("invalid " + name)
+			}
+			*dst = &b
+		}
+	}
+	for name, dst := range map[string]*time.Time{"created_after": &f.CreatedAfter, "created_before": &f.CreatedBefore} {
+		if v := q.Get(name); v != "" {
+			t, err := time.Parse(time.RFC3339, v)
+			if err != nil {
+				return f, errors.New("invalid " + name)
+			}
+			*dst = t
+		}
+	}
+	if v := q.Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 {
+			return f, errors.New("invalid limit")
+		}
+		f.Limit = min(n, maxUserPageSize)
+	}
+	if v := q.Get("offset"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 0 {
+			return f, errors.New("invalid offset")
+		}
+		f.Offset = n
+	}
+	return f, nil
+}
+
+// listUsersHandler returns a page of users matching the query filters, with the total count.
+func (s *Service) listUsersHandler(w http.ResponseWriter, r *http.Request) {
+	f, err := userFilter(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	ctx := r.Context()
+	users, err := s.opts.UserStore.ListUsers(ctx, f)
+	if err != nil {
+		s.logger.Printf("list users: %v", err)
+		http.Error(w, "failed to list users", http.StatusInternalServerError)
+		return
+	}
+	total, err := s.opts.UserStore.CountUsers(ctx, f)
+	if err != nil {
+		s.logger.Printf("count users: %v", err)
+		http.Error(w, "failed to list users", http.StatusInternalServerError)
+		return
+	}
+	if users == nil {
+		users = []data.User{}
+	}
+	json.NewEncoder(w).Encode(userListResponse{Users: users, Total: total, Limit: f.Limit, Offset: f.Offset})
+}
+
+// adminUser loads the user named in the URL, answering 404 when there is none.
+func (s *Service) adminUser(w http.ResponseWriter, r *http.Request) (*data.User, bool) {
+	u, err := s.opts.UserStore.GetUserByID(r.Context(), chi.URLParam(r, "id"))
+	if errors.Is(err, data.ErrUserNotFound) {
+		http.Error(w, "user not found", http.StatusNotFound)
+		return nil, false
+	}
+	if err != nil {
+		http.Error(w, "failed to load user", http.StatusInternalServerError)
+		return nil, false
+	}
+	return u, true
+}
+
+// getUserHandler returns a user with their identities and sessions, when those stores are configured.
+func (s *Service) getUserHandler(w http.ResponseWriter, r *http.Request) {
+	u, ok := s.adminUser(w, r)
+	if !ok {
+		return
+	}
+
+	ctx := r.Context()
+	resp := userDetailResponse{User: u}
+	var err error
+	if s.opts.IdentityStore != nil {
+		if resp.Identities, err = s.opts.IdentityStore.ListIdentitiesByUser(ctx, u.ID); err != nil {
+			http.Error(w, "failed to load identities", http.StatusInternalServerError)
+			return
+		}
+	}
+	if s.opts.SessionStore != nil {
+		if resp.Sessions, err = s.opts.SessionStore.ListSessionsByUser(ctx, u.ID); err != nil {
+			http.Error(w, "failed to load sessions", http.StatusInternalServerError)
+			return
+		}
+		// Only hashes are stored, but they identify the session all the same.
+		for i := range resp.Sessions {
+			resp.Sessions[i].RefreshToken = ""
+		}
+	}
+	json.NewEncoder(w).Encode(resp)
+}
+
+// setRoleHandler changes a user's role to one of Opts.Roles. It applies to tokens issued
+// afterwards; force a logout to apply it right away. Admins can't change their own role, so
+// there is always an admin left.
+func (s *Service) setRoleHandler(w http.ResponseWriter, r *http.Request) {
+	var req roleRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Role == "" {
+		http.Error(w, "invalid request body", http.StatusBadRequest)
+		return
+	}
+	if !slices.Contains(s.opts.Roles, req.Role) {
+		http.Error(w, "unknown role", http.StatusBadRequest)
+		return
+	}
+	u, ok := s.adminUser(w, r)
+	if !ok {
+		return
+	}
+	if u.ID == User(r).ID {
+		http.Error(w, "cannot change your own role", http.StatusBadRequest)
+		return
+	}
+
+	u.Role = req.Role
+	u.UpdatedAt = time.Now()
+	if err := s.opts.UserStore.UpdateUser(r.Context(), u); err != nil {
+		http.Error(w, "failed to update user", http.StatusInternalServerError)
+		return
+	}
+	json.NewEncoder(w).Encode(u)
+}
+
+// blockUserHandler blocks (POST, with an optional reason) or unblocks (DELETE) a user.
+// Blocking also logs the user out.
+func (s *Service) blockUserHandler(w http.ResponseWriter, r *http.Request) {
+	block := r.Method == http.MethodPost
+	var req blockRequest
+	if block {
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil && !errors.Is(err, io.EOF) {
+			http.Error(w, "invalid request body", http.StatusBadRequest)
+			return
+		}
+	}
+	u, ok := s.adminUser(w, r)
+	if !ok {
+		return
+	}
+	if block && u.ID == User(r).ID {
+		http.Error(w, "cannot block your own account", http.StatusBadRequest)
+		return
+	}
+
+	ctx := r.Context()
+	now := time.Now()
+	u.BlockedAt, u.BlockedReason = time.Time{}, ""
+	if block {
+		u.BlockedAt, u.BlockedReason = now, req.Reason
+	}
+	u.UpdatedAt = now
+	if err := s.opts.UserStore.UpdateUser(ctx, u); err != nil {
+		http.Error(w, "failed to update user", http.StatusInternalServerError)
+		return
+	}
+	if block {
+		if err := s.logoutUser(ctx, u.ID); err != nil {
+			s.logger.Printf("block %s: %v", u.ID, err)
+			http.Error(w, "failed to revoke sessions", http.StatusInternalServerError)
+			return
+		}
+	}
+	json.NewEncoder(w).Encode(u)
+}
+
+// forceLogoutHandler revokes all sessions of a user.
+func (s *Service) forceLogoutHandler(w http.ResponseWriter, r *http.Request) {
+	u, ok := s.adminUser(w, r)
+	if !ok {
+		return
+	}
+	if err := s.logoutUser(r.Context(), u.ID); err != nil {
+		s.logger.Printf("force logout %s: %v", u.ID, err)
+		http.Error(w, "failed to revoke sessions", http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// deleteUserHandler logs a user out and soft-deletes them; PurgeDeletedUsers removes them
+// for good after Opts.DeletedUserRetention.
+func (s *Service) deleteUserHandler(w http.ResponseWriter, r *http.Request) {
+	u, ok := s.adminUser(w, r)
+	if !ok {
+		return
+	}
+	if u.ID == User(r).ID {
+		http.Error(w, "cannot delete your own account", http.StatusBadRequest)
+		return
+	}
+
+	ctx := r.Context()
+	if err := s.logoutUser(ctx, u.ID); err != nil {
+		s.logger.Printf("delete %s: %v", u.ID, err)
+		http.Error(w, "failed to revoke sessions", http.StatusInternalServerError)
+		return
+	}
+	if u.DeletedAt.IsZero() {
+		u.DeletedAt = time.Now()
+		u.UpdatedAt = u.DeletedAt
+		if err := s.opts.UserStore.UpdateUser(ctx, u); err != nil {
+			http.Error(w, "failed to delete user", http.StatusInternalServerError)
+			return
+		}
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// logoutUser revokes every session of userID, so neither their refresh tokens nor the access
+// tokens issued with them are accepted anymore. Without a SessionStore there is nothing to revoke.
+func (s *Service) logoutUser(ctx context.Context, userID string) error {
+	if s.opts.SessionStore == nil {
+		return nil
+	}
+	sessions, err := s.opts.SessionStore.ListSessionsByUser(ctx, userID)
+	if err != nil {
+		return err
+	}
+	for _, session := range sessions {
+		if err := s.revokeSession(ctx, session.ID); err != nil {
+			return err
+		}
+	}
+	return nil
+}
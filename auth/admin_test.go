@@ -0,0 +1,167 @@
+package auth
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"auth-go-skd/data"
+	"auth-go-skd/store/memory"
+	"auth-go-skd/token"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+func TestAdminUsers(t *testing.T) {
+	ctx := context.Background()
+	mem := memory.New()
+	hash, _ := bcrypt.GenerateFromPassword([]byte("password"), bcrypt.MinCost)
+	start := time.Now().Add(-time.Hour)
+	for i, u := range []data.User{
+		{ID: "admin", Email: "admin@example.com", Role: "admin", IsVerified: true},
+		{ID: "u1", Email: "alice@example.com", Role: "user", IsVerified: true},
+		{ID: "u2", Email: "bob@example.org", Role: "user"},
+	} {
+		u.PasswordHash = string(hash)
+		u.CreatedAt = start.Add(time.Duration(i) * time.Minute)
+		mem.CreateUser(ctx, &u)
+	}
+	mem.CreateIdentity(ctx, &data.Identity{ID: "i1", UserID: "u1", Provider: "google", ProviderID: "g-1"})
+
+	s := New(Opts{URL: "http://localhost:8080", UserStore: mem, IdentityStore: mem, SessionStore: mem,
+		Roles: []string{"user", "editor", "admin"}})
+	h, _ := s.Handlers()
+
+	do := func(method, path, body, bearer string) *httptest.ResponseRecorder {
+		return doJSON(t, h, method, path, []byte(body), nil, bearer)
+	}
+	login := func() (*httptest.ResponseRecorder, string) {
+		rec := do(http.MethodPost, "/login", `{"email":"alice@example.com","password":"password"}`, "")
+		var resp struct {
+			Token string `json:"token"`
+		}
+		json.NewDecoder(rec.Body).Decode(&resp)
+		return rec, resp.Token
+	}
+	admin, _ := s.Token(token.User{ID: "admin", Attributes: map[string]interface{}{"role": "admin"}})
+	_, alice := login()
+
+	if rec := do(http.MethodGet, "/admin/users", "", alice); rec.Code != http.StatusForbidden {
+		t.Errorf("non-admin: expected 403, got %d", rec.Code)
+	}
+
+	t.Run("List", func(t *testing.T) {
+		list := func(query string) userListResponse {
+			t.Helper()
+			rec := do(http.MethodGet, "/admin/users"+query, "", admin)
+			if rec.Code != http.StatusOK {
+				t.Fatalf("list %s: %d %s", query, rec.Code, rec.Body)
+			}
+			var resp userListResponse
+			json.NewDecoder(rec.Body).Decode(&resp)
+			return resp
+		}
+
+		if resp := list(""); resp.Total != 3 || len(resp.Users) != 3 || resp.Users[0].ID != "admin" || resp.Limit != defaultUserPageSize {
+			t.Errorf("all: got %+v", resp)
+		}
+		if resp := list("?limit=1&offset=1"); resp.Total != 3 || len(resp.Users) != 1 || resp.Users[0].ID != "u1" {
+			t.Errorf("page: got %+v", resp)
+		}
+		if resp := list("?email=example.com&role=user&verified=true"); resp.Total != 1 || resp.Users[0].ID != "u1" {
+			t.Errorf("filters: got %+v", resp)
+		}
+		after := start.Add(90 * time.Second).Format(time.RFC3339Nano)
+		if resp := list("?created_after=" + after); resp.Total != 1 || resp.Users[0].ID != "u2" {
+			t.Errorf("created_after: got %+v", resp)
+		}
+		if rec := do(http.MethodGet, "/admin/users?verified=maybe", "", admin); rec.Code != http.StatusBadRequest {
+			t.Errorf("bad filter: expected 400, got %d", rec.Code)
+		}
+	})
+
+	t.Run("Get", func(t *testing.T) {
+		rec := do(http.MethodGet, "/admin/users/u1", "", admin)
+		var resp userDetailResponse
+		json.NewDecoder(rec.Body).Decode(&resp)
+		if rec.Code != http.StatusOK || resp.User.ID != "u1" || len(resp.Identities) != 1 || len(resp.Sessions) != 1 {
+			t.Fatalf("get: %d %+v", rec.Code, resp)
+		}
+		if resp.Sessions[0].RefreshToken != "" {
+			t.Error("expected the refresh token hash to be left out")
+		}
+		if rec := do(http.MethodGet, "/admin/users/missing", "", admin); rec.Code != http.StatusNotFound {
+			t.Errorf("unknown user: expected 404, got %d", rec.Code)
+		}
+	})
+
+	t.Run("Role", func(t *testing.T) {
+		if rec := do(http.MethodPut, "/admin/users/u2/role", `{"role":"editor"}`, admin); rec.Code != http.StatusOK {
+			t.Fatalf("set role: %d %s", rec.Code, rec.Body)
+		}
+		if u, _ := mem.GetUserByID(ctx, "u2"); u.Role != "editor" {
+			t.Errorf("expected the new role, got %q", u.Role)
+		}
+		if rec := do(http.MethodPut, "/admin/users/u2/role", `{"role":"root"}`, admin); rec.Code != http.StatusBadRequest {
+			t.Errorf("unknown role: expected 400, got %d", rec.Code)
+		}
+		if rec := do(http.MethodPut, "/admin/users/admin/role", `{"role":"user"}`, admin); rec.Code != http.StatusBadRequest {
+			t.Errorf("changing your own role: expected 400, got %d", rec.Code)
+		}
+	})
+
+	t.Run("Block", func(t *testing.T) {
+		if rec := do(http.MethodPost, "/admin/users/admin/block", "", admin); rec.Code != http.StatusBadRequest {
+			t.Errorf("blocking yourself: expected 400, got %d", rec.Code)
+		}
+		if rec := do(http.MethodPost, "/admin/users/u1/block", `{"reason":"spam"}`, admin); rec.Code != http.StatusOK {
+			t.Fatalf("block: %d %s", rec.Code, rec.Body)
+		}
+		if u, _ := mem.GetUserByID(ctx, "u1"); u.BlockedReason != "spam" {
+			t.Errorf("expected the block reason to be kept, got %q", u.BlockedReason)
+		}
+		if rec := do(http.MethodGet, "/sessions", "", alice); rec.Code != http.StatusUnauthorized {
+			t.Errorf("blocking should revoke existing sessions, got %d", rec.Code)
+		}
+		if rec, _ := login(); rec.Code != http.StatusForbidden {
+			t.Errorf("blocked login: expected 403, got %d", rec.Code)
+		}
+
+		if rec := do(http.MethodDelete, "/admin/users/u1/block", "", admin); rec.Code != http.StatusOK {
+			t.Fatalf("unblock: %d %s", rec.Code, rec.Body)
+		}
+		var rec *httptest.ResponseRecorder
+		if rec, alice = login(); rec.Code != http.StatusOK {
+			t.Errorf("login after unblocking: expected 200, got %d", rec.Code)
+		}
+	})
+
+	t.Run("ForceLogout", func(t *testing.T) {
+		if rec := do(http.MethodPost, "/admin/users/u1/logout", "", admin); rec.Code != http.StatusNoContent {
+			t.Fatalf("force logout: %d %s", rec.Code, rec.Body)
+		}
+		if rec := do(http.MethodGet, "/sessions", "", alice); rec.Code != http.StatusUnauthorized {
+			t.Errorf("expected the session to be revoked, got %d", rec.Code)
+		}
+	})
+
+	t.Run("Delete", func(t *testing.T) {
+		if rec := do(http.MethodDelete, "/admin/users/admin", "", admin); rec.Code != http.StatusBadRequest {
+			t.Errorf("deleting yourself: expected 400, got %d", rec.Code)
+		}
+		if rec := do(http.MethodDelete, "/admin/users/u2", "", admin); rec.Code != http.StatusNoContent {
+			t.Fatalf("delete: %d %s", rec.Code, rec.Body)
+		}
+		if u, err := mem.GetUserByID(ctx, "u2"); err != nil || u.DeletedAt.IsZero() {
+			t.Errorf("expected a soft-deleted user, got %+v (%v)", u, err)
+		}
+		var resp userListResponse
+		json.NewDecoder(do(http.MethodGet, "/admin/users?deleted=false", "", admin).Body).Decode(&resp)
+		if resp.Total != 2 {
+			t.Errorf("expected the deleted user to be filtered out, got %+v", resp.Users)
+		}
+	})
+}
@@ -0,0 +1,208 @@
+package auth
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+
+	"auth-go-skd/data"
+	"auth-go-skd/token"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+)
+
+const (
+	// API keys look like ak_<prefix>_<secret>; the prefix is stored in clear for the lookup.
+	apiKeyMarker = "ak_"
+	apiKeyHeader = "X-API-Key"
+	// apiKeyTouchInterval limits how often the last-used time and IP of a key are written.
+	apiKeyTouchInterval = time.Minute
+)
+
+var errInvalidAPIKey = errors.New("invalid api key")
+
+type apiKeyRequest struct {
+	Name      string    `json:"name"`
+	Scopes    []string  `json:"scopes"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+type apiKeyResponse struct {
+	// Key is the plain key, returned only when it is created.
+	Key    string       `json:"key"`
+	APIKey *data.APIKey `json:"api_key"`
+}
+
+// requestAPIKey reads an API key from the X-API-Key header or a bearer token of API key form.
+func requestAPIKey(r *http.Request) string {
+	if key := r.Header.Get(apiKeyHeader); key != "" {
+		return key
+	}
+	if key, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer "); ok && strings.HasPrefix(key, apiKeyMarker) {
+		return key
+	}
+	return ""
+}
+
+// CreateAPIKey creates a key for userID and returns it with the plain key. Only a hash of the
+// key is stored, so hand it to the user now. A zero expiresAt creates a key that doesn't expire.
+// The scopes are not checked against Opts.APIKeyScopes.
+func (s *Service) CreateAPIKey(ctx context.Context, userID, name string, scopes []string, expiresAt time.Time) (*data.APIKey, string, error) {
+	prefix := make([]byte, 6)
+	secret := make([]byte, 32)
+	if _, err := rand.Read(prefix); err != nil {
+		return nil, "", err
+	}
+	if _, err := rand.Read(secret); err != nil {
+		return nil, "", err
+	}
+	key := &data.APIKey{
+		ID:        uuid.NewString(),
+		UserID:    userID,
+		Name:      name,
+		Prefix:    hex.EncodeToString(prefix),
+		Scopes:    scopes,
+		ExpiresAt: expiresAt,
+		CreatedAt: time.Now(),
+	}
+	plain := apiKeyMarker + key.Prefix + "_" + base64.RawURLEncoding.EncodeToString(secret)
+	key.KeyHash = hashToken(plain)
+
+	if err := s.opts.APIKeyStore.CreateAPIKey(ctx, key); err != nil {
+		return nil, "", err
+	}
+	return key, plain, nil
+}
+
+// lookupAPIKey returns the stored key for plain. Unknown, mistyped and expired keys yield
+// errInvalidAPIKey.
+func (s *Service) lookupAPIKey(ctx context.Context, plain string) (*data.APIKey, error) {
+	rest, _ := strings.CutPrefix(plain, apiKeyMarker)
+	prefix, _, ok := strings.Cut(rest, "_")
+	if !ok {
+		return nil, errInvalidAPIKey
+	}
+
+	key, err := s.opts.APIKeyStore.GetAPIKeyByPrefix(ctx, prefix)
+	if errors.Is(err, data.ErrAPIKeyNotFound) {
+		return nil, errInvalidAPIKey
+	}
+	if err != nil {
+		return nil, err
+	}
+	if subtle.ConstantTimeCompare([]byte(hashToken(plain)), []byte(key.KeyHash)) != 1 {
+		return nil, errInvalidAPIKey
+	}
+	if !key.ExpiresAt.IsZero() && time.Now().After(key.ExpiresAt) {
+		return nil, errInvalidAPIKey
+	}
+	return key, nil
+}
+
+// apiKeyClaims resolves an API key to claims for its user, like those of an access token,
+// and records its use. Invalid keys yield errInvalidAPIKey; keys of blocked or deleted
+// users the account error.
+func (s *Service) apiKeyClaims(r *http.Request, plain string) (*token.Claims, error) {
+	ctx := r.Context()
+	key, err := s.lookupAPIKey(ctx, plain)
+	if err != nil {
+		return nil, err
+	}
+	user, err := s.loadUser(ctx, key.UserID)
+	if errors.Is(err, data.ErrUserNotFound) {
+		return nil, errInvalidAPIKey
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	if ip := clientIP(r); now.Sub(key.LastUsedAt) >= apiKeyTouchInterval || ip != key.LastUsedIP {
+		if err := s.opts.APIKeyStore.TouchAPIKey(ctx, key.ID, now, ip); err != nil {
+			s.logger.Printf("api key %s: %v", key.ID, err)
+		}
+	}
+	return keyClaims(key, user), nil
+}
+
+// keyClaims are the claims an API key stands for.
+func keyClaims(key *data.APIKey, user token.User) *token.Claims {
+	claims := &token.Claims{
+		User:        &user,
+		SubjectType: token.SubjectAPIKey,
+		Scope:       strings.Join(key.Scopes, " "),
+		RegisteredClaims: jwt.RegisteredClaims{
+			ID:       key.ID,
+			Subject:  key.UserID,
+			IssuedAt: jwt.NewNumericDate(key.CreatedAt),
+		},
+	}
+	if !key.ExpiresAt.IsZero() {
+		claims.ExpiresAt = jwt.NewNumericDate(key.ExpiresAt)
+	}
+	return claims
+}
+
+func (s *Service) listAPIKeysHandler(w http.ResponseWriter, r *http.Request) {
+	keys, err := s.opts.APIKeyStore.ListAPIKeysByUser(r.Context(), User(r).ID)
+	if err != nil {
+		http.Error(w, "failed to list api keys", http.StatusInternalServerError)
+		return
+	}
+	if keys == nil {
+		keys = []data.APIKey{}
+	}
+	json.NewEncoder(w).Encode(keys)
+}
+
+// createAPIKeyHandler creates a key for the calling user. The plain key is in the response
+// and can't be retrieved later.
+func (s *Service) createAPIKeyHandler(w http.ResponseWriter, r *http.Request) {
+	var req apiKeyRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Name == "" {
+		http.Error(w, "invalid request body", http.StatusBadRequest)
+		return
+	}
+	if !req.ExpiresAt.IsZero() && req.ExpiresAt.Before(time.Now()) {
+		http.Error(w, "expires_at is in the past", http.StatusBadRequest)
+		return
+	}
+	for _, scope := range req.Scopes {
+		if !slices.Contains(s.opts.APIKeyScopes, scope) {
+			http.Error(w, "scope "+scope+" is not allowed for api keys", http.StatusBadRequest)
+			return
+		}
+	}
+
+	key, plain, err := s.CreateAPIKey(r.Context(), User(r).ID, req.Name, req.Scopes, req.ExpiresAt)
+	if err != nil {
+		s.logger.Printf("create api key: %v", err)
+		http.Error(w, "failed to create api key", http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(apiKeyResponse{Key: plain, APIKey: key})
+}
+
+func (s *Service) revokeAPIKeyHandler(w http.ResponseWriter, r *http.Request) {
+	err := s.opts.APIKeyStore.DeleteAPIKey(r.Context(), User(r).ID, chi.URLParam(r, "id"))
+	if errors.Is(err, data.ErrAPIKeyNotFound) {
+		http.Error(w, "api key not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, "failed to revoke api key", http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
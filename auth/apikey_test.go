@@ -0,0 +1,138 @@
+package auth
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"auth-go-skd/data"
+	"auth-go-skd/store/memory"
+	"auth-go-skd/token"
+)
+
+func TestAPIKeys(t *testing.T) {
+	ctx := context.Background()
+	mem := memory.New()
+	mem.CreateUser(ctx, &data.User{ID: "u1", Email: "alice@example.com", Name: "Alice", Role: "user"})
+	mem.CreateUser(ctx, &data.User{ID: "u2", Email: "bob@example.com", Role: "user"})
+
+	s := New(Opts{URL: "http://localhost:8080", UserStore: mem, APIKeyStore: mem, APIKeyScopes: []string{"repo:read"}})
+	h, _ := s.Handlers()
+	alice, _ := s.Token(token.User{ID: "u1"})
+
+	do := func(method, path, body string, header http.Header) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, jsonBody(body))
+		for k, v := range header {
+			req.Header[k] = v
+		}
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+		return rec
+	}
+	bearer := func(tok string) http.Header { return http.Header{"Authorization": {"Bearer " + tok}} }
+
+	var created apiKeyResponse
+	rec := do(http.MethodPost, "/api-keys", `{"name":"ci","scopes":["repo:read"]}`, bearer(alice))
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("create: %d %s", rec.Code, rec.Body)
+	}
+	json.NewDecoder(rec.Body).Decode(&created)
+	if !strings.HasPrefix(created.Key, apiKeyMarker+created.APIKey.Prefix+"_") || created.APIKey.UserID != "u1" {
+		t.Fatalf("unexpected key: %+v", created)
+	}
+	if stored, _ := mem.GetAPIKeyByPrefix(ctx, created.APIKey.Prefix); stored.KeyHash == created.Key {
+		t.Fatal("expected only a hash of the key to be stored")
+	}
+	if rec := do(http.MethodPost, "/api-keys", `{"name":"old","expires_at":"2001-01-01T00:00:00Z"}`, bearer(alice)); rec.Code != http.StatusBadRequest {
+		t.Errorf("expired key: expected 400, got %d", rec.Code)
+	}
+	if rec := do(http.MethodPost, "/api-keys", `{"name":"admin","scopes":["reports:write"]}`, bearer(alice)); rec.Code != http.StatusBadRequest {
+		t.Errorf("scope outside Opts.APIKeyScopes: expected 400, got %d", rec.Code)
+	}
+
+	t.Run("Middleware", func(t *testing.T) {
+		var got token.Claims
+		protected := s.Middleware().Auth(s.Middleware().RequireScope("repo:read")(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			got, _ = token.GetClaims(r)
+			if User(r).Name != "Alice" {
+				t.Errorf("expected the key's user in the context, got %+v", User(r))
+			}
+		})))
+		call := func(header http.Header) int {
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			req.RemoteAddr = "10.0.0.7:1234"
+			for k, v := range header {
+				req.Header[k] = v
+			}
+			rec := httptest.NewRecorder()
+			protected.ServeHTTP(rec, req)
+			return rec.Code
+		}
+
+		if code := call(http.Header{"X-Api-Key": {created.Key}}); code != http.StatusOK {
+			t.Fatalf("X-API-Key: expected 200, got %d", code)
+		}
+		if got.SubjectType != token.SubjectAPIKey || got.ID != created.APIKey.ID {
+			t.Errorf("unexpected claims: %+v", got)
+		}
+		if code := call(bearer(created.Key)); code != http.StatusOK {
+			t.Errorf("bearer: expected 200, got %d", code)
+		}
+		if code := call(http.Header{"X-Api-Key": {created.Key + "x"}}); code != http.StatusUnauthorized {
+			t.Errorf("wrong key: expected 401, got %d", code)
+		}
+		if stored, _ := mem.GetAPIKeyByPrefix(ctx, created.APIKey.Prefix); stored.LastUsedIP != "10.0.0.7" || stored.LastUsedAt.IsZero() {
+			t.Errorf("expected the last use to be tracked, got %+v", stored)
+		}
+
+		if rec := do(http.MethodGet, "/api-keys", "", http.Header{"X-Api-Key": {created.Key}}); rec.Code != http.StatusForbidden {
+			t.Errorf("managing keys with a key: expected 403, got %d", rec.Code)
+		}
+
+		mem.UpdateUser(ctx, &data.User{ID: "u1", Email: "alice@example.com", Name: "Alice", Role: "admin"})
+		admin := s.Middleware().Auth(s.Middleware().RequireRole("admin")(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})))
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.Header.Set("X-Api-Key", created.Key)
+		rec := httptest.NewRecorder()
+		admin.ServeHTTP(rec, req)
+		if rec.Code != http.StatusForbidden {
+			t.Errorf("scoped key on an admin route: expected 403, got %d", rec.Code)
+		}
+		unscoped, plain, _ := s.CreateAPIKey(ctx, "u1", "unscoped", nil, time.Time{})
+		req.Header.Set("X-Api-Key", plain)
+		rec = httptest.NewRecorder()
+		admin.ServeHTTP(rec, req)
+		if rec.Code != http.StatusForbidden {
+			t.Errorf("unscoped key on an admin route: expected 403, got %d", rec.Code)
+		}
+		mem.DeleteAPIKey(ctx, "u1", unscoped.ID)
+
+		_, expired, _ := s.CreateAPIKey(ctx, "u1", "short", []string{"repo:read"}, time.Now().Add(-time.Second))
+		if code := call(http.Header{"X-Api-Key": {expired}}); code != http.StatusUnauthorized {
+			t.Errorf("expired key: expected 401, got %d", code)
+		}
+	})
+
+	t.Run("ListAndRevoke", func(t *testing.T) {
+		var keys []data.APIKey
+		json.NewDecoder(do(http.MethodGet, "/api-keys", "", bearer(alice)).Body).Decode(&keys)
+		if len(keys) != 2 || keys[0].ID != created.APIKey.ID {
+			t.Fatalf("list: got %+v", keys)
+		}
+
+		bob, _ := s.Token(token.User{ID: "u2"})
+		if rec := do(http.MethodDelete, "/api-keys/"+created.APIKey.ID, "", bearer(bob)); rec.Code != http.StatusNotFound {
+			t.Errorf("revoking someone else's key: expected 404, got %d", rec.Code)
+		}
+		if rec := do(http.MethodDelete, "/api-keys/"+created.APIKey.ID, "", bearer(alice)); rec.Code != http.StatusNoContent {
+			t.Fatalf("revoke: %d %s", rec.Code, rec.Body)
+		}
+		if _, err := s.apiKeyClaims(httptest.NewRequest(http.MethodGet, "/", nil), created.Key); err != errInvalidAPIKey {
+			t.Errorf("revoked key: expected errInvalidAPIKey, got %v", err)
+		}
+	})
+}
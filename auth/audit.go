@@ -0,0 +1,70 @@
+package auth
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"time"
+
+	"auth-go-skd/audit"
+
+	"github.com/google/uuid"
+)
+
+const (
+	defaultAuditLimit = 50
+	maxAuditLimit     = 500
+)
+
+// audit records e with the request's client IP and user agent. Sink errors are logged,
+// never returned, so a failing sink doesn't block logins.
+func (s *Service) audit(r *http.Request, e audit.Event) {
+	if s.opts.AuditSink == nil {
+		return
+	}
+	e.ID = uuid.NewString()
+	e.Time = time.Now()
+	e.IP = clientIP(r)
+	e.UserAgent = r.UserAgent()
+	if e.Outcome == "" {
+		e.Outcome = audit.Success
+	}
+	if err := s.opts.AuditSink.RecordEvent(r.Context(), e); err != nil {
+		s.logger.Printf("audit: %v", err)
+	}
+}
+
+// auditFailure records a failed attempt of type t.
+func (s *Service) auditFailure(r *http.Request, t audit.Type, provider, userID, reason string) {
+	s.audit(r, audit.Event{Type: t, Provider: provider, UserID: userID, Outcome: audit.Failure, Reason: reason})
+}
+
+// auditEventsHandler returns the most recent events of the user in ?user_id=, newest first.
+func (s *Service) auditEventsHandler(w http.ResponseWriter, r *http.Request) {
+	userID := r.URL.Query().Get("user_id")
+	if userID == "" {
+		http.Error(w, "user_id is required", http.StatusBadRequest)
+		return
+	}
+
+	limit := defaultAuditLimit
+	if v := r.URL.Query().Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 {
+			http.Error(w, "invalid limit", http.StatusBadRequest)
+			return
+		}
+		limit = min(n, maxAuditLimit)
+	}
+
+	events, err := s.opts.AuditSink.(audit.Querier).RecentEvents(r.Context(), userID, limit)
+	if err != nil {
+		s.logger.Printf("audit query: %v", err)
+		http.Error(w, "failed to load events", http.StatusInternalServerError)
+		return
+	}
+	if events == nil {
+		events = []audit.Event{}
+	}
+	json.NewEncoder(w).Encode(events)
+}
@@ -0,0 +1,107 @@
+package auth
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+
+	"auth-go-skd/audit"
+	"auth-go-skd/data"
+	"auth-go-skd/store/memory"
+	"auth-go-skd/token"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+func TestAudit_LoginEvents(t *testing.T) {
+	users := memory.New()
+	hash, _ := bcrypt.GenerateFromPassword([]byte("password"), bcrypt.MinCost)
+	users.CreateUser(context.Background(), &data.User{ID: "u1", Email: "a@example.com", PasswordHash: string(hash), Role: "user"})
+
+	sink, err := audit.NewFile(filepath.Join(t.TempDir(), "audit.jsonl"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sink.Close()
+
+	s := New(Opts{URL: "http://localhost:8080", UserStore: users, AuditSink: sink, LockoutStore: noLockouts{}})
+	h, _ := s.Handlers()
+
+	login := func(password string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/login", jsonBody(`{"email":"a@example.com","password":"`+password+`"}`))
+		req.Header.Set("User-Agent", "curl/8.0")
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+		return rec
+	}
+	login("wrong")
+	var resp struct {
+		Token string `json:"token"`
+	}
+	json.NewDecoder(login("password").Body).Decode(&resp)
+
+	req := httptest.NewRequest(http.MethodPost, "/logout", nil)
+	req.Header.Set("Authorization", "Bearer "+resp.Token)
+	h.ServeHTTP(httptest.NewRecorder(), req)
+
+	query := func(bearer string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/admin/audit?user_id=u1", nil)
+		req.Header.Set("Authorization", "Bearer "+bearer)
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+		return rec
+	}
+
+	user, _ := s.Token(token.User{ID: "u1", Attributes: map[string]interface{}{"role": "user"}})
+	if code := query(user).Code; code != http.StatusForbidden {
+		t.Errorf("expected 403 for non-admin, got %d", code)
+	}
+
+	admin, _ := s.Token(token.User{ID: "admin", Attributes: map[string]interface{}{"role": "admin"}})
+	rec := query(admin)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("audit query: %d %s", rec.Code, rec.Body)
+	}
+	var events []audit.Event
+	json.NewDecoder(rec.Body).Decode(&events)
+
+	want := []struct {
+		typ     audit.Type
+		outcome audit.Outcome
+		reason  string
+	}{
+		{audit.Logout, audit.Success, ""},
+		{audit.Login, audit.Success, ""},
+		{audit.Login, audit.Failure, "invalid_credentials"},
+	}
+	if len(events) != len(want) {
+		t.Fatalf("expected %d events, got %+v", len(want), events)
+	}
+	for i, w := range want {
+		e := events[i]
+		if e.Type != w.typ || e.Outcome != w.outcome || e.Reason != w.reason {
+			t.Errorf("event %d: expected %s/%s/%q, got %+v", i, w.typ, w.outcome, w.reason, e)
+		}
+	}
+	if e := events[1]; e.Provider != "password" || e.IP != "192.0.2.1" || e.UserAgent != "curl/8.0" {
+		t.Errorf("login event is missing request details: %+v", e)
+	}
+}
+
+func TestAudit_QueryRequiresQuerier(t *testing.T) {
+	sink := audit.Func(func(context.Context, audit.Event) error { return nil })
+	s := New(Opts{URL: "http://localhost:8080", AuditSink: sink})
+	h, _ := s.Handlers()
+
+	admin, _ := s.Token(token.User{ID: "admin", Attributes: map[string]interface{}{"role": "admin"}})
+	req := httptest.NewRequest(http.MethodGet, "/admin/audit?user_id=u1", nil)
+	req.Header.Set("Authorization", "Bearer "+admin)
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	if rec.Code != http.StatusNotFound && rec.Code != http.StatusMethodNotAllowed {
+		t.Errorf("expected no audit route for a write-only sink, got %d", rec.Code)
+	}
+}
@@ -0,0 +1,51 @@
+package auth
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"auth-go-skd/token"
+)
+
+var (
+	tenantClaim = token.NewKey[string]("tenant_id")
+	rolesClaim  = token.NewKey[map[string]string]("org_roles")
+)
+
+func TestToken_CustomClaims(t *testing.T) {
+	s := New(Opts{URL: "http://localhost:8080"})
+
+	tok, err := s.Token(token.User{ID: "u1"}, tenantClaim.With("acme"), rolesClaim.With(map[string]string{"acme": "owner"}))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var tenant string
+	var roles map[string]string
+	h := s.Middleware().Auth(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		tenant, _ = tenantClaim.FromRequest(r)
+		roles, _ = rolesClaim.FromRequest(r)
+	}))
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set("Authorization", "Bearer "+tok)
+	h.ServeHTTP(httptest.NewRecorder(), req)
+
+	if tenant != "acme" || roles["acme"] != "owner" {
+		t.Errorf("expected custom claims in middleware, got %q %v", tenant, roles)
+	}
+}
+
+func TestToken_SizeLimit(t *testing.T) {
+	s := New(Opts{URL: "http://localhost:8080", MaxTokenSize: 1000})
+
+	if _, err := s.Token(token.User{ID: "u1"}, tenantClaim.With("acme")); err != nil {
+		t.Fatalf("small token: %v", err)
+	}
+	_, err := s.Token(token.User{ID: "u1"}, tenantClaim.With(strings.Repeat("x", 1000)))
+	if !errors.Is(err, token.ErrTokenTooLarge) {
+		t.Errorf("expected ErrTokenTooLarge, got %v", err)
+	}
+}
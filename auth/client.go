@@ -0,0 +1,197 @@
+package auth
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"time"
+
+	"auth-go-skd/data"
+	"auth-go-skd/token"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+)
+
+const (
+	grantClientCredentials = "client_credentials"
+	grantAuthorizationCode = "authorization_code"
+)
+
+type tokenResponse struct {
+	AccessToken string `json:"access_token"`
+	TokenType   string `json:"token_type"`
+	ExpiresIn   int    `json:"expires_in"`
+	Scope       string `json:"scope,omitempty"`
+	IDToken     string `json:"id_token,omitempty"`
+}
+
+// oauthError is the error body of the OAuth2 token endpoint (RFC 6749, section 5.2).
+type oauthError struct {
+	Error       string `json:"error"`
+	Description string `json:"error_description,omitempty"`
+}
+
+func writeOAuthError(w http.ResponseWriter, status int, code, description string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	if status == http.StatusUnauthorized {
+		w.Header().Set("WWW-Authenticate", `Basic realm="token"`)
+	}
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(oauthError{Error: code, Description: description})
+}
+
+// CreateClient registers a machine client allowed the given scopes and returns it with its
+// secret. Only a hash of the secret is stored, so hand it to the client now.
+func (s *Service) CreateClient(ctx context.Context, name string, scopes ...string) (*data.Client, string, error) {
+	return s.createClient(ctx, &data.Client{Name: name, Scopes: scopes}, true)
+}
+
+// createClient stores client under a new ID, with a fresh secret unless it is a public client.
+func (s *Service) createClient(ctx context.Context, client *data.Client, confidential bool) (*data.Client, string, error) {
+	var secret string
+	if confidential {
+		b := make([]byte, 32)
+		if _, err := rand.Read(b); err != nil {
+			return nil, "", err
+		}
+		secret = base64.RawURLEncoding.EncodeToString(b)
+		client.SecretHash = hashToken(secret)
+	}
+	client.ID = uuid.NewString()
+	client.CreatedAt = time.Now()
+	if err := s.opts.ClientStore.CreateClient(ctx, client); err != nil {
+		return nil, "", err
+	}
+	return client, secret, nil
+}
+
+// clientCredentials reads the client ID and secret from HTTP Basic auth or, failing that,
+// from the form body.
+func clientCredentials(r *http.Request) (id, secret string) {
+	if id, secret, ok := r.BasicAuth(); ok {
+		// RFC 6749 form-encodes both before they go into the header.
+		if v, err := url.QueryUnescape(id); err == nil {
+			id = v
+		}
+		if v, err := url.QueryUnescape(secret); err == nil {
+			secret = v
+		}
+		return id, secret
+	}
+	return r.PostForm.Get("client_id"), r.PostForm.Get("client_secret")
+}
+
+// authenticateClient returns the client whose credentials are on r, or nil when they don't match.
+// Public clients have no secret and are identified by their ID alone.
+func (s *Service) authenticateClient(r *http.Request) (*data.Client, error) {
+	id, secret := clientCredentials(r)
+	if id == "" {
+		return nil, nil
+	}
+	client, err := s.opts.ClientStore.GetClient(r.Context(), id)
+	if errors.Is(err, data.ErrClientNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if client.SecretHash == "" {
+		if secret != "" {
+			return nil, nil
+		}
+		return client, nil
+	}
+	if subtle.ConstantTimeCompare([]byte(hashToken(secret)), []byte(client.SecretHash)) != 1 {
+		return nil, nil
+	}
+	return client, nil
+}
+
+// tokenHandler is the OAuth2 token endpoint. It serves the client_credentials grant and, with
+// OpenID Connect enabled, the authorization_code grant.
+func (s *Service) tokenHandler(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		writeOAuthError(w, http.StatusBadRequest, "invalid_request", "invalid form body")
+		return
+	}
+	grant := r.PostForm.Get("grant_type")
+	if grant != grantClientCredentials && (grant != grantAuthorizationCode || !s.oidcEnabled()) {
+		writeOAuthError(w, http.StatusBadRequest, "unsupported_grant_type", "grant type "+grant+" is not supported")
+		return
+	}
+
+	client, err := s.authenticateClient(r)
+	if err != nil {
+		s.logger.Printf("client token: %v", err)
+		writeOAuthError(w, http.StatusInternalServerError, "server_error", "")
+		return
+	}
+	if client == nil {
+		writeOAuthError(w, http.StatusUnauthorized, "invalid_client", "unknown client or wrong secret")
+		return
+	}
+
+	if grant == grantAuthorizationCode {
+		s.authorizationCodeGrant(w, r, client)
+		return
+	}
+	s.clientCredentialsGrant(w, r, client)
+}
+
+// clientCredentialsGrant implements the OAuth2 client_credentials grant (RFC 6749, section 4.4).
+// Without a scope parameter the token gets every scope of the client.
+func (s *Service) clientCredentialsGrant(w http.ResponseWriter, r *http.Request, client *data.Client) {
+	if client.SecretHash == "" {
+		writeOAuthError(w, http.StatusBadRequest, "unauthorized_client", "public clients can't use client_credentials")
+		return
+	}
+
+	scopes := client.Scopes
+	if requested := strings.Fields(r.PostForm.Get("scope")); len(requested) > 0 {
+		for _, scope := range requested {
+			if !slices.Contains(client.Scopes, scope) {
+				writeOAuthError(w, http.StatusBadRequest, "invalid_scope", "scope "+scope+" is not allowed for this client")
+				return
+			}
+		}
+		scopes = requested
+	}
+
+	now := time.Now()
+	claims := token.Claims{
+		SubjectType: token.SubjectClient,
+		Scope:       strings.Join(scopes, " "),
+		RegisteredClaims: jwt.RegisteredClaims{
+			ID:        uuid.NewString(),
+			Subject:   client.ID,
+			Issuer:    s.opts.Issuer,
+			ExpiresAt: jwt.NewNumericDate(now.Add(s.opts.ClientTokenDuration)),
+			IssuedAt:  jwt.NewNumericDate(now),
+			Audience:  jwt.ClaimStrings{s.opts.URL},
+		},
+	}
+	signed, err := s.sign(r, claims, client.ID)
+	if err != nil {
+		s.logger.Printf("client token: %v", err)
+		writeOAuthError(w, http.StatusInternalServerError, "server_error", "")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	json.NewEncoder(w).Encode(tokenResponse{
+		AccessToken: signed,
+		TokenType:   "Bearer",
+		ExpiresIn:   int(s.opts.ClientTokenDuration.Seconds()),
+		Scope:       claims.Scope,
+	})
+}
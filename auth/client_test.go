@@ -0,0 +1,119 @@
+package auth
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"auth-go-skd/store/memory"
+	"auth-go-skd/token"
+)
+
+func TestClientCredentials(t *testing.T) {
+	mem := memory.New()
+	s := New(Opts{URL: "http://localhost:8080", ClientStore: mem})
+	h, _ := s.Handlers()
+	client, secret, err := s.CreateClient(context.Background(), "worker", "reports:read", "reports:write")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stored, _ := mem.GetClient(context.Background(), client.ID); stored.SecretHash == secret {
+		t.Fatal("expected only a hash of the secret to be stored")
+	}
+
+	tokenRequest := func(form url.Values, basic bool) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/token", strings.NewReader(form.Encode()))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		if basic {
+			req.SetBasicAuth(client.ID, secret)
+		}
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+		return rec
+	}
+	issue := func(t *testing.T, form url.Values, basic bool) tokenResponse {
+		t.Helper()
+		rec := tokenRequest(form, basic)
+		if rec.Code != http.StatusOK {
+			t.Fatalf("token: %d %s", rec.Code, rec.Body)
+		}
+		var resp tokenResponse
+		json.NewDecoder(rec.Body).Decode(&resp)
+		return resp
+	}
+
+	t.Run("Grant", func(t *testing.T) {
+		resp := issue(t, url.Values{"grant_type": {"client_credentials"}}, true)
+		if resp.TokenType != "Bearer" || resp.ExpiresIn != 3600 || resp.Scope != "reports:read reports:write" {
+			t.Errorf("unexpected response: %+v", resp)
+		}
+		claims, err := s.ParseToken(resp.AccessToken)
+		if err != nil || claims.SubjectType != token.SubjectClient || claims.Subject != client.ID || claims.User != nil {
+			t.Fatalf("unexpected claims: %+v (%v)", claims, err)
+		}
+
+		resp = issue(t, url.Values{"grant_type": {"client_credentials"}, "client_id": {client.ID}, "client_secret": {secret}, "scope": {"reports:read"}}, false)
+		if resp.Scope != "reports:read" {
+			t.Errorf("expected the requested scope only, got %q", resp.Scope)
+		}
+	})
+
+	t.Run("Errors", func(t *testing.T) {
+		for name, tc := range map[string]struct {
+			form  url.Values
+			basic bool
+			code  int
+			err   string
+		}{
+			"grant":  {url.Values{"grant_type": {"password"}}, true, http.StatusBadRequest, "unsupported_grant_type"},
+			"secret": {url.Values{"grant_type": {"client_credentials"}, "client_id": {client.ID}, "client_secret": {"wrong"}}, false, http.StatusUnauthorized, "invalid_client"},
+			"none":   {url.Values{"grant_type": {"client_credentials"}}, false, http.StatusUnauthorized, "invalid_client"},
+			"scope":  {url.Values{"grant_type": {"client_credentials"}, "scope": {"admin"}}, true, http.StatusBadRequest, "invalid_scope"},
+		} {
+			rec := tokenRequest(tc.form, tc.basic)
+			var body oauthError
+			json.NewDecoder(rec.Body).Decode(&body)
+			if rec.Code != tc.code || body.Error != tc.err {
+				t.Errorf("%s: expected %d %s, got %d %+v", name, tc.code, tc.err, rec.Code, body)
+			}
+		}
+	})
+
+	t.Run("Middleware", func(t *testing.T) {
+		ok := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
+		m := s.Middleware()
+		do := func(h http.Handler, bearer string) int {
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			req.Header.Set("Authorization", "Bearer "+bearer)
+			rec := httptest.NewRecorder()
+			h.ServeHTTP(rec, req)
+			return rec.Code
+		}
+		read := issue(t, url.Values{"grant_type": {"client_credentials"}, "scope": {"reports:read"}}, true).AccessToken
+		user, _ := s.Token(token.User{ID: "u1"})
+
+		if code := do(m.Auth(m.RequireScope("reports:read")(ok)), read); code != http.StatusOK {
+			t.Errorf("client with scope: expected 200, got %d", code)
+		}
+		if code := do(m.Auth(m.RequireScope("reports:write")(ok)), read); code != http.StatusForbidden {
+			t.Errorf("client without scope: expected 403, got %d", code)
+		}
+		if code := do(m.Auth(m.RequireScope("reports:read")(ok)), user); code != http.StatusForbidden {
+			t.Errorf("user token: expected 403, got %d", code)
+		}
+		if code := do(m.UserAuth(ok), read); code != http.StatusForbidden {
+			t.Errorf("UserAuth: expected client tokens to be refused, got %d", code)
+		}
+		req := httptest.NewRequest(http.MethodGet, "/account/export", nil)
+		req.Header.Set("Authorization", "Bearer "+read)
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+		if rec.Code != http.StatusForbidden {
+			t.Errorf("user routes: expected client tokens to be refused, got %d", rec.Code)
+		}
+	})
+}
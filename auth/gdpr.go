@@ -0,0 +1,204 @@
+package auth
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"auth-go-skd/audit"
+	"auth-go-skd/data"
+)
+
+// exportAuditLimit caps the audit events in an export, newest first.
+const exportAuditLimit = 10000
+
+// UserExport is everything the configured stores keep about a user, as returned by
+// Service.ExportUserData. Refresh token hashes, passkey public keys and API key hashes
+// are left out.
+type UserExport struct {
+	ExportedAt  time.Time         `json:"exported_at"`
+	User        *data.User        `json:"user,omitempty"`
+	Identities  []data.Identity   `json:"identities,omitempty"`
+	Sessions    []data.Session    `json:"sessions,omitempty"`
+	Credentials []data.Credential `json:"credentials,omitempty"`
+	Memberships []data.Membership `json:"memberships,omitempty"`
+	APIKeys     []data.APIKey     `json:"api_keys,omitempty"`
+	AuditEvents []audit.Event     `json:"audit_events,omitempty"`
+	Avatar      []byte            `json:"avatar,omitempty"`
+}
+
+// ExportUserData collects the user's account, identities, sessions, passkeys, memberships,
+// API keys, audit events (when the sink is an audit.Querier) and avatar. Users unknown to
+// UserStore, such as OAuth logins that aren't persisted, get an export without the account.
+func (s *Service) ExportUserData(ctx context.Context, userID string) (*UserExport, error) {
+	export := &UserExport{ExportedAt: time.Now()}
+	var err error
+
+	if s.opts.UserStore != nil {
+		export.User, err = s.opts.UserStore.GetUserByID(ctx, userID)
+		if err != nil && !errors.Is(err, data.ErrUserNotFound) {
+			return nil, fmt.Errorf("user: %w", err)
+		}
+	}
+	if s.opts.IdentityStore != nil {
+		if export.Identities, err = s.opts.IdentityStore.ListIdentitiesByUser(ctx, userID); err != nil {
+			return nil, fmt.Errorf("identities: %w", err)
+		}
+	}
+	if s.opts.SessionStore != nil {
+		if export.Sessions, err = s.opts.SessionStore.ListSessionsByUser(ctx, userID); err != nil {
+			return nil, fmt.Errorf("sessions: %w", err)
+		}
+		for i := range export.Sessions {
+			export.Sessions[i].RefreshToken = ""
+		}
+	}
+	if s.opts.CredentialStore != nil {
+		if export.Credentials, err = s.opts.CredentialStore.GetCredentialsByUser(ctx, userID); err != nil {
+			return nil, fmt.Errorf("credentials: %w", err)
+		}
+	}
+	if s.opts.MembershipStore != nil {
+		if export.Memberships, err = s.opts.MembershipStore.ListMembershipsByUser(ctx, userID); err != nil {
+			return nil, fmt.Errorf("memberships: %w", err)
+		}
+	}
+	if s.opts.APIKeyStore != nil {
+		if export.APIKeys, err = s.opts.APIKeyStore.ListAPIKeysByUser(ctx, userID); err != nil {
+			return nil, fmt.Errorf("api keys: %w", err)
+		}
+	}
+	if q, ok := s.opts.AuditSink.(audit.Querier); ok {
+		if export.AuditEvents, err = q.RecentEvents(ctx, userID, exportAuditLimit); err != nil {
+			return nil, fmt.Errorf("audit events: %w", err)
+		}
+	}
+	if export.Avatar, err = s.readAvatar(userID); err != nil {
+		return nil, fmt.Errorf("avatar: %w", err)
+	}
+	return export, nil
+}
+
+// readAvatar returns the user's avatar image, or nil when there is none.
+func (s *Service) readAvatar(userID string) ([]byte, error) {
+	name, err := s.opts.AvatarStore.Find(userID)
+	if err != nil || name == "" {
+		return nil, err
+	}
+	r, _, err := s.opts.AvatarStore.Get(name)
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+	return io.ReadAll(r)
+}
+
+// EraseUser removes the user from every configured store: their sessions and access tokens are
+// revoked, the account is deleted with its identities, memberships and API keys, and their passkeys, avatar and
+// lockout counters are removed. Audit events are anonymised when the sink is an audit.Eraser,
+// so the log keeps its counts. Pending invitations to the user's email are left to expire.
+// Erasing a user that is already gone succeeds.
+func (s *Service) EraseUser(ctx context.Context, userID string) error {
+	if err := s.logoutUser(ctx, userID); err != nil {
+		return fmt.Errorf("sessions: %w", err)
+	}
+	// Tokens issued without a session, such as those of Service.Token, are refused by user.
+	if err := s.opts.RevocationStore.Revoke(ctx, userRevocationID(userID), s.opts.TokenDuration); err != nil {
+		return fmt.Errorf("tokens: %w", err)
+	}
+	if s.opts.CredentialStore != nil {
+		if err := s.opts.CredentialStore.DeleteCredentialsByUser(ctx, userID); err != nil {
+			return fmt.Errorf("credentials: %w", err)
+		}
+	}
+	if name, err := s.opts.AvatarStore.Find(userID); err != nil {
+		return fmt.Errorf("avatar: %w", err)
+	} else if name != "" {
+		if err := s.opts.AvatarStore.Remove(name); err != nil {
+			return fmt.Errorf("avatar: %w", err)
+		}
+	}
+	if e, ok := s.opts.AuditSink.(audit.Eraser); ok {
+		if err := e.EraseUserEvents(ctx, userID); err != nil {
+			return fmt.Errorf("audit events: %w", err)
+		}
+	}
+
+	if s.opts.UserStore == nil {
+		return nil
+	}
+	u, err := s.opts.UserStore.GetUserByID(ctx, userID)
+	if errors.Is(err, data.ErrUserNotFound) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("user: %w", err)
+	}
+	if err := s.opts.LockoutStore.ResetFailures(ctx, "acct:"+u.Email); err != nil {
+		return fmt.Errorf("lockout: %w", err)
+	}
+	if err := s.opts.UserStore.DeleteUser(ctx, userID); err != nil && !errors.Is(err, data.ErrUserNotFound) {
+		return fmt.Errorf("user: %w", err)
+	}
+	return nil
+}
+
+// writeExport sends the export as a JSON file download.
+func (s *Service) writeExport(w http.ResponseWriter, r *http.Request, userID string) {
+	export, err := s.ExportUserData(r.Context(), userID)
+	if err != nil {
+		s.logger.Printf("export %s: %v", userID, err)
+		http.Error(w, "failed to export user data", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Content-Disposition", `attachment; filename="user-data.json"`)
+	json.NewEncoder(w).Encode(export)
+}
+
+// exportAccountHandler lets users download their own data.
+func (s *Service) exportAccountHandler(w http.ResponseWriter, r *http.Request) {
+	s.writeExport(w, r, User(r).ID)
+}
+
+// eraseAccountHandler erases the calling user and clears their JWT cookie.
+func (s *Service) eraseAccountHandler(w http.ResponseWriter, r *http.Request) {
+	id := User(r).ID
+	if err := s.EraseUser(r.Context(), id); err != nil {
+		s.logger.Printf("erase %s: %v", id, err)
+		http.Error(w, "failed to erase account", http.StatusInternalServerError)
+		return
+	}
+	clearJWTCookie(w)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// exportUserHandler returns the data of the user named in the URL.
+func (s *Service) exportUserHandler(w http.ResponseWriter, r *http.Request) {
+	if u, ok := s.adminUser(w, r); ok {
+		s.writeExport(w, r, u.ID)
+	}
+}
+
+// eraseUserHandler erases the user named in the URL. Unlike DELETE /admin/users/{id}, nothing
+// is kept for a retention window.
+func (s *Service) eraseUserHandler(w http.ResponseWriter, r *http.Request) {
+	u, ok := s.adminUser(w, r)
+	if !ok {
+		return
+	}
+	if u.ID == User(r).ID {
+		http.Error(w, "erase your own account at /account/erase", http.StatusBadRequest)
+		return
+	}
+	if err := s.EraseUser(r.Context(), u.ID); err != nil {
+		s.logger.Printf("erase %s: %v", u.ID, err)
+		http.Error(w, "failed to erase user", http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
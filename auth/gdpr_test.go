@@ -0,0 +1,125 @@
+package auth
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"auth-go-skd/audit"
+	"auth-go-skd/avatar"
+	"auth-go-skd/data"
+	"auth-go-skd/store/memory"
+	"auth-go-skd/token"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+func TestUserDataExportAndErase(t *testing.T) {
+	ctx := context.Background()
+	mem := memory.New()
+	hash, _ := bcrypt.GenerateFromPassword([]byte("password"), bcrypt.MinCost)
+	for _, u := range []data.User{
+		{ID: "u1", Email: "alice@example.com", PasswordHash: string(hash), Role: "user"},
+		{ID: "u2", Email: "bob@example.com", PasswordHash: string(hash), Role: "user"},
+	} {
+		mem.CreateUser(ctx, &u)
+		mem.CreateIdentity(ctx, &data.Identity{ID: "i-" + u.ID, UserID: u.ID, Provider: "google", ProviderID: "g-" + u.ID})
+		mem.CreateCredential(ctx, &data.Credential{ID: []byte("c-" + u.ID), UserID: u.ID, PublicKey: []byte("pk")})
+	}
+	mem.CreateOrganization(ctx, &data.Organization{ID: "acme", Name: "Acme", Slug: "acme"})
+	mem.AddMember(ctx, &data.Membership{OrgID: "acme", UserID: "u1", Role: OrgRoleMember})
+
+	avatars := avatar.NewLocalFS(t.TempDir())
+	avatars.Put("u1", strings.NewReader("png"))
+	sink, err := audit.NewFile(filepath.Join(t.TempDir(), "audit.jsonl"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sink.Close()
+
+	s := New(Opts{
+		URL:             "http://localhost:8080",
+		UserStore:       mem,
+		IdentityStore:   mem,
+		SessionStore:    mem,
+		CredentialStore: mem,
+		MembershipStore: mem,
+		AvatarStore:     avatars,
+		AuditSink:       sink,
+	})
+	h, _ := s.Handlers()
+
+	do := func(method, path, body, bearer string) *httptest.ResponseRecorder {
+		return doJSON(t, h, method, path, []byte(body), nil, bearer)
+	}
+	login := func(email string) string {
+		var resp struct {
+			Token string `json:"token"`
+		}
+		json.NewDecoder(do(http.MethodPost, "/login", `{"email":"`+email+`","password":"password"}`, "").Body).Decode(&resp)
+		return resp.Token
+	}
+	alice := login("alice@example.com")
+	// Tokens issued without a session can't be revoked with it
+	bob, _ := s.Token(token.User{ID: "u2"})
+	admin, _ := s.Token(token.User{ID: "admin", Attributes: map[string]interface{}{"role": "admin"}})
+
+	t.Run("Export", func(t *testing.T) {
+		rec := do(http.MethodGet, "/account/export", "", alice)
+		if rec.Code != http.StatusOK || !strings.Contains(rec.Header().Get("Content-Disposition"), "attachment") {
+			t.Fatalf("export: %d %s", rec.Code, rec.Body)
+		}
+		var export UserExport
+		json.NewDecoder(rec.Body).Decode(&export)
+		if export.User == nil || export.User.ID != "u1" || len(export.Identities) != 1 || len(export.Credentials) != 1 ||
+			len(export.Memberships) != 1 || len(export.AuditEvents) != 1 || string(export.Avatar) != "png" {
+			t.Fatalf("incomplete export: %+v", export)
+		}
+		if len(export.Sessions) != 1 || export.Sessions[0].RefreshToken != "" {
+			t.Errorf("expected the session without its refresh token hash, got %+v", export.Sessions)
+		}
+
+		if rec := do(http.MethodGet, "/admin/users/u2/export", "", admin); rec.Code != http.StatusOK {
+			t.Errorf("admin export: expected 200, got %d", rec.Code)
+		}
+		if rec := do(http.MethodGet, "/admin/users/missing/export", "", admin); rec.Code != http.StatusNotFound {
+			t.Errorf("unknown user: expected 404, got %d", rec.Code)
+		}
+	})
+
+	t.Run("Erase", func(t *testing.T) {
+		rec := do(http.MethodPost, "/account/erase", "", alice)
+		if rec.Code != http.StatusNoContent {
+			t.Fatalf("erase: %d %s", rec.Code, rec.Body)
+		}
+		if _, err := mem.GetUserByID(ctx, "u1"); err == nil {
+			t.Error("expected the user to be deleted")
+		}
+		if creds, _ := mem.GetCredentialsByUser(ctx, "u1"); len(creds) != 0 {
+			t.Errorf("expected the passkeys to be deleted, got %d", len(creds))
+		}
+		if name, _ := avatars.Find("u1"); name != "" {
+			t.Errorf("expected the avatar to be removed, got %q", name)
+		}
+		if events, _ := sink.RecentEvents(ctx, "u1", 10); len(events) != 0 {
+			t.Errorf("expected the audit events to be anonymised, got %+v", events)
+		}
+		if rec := do(http.MethodGet, "/account/export", "", alice); rec.Code != http.StatusUnauthorized {
+			t.Errorf("the erased user's token should be revoked, got %d", rec.Code)
+		}
+
+		if rec := do(http.MethodPost, "/admin/users/u2/erase", "", admin); rec.Code != http.StatusNoContent {
+			t.Fatalf("admin erase: %d %s", rec.Code, rec.Body)
+		}
+		if _, err := mem.GetUserByID(ctx, "u2"); err == nil {
+			t.Error("expected the user to be deleted")
+		}
+		if rec := do(http.MethodGet, "/account/export", "", bob); rec.Code != http.StatusUnauthorized {
+			t.Errorf("the erased user's session-less token should be revoked, got %d", rec.Code)
+		}
+	})
+}
@@ -4,11 +4,18 @@ import (
 	"crypto/rand"
 	"encoding/base64"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"net/http"
 	"time"
 
+	"auth-go-skd/audit"
+	"auth-go-skd/data"
+	"auth-go-skd/limiter"
+	"auth-go-skd/token"
+
 	"github.com/go-chi/chi/v5"
+	"golang.org/x/crypto/bcrypt"
 )
 
 // Handlers returns the http handlers for auth and avatar
@@ -20,7 +27,125 @@ func (s *Service) Handlers() (http.Handler, http.Handler) {
 	r.Post("/logout", s.logoutHandler)
 
 	// Direct auth routes (simplified)
-	r.Post("/login", s.directLoginHandler)
+	r.With(s.limit(limiter.ByIP, limiter.ByEmail)).Post("/login", s.directLoginHandler)
+
+	// Refresh tokens and session management, enabled by Opts.SessionStore
+	if s.opts.SessionStore != nil {
+		r.With(s.limit(limiter.ByIP)).Post("/refresh", s.refreshHandler)
+		r.Group(func(r chi.Router) {
+			r.Use(s.Middleware().UserAuth)
+			r.Get("/sessions", s.listSessionsHandler)
+			r.Delete("/sessions", s.revokeOtherSessionsHandler)
+			r.Delete("/sessions/{id}", s.revokeSessionHandler)
+		})
+	}
+
+	// Data export and erasure of the calling user
+	r.Group(func(r chi.Router) {
+		r.Use(s.Middleware().UserAuth)
+		r.Get("/account/export", s.exportAccountHandler)
+		r.Post("/account/erase", s.eraseAccountHandler)
+	})
+
+	// OAuth2 token, introspection and revocation endpoints, enabled by Opts.ClientStore
+	if s.opts.ClientStore != nil {
+		r.With(s.limit(limiter.ByIP)).Post("/token", s.tokenHandler)
+		// Not rate limited: resource servers introspect on every request they serve.
+		r.Post("/introspect", s.introspectHandler)
+		r.Post("/revoke", s.revokeHandler)
+	}
+
+	// OpenID Connect provider, enabled by Opts.OIDCSigningKey, Opts.ClientStore and Opts.UserStore
+	if s.oidcEnabled() {
+		r.Get("/.well-known/openid-configuration", s.discoveryHandler)
+		r.Get("/.well-known/jwks.json", s.jwksHandler)
+		r.Get("/authorize", s.authorizeHandler)
+		r.Post("/authorize", s.authorizeHandler)
+		r.Group(func(r chi.Router) {
+			r.Use(s.Middleware().ScopedAuth(ScopeOpenID))
+			r.Get("/userinfo", s.userInfoHandler)
+			r.Post("/userinfo", s.userInfoHandler)
+		})
+	}
+
+	// API keys, enabled by Opts.APIKeyStore
+	if s.opts.APIKeyStore != nil {
+		r.Group(func(r chi.Router) {
+			r.Use(s.Middleware().UserAuth)
+			r.Get("/api-keys", s.listAPIKeysHandler)
+			r.Post("/api-keys", s.createAPIKeyHandler)
+			r.Delete("/api-keys/{id}", s.revokeAPIKeyHandler)
+		})
+	}
+
+	// Organizations, enabled by Opts.MembershipStore
+	if s.opts.MembershipStore != nil {
+		r.Group(func(r chi.Router) {
+			r.Use(s.Middleware().UserAuth)
+			r.Get("/orgs", s.listOrgsHandler)
+			r.Post("/orgs/switch", s.switchOrgHandler)
+			if s.opts.OrganizationStore != nil {
+				r.Post("/orgs", s.createOrgHandler)
+			}
+		})
+	}
+
+	// Invitations, enabled by Opts.InvitationStore, Opts.MembershipStore and Opts.Mailer
+	if s.opts.InvitationStore != nil && s.opts.MembershipStore != nil && s.opts.Mailer != nil {
+		r.Group(func(r chi.Router) {
+			r.Use(s.Middleware().UserAuth)
+			r.Post("/invitations/accept", s.acceptInviteHandler)
+			r.Group(func(r chi.Router) {
+				r.Use(s.Middleware().RequireOrgRole(OrgRoleOwner, OrgRoleAdmin))
+				r.Post("/orgs/invitations", s.createInviteHandler)
+				r.Get("/orgs/invitations", s.listInvitesHandler)
+				r.Delete("/orgs/invitations/{id}", s.revokeInviteHandler)
+			})
+		})
+	}
+
+	// One-time email code login, enabled by Opts.CodeStore, Opts.Mailer and Opts.UserStore
+	if s.opts.CodeStore != nil && s.opts.Mailer != nil && s.opts.UserStore != nil {
+		r.With(s.limit(limiter.ByIP, limiter.ByEmail)).Post("/otp/request", s.otpRequestHandler)
+		r.With(s.limit(limiter.ByIP, limiter.ByEmail)).Post("/otp/verify", s.otpVerifyHandler)
+	}
+
+	// Magic-link login, enabled by Opts.Mailer and Opts.UserStore
+	if s.opts.Mailer != nil && s.opts.UserStore != nil {
+		r.With(s.limit(limiter.ByIP, limiter.ByEmail)).Post("/magic/request", s.magicRequestHandler)
+		r.With(s.limit(limiter.ByIP)).Get("/magic/verify", s.magicVerifyHandler)
+	}
+
+	// Passkey (WebAuthn) routes, enabled by Opts.CredentialStore
+	if s.webauthn != nil {
+		r.With(s.limit(limiter.ByIP)).Post("/passkey/login/begin", s.passkeyLoginBeginHandler)
+		r.With(s.limit(limiter.ByIP)).Post("/passkey/login/finish", s.passkeyLoginFinishHandler)
+		r.Group(func(r chi.Router) {
+			r.Use(s.Middleware().UserAuth)
+			r.Post("/passkey/register/begin", s.passkeyRegisterBeginHandler)
+			r.Post("/passkey/register/finish", s.passkeyRegisterFinishHandler)
+		})
+	}
+
+	// Admin routes
+	r.Group(func(r chi.Router) {
+		r.Use(s.Middleware().UserAuth, s.Middleware().RequireRole("admin"))
+		r.Post("/admin/unlock", s.unlockHandler)
+		if s.opts.UserStore != nil {
+			r.Get("/admin/users", s.listUsersHandler)
+			r.Get("/admin/users/{id}", s.getUserHandler)
+			r.Put("/admin/users/{id}/role", s.setRoleHandler)
+			r.Post("/admin/users/{id}/block", s.blockUserHandler)
+			r.Delete("/admin/users/{id}/block", s.blockUserHandler)
+			r.Post("/admin/users/{id}/logout", s.forceLogoutHandler)
+			r.Delete("/admin/users/{id}", s.deleteUserHandler)
+			r.Get("/admin/users/{id}/export", s.exportUserHandler)
+			r.Post("/admin/users/{id}/erase", s.eraseUserHandler)
+		}
+		if _, ok := s.opts.AuditSink.(audit.Querier); ok {
+			r.Get("/admin/audit", s.auditEventsHandler)
+		}
+	})
 
 	avatarRouter := chi.NewRouter()
 	// avatarRouter.Get("/{id}", s.avatarHandler)
@@ -37,7 +162,7 @@ func generateState() string {
 
 func (s *Service) loginHandler(w http.ResponseWriter, r *http.Request) {
 	providerName := chi.URLParam(r, "provider")
-	p, ok := s.providers[providerName]
+	p, _, ok := s.provider(r, providerName)
 	if !ok {
 		http.Error(w, "provider not found", http.StatusNotFound)
 		return
@@ -56,6 +181,17 @@ func (s *Service) loginHandler(w http.ResponseWriter, r *http.Request) {
 		Secure:   r.TLS != nil || s.opts.URLIsHTTPS, // Auto-detect HTTPS or config
 		SameSite: http.SameSiteLaxMode,
 	})
+	if invite := r.URL.Query().Get("invite"); invite != "" {
+		http.SetCookie(w, &http.Cookie{
+			Name:     inviteCookie,
+			Value:    invite,
+			Path:     "/",
+			Expires:  time.Now().Add(10 * time.Minute),
+			HttpOnly: true,
+			Secure:   r.TLS != nil || s.opts.URLIsHTTPS,
+			SameSite: http.SameSiteLaxMode,
+		})
+	}
 
 	// 3. Redirect to Provider
 	url := p.GetAuthURL(state)
@@ -64,7 +200,7 @@ func (s *Service) loginHandler(w http.ResponseWriter, r *http.Request) {
 
 func (s *Service) callbackHandler(w http.ResponseWriter, r *http.Request) {
 	providerName := chi.URLParam(r, "provider")
-	p, ok := s.providers[providerName]
+	p, t, ok := s.provider(r, providerName)
 	if !ok {
 		http.Error(w, "provider not found", http.StatusNotFound)
 		return
@@ -74,6 +210,7 @@ func (s *Service) callbackHandler(w http.ResponseWriter, r *http.Request) {
 	stateParam := r.URL.Query().Get("state")
 	stateCookie, err := r.Cookie("oauth_state")
 	if err != nil || stateCookie.Value != stateParam {
+		s.auditFailure(r, audit.Login, providerName, "", "invalid_state")
 		http.Error(w, "invalid oauth state", http.StatusForbidden)
 		return
 	}
@@ -91,18 +228,98 @@ func (s *Service) callbackHandler(w http.ResponseWriter, r *http.Request) {
 	code := r.URL.Query().Get("code")
 	user, err := p.FetchUser(r.Context(), code)
 	if err != nil {
+		s.auditFailure(r, audit.Login, providerName, "", "provider_error")
 		http.Error(w, fmt.Sprintf("failed to login: %v", err), http.StatusInternalServerError)
 		return
 	}
 
-	// 3. Create JWT
-	tokenStr, err := s.Token(user)
+	// 3. Resolve the stored user, if OAuth logins are persisted
+	if s.opts.UserStore != nil && s.opts.IdentityStore != nil {
+		u, err := s.oauthUser(r, providerName, t, user)
+		if err != nil {
+			s.auditFailure(r, audit.Login, providerName, "", "user_lookup_failed")
+			s.writeError(w, err, "failed to login")
+			return
+		}
+		user = tokenUser(u)
+	}
+
+	// 4. Issue JWT and session cookie
+	s.authorize(w, r, user, providerName)
+}
+
+// authorize issues a JWT for user, sets the session cookie and writes the token as JSON.
+// Every login flow finishes through here so clients get the same response shape and hooks
+// and audit events run once per login; provider names the login method.
+func (s *Service) authorize(w http.ResponseWriter, r *http.Request, user token.User, provider string) {
+	ctx := r.Context()
+	// OAuth logins without an IdentityStore aren't persisted, so a missing user is no reason to
+	// refuse one that just authenticated.
+	if err := s.checkAccount(ctx, user.ID); err != nil && !errors.Is(err, errAccountNotFound) {
+		s.auditFailure(r, audit.Login, provider, user.ID, "account_disabled")
+		s.writeError(w, err, "failed to login")
+		return
+	}
+	if s.opts.BeforeLogin != nil {
+		if err := s.opts.BeforeLogin(ctx, r, user); err != nil {
+			s.auditFailure(r, audit.Login, provider, user.ID, "rejected")
+			s.writeError(w, err, "login rejected")
+			return
+		}
+	}
+
+	// With a SessionStore every login returns a token pair.
+	var sessionID, refreshToken string
+	if s.opts.SessionStore != nil {
+		session, rt, err := s.createSession(r, user.ID)
+		if err != nil {
+			s.logger.Printf("failed to create session for %s: %v", user.ID, err)
+			http.Error(w, "failed to create session", http.StatusInternalServerError)
+			return
+		}
+		sessionID, refreshToken = session.ID, rt
+	}
+
+	if s.opts.AfterLogin != nil {
+		if err := s.opts.AfterLogin(ctx, r, user); err != nil {
+			if sessionID != "" {
+				if err := s.opts.SessionStore.DeleteSession(ctx, sessionID); err != nil {
+					s.logger.Printf("failed to delete session %s: %v", sessionID, err)
+				}
+			}
+			s.auditFailure(r, audit.Login, provider, user.ID, "rejected")
+			s.writeError(w, err, "login rejected")
+			return
+		}
+	}
+
+	extra := s.loginInvite(w, r, user)
+
+	s.audit(r, audit.Event{Type: audit.Login, Provider: provider, UserID: user.ID})
+	s.respondWithToken(w, r, user, sessionID, refreshToken, extra...)
+}
+
+// respondWithToken signs the access token, sets the JWT cookie and writes the login response.
+func (s *Service) respondWithToken(w http.ResponseWriter, r *http.Request, user token.User, sessionID, refreshToken string, extra ...token.ClaimSetter) {
+	tokenStr, err := s.token(r, user, sessionID, extra...)
 	if err != nil {
-		http.Error(w, "failed to create token", http.StatusInternalServerError)
+		s.writeError(w, err, "failed to create token")
 		return
 	}
+	s.writeToken(w, r, user, tokenStr, refreshToken)
+}
+
+// writeToken sets the JWT cookie and writes tokenStr, with refreshToken when there is one, as
+// the login response.
+func (s *Service) writeToken(w http.ResponseWriter, r *http.Request, user token.User, tokenStr, refreshToken string) {
+	resp := map[string]interface{}{
+		"token": tokenStr,
+		"user":  user,
+	}
+	if refreshToken != "" {
+		resp["refresh_token"] = refreshToken
+	}
 
-	// 4. Set Session Cookie
 	http.SetCookie(w, &http.Cookie{
 		Name:     "JWT",
 		Value:    tokenStr,
@@ -116,18 +333,99 @@ func (s *Service) callbackHandler(w http.ResponseWriter, r *http.Request) {
 	// Redirect or return JSON
 	// For SDK, usually redirects to frontend or returns JSON.
 	// Let's just return JSON for now as generic behavior
-	json.NewEncoder(w).Encode(map[string]interface{}{
-		"token": tokenStr,
-		"user":  user,
-	})
+	json.NewEncoder(w).Encode(resp)
 }
 
+// logoutHandler clears the JWT cookie and, when the request carries a token, revokes it
+// together with its refresh session so neither can be used again. An OnLogout error is only
+// logged: a failing hook must not keep users signed in.
 func (s *Service) logoutHandler(w http.ResponseWriter, r *http.Request) {
-	// TODO: Clear cookie
+	if claims, err := s.parseToken(r, requestToken(r)); err == nil {
+		ctx := r.Context()
+		if claims.User != nil {
+			if s.opts.OnLogout != nil {
+				if err := s.opts.OnLogout(ctx, r, *claims.User); err != nil {
+					s.logger.Printf("logout hook: %v", err)
+				}
+			}
+			s.audit(r, audit.Event{Type: audit.Logout, UserID: claims.User.ID})
+		}
+		if claims.ID != "" && claims.ExpiresAt != nil {
+			if err := s.opts.RevocationStore.Revoke(ctx, claims.ID, time.Until(claims.ExpiresAt.Time)); err != nil {
+				s.logger.Printf("logout: %v", err)
+			}
+		}
+		if claims.SessionID != "" {
+			if err := s.revokeSession(ctx, claims.SessionID); err != nil {
+				s.logger.Printf("logout: %v", err)
+			}
+		}
+	}
+
+	clearJWTCookie(w)
 	w.WriteHeader(http.StatusOK)
 }
 
+func clearJWTCookie(w http.ResponseWriter) {
+	http.SetCookie(w, &http.Cookie{
+		Name:     "JWT",
+		Value:    "",
+		Path:     "/",
+		Expires:  time.Unix(0, 0),
+		HttpOnly: true,
+	})
+}
+
+// dummyHash is compared against when the account does not exist, so unknown
+// emails take as long as wrong passwords.
+var dummyHash, _ = bcrypt.GenerateFromPassword([]byte("dummy-password"), bcrypt.DefaultCost)
+
 func (s *Service) directLoginHandler(w http.ResponseWriter, r *http.Request) {
-	// TODO: Implement direct login
-	w.WriteHeader(http.StatusNotImplemented)
+	if s.opts.UserStore == nil {
+		w.WriteHeader(http.StatusNotImplemented)
+		return
+	}
+
+	var req data.LoginRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	email := normalizeEmail(req.Email)
+	if email == "" || req.Password == "" {
+		http.Error(w, "invalid email or password", http.StatusUnauthorized)
+		return
+	}
+
+	if !s.checkLockout(w, r, email) {
+		s.auditFailure(r, audit.Login, "password", "", "locked")
+		return
+	}
+
+	hash := dummyHash
+	u, err := s.opts.UserStore.GetUserByEmail(r.Context(), email)
+	if err != nil && !errors.Is(err, data.ErrUserNotFound) {
+		// A store outage is not a wrong password and must not lock anyone out.
+		s.logger.Printf("login: %v", err)
+		http.Error(w, "failed to load user", http.StatusInternalServerError)
+		return
+	}
+	if err == nil && u.PasswordHash != "" {
+		hash = []byte(u.PasswordHash)
+	}
+
+	if bcrypt.CompareHashAndPassword(hash, []byte(req.Password)) != nil || err != nil || u.PasswordHash == "" {
+		s.loginFailed(r, email)
+		var userID string
+		if err == nil {
+			userID = u.ID
+		}
+		s.auditFailure(r, audit.Login, "password", userID, "invalid_credentials")
+		http.Error(w, "invalid email or password", http.StatusUnauthorized)
+		return
+	}
+
+	s.loginSucceeded(r, email)
+	s.authorize(w, r, tokenUser(u), "password")
 }
@@ -0,0 +1,49 @@
+package auth
+
+import (
+	"errors"
+	"net/http"
+)
+
+// HookError aborts a flow from a hook. The client gets Status (403 when zero) and Message;
+// Err is only logged.
+type HookError struct {
+	Status  int
+	Message string
+	Err     error
+}
+
+// Reject returns a HookError answering with status and message.
+func Reject(status int, message string) *HookError {
+	return &HookError{Status: status, Message: message}
+}
+
+func (e *HookError) Error() string {
+	if e.Err != nil {
+		return e.Message + ": " + e.Err.Error()
+	}
+	return e.Message
+}
+
+func (e *HookError) Unwrap() error {
+	return e.Err
+}
+
+// writeError answers with the status and message of a HookError in err's chain, or logs
+// err and answers 500 with fallback.
+func (s *Service) writeError(w http.ResponseWriter, err error, fallback string) {
+	var he *HookError
+	if errors.As(err, &he) {
+		if he.Err != nil {
+			s.logger.Printf("hook: %v", he)
+		}
+		status := he.Status
+		if status == 0 {
+			status = http.StatusForbidden
+		}
+		http.Error(w, he.Message, status)
+		return
+	}
+	s.logger.Printf("%s: %v", fallback, err)
+	http.Error(w, fallback, http.StatusInternalServerError)
+}
@@ -0,0 +1,182 @@
+package auth
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"auth-go-skd/data"
+	"auth-go-skd/store"
+	"auth-go-skd/store/memory"
+	"auth-go-skd/token"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+func TestHooks_Login(t *testing.T) {
+	ctx := context.Background()
+	mem := memory.New()
+	hash, _ := bcrypt.GenerateFromPassword([]byte("password"), bcrypt.MinCost)
+	mem.CreateUser(ctx, &data.User{ID: "u1", Email: "a@example.com", PasswordHash: string(hash), Role: "user"})
+	mem.CreateUser(ctx, &data.User{ID: "u2", Email: "b@example.com", PasswordHash: string(hash), Role: "user"})
+
+	var loggedOut string
+	s := New(Opts{
+		URL:          "http://localhost:8080",
+		UserStore:    mem,
+		SessionStore: mem,
+		LockoutStore: noLockouts{},
+		BeforeLogin: func(_ context.Context, _ *http.Request, user token.User) error {
+			if user.ID == "u2" {
+				return Reject(http.StatusForbidden, "account suspended")
+			}
+			return nil
+		},
+		AfterLogin: func(_ context.Context, r *http.Request, _ token.User) error {
+			if r.Header.Get("X-Fail") != "" {
+				return errors.New("provisioning failed")
+			}
+			return nil
+		},
+		ClaimsEnricher: func(_ context.Context, _ *http.Request, claims *token.Claims) error {
+			claims.User.Attributes["tenant"] = "acme"
+			return nil
+		},
+		OnLogout: func(_ context.Context, _ *http.Request, user token.User) error {
+			loggedOut = user.ID
+			return errors.New("downstream unavailable")
+		},
+	})
+	h, _ := s.Handlers()
+
+	login := func(email string, header ...string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/login", jsonBody(`{"email":"`+email+`","password":"password"}`))
+		if len(header) == 2 {
+			req.Header.Set(header[0], header[1])
+		}
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+		return rec
+	}
+
+	rec := login("b@example.com")
+	if rec.Code != http.StatusForbidden || !strings.Contains(rec.Body.String(), "account suspended") {
+		t.Errorf("BeforeLogin: expected 403 with the hook message, got %d %s", rec.Code, rec.Body)
+	}
+	if list, _ := mem.ListSessionsByUser(ctx, "u2"); len(list) != 0 {
+		t.Errorf("BeforeLogin: rejected login created %d sessions", len(list))
+	}
+
+	if rec := login("a@example.com", "X-Fail", "1"); rec.Code != http.StatusInternalServerError {
+		t.Errorf("AfterLogin: expected 500, got %d", rec.Code)
+	}
+	if list, _ := mem.ListSessionsByUser(ctx, "u1"); len(list) != 0 {
+		t.Errorf("AfterLogin: aborted login left %d sessions", len(list))
+	}
+
+	rec = login("a@example.com")
+	if rec.Code != http.StatusOK {
+		t.Fatalf("login: %d %s", rec.Code, rec.Body)
+	}
+	var resp struct {
+		Token string `json:"token"`
+	}
+	json.NewDecoder(rec.Body).Decode(&resp)
+	claims, err := s.ParseToken(resp.Token)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if claims.User.Attributes["tenant"] != "acme" {
+		t.Errorf("ClaimsEnricher: expected tenant claim, got %v", claims.User.Attributes)
+	}
+
+	req := httptest.NewRequest(http.MethodPost, "/logout", nil)
+	req.Header.Set("Authorization", "Bearer "+resp.Token)
+	rec = httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	if loggedOut != "u1" {
+		t.Errorf("OnLogout: expected u1, got %q", loggedOut)
+	}
+	if rec.Code != http.StatusOK || !strings.Contains(rec.Header().Get("Set-Cookie"), "JWT=;") {
+		t.Errorf("OnLogout: a failing hook should not stop the logout, got %d %q", rec.Code, rec.Header().Get("Set-Cookie"))
+	}
+	if !s.isRevoked(ctx, claims) {
+		t.Error("OnLogout: expected the token to be revoked despite the hook error")
+	}
+}
+
+func TestHooks_OnUserCreatedRejectsSignup(t *testing.T) {
+	ctx := context.Background()
+	mem := memory.New()
+
+	var created []string
+	s := New(Opts{
+		URL:           "http://localhost:8080",
+		UserStore:     mem,
+		IdentityStore: mem,
+		OnUserCreated: func(_ context.Context, _ *http.Request, _ store.Store, user *data.User) error {
+			if strings.HasSuffix(user.Email, "@blocked.example") {
+				return Reject(http.StatusForbidden, "signups from this domain are not allowed")
+			}
+			created = append(created, user.Email)
+			return nil
+		},
+	})
+	s.Add(fakeProvider{user: token.User{ID: "p-1", Name: "Mallory", Email: "m@blocked.example"}})
+	h, _ := s.Handlers()
+
+	if rec := oauthCallback(t, h); rec.Code != http.StatusForbidden {
+		t.Fatalf("expected 403, got %d %s", rec.Code, rec.Body)
+	}
+	if _, err := mem.GetUserByEmail(ctx, "m@blocked.example"); !errors.Is(err, data.ErrUserNotFound) {
+		t.Errorf("rejected user should not be stored, got %v", err)
+	}
+	if _, err := mem.GetIdentityByProvider(ctx, "fake", "p-1"); !errors.Is(err, data.ErrIdentityNotFound) {
+		t.Errorf("rejected identity should not be stored, got %v", err)
+	}
+
+	s.Add(fakeProvider{user: token.User{ID: "p-2", Name: "Alice", Email: "alice@example.com"}})
+	if rec := oauthCallback(t, h); rec.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d %s", rec.Code, rec.Body)
+	}
+	if len(created) != 1 || created[0] != "alice@example.com" {
+		t.Errorf("expected OnUserCreated for alice only, got %v", created)
+	}
+	if u, _ := mem.GetUserByEmail(ctx, "alice@example.com"); u == nil || u.Name != "Alice" {
+		t.Errorf("expected the new user to carry the provider name, got %+v", u)
+	}
+}
+
+func TestHooks_OnUserCreatedProvisions(t *testing.T) {
+	ctx := context.Background()
+	mem := memory.New()
+	mem.CreateOrganization(ctx, &data.Organization{ID: "o1", Name: "Acme", Slug: "acme"})
+
+	s := New(Opts{
+		URL:               "http://localhost:8080",
+		UserStore:         mem,
+		IdentityStore:     mem,
+		OrganizationStore: mem,
+		MembershipStore:   mem,
+		OnUserCreated: func(ctx context.Context, _ *http.Request, tx store.Store, user *data.User) error {
+			return tx.AddMember(ctx, &data.Membership{OrgID: "o1", UserID: user.ID, Role: OrgRoleMember})
+		},
+	})
+	s.Add(fakeProvider{user: token.User{ID: "p-1", Name: "Alice", Email: "alice@example.com"}})
+	h, _ := s.Handlers()
+
+	if rec := oauthCallback(t, h); rec.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d %s", rec.Code, rec.Body)
+	}
+	u, err := mem.GetUserByEmail(ctx, "alice@example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := mem.GetMembership(ctx, "o1", u.ID); err != nil {
+		t.Errorf("expected the hook to add a membership: %v", err)
+	}
+}
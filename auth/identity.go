@@ -0,0 +1,80 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"auth-go-skd/data"
+	"auth-go-skd/store"
+	"auth-go-skd/token"
+
+	"github.com/google/uuid"
+)
+
+var errUnverifiedDomain = Reject(http.StatusForbidden, "email domain not verified for this tenant")
+
+// oauthUser returns the user linked to the provider account, linking it on first login to the
+// user registered under the provider's email, or to a new one. Providers are trusted to have
+// verified the email they return, except those of a tenant t, which may be nil: their identities
+// are kept apart per tenant, and they only link emails in the tenant's verified domains.
+func (s *Service) oauthUser(r *http.Request, provider string, t *tenant, pu token.User) (*data.User, error) {
+	ctx := r.Context()
+	if t != nil {
+		provider = t.identityProvider(provider)
+	}
+	u, err := s.linkedUser(ctx, provider, pu.ID)
+	if !errors.Is(err, data.ErrIdentityNotFound) {
+		return u, err
+	}
+
+	email := normalizeEmail(pu.Email)
+	if email == "" {
+		return nil, fmt.Errorf("provider returned no email for %s", pu.ID)
+	}
+	if t != nil && !t.verifiedEmail(email) {
+		return nil, errUnverifiedDomain
+	}
+
+	err = s.inTx(ctx, func(tx store.Store) error {
+		u, err = s.findOrCreateUser(r, tx, email, pu.Name)
+		if err != nil {
+			return err
+		}
+		if u.Name == "" && pu.Name != "" {
+			u.Name = pu.Name
+			u.UpdatedAt = time.Now()
+			if err := tx.UpdateUser(ctx, u); err != nil {
+				return err
+			}
+		}
+
+		now := time.Now()
+		return tx.CreateIdentity(ctx, &data.Identity{
+			ID:         uuid.NewString(),
+			UserID:     u.ID,
+			Provider:   provider,
+			ProviderID: pu.ID,
+			CreatedAt:  now,
+			LastLogin:  now,
+		})
+	})
+	if errors.Is(err, data.ErrConflict) || errors.Is(err, data.ErrEmailTaken) {
+		// A concurrent login linked the account first.
+		return s.linkedUser(ctx, provider, pu.ID)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return u, nil
+}
+
+func (s *Service) linkedUser(ctx context.Context, provider, providerID string) (*data.User, error) {
+	identity, err := s.opts.IdentityStore.GetIdentityByProvider(ctx, provider, providerID)
+	if err != nil {
+		return nil, err
+	}
+	return s.opts.UserStore.GetUserByID(ctx, identity.UserID)
+}
@@ -0,0 +1,95 @@
+package auth
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"auth-go-skd/data"
+	"auth-go-skd/store"
+	"auth-go-skd/store/memory"
+	"auth-go-skd/token"
+)
+
+type fakeProvider struct{ user token.User }
+
+func (p fakeProvider) Name() string { return "fake" }
+func (p fakeProvider) GetAuthURL(state string) string {
+	return "https://provider.example/auth?state=" + state
+}
+func (p fakeProvider) FetchUser(context.Context, string) (token.User, error) {
+	return p.user, nil
+}
+
+func oauthCallback(t *testing.T, h http.Handler) *httptest.ResponseRecorder {
+	t.Helper()
+	req := httptest.NewRequest(http.MethodGet, "/fake/callback?state=st&code=c", nil)
+	req.AddCookie(&http.Cookie{Name: "oauth_state", Value: "st"})
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	return rec
+}
+
+func TestOAuthCallback_LinksIdentity(t *testing.T) {
+	ctx := context.Background()
+	mem := memory.New()
+	mem.CreateUser(ctx, &data.User{ID: "u1", Email: "a@example.com", Role: "user"})
+
+	s := New(Opts{URL: "http://localhost:8080", UserStore: mem, IdentityStore: mem})
+	s.Add(fakeProvider{user: token.User{ID: "p-1", Name: "Alice", Email: "A@example.com"}})
+	h, _ := s.Handlers()
+
+	for range 2 {
+		rec := oauthCallback(t, h)
+		if rec.Code != http.StatusOK {
+			t.Fatalf("callback: %d %s", rec.Code, rec.Body)
+		}
+		var resp struct {
+			User token.User `json:"user"`
+		}
+		json.NewDecoder(rec.Body).Decode(&resp)
+		if resp.User.ID != "u1" {
+			t.Errorf("expected the existing user, got %q", resp.User.ID)
+		}
+	}
+
+	identity, err := mem.GetIdentityByProvider(ctx, "fake", "p-1")
+	if err != nil || identity.UserID != "u1" {
+		t.Fatalf("identity: %+v (%v)", identity, err)
+	}
+	if u, _ := mem.GetUserByID(ctx, "u1"); u.Name != "Alice" {
+		t.Errorf("expected the provider name to fill in the profile, got %q", u.Name)
+	}
+}
+
+// failingStore fails every identity write made inside a transaction.
+type failingStore struct{ *memory.Memory }
+
+func (f failingStore) WithTx(ctx context.Context, fn func(tx store.Store) error) error {
+	return f.Memory.WithTx(ctx, func(tx store.Store) error { return fn(failingTx{tx}) })
+}
+
+type failingTx struct{ store.Store }
+
+func (failingTx) CreateIdentity(context.Context, *data.Identity) error {
+	return errors.New("identity write failed")
+}
+
+func TestOAuthCallback_CreatesUserAtomically(t *testing.T) {
+	mem := memory.New()
+	fs := failingStore{mem}
+
+	s := New(Opts{URL: "http://localhost:8080", UserStore: fs, IdentityStore: fs})
+	s.Add(fakeProvider{user: token.User{ID: "p-1", Email: "new@example.com"}})
+	h, _ := s.Handlers()
+
+	if rec := oauthCallback(t, h); rec.Code != http.StatusInternalServerError {
+		t.Fatalf("expected 500, got %d", rec.Code)
+	}
+	if _, err := mem.GetUserByEmail(context.Background(), "new@example.com"); !errors.Is(err, data.ErrUserNotFound) {
+		t.Errorf("user should be rolled back with the identity, got %v", err)
+	}
+}
@@ -0,0 +1,255 @@
+package auth
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+
+	"auth-go-skd/audit"
+	"auth-go-skd/data"
+	"auth-go-skd/token"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// ScopeIntrospect lets a confidential client introspect any token and revoke tokens that
+// weren't issued to it. Grant it with Service.CreateClient to resource servers only.
+const ScopeIntrospect = "introspect"
+
+// Token kinds reported by the introspection endpoint in token_use.
+const (
+	tokenUseAccess  = "access"
+	tokenUseRefresh = "refresh"
+	tokenUseAPIKey  = "api_key"
+)
+
+// introspection is the response of the token introspection endpoint (RFC 7662): active and,
+// for active tokens, what kind of token it is and its claims.
+type introspection struct {
+	Active   bool   `json:"active"`
+	Use      string `json:"token_use,omitempty"`
+	ClientID string `json:"client_id,omitempty"`
+	*token.Claims
+}
+
+// isJWT tells access tokens apart from refresh tokens, which are opaque.
+func isJWT(tok string) bool {
+	return strings.Count(tok, ".") == 2
+}
+
+// introspect resolves an access token, refresh token or API key to its claims, like the
+// middleware would. Unknown, expired and revoked tokens and those of blocked or deleted
+// users are inactive. API keys aren't marked as used.
+func (s *Service) introspect(r *http.Request, tok string) (*introspection, error) {
+	ctx := r.Context()
+	switch {
+	case strings.HasPrefix(tok, apiKeyMarker) && s.opts.APIKeyStore != nil:
+		key, err := s.lookupAPIKey(ctx, tok)
+		if errors.Is(err, errInvalidAPIKey) {
+			return &introspection{}, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		user, err := s.loadUser(ctx, key.UserID)
+		if accountUnusable(err) {
+			return &introspection{}, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		return &introspection{Active: true, Use: tokenUseAPIKey, Claims: keyClaims(key, user)}, nil
+
+	case isJWT(tok):
+		claims, err := s.parseToken(r, tok)
+		if err != nil || s.isRevoked(ctx, claims) {
+			return &introspection{}, nil
+		}
+		if claims.SubjectType == token.SubjectClient {
+			return &introspection{Active: true, Use: tokenUseAccess, ClientID: claims.Subject, Claims: claims}, nil
+		}
+		if claims.User == nil {
+			return &introspection{}, nil
+		}
+		err = s.checkAccount(ctx, claims.User.ID)
+		if accountUnusable(err) {
+			return &introspection{}, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		// User tokens name their user only in the user claim; RFC 7662 wants it in sub.
+		if claims.Subject == "" {
+			claims.Subject = claims.User.ID
+		}
+		resp := &introspection{Active: true, Use: tokenUseAccess, Claims: claims}
+		// Tokens issued to a relying party have it as their audience.
+		if !slices.Contains(claims.Audience, s.opts.URL) && len(claims.Audience) == 1 {
+			resp.ClientID = claims.Audience[0]
+		}
+		return resp, nil
+
+	case s.opts.SessionStore != nil:
+		session, err := s.opts.SessionStore.GetSessionByRefreshToken(ctx, hashToken(tok))
+		if errors.Is(err, data.ErrSessionNotFound) {
+			return &introspection{}, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		if session.IsBlocked || time.Now().After(session.ExpiresAt) {
+			return &introspection{}, nil
+		}
+		user, err := s.loadUser(ctx, session.UserID)
+		if accountUnusable(err) {
+			return &introspection{}, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		return &introspection{Active: true, Use: tokenUseRefresh, Claims: &token.Claims{
+			User:      &user,
+			SessionID: session.ID,
+			RegisteredClaims: jwt.RegisteredClaims{
+				Subject:   user.ID,
+				Issuer:    s.opts.Issuer,
+				ExpiresAt: jwt.NewNumericDate(session.ExpiresAt),
+				IssuedAt:  jwt.NewNumericDate(session.CreatedAt),
+			},
+		}}, nil
+	}
+	return &introspection{}, nil
+}
+
+// revokeToken revokes an access token, refresh token or API key and returns the user it
+// belonged to, if any. Access tokens go on the revocation list like on logout; refresh tokens
+// end their session, which also blocks the access tokens issued with it; API keys are deleted.
+// Unknown and invalid tokens are ignored.
+func (s *Service) revokeToken(r *http.Request, tok string) (string, error) {
+	ctx := r.Context()
+	switch {
+	case strings.HasPrefix(tok, apiKeyMarker) && s.opts.APIKeyStore != nil:
+		key, err := s.lookupAPIKey(ctx, tok)
+		if errors.Is(err, errInvalidAPIKey) {
+			return "", nil
+		}
+		if err != nil {
+			return "", err
+		}
+		if err := s.opts.APIKeyStore.DeleteAPIKey(ctx, key.UserID, key.ID); err != nil && !errors.Is(err, data.ErrAPIKeyNotFound) {
+			return "", err
+		}
+		return key.UserID, nil
+
+	case isJWT(tok):
+		claims, err := s.parseToken(r, tok)
+		if err != nil || claims.ID == "" || claims.ExpiresAt == nil {
+			return "", nil
+		}
+		if err := s.opts.RevocationStore.Revoke(ctx, claims.ID, time.Until(claims.ExpiresAt.Time)); err != nil {
+			return "", err
+		}
+		if claims.User != nil {
+			return claims.User.ID, nil
+		}
+		return "", nil
+
+	case s.opts.SessionStore != nil:
+		session, err := s.opts.SessionStore.GetSessionByRefreshToken(ctx, hashToken(tok))
+		if errors.Is(err, data.ErrSessionNotFound) {
+			return "", nil
+		}
+		if err != nil {
+			return "", err
+		}
+		return session.UserID, s.revokeSession(ctx, session.ID)
+	}
+	return "", nil
+}
+
+// introspectionClient authenticates the confidential client calling an introspection or
+// revocation endpoint, answering with an OAuth2 error and returning nil when there is none.
+func (s *Service) introspectionClient(w http.ResponseWriter, r *http.Request) *data.Client {
+	if err := r.ParseForm(); err != nil {
+		writeOAuthError(w, http.StatusBadRequest, "invalid_request", "invalid form body")
+		return nil
+	}
+	client, err := s.authenticateClient(r)
+	if err != nil {
+		s.logger.Printf("client auth: %v", err)
+		writeOAuthError(w, http.StatusInternalServerError, "server_error", "")
+		return nil
+	}
+	if client == nil || client.SecretHash == "" {
+		writeOAuthError(w, http.StatusUnauthorized, "invalid_client", "unknown client or wrong secret")
+		return nil
+	}
+	if r.PostForm.Get("token") == "" {
+		writeOAuthError(w, http.StatusBadRequest, "invalid_request", "token is required")
+		return nil
+	}
+	return client
+}
+
+// introspectHandler implements token introspection (RFC 7662) for confidential clients with
+// ScopeIntrospect, so services that can't call Service.ParseToken can check tokens. The kind
+// of token is told from its form, so token_type_hint is ignored.
+func (s *Service) introspectHandler(w http.ResponseWriter, r *http.Request) {
+	client := s.introspectionClient(w, r)
+	if client == nil {
+		return
+	}
+	if !slices.Contains(client.Scopes, ScopeIntrospect) {
+		writeOAuthError(w, http.StatusForbidden, "insufficient_scope", "the client may not introspect tokens")
+		return
+	}
+	resp, err := s.introspect(r, r.PostForm.Get("token"))
+	if err != nil {
+		s.logger.Printf("introspect: %v", err)
+		writeOAuthError(w, http.StatusInternalServerError, "server_error", "")
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	json.NewEncoder(w).Encode(resp)
+}
+
+// revokeHandler implements token revocation (RFC 7009) for confidential clients. Clients
+// revoke the tokens issued to them; only those with ScopeIntrospect may revoke any token. It
+// answers 200 for tokens that are unknown or already revoked, as the RFC asks.
+func (s *Service) revokeHandler(w http.ResponseWriter, r *http.Request) {
+	client := s.introspectionClient(w, r)
+	if client == nil {
+		return
+	}
+	tok := r.PostForm.Get("token")
+	if !slices.Contains(client.Scopes, ScopeIntrospect) {
+		info, err := s.introspect(r, tok)
+		if err != nil {
+			s.logger.Printf("revoke: %v", err)
+			writeOAuthError(w, http.StatusInternalServerError, "server_error", "")
+			return
+		}
+		if !info.Active {
+			w.WriteHeader(http.StatusOK)
+			return
+		}
+		if info.ClientID != client.ID {
+			writeOAuthError(w, http.StatusBadRequest, "unauthorized_client", "the token was not issued to this client")
+			return
+		}
+	}
+	userID, err := s.revokeToken(r, tok)
+	if err != nil {
+		s.logger.Printf("revoke: %v", err)
+		writeOAuthError(w, http.StatusInternalServerError, "server_error", "")
+		return
+	}
+	if userID != "" {
+		s.audit(r, audit.Event{Type: audit.SessionRevoke, UserID: userID, Reason: "token_revocation"})
+	}
+	w.WriteHeader(http.StatusOK)
+}
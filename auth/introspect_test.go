@@ -0,0 +1,163 @@
+package auth
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"auth-go-skd/data"
+	"auth-go-skd/store/memory"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+func TestIntrospectAndRevoke(t *testing.T) {
+	ctx := context.Background()
+	mem := memory.New()
+	hash, _ := bcrypt.GenerateFromPassword([]byte("password"), bcrypt.MinCost)
+	mem.CreateUser(ctx, &data.User{ID: "u1", Email: "a@example.com", PasswordHash: string(hash), Role: "user"})
+
+	s := New(Opts{URL: "http://localhost:8080", UserStore: mem, SessionStore: mem, ClientStore: mem, APIKeyStore: mem})
+	h, _ := s.Handlers()
+	client, secret, err := s.CreateClient(ctx, "resource-server", ScopeIntrospect)
+	if err != nil {
+		t.Fatal(err)
+	}
+	worker, workerSecret, err := s.CreateClient(ctx, "worker", "reports:read")
+	if err != nil {
+		t.Fatal(err)
+	}
+	spa, _, err := s.CreateRelyingParty(ctx, "spa", []string{"https://app.example/callback"}, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, apiKey, err := s.CreateAPIKey(ctx, "u1", "ci", []string{"reports:read"}, time.Time{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	post := func(path string, form url.Values, clientID, clientSecret string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, path, strings.NewReader(form.Encode()))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		if clientID != "" {
+			req.SetBasicAuth(clientID, clientSecret)
+		}
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+		return rec
+	}
+	introspect := func(t *testing.T, tok string) map[string]any {
+		t.Helper()
+		rec := post("/introspect", url.Values{"token": {tok}}, client.ID, secret)
+		if rec.Code != http.StatusOK {
+			t.Fatalf("introspect: %d %s", rec.Code, rec.Body)
+		}
+		var resp map[string]any
+		json.NewDecoder(rec.Body).Decode(&resp)
+		return resp
+	}
+	revoke := func(t *testing.T, tok string) {
+		t.Helper()
+		if rec := post("/revoke", url.Values{"token": {tok}}, client.ID, secret); rec.Code != http.StatusOK {
+			t.Fatalf("revoke: %d %s", rec.Code, rec.Body)
+		}
+	}
+
+	var login struct {
+		Token        string `json:"token"`
+		RefreshToken string `json:"refresh_token"`
+	}
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/login", jsonBody(`{"email":"a@example.com","password":"password"}`)))
+	json.NewDecoder(rec.Body).Decode(&login)
+	var clientToken tokenResponse
+	json.NewDecoder(post("/token", url.Values{"grant_type": {"client_credentials"}}, worker.ID, workerSecret).Body).Decode(&clientToken)
+
+	t.Run("Introspect", func(t *testing.T) {
+		for name, tc := range map[string]struct {
+			token, use, sub string
+		}{
+			"access":  {login.Token, "access", "u1"},
+			"refresh": {login.RefreshToken, "refresh", "u1"},
+			"api key": {apiKey, "api_key", "u1"},
+			"client":  {clientToken.AccessToken, "access", worker.ID},
+		} {
+			resp := introspect(t, tc.token)
+			if resp["active"] != true || resp["token_use"] != tc.use || resp["sub"] != tc.sub {
+				t.Errorf("%s: unexpected introspection %v", name, resp)
+			}
+		}
+		if resp := introspect(t, clientToken.AccessToken); resp["client_id"] != worker.ID || resp["scope"] != "reports:read" {
+			t.Errorf("client token: unexpected introspection %v", resp)
+		}
+		for _, tok := range []string{"garbage", "a.b.c", "ak_000000000000_nope"} {
+			if resp := introspect(t, tok); resp["active"] != false || len(resp) != 1 {
+				t.Errorf("%q: expected only active false, got %v", tok, resp)
+			}
+		}
+	})
+
+	t.Run("ClientAuth", func(t *testing.T) {
+		form := url.Values{"token": {login.Token}}
+		for path, rec := range map[string]*httptest.ResponseRecorder{
+			"no client":     post("/introspect", form, "", ""),
+			"wrong secret":  post("/introspect", form, client.ID, "wrong"),
+			"public client": post("/revoke", url.Values{"token": {login.Token}, "client_id": {spa.ID}}, "", ""),
+		} {
+			if rec.Code != http.StatusUnauthorized {
+				t.Errorf("%s: expected 401, got %d", path, rec.Code)
+			}
+		}
+		if rec := post("/introspect", url.Values{}, client.ID, secret); rec.Code != http.StatusBadRequest {
+			t.Errorf("missing token: expected 400, got %d", rec.Code)
+		}
+	})
+
+	t.Run("UnrelatedClient", func(t *testing.T) {
+		if rec := post("/introspect", url.Values{"token": {login.Token}}, worker.ID, workerSecret); rec.Code != http.StatusForbidden {
+			t.Errorf("introspect without the introspect scope: expected 403, got %d", rec.Code)
+		}
+		for name, tok := range map[string]string{"access": login.Token, "refresh": login.RefreshToken, "api key": apiKey} {
+			rec := post("/revoke", url.Values{"token": {tok}}, worker.ID, workerSecret)
+			if rec.Code != http.StatusBadRequest || !strings.Contains(rec.Body.String(), "unauthorized_client") {
+				t.Errorf("%s: expected unauthorized_client, got %d %s", name, rec.Code, rec.Body)
+			}
+			if resp := introspect(t, tok); resp["active"] != true {
+				t.Errorf("%s: a refused revocation should keep the token, got %v", name, resp)
+			}
+		}
+	})
+
+	t.Run("Revoke", func(t *testing.T) {
+		revoke(t, login.Token)
+		if resp := introspect(t, login.Token); resp["active"] != false {
+			t.Errorf("revoked access token should be inactive, got %v", resp)
+		}
+		if resp := introspect(t, login.RefreshToken); resp["active"] != true {
+			t.Errorf("revoking the access token should keep the refresh token, got %v", resp)
+		}
+
+		revoke(t, login.RefreshToken)
+		if resp := introspect(t, login.RefreshToken); resp["active"] != false {
+			t.Errorf("revoked refresh token should be inactive, got %v", resp)
+		}
+
+		revoke(t, apiKey)
+		if keys, _ := mem.ListAPIKeysByUser(ctx, "u1"); len(keys) != 0 {
+			t.Errorf("revoked api key should be deleted, got %d", len(keys))
+		}
+		revoke(t, "unknown")
+
+		if rec := post("/revoke", url.Values{"token": {clientToken.AccessToken}}, worker.ID, workerSecret); rec.Code != http.StatusOK {
+			t.Fatalf("revoking its own token: %d %s", rec.Code, rec.Body)
+		}
+		if resp := introspect(t, clientToken.AccessToken); resp["active"] != false {
+			t.Errorf("revoked client token should be inactive, got %v", resp)
+		}
+	})
+}
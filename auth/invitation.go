@@ -0,0 +1,293 @@
+package auth
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"auth-go-skd/data"
+	"auth-go-skd/mailer"
+	"auth-go-skd/store"
+	"auth-go-skd/token"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+)
+
+const (
+	// OrgRoleAdmin may invite members, like OrgRoleOwner.
+	OrgRoleAdmin = "admin"
+	// OrgRoleMember is the role of invitations that don't name one.
+	OrgRoleMember = "member"
+
+	inviteAudience = "org_invite"
+	// inviteCookie carries an invitation through an OAuth login.
+	inviteCookie = "invite"
+)
+
+var errInviteEmailMismatch = errors.New("invitation was sent to another email address")
+
+type inviteClaims struct {
+	OrgID string `json:"org"`
+	Email string `json:"email"`
+	jwt.RegisteredClaims
+}
+
+type createInviteRequest struct {
+	Email string `json:"email"`
+	Role  string `json:"role"`
+}
+
+type acceptInviteRequest struct {
+	Token string `json:"token"`
+}
+
+// inviteToken signs the token of inv that the invitation email links to.
+func (s *Service) inviteToken(r *http.Request, inv *data.Invitation) (string, error) {
+	claims := inviteClaims{
+		OrgID: inv.OrgID,
+		Email: inv.Email,
+		RegisteredClaims: jwt.RegisteredClaims{
+			ID:        inv.ID,
+			Issuer:    s.opts.Issuer,
+			Audience:  jwt.ClaimStrings{inviteAudience},
+			IssuedAt:  jwt.NewNumericDate(inv.CreatedAt),
+			ExpiresAt: jwt.NewNumericDate(inv.ExpiresAt),
+		},
+	}
+
+	secret, err := s.secretFor(r, "")
+	if err != nil {
+		return "", err
+	}
+	return jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString(secret)
+}
+
+// acceptInvite checks tokenStr and makes user a member of the invited organization. The
+// invitation must have been sent to the user's email address. A user who is already a member
+// keeps their role.
+func (s *Service) acceptInvite(r *http.Request, tokenStr string, user token.User) (*data.Membership, error) {
+	var claims inviteClaims
+	_, err := jwt.ParseWithClaims(tokenStr, &claims, func(t *jwt.Token) (interface{}, error) {
+		if _, ok := t.Method.(*jwt.SigningMethodHMAC); !ok {
+			return nil, fmt.Errorf("unexpected signing method: %v", t.Header["alg"])
+		}
+		return s.secretFor(r, "")
+	}, jwt.WithAudience(inviteAudience), jwt.WithExpirationRequired())
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", data.ErrInviteNotFound, err)
+	}
+	if normalizeEmail(user.Email) != claims.Email {
+		return nil, errInviteEmailMismatch
+	}
+
+	ctx := r.Context()
+	var m *data.Membership
+	err = s.inTx(ctx, func(tx store.Store) error {
+		inv, err := tx.GetInvitation(ctx, claims.ID)
+		if err != nil {
+			return err
+		}
+		now := time.Now()
+		if now.After(inv.ExpiresAt) {
+			return data.ErrInviteNotFound
+		}
+		if err := tx.AcceptInvitation(ctx, inv.ID, now); err != nil {
+			return err
+		}
+
+		m, err = tx.GetMembership(ctx, inv.OrgID, user.ID)
+		if !errors.Is(err, data.ErrMemberNotFound) {
+			return err
+		}
+		m = &data.Membership{OrgID: inv.OrgID, UserID: user.ID, Role: inv.Role, CreatedAt: now}
+		return tx.AddMember(ctx, m)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// loginInvite accepts the invitation a login request carries in the invite query parameter
+// or cookie, returning the claims that make its organization active. A bad invitation
+// doesn't fail the login.
+func (s *Service) loginInvite(w http.ResponseWriter, r *http.Request, user token.User) []token.ClaimSetter {
+	if s.opts.InvitationStore == nil || s.opts.MembershipStore == nil {
+		return nil
+	}
+	tokenStr := r.URL.Query().Get("invite")
+	if cookie, err := r.Cookie(inviteCookie); err == nil {
+		http.SetCookie(w, &http.Cookie{Name: inviteCookie, Value: "", Path: "/", Expires: time.Unix(0, 0), HttpOnly: true})
+		if tokenStr == "" {
+			tokenStr = cookie.Value
+		}
+	}
+	if tokenStr == "" {
+		return nil
+	}
+
+	m, err := s.acceptInvite(r, tokenStr, user)
+	if err != nil {
+		s.logger.Printf("login of %s: invitation not accepted: %v", user.ID, err)
+		return nil
+	}
+	return []token.ClaimSetter{orgClaims(m)}
+}
+
+// createInviteHandler invites an email address into the active organization and mails
+// the invitation link. Only owners can invite owners.
+func (s *Service) createInviteHandler(w http.ResponseWriter, r *http.Request) {
+	var req createInviteRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "invalid request body", http.StatusBadRequest)
+		return
+	}
+	email := normalizeEmail(req.Email)
+	if email == "" {
+		http.Error(w, "invalid email", http.StatusBadRequest)
+		return
+	}
+	switch req.Role {
+	case "":
+		req.Role = OrgRoleMember
+	case OrgRoleOwner, OrgRoleAdmin, OrgRoleMember:
+	default:
+		http.Error(w, "unknown role", http.StatusBadRequest)
+		return
+	}
+
+	claims, _ := token.GetClaims(r)
+	if req.Role == OrgRoleOwner && claims.OrgRole != OrgRoleOwner {
+		http.Error(w, "only owners can invite owners", http.StatusForbidden)
+		return
+	}
+
+	if !s.allowMail(w, r, email) {
+		return
+	}
+
+	now := time.Now()
+	inv := &data.Invitation{
+		ID:        uuid.NewString(),
+		OrgID:     claims.OrgID,
+		Email:     email,
+		Role:      req.Role,
+		InvitedBy: claims.User.ID,
+		ExpiresAt: now.Add(s.opts.InvitationTTL),
+		CreatedAt: now,
+	}
+	ctx := r.Context()
+	if err := s.opts.InvitationStore.CreateInvitation(ctx, inv); err != nil {
+		s.logger.Printf("create invitation: %v", err)
+		http.Error(w, "failed to create invitation", http.StatusInternalServerError)
+		return
+	}
+
+	if err := s.sendInvite(r, inv); err != nil {
+		s.logger.Printf("invitation: failed to send mail: %v", err)
+		if err := s.opts.InvitationStore.DeleteInvitation(ctx, inv.ID); err != nil {
+			s.logger.Printf("failed to remove invitation %s: %v", inv.ID, err)
+		}
+		http.Error(w, "failed to send invitation", http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(inv)
+}
+
+func (s *Service) sendInvite(r *http.Request, inv *data.Invitation) error {
+	tokenStr, err := s.inviteToken(r, inv)
+	if err != nil {
+		return err
+	}
+
+	orgName := "an organization"
+	if s.opts.OrganizationStore != nil {
+		if org, err := s.opts.OrganizationStore.GetOrganization(r.Context(), inv.OrgID); err == nil {
+			orgName = org.Name
+		}
+	}
+
+	link := s.opts.InvitationURL + "?token=" + url.QueryEscape(tokenStr)
+	if strings.Contains(s.opts.InvitationURL, "?") {
+		link = s.opts.InvitationURL + "&token=" + url.QueryEscape(tokenStr)
+	}
+	msg := mailer.Message{
+		To:      inv.Email,
+		Subject: "You're invited to join " + orgName,
+		Body: fmt.Sprintf("You have been invited to join %s as %s. The invitation expires on %s.\n\n%s\n",
+			orgName, inv.Role, inv.ExpiresAt.Format(time.RFC1123), link),
+	}
+	return s.opts.Mailer.Send(r.Context(), msg)
+}
+
+// listInvitesHandler returns the pending invitations of the active organization.
+func (s *Service) listInvitesHandler(w http.ResponseWriter, r *http.Request) {
+	claims, _ := token.GetClaims(r)
+	list, err := s.opts.InvitationStore.ListInvitationsByOrg(r.Context(), claims.OrgID)
+	if err != nil {
+		http.Error(w, "failed to list invitations", http.StatusInternalServerError)
+		return
+	}
+	if list == nil {
+		list = []data.Invitation{}
+	}
+	json.NewEncoder(w).Encode(list)
+}
+
+// revokeInviteHandler deletes a pending invitation of the active organization.
+func (s *Service) revokeInviteHandler(w http.ResponseWriter, r *http.Request) {
+	claims, _ := token.GetClaims(r)
+	ctx := r.Context()
+	inv, err := s.opts.InvitationStore.GetInvitation(ctx, chi.URLParam(r, "id"))
+	if err == nil && inv.OrgID != claims.OrgID {
+		err = data.ErrInviteNotFound
+	}
+	if err == nil {
+		err = s.opts.InvitationStore.DeleteInvitation(ctx, inv.ID)
+	}
+	if errors.Is(err, data.ErrInviteNotFound) {
+		http.Error(w, "invitation not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, "failed to revoke invitation", http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// acceptInviteHandler accepts an invitation for the current user and reissues the access
+// token with the organization active.
+func (s *Service) acceptInviteHandler(w http.ResponseWriter, r *http.Request) {
+	var req acceptInviteRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Token == "" {
+		http.Error(w, "invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	user := User(r)
+	m, err := s.acceptInvite(r, req.Token, user)
+	if errors.Is(err, errInviteEmailMismatch) {
+		http.Error(w, err.Error(), http.StatusForbidden)
+		return
+	}
+	if errors.Is(err, data.ErrInviteNotFound) {
+		http.Error(w, "invalid or expired invitation", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		s.logger.Printf("accept invitation: %v", err)
+		http.Error(w, "failed to accept invitation", http.StatusInternalServerError)
+		return
+	}
+
+	s.respondWithToken(w, r, user, currentSessionID(r), "", orgClaims(m))
+}
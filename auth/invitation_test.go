@@ -0,0 +1,162 @@
+package auth
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"auth-go-skd/data"
+	"auth-go-skd/mailer"
+	"auth-go-skd/store/memory"
+	"auth-go-skd/token"
+)
+
+func TestInvitations(t *testing.T) {
+	ctx := context.Background()
+	mem := memory.New()
+	mem.CreateOrganization(ctx, &data.Organization{ID: "acme", Name: "Acme", Slug: "acme"})
+	for _, u := range []data.User{{ID: "owner", Email: "owner@example.com"}, {ID: "bob", Email: "bob@example.com"}} {
+		mem.CreateUser(ctx, &u)
+	}
+	mem.AddMember(ctx, &data.Membership{OrgID: "acme", UserID: "owner", Role: OrgRoleOwner})
+
+	var sent []mailer.Message
+	s := New(Opts{
+		URL:               "http://localhost:8080",
+		UserStore:         mem,
+		IdentityStore:     mem,
+		MembershipStore:   mem,
+		OrganizationStore: mem,
+		InvitationStore:   mem,
+		Mailer: mailer.Func(func(_ context.Context, msg mailer.Message) error {
+			sent = append(sent, msg)
+			return nil
+		}),
+	})
+	h, _ := s.Handlers()
+
+	bearer := func(id, email, role string) string {
+		tok, err := s.Token(token.User{ID: id, Email: email}, func(c *token.Claims) error {
+			c.OrgID, c.OrgRole = "acme", role
+			return nil
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return tok
+	}
+	do := func(method, path, body, bearer string) *httptest.ResponseRecorder {
+		return doJSON(t, h, method, path, []byte(body), nil, bearer)
+	}
+	owner := bearer("owner", "owner@example.com", OrgRoleOwner)
+	invite := func(t *testing.T, email string) (data.Invitation, string) {
+		t.Helper()
+		rec := do(http.MethodPost, "/orgs/invitations", `{"email":"`+email+`"}`, owner)
+		if rec.Code != http.StatusCreated {
+			t.Fatalf("invite: %d %s", rec.Code, rec.Body)
+		}
+		var inv data.Invitation
+		json.NewDecoder(rec.Body).Decode(&inv)
+		msg := sent[len(sent)-1]
+		if msg.To != strings.ToLower(email) || !strings.Contains(msg.Subject, "Acme") {
+			t.Fatalf("unexpected mail: %+v", msg)
+		}
+		link := msg.Body[strings.Index(msg.Body, "http://"):]
+		u, _ := url.Parse(strings.TrimSpace(link))
+		return inv, u.Query().Get("token")
+	}
+
+	if rec := do(http.MethodPost, "/orgs/invitations", `{"email":"x@example.com"}`, bearer("bob", "bob@example.com", OrgRoleMember)); rec.Code != http.StatusForbidden {
+		t.Errorf("member inviting: expected 403, got %d", rec.Code)
+	}
+	if rec := do(http.MethodPost, "/orgs/invitations", `{"email":"x@example.com","role":"superuser"}`, bearer("bob", "bob@example.com", OrgRoleAdmin)); rec.Code != http.StatusBadRequest {
+		t.Errorf("unknown role: expected 400, got %d", rec.Code)
+	}
+	if rec := do(http.MethodPost, "/orgs/invitations", `{"email":"x@example.com","role":"owner"}`, bearer("bob", "bob@example.com", OrgRoleAdmin)); rec.Code != http.StatusForbidden {
+		t.Errorf("admin inviting an owner: expected 403, got %d", rec.Code)
+	}
+
+	t.Run("ExistingUser", func(t *testing.T) {
+		inv, tok := invite(t, "Bob@example.com")
+		if inv.Role != OrgRoleMember || inv.InvitedBy != "owner" {
+			t.Errorf("unexpected invitation: %+v", inv)
+		}
+		var list []data.Invitation
+		json.NewDecoder(do(http.MethodGet, "/orgs/invitations", "", owner).Body).Decode(&list)
+		if len(list) != 1 || list[0].ID != inv.ID {
+			t.Fatalf("list: got %+v", list)
+		}
+
+		if rec := do(http.MethodPost, "/invitations/accept", `{"token":"`+tok+`"}`, owner); rec.Code != http.StatusForbidden {
+			t.Errorf("accepting someone else's invitation: expected 403, got %d", rec.Code)
+		}
+		bob, _ := s.Token(token.User{ID: "bob", Email: "bob@example.com"})
+		rec := do(http.MethodPost, "/invitations/accept", `{"token":"`+tok+`"}`, bob)
+		if rec.Code != http.StatusOK {
+			t.Fatalf("accept: %d %s", rec.Code, rec.Body)
+		}
+		var resp struct {
+			Token string `json:"token"`
+		}
+		json.NewDecoder(rec.Body).Decode(&resp)
+		if claims, _ := s.ParseToken(resp.Token); claims.OrgID != "acme" || claims.OrgRole != OrgRoleMember {
+			t.Errorf("expected the organization to be active, got %q %q", claims.OrgID, claims.OrgRole)
+		}
+		if rec := do(http.MethodPost, "/invitations/accept", `{"token":"`+tok+`"}`, bob); rec.Code != http.StatusNotFound {
+			t.Errorf("second accept: expected 404, got %d", rec.Code)
+		}
+	})
+
+	t.Run("OAuthSignup", func(t *testing.T) {
+		_, tok := invite(t, "carol@example.com")
+		s.Add(fakeProvider{user: token.User{ID: "p-carol", Name: "Carol", Email: "carol@example.com"}})
+
+		rec := do(http.MethodGet, "/fake/login?invite="+url.QueryEscape(tok), "", "")
+		var cookie *http.Cookie
+		for _, c := range rec.Result().Cookies() {
+			if c.Name == inviteCookie {
+				cookie = c
+			}
+		}
+		if cookie == nil {
+			t.Fatal("expected the invitation to be kept in a cookie")
+		}
+
+		req := httptest.NewRequest(http.MethodGet, "/fake/callback?state=st&code=c", nil)
+		req.AddCookie(&http.Cookie{Name: "oauth_state", Value: "st"})
+		req.AddCookie(cookie)
+		rec = httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+		if rec.Code != http.StatusOK {
+			t.Fatalf("callback: %d %s", rec.Code, rec.Body)
+		}
+		var resp struct {
+			Token string     `json:"token"`
+			User  token.User `json:"user"`
+		}
+		json.NewDecoder(rec.Body).Decode(&resp)
+		if m, err := mem.GetMembership(ctx, "acme", resp.User.ID); err != nil || m.Role != OrgRoleMember {
+			t.Fatalf("expected a membership for the new user, got %+v (%v)", m, err)
+		}
+		if claims, _ := s.ParseToken(resp.Token); claims.OrgID != "acme" {
+			t.Errorf("expected the organization to be active, got %q", claims.OrgID)
+		}
+	})
+
+	t.Run("Revoke", func(t *testing.T) {
+		inv, tok := invite(t, "dave@example.com")
+		if rec := do(http.MethodDelete, "/orgs/invitations/"+inv.ID, "", owner); rec.Code != http.StatusNoContent {
+			t.Fatalf("revoke: %d %s", rec.Code, rec.Body)
+		}
+		if rec := do(http.MethodDelete, "/orgs/invitations/"+inv.ID, "", owner); rec.Code != http.StatusNotFound {
+			t.Errorf("second revoke: expected 404, got %d", rec.Code)
+		}
+		if _, err := s.acceptInvite(httptest.NewRequest(http.MethodPost, "/", nil), tok, token.User{ID: "bob", Email: "dave@example.com"}); err == nil {
+			t.Error("expected a revoked invitation to be rejected")
+		}
+	})
+}
@@ -0,0 +1,161 @@
+package auth
+
+import (
+	"context"
+	"encoding/json"
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+const (
+	lockoutBaseDelay = 500 * time.Millisecond
+	lockoutMaxDelay  = 30 * time.Second
+	// ipThresholdFactor lets one IP fail more often than one account before it is locked,
+	// since offices and NATs share addresses.
+	ipThresholdFactor = 4
+)
+
+// LockoutEvent is passed to Opts.OnLockout when an account or IP gets locked.
+type LockoutEvent struct {
+	Scope    string // "account" or "ip"
+	Subject  string // normalized email or client IP
+	Failures int
+	Until    time.Time
+}
+
+type unlockRequest struct {
+	Email string `json:"email"`
+	IP    string `json:"ip"`
+}
+
+// lockoutKeys returns the counters an attempt for email counts against. Attempts that name no
+// account, such as passkey logins, count against the client IP only.
+func lockoutKeys(r *http.Request, email string) map[string]string {
+	keys := map[string]string{"ip": "ip:" + clientIP(r)}
+	if email != "" {
+		keys["account"] = "acct:" + email
+	}
+	return keys
+}
+
+// checkLockout reports whether a login attempt for email may proceed. Attempts are keyed by the
+// submitted address whether or not an account exists, so responses don't reveal accounts.
+func (s *Service) checkLockout(w http.ResponseWriter, r *http.Request, email string) bool {
+	var until time.Time
+	for _, key := range lockoutKeys(r, email) {
+		t, err := s.opts.LockoutStore.GetLockedUntil(r.Context(), key)
+		if err != nil {
+			s.logger.Printf("lockout: %v", err)
+			continue
+		}
+		if t.After(until) {
+			until = t
+		}
+	}
+
+	if wait := time.Until(until); wait > 0 {
+		w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+		http.Error(w, "too many failed attempts, try again later", http.StatusTooManyRequests)
+		return false
+	}
+	return true
+}
+
+// loginFailed records a failed attempt for email and the client IP. Every failure delays the next
+// attempt exponentially; reaching the threshold locks for Opts.LockoutDuration.
+func (s *Service) loginFailed(r *http.Request, email string) {
+	ctx := r.Context()
+	for scope, key := range lockoutKeys(r, email) {
+		threshold := s.opts.LockoutThreshold
+		subject := email
+		if scope == "ip" {
+			threshold *= ipThresholdFactor
+			subject = clientIP(r)
+		}
+
+		failures, err := s.opts.LockoutStore.RegisterFailure(ctx, key, s.opts.LockoutDuration)
+		if err != nil {
+			s.logger.Printf("lockout: %v", err)
+			continue
+		}
+
+		if failures < 1 {
+			continue
+		}
+
+		var until time.Time
+		if failures >= threshold {
+			until = time.Now().Add(s.opts.LockoutDuration)
+		} else {
+			delay := lockoutMaxDelay
+			if failures <= 16 {
+				delay = min(lockoutBaseDelay<<(failures-1), lockoutMaxDelay)
+			}
+			until = time.Now().Add(delay)
+		}
+
+		if err := s.opts.LockoutStore.SetLockedUntil(ctx, key, until); err != nil {
+			s.logger.Printf("lockout: %v", err)
+			continue
+		}
+
+		if failures == threshold {
+			s.logger.Printf("lockout: %s %s locked until %s after %d failures", scope, subject, until.Format(time.RFC3339), failures)
+			if s.opts.OnLockout != nil {
+				s.opts.OnLockout(ctx, LockoutEvent{Scope: scope, Subject: subject, Failures: failures, Until: until})
+			}
+		}
+	}
+}
+
+// loginSucceeded clears the account counter. The IP counter is kept so one valid
+// account can't be used to reset guessing against others.
+func (s *Service) loginSucceeded(r *http.Request, email string) {
+	if email == "" {
+		return
+	}
+	if err := s.opts.LockoutStore.ResetFailures(r.Context(), lockoutKeys(r, email)["account"]); err != nil {
+		s.logger.Printf("lockout: %v", err)
+	}
+}
+
+// UnlockAccount clears failed attempts and any lock for the account with email.
+func (s *Service) UnlockAccount(ctx context.Context, email string) error {
+	return s.opts.LockoutStore.ResetFailures(ctx, "acct:"+normalizeEmail(email))
+}
+
+// UnlockIP clears failed attempts and any lock for the client IP ip.
+func (s *Service) UnlockIP(ctx context.Context, ip string) error {
+	return s.opts.LockoutStore.ResetFailures(ctx, "ip:"+ip)
+}
+
+// unlockHandler clears the lock of an account, an IP or both, as the request names them.
+func (s *Service) unlockHandler(w http.ResponseWriter, r *http.Request) {
+	var req unlockRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || (normalizeEmail(req.Email) == "" && req.IP == "") {
+		http.Error(w, "invalid request body", http.StatusBadRequest)
+		return
+	}
+	if req.IP != "" && net.ParseIP(req.IP) == nil {
+		http.Error(w, "invalid ip", http.StatusBadRequest)
+		return
+	}
+
+	ctx := r.Context()
+	if normalizeEmail(req.Email) != "" {
+		if err := s.UnlockAccount(ctx, req.Email); err != nil {
+			http.Error(w, "failed to unlock account", http.StatusInternalServerError)
+			return
+		}
+	}
+	if req.IP != "" {
+		if err := s.UnlockIP(ctx, req.IP); err != nil {
+			http.Error(w, "failed to unlock ip", http.StatusInternalServerError)
+			return
+		}
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,141 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+
+	"auth-go-skd/data"
+	"auth-go-skd/store/memory"
+	"auth-go-skd/token"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+func TestDirectLogin_Lockout(t *testing.T) {
+	users := memory.New()
+	hash, _ := bcrypt.GenerateFromPassword([]byte("correct-password"), bcrypt.MinCost)
+	users.CreateUser(context.Background(), &data.User{ID: "u1", Email: "a@example.com", PasswordHash: string(hash), Role: "user"})
+
+	lockouts := memory.New()
+	var events []LockoutEvent
+	s := New(Opts{
+		URL:              "http://localhost:8080",
+		UserStore:        users,
+		LockoutStore:     lockouts,
+		LockoutThreshold: 3,
+		OnLockout:        func(_ context.Context, e LockoutEvent) { events = append(events, e) },
+	})
+	h, _ := s.Handlers()
+
+	login := func(email, password string) int {
+		return doJSON(t, h, http.MethodPost, "/login", []byte(`{"email":"`+email+`","password":"`+password+`"}`), nil, "").Code
+	}
+	// skipDelay lets the next attempt through without waiting for the progressive delay.
+	skipDelay := func(email string) {
+		lockouts.SetLockedUntil(context.Background(), "acct:"+email, time.Time{})
+		lockouts.SetLockedUntil(context.Background(), "ip:192.0.2.1", time.Time{})
+	}
+
+	if code := login("a@example.com", "wrong"); code != http.StatusUnauthorized {
+		t.Fatalf("expected 401 for wrong password, got %d", code)
+	}
+	if code := login("a@example.com", "correct-password"); code != http.StatusTooManyRequests {
+		t.Fatalf("expected progressive delay after a failure, got %d", code)
+	}
+
+	for i := 0; i < 2; i++ {
+		skipDelay("a@example.com")
+		login("a@example.com", "wrong")
+	}
+	if len(events) != 1 || events[0].Scope != "account" || events[0].Subject != "a@example.com" {
+		t.Fatalf("expected one account lockout event, got %+v", events)
+	}
+	if code := login("a@example.com", "correct-password"); code != http.StatusTooManyRequests {
+		t.Fatalf("expected locked account, got %d", code)
+	}
+
+	// Unknown accounts are locked the same way
+	for i := 0; i < 3; i++ {
+		skipDelay("ghost@example.com")
+		if code := login("ghost@example.com", "wrong"); code != http.StatusUnauthorized {
+			t.Fatalf("expected 401 for unknown account, got %d", code)
+		}
+	}
+	if code := login("ghost@example.com", "wrong"); code != http.StatusTooManyRequests {
+		t.Errorf("expected unknown account to lock like a real one, got %d", code)
+	}
+
+	// Admin unlock
+	admin, _ := s.Token(token.User{ID: "admin", Attributes: map[string]interface{}{"role": "admin"}})
+	if code := doJSON(t, h, http.MethodPost, "/admin/unlock", []byte(`{"email":"a@example.com"}`), nil, admin).Code; code != http.StatusNoContent {
+		t.Fatalf("unlock: %d", code)
+	}
+	if code := login("a@example.com", "correct-password"); code != http.StatusTooManyRequests {
+		t.Fatalf("expected the IP to stay locked, got %d", code)
+	}
+	if code := doJSON(t, h, http.MethodPost, "/admin/unlock", []byte(`{"ip":"192.0.2.1"}`), nil, admin).Code; code != http.StatusNoContent {
+		t.Fatalf("unlock ip: %d", code)
+	}
+	if code := login("a@example.com", "correct-password"); code != http.StatusOK {
+		t.Errorf("expected login after unlock, got %d", code)
+	}
+}
+
+func TestAdminUnlock_RequiresAdmin(t *testing.T) {
+	s := New(Opts{URL: "http://localhost:8080"})
+	h, _ := s.Handlers()
+
+	user, _ := s.Token(token.User{ID: "u1", Attributes: map[string]interface{}{"role": "user"}})
+	if code := doJSON(t, h, http.MethodPost, "/admin/unlock", []byte(`{"email":"a@example.com"}`), nil, user).Code; code != http.StatusForbidden {
+		t.Errorf("expected 403 for non-admin, got %d", code)
+	}
+}
+
+// brokenUsers fails every user lookup, like a database outage.
+type brokenUsers struct{ *memory.Memory }
+
+func (brokenUsers) GetUserByEmail(context.Context, string) (*data.User, error) {
+	return nil, errors.New("connection refused")
+}
+
+func TestDirectLogin_StoreErrorIsNotAFailure(t *testing.T) {
+	lockouts := memory.New()
+	s := New(Opts{URL: "http://localhost:8080", UserStore: brokenUsers{memory.New()}, LockoutStore: lockouts, LockoutThreshold: 1})
+	h, _ := s.Handlers()
+
+	for i := 0; i < 2; i++ {
+		rec := doJSON(t, h, http.MethodPost, "/login", []byte(`{"email":"a@example.com","password":"password"}`), nil, "")
+		if rec.Code != http.StatusInternalServerError {
+			t.Fatalf("expected 500 on a store error, got %d", rec.Code)
+		}
+	}
+	if until, _ := lockouts.GetLockedUntil(context.Background(), "acct:a@example.com"); !until.IsZero() {
+		t.Errorf("store errors should not count as failures, locked until %s", until)
+	}
+}
+
+func TestPasskeyLogin_FailuresLockIP(t *testing.T) {
+	s := New(Opts{URL: "http://localhost:8080", CredentialStore: memory.New()})
+	h, _ := s.Handlers()
+
+	finish := func() int {
+		begin := doJSON(t, h, http.MethodPost, "/passkey/login/begin", nil, nil, "")
+		return doJSON(t, h, http.MethodPost, "/passkey/login/finish", []byte(`{}`), begin.Result().Cookies(), "").Code
+	}
+	if code := finish(); code != http.StatusUnauthorized {
+		t.Fatalf("invalid assertion: expected 401, got %d", code)
+	}
+	if code := finish(); code != http.StatusTooManyRequests {
+		t.Errorf("expected the failure to delay the next attempt, got %d", code)
+	}
+
+	if err := s.UnlockIP(context.Background(), "192.0.2.1"); err != nil {
+		t.Fatal(err)
+	}
+	if code := finish(); code != http.StatusUnauthorized {
+		t.Errorf("after unlock: expected 401, got %d", code)
+	}
+}
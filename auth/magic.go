@@ -0,0 +1,165 @@
+package auth
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/mail"
+	"net/url"
+	"strings"
+	"time"
+
+	"auth-go-skd/audit"
+	"auth-go-skd/data"
+	"auth-go-skd/mailer"
+	"auth-go-skd/store"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+)
+
+const magicLinkAudience = "magic_link"
+
+type magicClaims struct {
+	Email string `json:"email"`
+	jwt.RegisteredClaims
+}
+
+type magicRequest struct {
+	Email string `json:"email"`
+	// Invite is an invitation token to accept once the link is used.
+	Invite string `json:"invite,omitempty"`
+}
+
+// normalizeEmail lower-cases and validates an address, returning "" if it is not a plain address.
+func normalizeEmail(raw string) string {
+	addr, err := mail.ParseAddress(strings.TrimSpace(raw))
+	if err != nil || addr.Name != "" {
+		return ""
+	}
+	return strings.ToLower(addr.Address)
+}
+
+// magicLinkToken signs a single-use login token for email. The jti is kept in the
+// ChallengeStore until the link is used or expires.
+func (s *Service) magicLinkToken(r *http.Request, email string) (string, error) {
+	jti := uuid.NewString()
+	now := time.Now()
+
+	claims := magicClaims{
+		Email: email,
+		RegisteredClaims: jwt.RegisteredClaims{
+			ID:        jti,
+			Issuer:    s.opts.Issuer,
+			Audience:  jwt.ClaimStrings{magicLinkAudience},
+			IssuedAt:  jwt.NewNumericDate(now),
+			ExpiresAt: jwt.NewNumericDate(now.Add(s.opts.MagicLinkTTL)),
+		},
+	}
+
+	secret, err := s.secretFor(r, "")
+	if err != nil {
+		return "", err
+	}
+	tokenStr, err := jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString(secret)
+	if err != nil {
+		return "", err
+	}
+
+	if err := s.challenges.SaveChallenge(r.Context(), "magic:"+jti, []byte(email), s.opts.MagicLinkTTL); err != nil {
+		return "", err
+	}
+	return tokenStr, nil
+}
+
+// consumeMagicLink validates the token signature and marks it used, returning the email it was issued for.
+func (s *Service) consumeMagicLink(r *http.Request, tokenStr string) (string, error) {
+	var claims magicClaims
+	_, err := jwt.ParseWithClaims(tokenStr, &claims, func(t *jwt.Token) (interface{}, error) {
+		if _, ok := t.Method.(*jwt.SigningMethodHMAC); !ok {
+			return nil, fmt.Errorf("unexpected signing method: %v", t.Header["alg"])
+		}
+		return s.secretFor(r, "")
+	}, jwt.WithAudience(magicLinkAudience), jwt.WithExpirationRequired())
+	if err != nil {
+		return "", err
+	}
+
+	email, err := s.challenges.PopChallenge(r.Context(), "magic:"+claims.ID)
+	if err != nil {
+		return "", err
+	}
+	if string(email) != claims.Email {
+		return "", errors.New("magic link email mismatch")
+	}
+	return claims.Email, nil
+}
+
+func (s *Service) magicRequestHandler(w http.ResponseWriter, r *http.Request) {
+	var req magicRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	email := normalizeEmail(req.Email)
+	if email == "" {
+		http.Error(w, "invalid email", http.StatusBadRequest)
+		return
+	}
+
+	if !s.allowMail(w, r, email) {
+		return
+	}
+
+	tokenStr, err := s.magicLinkToken(r, email)
+	if err != nil {
+		http.Error(w, "failed to create login link", http.StatusInternalServerError)
+		return
+	}
+
+	link := s.authURL(r) + "/magic/verify?token=" + url.QueryEscape(tokenStr)
+	if req.Invite != "" {
+		link += "&invite=" + url.QueryEscape(req.Invite)
+	}
+	msg := mailer.Message{
+		To:      email,
+		Subject: "Your login link",
+		Body: fmt.Sprintf("Click the link below to sign in. It expires in %s and can be used once.\n\n%s\n",
+			s.opts.MagicLinkTTL, link),
+	}
+	if err := s.opts.Mailer.Send(r.Context(), msg); err != nil {
+		s.logger.Printf("magic link: failed to send mail: %v", err)
+		http.Error(w, "failed to send login link", http.StatusInternalServerError)
+		return
+	}
+
+	// Same response whether or not the account exists.
+	w.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(w).Encode(map[string]string{"status": "sent"})
+}
+
+func (s *Service) magicVerifyHandler(w http.ResponseWriter, r *http.Request) {
+	email, err := s.consumeMagicLink(r, r.URL.Query().Get("token"))
+	if err != nil {
+		if !errors.Is(err, data.ErrChallengeNotFound) {
+			s.logger.Printf("magic link: %v", err)
+		}
+		s.auditFailure(r, audit.Login, "magic", "", "invalid_link")
+		http.Error(w, "invalid or expired login link", http.StatusUnauthorized)
+		return
+	}
+
+	var u *data.User
+	err = s.inTx(r.Context(), func(tx store.Store) error {
+		u, err = s.findOrCreateUser(r, tx, email, "")
+		return err
+	})
+	if err != nil {
+		s.writeError(w, err, "failed to load user")
+		return
+	}
+
+	s.authorize(w, r, tokenUser(u), "magic")
+}
@@ -0,0 +1,116 @@
+package auth
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"regexp"
+	"testing"
+	"time"
+
+	"auth-go-skd/limiter"
+	"auth-go-skd/mailer"
+	"auth-go-skd/store/memory"
+)
+
+func TestMagicLink_RequestAndVerify(t *testing.T) {
+	var sent []mailer.Message
+	users := memory.New()
+	s := New(Opts{
+		Secret:    "test-secret-key-12345",
+		URL:       "http://localhost:8080",
+		UserStore: users,
+		Mailer: mailer.Func(func(_ context.Context, msg mailer.Message) error {
+			sent = append(sent, msg)
+			return nil
+		}),
+	})
+	h, _ := s.Handlers()
+
+	rec := doJSON(t, h, http.MethodPost, "/magic/request", []byte(`{"email":"New.User@Example.com"}`), nil, "")
+	if rec.Code != http.StatusAccepted {
+		t.Fatalf("request: %d %s", rec.Code, rec.Body)
+	}
+	if len(sent) != 1 || sent[0].To != "new.user@example.com" {
+		t.Fatalf("expected one mail to normalized address, got %+v", sent)
+	}
+
+	link := regexp.MustCompile(`http\S+`).FindString(sent[0].Body)
+	u, err := url.Parse(link)
+	if err != nil || u.Path != "/auth/magic/verify" {
+		t.Fatalf("unexpected link %q", link)
+	}
+
+	verify := func() *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/magic/verify?"+u.RawQuery, nil)
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+		return rec
+	}
+
+	rec = verify()
+	if rec.Code != http.StatusOK {
+		t.Fatalf("verify: %d %s", rec.Code, rec.Body)
+	}
+	if _, err := users.GetUserByEmail(context.Background(), "new.user@example.com"); err != nil {
+		t.Errorf("expected user to be created: %v", err)
+	}
+	if !bytes.Contains(rec.Body.Bytes(), []byte(`"token"`)) {
+		t.Errorf("expected token in response, got %s", rec.Body)
+	}
+
+	if rec = verify(); rec.Code != http.StatusUnauthorized {
+		t.Errorf("expected reused link to be rejected, got %d", rec.Code)
+	}
+}
+
+func TestMagicLink_RateLimited(t *testing.T) {
+	s := New(Opts{
+		URL:       "http://localhost:8080",
+		UserStore: memory.New(),
+		Mailer:    mailer.Func(func(context.Context, mailer.Message) error { return nil }),
+	})
+	h, _ := s.Handlers()
+
+	var last int
+	for i := 0; i < 6; i++ {
+		last = doJSON(t, h, http.MethodPost, "/magic/request", []byte(`{"email":"a@example.com"}`), nil, "").Code
+	}
+	if last != http.StatusTooManyRequests {
+		t.Errorf("expected 429 after repeated requests, got %d", last)
+	}
+}
+
+func TestMagicLink_ConfiguredQuota(t *testing.T) {
+	s := New(Opts{
+		URL:          "http://localhost:8080",
+		UserStore:    memory.New(),
+		Mailer:       mailer.Func(func(context.Context, mailer.Message) error { return nil }),
+		MailPerEmail: 1,
+		RateLimiter:  limiter.NewMemory(0.001, 2, time.Minute),
+	})
+	h, _ := s.Handlers()
+
+	request := func(email string) int {
+		return doJSON(t, h, http.MethodPost, "/magic/request", []byte(`{"email":"`+email+`"}`), nil, "").Code
+	}
+	if code := request("a@example.com"); code != http.StatusAccepted {
+		t.Fatalf("first request: %d", code)
+	}
+	if code := request("a@example.com"); code != http.StatusTooManyRequests {
+		t.Errorf("expected 429 once MailPerEmail is used up, got %d", code)
+	}
+
+	// The verify link is limited by Opts.RateLimiter too
+	var last int
+	for i := 0; i < 3; i++ {
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/magic/verify?token=guess", nil))
+		last = rec.Code
+	}
+	if last != http.StatusTooManyRequests {
+		t.Errorf("verify: expected 429 after repeated guesses, got %d", last)
+	}
+}
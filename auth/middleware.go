@@ -1,7 +1,9 @@
 package auth
 
 import (
+	"errors"
 	"net/http"
+	"slices"
 	"strings"
 
 	"auth-go-skd/token"
@@ -11,42 +13,207 @@ type Middleware struct {
 	service *Service
 }
 
+// requestToken reads the JWT from the cookie or the Authorization header.
+func requestToken(r *http.Request) string {
+	if cookie, err := r.Cookie("JWT"); err == nil && cookie.Value != "" {
+		return cookie.Value
+	}
+
+	reqToken := r.Header.Get("Authorization")
+	splitToken := strings.Split(reqToken, "Bearer ")
+	if len(splitToken) == 2 {
+		return splitToken[1]
+	}
+	return ""
+}
+
+// authMode selects which tokens auth accepts.
+type authMode int
+
+const (
+	authAny    authMode = iota // Auth
+	authUser                   // UserAuth
+	authScoped                 // ScopedAuth
+)
+
+// Auth accepts user tokens and, with Opts.ClientStore, client tokens (see token.SubjectClient).
+// Client tokens carry no user, so token.GetUserInfo fails for them; guard routes that act for
+// a user with UserAuth instead, and routes meant for clients with RequireScope. With
+// Opts.APIKeyStore, users' API keys are accepted too and resolved to their user. Access tokens
+// issued to OpenID Connect relying parties are refused; only ScopedAuth accepts them.
 func (m *Middleware) Auth(next http.Handler) http.Handler {
-	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+	return m.auth(next, authAny)
+}
 
-		var tokenStr string
+// UserAuth is Auth for routes that act on behalf of a signed-in user: it refuses client
+// tokens, API keys and the scoped tokens issued to OpenID Connect relying parties.
+func (m *Middleware) UserAuth(next http.Handler) http.Handler {
+	return m.auth(next, authUser)
+}
 
-		cookie, err := r.Cookie("JWT")
-		if err == nil {
-			tokenStr = cookie.Value
-		}
+// ScopedAuth is Auth followed by RequireScope(scopes...) that also accepts the access tokens
+// issued to OpenID Connect relying parties. Their audience is the relying party rather than
+// Opts.URL, so they only reach routes that name the scopes they need.
+func (m *Middleware) ScopedAuth(scopes ...string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return m.auth(m.RequireScope(scopes...)(next), authScoped)
+	}
+}
 
-		if tokenStr == "" {
-			reqToken := r.Header.Get("Authorization")
-			splitToken := strings.Split(reqToken, "Bearer ")
-			if len(splitToken) == 2 {
-				tokenStr = splitToken[1]
+func (m *Middleware) auth(next http.Handler, mode authMode) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+
+		if key := requestAPIKey(r); key != "" && m.service.opts.APIKeyStore != nil {
+			if mode == authUser {
+				http.Error(w, "Forbidden (API Key)", http.StatusForbidden)
+				return
+			}
+			claims, err := m.service.apiKeyClaims(r, key)
+			if errors.Is(err, errInvalidAPIKey) {
+				http.Error(w, "Unauthorized", http.StatusUnauthorized)
+				return
+			}
+			if err != nil {
+				m.service.writeError(w, err, "failed to check api key")
+				return
 			}
+			r = token.SetUserInfo(r, *claims.User)
+			next.ServeHTTP(w, token.SetClaims(r, *claims))
+			return
 		}
 
+		tokenStr := requestToken(r)
 		if tokenStr == "" {
 			http.Error(w, "Unauthorized", http.StatusUnauthorized)
 			return
 		}
 
-		claims, err := m.service.ParseToken(tokenStr)
+		claims, err := m.service.parseToken(r, tokenStr)
 		if err != nil {
 			http.Error(w, "Unauthorized", http.StatusUnauthorized)
 			return
 		}
 
+		if claims.SubjectType == token.SubjectClient {
+			if mode == authUser {
+				http.Error(w, "Forbidden (Client Token)", http.StatusForbidden)
+				return
+			}
+			if m.service.isRevoked(r.Context(), claims) {
+				http.Error(w, "Unauthorized", http.StatusUnauthorized)
+				return
+			}
+			next.ServeHTTP(w, token.SetClaims(r, *claims))
+			return
+		}
+
 		if claims.User == nil {
 			http.Error(w, "Unauthorized (No User)", http.StatusUnauthorized)
 			return
 		}
 
+		if mode == authUser && claims.Scope != "" {
+			http.Error(w, "Forbidden (Delegated Token)", http.StatusForbidden)
+			return
+		}
+		if mode != authScoped && !slices.Contains(claims.Audience, m.service.opts.URL) {
+			http.Error(w, "Forbidden (Relying Party Token)", http.StatusForbidden)
+			return
+		}
+
+		if m.service.isRevoked(r.Context(), claims) {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		if m.service.opts.CheckAccountStatus {
+			if err := m.service.checkAccount(r.Context(), claims.User.ID); err != nil {
+				m.service.writeError(w, err, "failed to check account")
+				return
+			}
+		}
+
 		r = token.SetUserInfo(r, *claims.User)
+		r = token.SetClaims(r, *claims)
 
 		next.ServeHTTP(w, r)
 	})
 }
+
+// RequireOrgRole allows only users whose active organization role is one of roles. Use after
+// Auth. The role is read from the token, so role changes apply once the token is reissued.
+func (m *Middleware) RequireOrgRole(roles ...string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			claims, err := token.GetClaims(r)
+			if err != nil {
+				http.Error(w, "Unauthorized", http.StatusUnauthorized)
+				return
+			}
+			if claims.OrgID == "" {
+				http.Error(w, "Forbidden (No Organization)", http.StatusForbidden)
+				return
+			}
+
+			for _, allowed := range roles {
+				if claims.OrgRole == allowed {
+					next.ServeHTTP(w, r)
+					return
+				}
+			}
+			http.Error(w, "Forbidden", http.StatusForbidden)
+		})
+	}
+}
+
+// RequireScope allows only tokens granted every one of scopes. Use after Auth, or use
+// ScopedAuth to serve OpenID Connect relying parties as well. User tokens carry no scopes, so
+// a route guarded by RequireScope serves clients, API keys and relying parties only. Users choose the
+// scopes of their API keys from Opts.APIKeyScopes, so keep scopes meant for machine clients
+// out of it.
+func (m *Middleware) RequireScope(scopes ...string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			claims, err := token.GetClaims(r)
+			if err != nil {
+				http.Error(w, "Unauthorized", http.StatusUnauthorized)
+				return
+			}
+			for _, scope := range scopes {
+				if !claims.HasScope(scope) {
+					http.Error(w, "Forbidden (Missing Scope)", http.StatusForbidden)
+					return
+				}
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// RequireRole allows only users whose "role" attribute is one of roles. Use after Auth.
+// Scoped tokens and API keys are refused: a scope limits what they may do, so they never
+// act with the user's full role.
+func (m *Middleware) RequireRole(roles ...string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			user, err := token.GetUserInfo(r)
+			if err != nil {
+				http.Error(w, "Unauthorized", http.StatusUnauthorized)
+				return
+			}
+			if claims, err := token.GetClaims(r); err == nil && (claims.SubjectType == token.SubjectAPIKey || claims.Scope != "") {
+				http.Error(w, "Forbidden (Scoped Token)", http.StatusForbidden)
+				return
+			}
+
+			role, _ := user.Attributes["role"].(string)
+			for _, allowed := range roles {
+				if role == allowed {
+					next.ServeHTTP(w, r)
+					return
+				}
+			}
+			http.Error(w, "Forbidden", http.StatusForbidden)
+		})
+	}
+}
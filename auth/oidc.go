@@ -0,0 +1,513 @@
+package auth
+
+import (
+	"context"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"time"
+
+	"auth-go-skd/data"
+	"auth-go-skd/token"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// OpenID Connect scopes. Relying parties created without scopes may request all three.
+const (
+	ScopeOpenID  = "openid"
+	ScopeProfile = "profile"
+	ScopeEmail   = "email"
+)
+
+const oidcCodePrefix = "oidc_code:"
+
+// ErrConsentDenied is returned by Opts.OIDCConsent when the user refuses the request; the
+// relying party then gets an access_denied error.
+var ErrConsentDenied = errors.New("consent denied")
+
+// ConsentRequest describes an authorization request awaiting the user's consent.
+type ConsentRequest struct {
+	Client *data.Client
+	User   token.User
+	Scopes []string
+}
+
+// authCode is what an authorization code stands for, kept in Opts.ChallengeStore until the
+// relying party redeems it.
+type authCode struct {
+	ClientID      string    `json:"client_id"`
+	UserID        string    `json:"user_id"`
+	RedirectURI   string    `json:"redirect_uri"`
+	Scope         string    `json:"scope"`
+	Nonce         string    `json:"nonce,omitempty"`
+	CodeChallenge string    `json:"code_challenge,omitempty"`
+	SessionID     string    `json:"sid,omitempty"`
+	AuthTime      time.Time `json:"auth_time"`
+}
+
+// userInfo holds the standard claims released for the granted scopes. The subject is added
+// by the id_token and /userinfo, which both need it under "sub".
+type userInfo struct {
+	Name          string `json:"name,omitempty"`
+	UpdatedAt     int64  `json:"updated_at,omitempty"`
+	Email         string `json:"email,omitempty"`
+	EmailVerified *bool  `json:"email_verified,omitempty"`
+}
+
+type idTokenClaims struct {
+	Nonce           string           `json:"nonce,omitempty"`
+	AuthTime        *jwt.NumericDate `json:"auth_time,omitempty"`
+	SessionID       string           `json:"sid,omitempty"`
+	AccessTokenHash string           `json:"at_hash,omitempty"`
+	userInfo
+	jwt.RegisteredClaims
+}
+
+type oidcMetadata struct {
+	Issuer                            string   `json:"issuer"`
+	AuthorizationEndpoint             string   `json:"authorization_endpoint"`
+	TokenEndpoint                     string   `json:"token_endpoint"`
+	UserinfoEndpoint                  string   `json:"userinfo_endpoint"`
+	JWKSURI                           string   `json:"jwks_uri"`
+	IntrospectionEndpoint             string   `json:"introspection_endpoint"`
+	RevocationEndpoint                string   `json:"revocation_endpoint"`
+	ResponseTypesSupported            []string `json:"response_types_supported"`
+	GrantTypesSupported               []string `json:"grant_types_supported"`
+	SubjectTypesSupported             []string `json:"subject_types_supported"`
+	IDTokenSigningAlgValuesSupported  []string `json:"id_token_signing_alg_values_supported"`
+	ScopesSupported                   []string `json:"scopes_supported"`
+	TokenEndpointAuthMethodsSupported []string `json:"token_endpoint_auth_methods_supported"`
+	CodeChallengeMethodsSupported     []string `json:"code_challenge_methods_supported"`
+	ClaimsSupported                   []string `json:"claims_supported"`
+}
+
+type jwk struct {
+	Kty string `json:"kty"`
+	Use string `json:"use"`
+	Alg string `json:"alg"`
+	Kid string `json:"kid"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+}
+
+// oidcEnabled reports whether the service acts as an OpenID Connect provider.
+func (s *Service) oidcEnabled() bool {
+	return s.opts.OIDCSigningKey != nil && s.opts.ClientStore != nil && s.opts.UserStore != nil
+}
+
+// keyID derives the JWKS key ID from the public key, so it changes when the key is rotated.
+func keyID(key *rsa.PublicKey) string {
+	der, err := x509.MarshalPKIXPublicKey(key)
+	if err != nil {
+		return ""
+	}
+	sum := sha256.Sum256(der)
+	return base64.RawURLEncoding.EncodeToString(sum[:12])
+}
+
+// CreateRelyingParty registers an OpenID Connect client that may redirect to the given absolute
+// URIs and returns it with its secret. Public clients, such as single-page and mobile apps, get
+// no secret and must use PKCE. Without scopes it may request openid, profile and email.
+func (s *Service) CreateRelyingParty(ctx context.Context, name string, redirectURIs []string, public bool, scopes ...string) (*data.Client, string, error) {
+	if len(redirectURIs) == 0 {
+		return nil, "", errors.New("relying party needs a redirect URI")
+	}
+	for _, uri := range redirectURIs {
+		u, err := url.Parse(uri)
+		if err != nil || !u.IsAbs() || u.Fragment != "" {
+			return nil, "", fmt.Errorf("invalid redirect URI %q", uri)
+		}
+	}
+	if len(scopes) == 0 {
+		scopes = []string{ScopeOpenID, ScopeProfile, ScopeEmail}
+	}
+	return s.createClient(ctx, &data.Client{Name: name, Scopes: scopes, RedirectURIs: redirectURIs}, !public)
+}
+
+// redirectParams sends the browser back to the relying party with params added to its redirect URI.
+func redirectParams(w http.ResponseWriter, r *http.Request, redirectURI string, params url.Values) {
+	u, err := url.Parse(redirectURI)
+	if err != nil {
+		http.Error(w, "invalid redirect_uri", http.StatusBadRequest)
+		return
+	}
+	q := u.Query()
+	for k, v := range params {
+		q[k] = v
+	}
+	u.RawQuery = q.Encode()
+	http.Redirect(w, r, u.String(), http.StatusFound)
+}
+
+// authorizingUser returns the claims of the signed-in user, or nil when the request carries no
+// valid user token. Tokens issued to relying parties don't count as a login.
+func (s *Service) authorizingUser(r *http.Request) (*token.Claims, error) {
+	claims, err := s.parseToken(r, requestToken(r))
+	if err != nil || claims.User == nil || claims.SubjectType != "" || claims.Scope != "" {
+		return nil, nil
+	}
+	if s.isRevoked(r.Context(), claims) {
+		return nil, nil
+	}
+	if err := s.checkAccount(r.Context(), claims.User.ID); err != nil {
+		if accountUnusable(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return claims, nil
+}
+
+// authTime is when the user logged in: the start of their session when it is known, else the
+// time their token was issued.
+func (s *Service) authTime(ctx context.Context, claims *token.Claims) time.Time {
+	if s.opts.SessionStore != nil && claims.SessionID != "" {
+		sessions, err := s.opts.SessionStore.ListSessionsByUser(ctx, claims.User.ID)
+		if err != nil {
+			s.logger.Printf("auth time: %v", err)
+		}
+		for _, sess := range sessions {
+			if sess.ID == claims.SessionID {
+				return sess.CreatedAt
+			}
+		}
+	}
+	if claims.IssuedAt != nil {
+		return claims.IssuedAt.Time
+	}
+	return time.Now()
+}
+
+// authorizeHandler is the OpenID Connect authorization endpoint for the authorization code
+// flow. Errors are shown to the user until client_id and redirect_uri are verified, and sent
+// back to the relying party after that. Signed-out users go to Opts.OIDCLoginURL, or get
+// login_required with prompt=none.
+func (s *Service) authorizeHandler(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, "invalid request", http.StatusBadRequest)
+		return
+	}
+	ctx := r.Context()
+
+	client, err := s.opts.ClientStore.GetClient(ctx, r.Form.Get("client_id"))
+	if errors.Is(err, data.ErrClientNotFound) {
+		http.Error(w, "unknown client", http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		s.logger.Printf("authorize: %v", err)
+		http.Error(w, "failed to load client", http.StatusInternalServerError)
+		return
+	}
+	redirectURI := r.Form.Get("redirect_uri")
+	if !slices.Contains(client.RedirectURIs, redirectURI) {
+		http.Error(w, "redirect_uri is not registered for this client", http.StatusBadRequest)
+		return
+	}
+
+	state := r.Form.Get("state")
+	fail := func(code, description string) {
+		params := url.Values{"error": {code}, "error_description": {description}}
+		if state != "" {
+			params.Set("state", state)
+		}
+		redirectParams(w, r, redirectURI, params)
+	}
+
+	if r.Form.Get("response_type") != "code" {
+		fail("unsupported_response_type", "only the code response type is supported")
+		return
+	}
+	scopes := strings.Fields(r.Form.Get("scope"))
+	if !slices.Contains(scopes, ScopeOpenID) {
+		fail("invalid_scope", "the openid scope is required")
+		return
+	}
+	for _, scope := range scopes {
+		if !slices.Contains(client.Scopes, scope) {
+			fail("invalid_scope", "scope "+scope+" is not allowed for this client")
+			return
+		}
+	}
+	challenge := r.Form.Get("code_challenge")
+	if challenge == "" && client.SecretHash == "" {
+		fail("invalid_request", "public clients must use PKCE")
+		return
+	}
+	if challenge != "" && r.Form.Get("code_challenge_method") != "S256" {
+		fail("invalid_request", "code_challenge_method must be S256")
+		return
+	}
+
+	claims, err := s.authorizingUser(r)
+	if err != nil {
+		s.logger.Printf("authorize: %v", err)
+		fail("server_error", "")
+		return
+	}
+	if claims == nil {
+		switch {
+		case r.Form.Get("prompt") == "none":
+			fail("login_required", "the user is not signed in")
+		case s.opts.OIDCLoginURL != "":
+			s.redirectToLogin(w, r)
+		default:
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		}
+		return
+	}
+
+	if s.opts.OIDCConsent != nil {
+		granted, err := s.opts.OIDCConsent(w, r, ConsentRequest{Client: client, User: *claims.User, Scopes: scopes})
+		if errors.Is(err, ErrConsentDenied) {
+			fail("access_denied", "the user denied the request")
+			return
+		}
+		if err != nil {
+			s.writeError(w, err, "failed to ask for consent")
+			return
+		}
+		if !granted {
+			// The hook wrote its own response, e.g. a consent page.
+			return
+		}
+	}
+
+	code := generateState()
+	grant, err := json.Marshal(authCode{
+		ClientID:      client.ID,
+		UserID:        claims.User.ID,
+		RedirectURI:   redirectURI,
+		Scope:         strings.Join(scopes, " "),
+		Nonce:         r.Form.Get("nonce"),
+		CodeChallenge: challenge,
+		SessionID:     claims.SessionID,
+		AuthTime:      s.authTime(ctx, claims),
+	})
+	if err == nil {
+		err = s.challenges.SaveChallenge(ctx, oidcCodePrefix+hashToken(code), grant, s.opts.OIDCCodeTTL)
+	}
+	if err != nil {
+		s.logger.Printf("authorize: %v", err)
+		fail("server_error", "")
+		return
+	}
+
+	params := url.Values{"code": {code}}
+	if state != "" {
+		params.Set("state", state)
+	}
+	redirectParams(w, r, redirectURI, params)
+}
+
+// redirectToLogin sends a signed-out user to Opts.OIDCLoginURL with a return_to parameter
+// that resumes the authorization request once they have logged in.
+func (s *Service) redirectToLogin(w http.ResponseWriter, r *http.Request) {
+	login, err := url.Parse(s.opts.OIDCLoginURL)
+	if err != nil {
+		s.logger.Printf("authorize: invalid login URL: %v", err)
+		http.Error(w, "invalid login URL", http.StatusInternalServerError)
+		return
+	}
+	q := login.Query()
+	q.Set("return_to", s.opts.OIDCIssuer+"/authorize?"+r.Form.Encode())
+	login.RawQuery = q.Encode()
+	http.Redirect(w, r, login.String(), http.StatusFound)
+}
+
+// pkceChallenge is the S256 code challenge for verifier (RFC 7636).
+func pkceChallenge(verifier string) string {
+	sum := sha256.Sum256([]byte(verifier))
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
+
+// authorizationCodeGrant redeems an authorization code for an access token and an id_token.
+// The access token is a user token limited to the granted scopes and tied to the user's
+// session, so logging out revokes it too; relying parties get no refresh token.
+func (s *Service) authorizationCodeGrant(w http.ResponseWriter, r *http.Request, client *data.Client) {
+	ctx := r.Context()
+	raw, err := s.challenges.PopChallenge(ctx, oidcCodePrefix+hashToken(r.PostForm.Get("code")))
+	if errors.Is(err, data.ErrChallengeNotFound) {
+		writeOAuthError(w, http.StatusBadRequest, "invalid_grant", "invalid or expired code")
+		return
+	}
+	var code authCode
+	if err == nil {
+		err = json.Unmarshal(raw, &code)
+	}
+	if err != nil {
+		s.logger.Printf("authorization code: %v", err)
+		writeOAuthError(w, http.StatusInternalServerError, "server_error", "")
+		return
+	}
+
+	if code.ClientID != client.ID || code.RedirectURI != r.PostForm.Get("redirect_uri") {
+		writeOAuthError(w, http.StatusBadRequest, "invalid_grant", "code was issued to another client or redirect_uri")
+		return
+	}
+	if code.CodeChallenge != "" && pkceChallenge(r.PostForm.Get("code_verifier")) != code.CodeChallenge {
+		writeOAuthError(w, http.StatusBadRequest, "invalid_grant", "code_verifier doesn't match")
+		return
+	}
+	if s.isRevoked(ctx, &token.Claims{SessionID: code.SessionID}) {
+		writeOAuthError(w, http.StatusBadRequest, "invalid_grant", "the user has logged out")
+		return
+	}
+	user, err := s.loadUser(ctx, code.UserID)
+	if err != nil {
+		if accountUnusable(err) {
+			writeOAuthError(w, http.StatusBadRequest, "invalid_grant", "the user can no longer sign in")
+			return
+		}
+		s.logger.Printf("authorization code: %v", err)
+		writeOAuthError(w, http.StatusInternalServerError, "server_error", "")
+		return
+	}
+
+	// The relying party is the audience, so Middleware.Auth won't take the token for a login.
+	accessToken, err := s.token(r, user, code.SessionID, func(c *token.Claims) error {
+		c.Scope = code.Scope
+		c.Audience = jwt.ClaimStrings{client.ID}
+		return nil
+	})
+	if err != nil {
+		s.logger.Printf("authorization code: %v", err)
+		writeOAuthError(w, http.StatusInternalServerError, "server_error", "")
+		return
+	}
+	idToken, err := s.idToken(ctx, code, accessToken)
+	if err != nil {
+		s.logger.Printf("authorization code: %v", err)
+		writeOAuthError(w, http.StatusInternalServerError, "server_error", "")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	json.NewEncoder(w).Encode(tokenResponse{
+		AccessToken: accessToken,
+		TokenType:   "Bearer",
+		ExpiresIn:   int(s.opts.TokenDuration.Seconds()),
+		Scope:       code.Scope,
+		IDToken:     idToken,
+	})
+}
+
+// idToken signs the id_token for a redeemed code with Opts.OIDCSigningKey.
+func (s *Service) idToken(ctx context.Context, code authCode, accessToken string) (string, error) {
+	info, err := s.userInfo(ctx, code.UserID, code.Scope)
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256([]byte(accessToken))
+	now := time.Now()
+	claims := idTokenClaims{
+		Nonce:           code.Nonce,
+		AuthTime:        jwt.NewNumericDate(code.AuthTime),
+		SessionID:       code.SessionID,
+		AccessTokenHash: base64.RawURLEncoding.EncodeToString(sum[:len(sum)/2]),
+		userInfo:        info,
+		RegisteredClaims: jwt.RegisteredClaims{
+			Issuer:    s.opts.OIDCIssuer,
+			Subject:   code.UserID,
+			Audience:  jwt.ClaimStrings{code.ClientID},
+			ExpiresAt: jwt.NewNumericDate(now.Add(s.opts.TokenDuration)),
+			IssuedAt:  jwt.NewNumericDate(now),
+		},
+	}
+	t := jwt.NewWithClaims(jwt.SigningMethodRS256, claims)
+	t.Header["kid"] = s.oidcKeyID
+	return t.SignedString(s.opts.OIDCSigningKey)
+}
+
+// userInfo loads the claims of userID released by the space-separated scopes.
+func (s *Service) userInfo(ctx context.Context, userID, scope string) (userInfo, error) {
+	u, err := s.opts.UserStore.GetUserByID(ctx, userID)
+	if err != nil {
+		return userInfo{}, err
+	}
+	scopes := strings.Fields(scope)
+	var info userInfo
+	if slices.Contains(scopes, ScopeProfile) {
+		info.Name = u.Name
+		if !u.UpdatedAt.IsZero() {
+			info.UpdatedAt = u.UpdatedAt.Unix()
+		}
+	}
+	if slices.Contains(scopes, ScopeEmail) {
+		verified := u.IsVerified
+		info.Email, info.EmailVerified = u.Email, &verified
+	}
+	return info, nil
+}
+
+// userInfoHandler returns the claims of the user an openid access token was issued for.
+func (s *Service) userInfoHandler(w http.ResponseWriter, r *http.Request) {
+	claims, err := token.GetClaims(r)
+	if err != nil || claims.User == nil || claims.SubjectType != "" {
+		http.Error(w, "Forbidden (No User)", http.StatusForbidden)
+		return
+	}
+	info, err := s.userInfo(r.Context(), claims.User.ID, claims.Scope)
+	if errors.Is(err, data.ErrUserNotFound) {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+	if err != nil {
+		s.logger.Printf("userinfo: %v", err)
+		http.Error(w, "failed to load user", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(struct {
+		Subject string `json:"sub"`
+		userInfo
+	}{claims.User.ID, info})
+}
+
+// discoveryHandler serves the OpenID Provider metadata.
+func (s *Service) discoveryHandler(w http.ResponseWriter, r *http.Request) {
+	issuer := s.opts.OIDCIssuer
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(oidcMetadata{
+		Issuer:                            issuer,
+		AuthorizationEndpoint:             issuer + "/authorize",
+		TokenEndpoint:                     issuer + "/token",
+		UserinfoEndpoint:                  issuer + "/userinfo",
+		JWKSURI:                           issuer + "/.well-known/jwks.json",
+		IntrospectionEndpoint:             issuer + "/introspect",
+		RevocationEndpoint:                issuer + "/revoke",
+		ResponseTypesSupported:            []string{"code"},
+		GrantTypesSupported:               []string{grantAuthorizationCode, grantClientCredentials},
+		SubjectTypesSupported:             []string{"public"},
+		IDTokenSigningAlgValuesSupported:  []string{jwt.SigningMethodRS256.Alg()},
+		ScopesSupported:                   []string{ScopeOpenID, ScopeProfile, ScopeEmail},
+		TokenEndpointAuthMethodsSupported: []string{"client_secret_basic", "client_secret_post", "none"},
+		CodeChallengeMethodsSupported:     []string{"S256"},
+		ClaimsSupported:                   []string{"sub", "iss", "aud", "exp", "iat", "auth_time", "nonce", "sid", "name", "updated_at", "email", "email_verified"},
+	})
+}
+
+// jwksHandler publishes the public key id_tokens are signed with.
+func (s *Service) jwksHandler(w http.ResponseWriter, r *http.Request) {
+	pub := s.opts.OIDCSigningKey.PublicKey
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string][]jwk{"keys": {{
+		Kty: "RSA",
+		Use: "sig",
+		Alg: jwt.SigningMethodRS256.Alg(),
+		Kid: s.oidcKeyID,
+		N:   base64.RawURLEncoding.EncodeToString(pub.N.Bytes()),
+		E:   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(pub.E)).Bytes()),
+	}}})
+}
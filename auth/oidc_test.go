@@ -0,0 +1,269 @@
+package auth
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"auth-go-skd/data"
+	"auth-go-skd/store/memory"
+
+	"github.com/golang-jwt/jwt/v5"
+	"golang.org/x/crypto/bcrypt"
+)
+
+func TestOpenIDConnect(t *testing.T) {
+	ctx := context.Background()
+	mem := memory.New()
+	hash, _ := bcrypt.GenerateFromPassword([]byte("password"), bcrypt.MinCost)
+	mem.CreateUser(ctx, &data.User{ID: "u1", Email: "a@example.com", Name: "Alice", PasswordHash: string(hash), Role: "user", IsVerified: true})
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var consent func(req ConsentRequest) (bool, error)
+	s := New(Opts{
+		URL:            "http://localhost:8080",
+		UserStore:      mem,
+		SessionStore:   mem,
+		ClientStore:    mem,
+		OIDCSigningKey: key,
+		OIDCLoginURL:   "http://localhost:8080/login",
+		OIDCConsent: func(w http.ResponseWriter, r *http.Request, req ConsentRequest) (bool, error) {
+			if consent == nil {
+				return true, nil
+			}
+			return consent(req)
+		},
+	})
+	h, _ := s.Handlers()
+
+	const callback = "https://app.example/callback"
+	web, secret, err := s.CreateRelyingParty(ctx, "web", []string{callback}, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	spa, _, err := s.CreateRelyingParty(ctx, "spa", []string{callback}, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := s.CreateRelyingParty(ctx, "bad", []string{"/relative"}, true); err == nil {
+		t.Error("expected relative redirect URIs to be refused")
+	}
+
+	var login struct {
+		Token string `json:"token"`
+	}
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/login", jsonBody(`{"email":"a@example.com","password":"password"}`)))
+	json.NewDecoder(rec.Body).Decode(&login)
+
+	authorize := func(params url.Values, signedIn bool) *url.URL {
+		t.Helper()
+		req := httptest.NewRequest(http.MethodGet, "/authorize?"+params.Encode(), nil)
+		if signedIn {
+			req.AddCookie(&http.Cookie{Name: "JWT", Value: login.Token})
+		}
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+		if rec.Code != http.StatusFound {
+			t.Fatalf("authorize: %d %s", rec.Code, rec.Body)
+		}
+		u, _ := url.Parse(rec.Header().Get("Location"))
+		return u
+	}
+	exchange := func(form url.Values, clientID, clientSecret string) *httptest.ResponseRecorder {
+		form.Set("grant_type", "authorization_code")
+		form.Set("redirect_uri", callback)
+		if clientSecret == "" {
+			form.Set("client_id", clientID)
+		}
+		req := httptest.NewRequest(http.MethodPost, "/token", strings.NewReader(form.Encode()))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		if clientSecret != "" {
+			req.SetBasicAuth(clientID, clientSecret)
+		}
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+		return rec
+	}
+	request := func(clientID string) url.Values {
+		return url.Values{
+			"response_type": {"code"},
+			"client_id":     {clientID},
+			"redirect_uri":  {callback},
+			"scope":         {"openid email"},
+			"state":         {"xyz"},
+			"nonce":         {"n-1"},
+		}
+	}
+
+	t.Run("CodeFlow", func(t *testing.T) {
+		loc := authorize(request(web.ID), true)
+		code := loc.Query().Get("code")
+		if code == "" || loc.Query().Get("state") != "xyz" {
+			t.Fatalf("expected a code and the state, got %s", loc)
+		}
+
+		rec := exchange(url.Values{"code": {code}}, web.ID, secret)
+		if rec.Code != http.StatusOK {
+			t.Fatalf("token: %d %s", rec.Code, rec.Body)
+		}
+		var resp tokenResponse
+		json.NewDecoder(rec.Body).Decode(&resp)
+		if resp.Scope != "openid email" || resp.IDToken == "" {
+			t.Fatalf("unexpected token response: %+v", resp)
+		}
+
+		var claims idTokenClaims
+		_, err := jwt.ParseWithClaims(resp.IDToken, &claims, func(*jwt.Token) (interface{}, error) {
+			return &key.PublicKey, nil
+		}, jwt.WithValidMethods([]string{"RS256"}), jwt.WithAudience(web.ID), jwt.WithIssuer("http://localhost:8080/auth"))
+		if err != nil {
+			t.Fatalf("id_token: %v", err)
+		}
+		if claims.Subject != "u1" || claims.Nonce != "n-1" || claims.Email != "a@example.com" || claims.Name != "" ||
+			claims.EmailVerified == nil || !*claims.EmailVerified || claims.SessionID == "" || claims.AuthTime == nil {
+			t.Errorf("unexpected id_token claims: %+v", claims)
+		}
+
+		if rec := exchange(url.Values{"code": {code}}, web.ID, secret); rec.Code != http.StatusBadRequest {
+			t.Errorf("codes must be single use, got %d", rec.Code)
+		}
+
+		req := httptest.NewRequest(http.MethodGet, "/userinfo", nil)
+		req.Header.Set("Authorization", "Bearer "+resp.AccessToken)
+		rec = httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+		if rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), `"sub":"u1"`) || !strings.Contains(rec.Body.String(), `"email":"a@example.com"`) {
+			t.Errorf("userinfo: %d %s", rec.Code, rec.Body)
+		}
+
+		req = httptest.NewRequest(http.MethodGet, "/account/export", nil)
+		req.Header.Set("Authorization", "Bearer "+resp.AccessToken)
+		rec = httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+		if rec.Code != http.StatusForbidden {
+			t.Errorf("relying party tokens should not reach user routes, got %d", rec.Code)
+		}
+
+		m := s.Middleware()
+		ok := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
+		for name, tc := range map[string]struct {
+			h    http.Handler
+			want int
+		}{
+			"Auth":                    {m.Auth(ok), http.StatusForbidden},
+			"ScopedAuth":              {m.ScopedAuth(ScopeEmail)(ok), http.StatusOK},
+			"ScopedAuth, other scope": {m.ScopedAuth("reports:read")(ok), http.StatusForbidden},
+		} {
+			req := httptest.NewRequest(http.MethodGet, "/api", nil)
+			req.Header.Set("Authorization", "Bearer "+resp.AccessToken)
+			rec := httptest.NewRecorder()
+			tc.h.ServeHTTP(rec, req)
+			if rec.Code != tc.want {
+				t.Errorf("%s: expected %d, got %d", name, tc.want, rec.Code)
+			}
+		}
+
+		form := url.Values{"token": {resp.AccessToken}}
+		req = httptest.NewRequest(http.MethodPost, "/revoke", strings.NewReader(form.Encode()))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		req.SetBasicAuth(web.ID, secret)
+		rec = httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+		if rec.Code != http.StatusOK {
+			t.Errorf("relying parties should revoke their own tokens, got %d %s", rec.Code, rec.Body)
+		}
+		req = httptest.NewRequest(http.MethodGet, "/userinfo", nil)
+		req.Header.Set("Authorization", "Bearer "+resp.AccessToken)
+		rec = httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+		if rec.Code != http.StatusUnauthorized {
+			t.Errorf("revoked token: expected 401 from userinfo, got %d", rec.Code)
+		}
+	})
+
+	t.Run("PKCE", func(t *testing.T) {
+		params := request(spa.ID)
+		if loc := authorize(params, true); loc.Query().Get("error") != "invalid_request" {
+			t.Fatalf("public clients must use PKCE, got %s", loc)
+		}
+
+		params.Set("code_challenge", pkceChallenge("verifier"))
+		params.Set("code_challenge_method", "S256")
+		code := authorize(params, true).Query().Get("code")
+		if rec := exchange(url.Values{"code": {code}, "code_verifier": {"wrong"}}, spa.ID, ""); rec.Code != http.StatusBadRequest {
+			t.Errorf("wrong verifier: expected 400, got %d", rec.Code)
+		}
+		code = authorize(params, true).Query().Get("code")
+		if rec := exchange(url.Values{"code": {code}, "code_verifier": {"verifier"}}, spa.ID, ""); rec.Code != http.StatusOK {
+			t.Errorf("public client: %d %s", rec.Code, rec.Body)
+		}
+	})
+
+	t.Run("Errors", func(t *testing.T) {
+		params := request(web.ID)
+		params.Set("redirect_uri", "https://evil.example/callback")
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/authorize?"+params.Encode(), nil))
+		if rec.Code != http.StatusBadRequest {
+			t.Errorf("unregistered redirect_uri: expected 400, got %d", rec.Code)
+		}
+
+		loc := authorize(request(web.ID), false)
+		if loc.Host != "localhost:8080" || !strings.Contains(loc.Query().Get("return_to"), "/auth/authorize?") {
+			t.Errorf("signed-out users should be sent to the login page, got %s", loc)
+		}
+		params = request(web.ID)
+		params.Set("prompt", "none")
+		if loc := authorize(params, false); loc.Query().Get("error") != "login_required" {
+			t.Errorf("prompt=none: expected login_required, got %s", loc)
+		}
+
+		params = request(web.ID)
+		params.Set("scope", "openid admin")
+		if loc := authorize(params, true); loc.Query().Get("error") != "invalid_scope" {
+			t.Errorf("expected invalid_scope, got %s", loc)
+		}
+
+		consent = func(req ConsentRequest) (bool, error) {
+			if req.Client.ID != web.ID || req.User.ID != "u1" || len(req.Scopes) != 2 {
+				t.Errorf("unexpected consent request: %+v", req)
+			}
+			return false, ErrConsentDenied
+		}
+		defer func() { consent = nil }()
+		if loc := authorize(request(web.ID), true); loc.Query().Get("error") != "access_denied" || loc.Query().Get("state") != "xyz" {
+			t.Errorf("expected access_denied, got %s", loc)
+		}
+	})
+
+	t.Run("Discovery", func(t *testing.T) {
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/.well-known/openid-configuration", nil))
+		var meta oidcMetadata
+		json.NewDecoder(rec.Body).Decode(&meta)
+		if meta.Issuer != "http://localhost:8080/auth" || meta.TokenEndpoint != "http://localhost:8080/auth/token" ||
+			meta.JWKSURI != "http://localhost:8080/auth/.well-known/jwks.json" {
+			t.Errorf("unexpected metadata: %+v", meta)
+		}
+
+		rec = httptest.NewRecorder()
+		h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/.well-known/jwks.json", nil))
+		var jwks struct {
+			Keys []jwk `json:"keys"`
+		}
+		json.NewDecoder(rec.Body).Decode(&jwks)
+		if len(jwks.Keys) != 1 || jwks.Keys[0].Kid != keyID(&key.PublicKey) || jwks.Keys[0].E != "AQAB" {
+			t.Errorf("unexpected jwks: %+v", jwks)
+		}
+	})
+}
@@ -1,9 +1,18 @@
 package auth
 
 import (
+	"context"
+	"crypto/rsa"
+	"net/http"
 	"time"
 
+	"auth-go-skd/audit"
 	"auth-go-skd/avatar"
+	"auth-go-skd/data"
+	"auth-go-skd/limiter"
+	"auth-go-skd/mailer"
+	"auth-go-skd/provider"
+	"auth-go-skd/store"
 	"auth-go-skd/token"
 )
 
@@ -18,4 +27,157 @@ type Opts struct {
 	AvatarStore    avatar.Store
 	Validator      token.Validator
 	DisableXSRF    bool
+
+	// MaxTokenSize is the largest signed access token, in bytes, so it fits in a cookie.
+	// Issuing a larger token fails with token.ErrTokenTooLarge. Default 4000.
+	MaxTokenSize int
+
+	// RateLimiter throttles the login, refresh and passwordless routes, see limiter.New.
+	RateLimiter limiter.Limiter
+	// MailLimiter builds the hourly quotas on login and invitation emails; defaults to in-memory
+	// limiters. Pass limiter.NewFactory(rdb) to share them between instances.
+	MailLimiter limiter.Factory
+	// MailPerEmail is how many emails one address may be sent per hour. Default 5.
+	MailPerEmail int
+	// MailPerIP is how many emails one client IP may request per hour. Default 20.
+	MailPerIP int
+
+	// UserStore resolves users for passwordless logins. Optional for OAuth-only setups.
+	UserStore store.UserStorage
+	// CheckAccountStatus makes Middleware.Auth look the user up in UserStore on every request
+	// and refuse blocked, deleted and removed accounts before their tokens expire, so OAuth logins
+	// need an IdentityStore to keep working. Logins and refreshes always check.
+	CheckAccountStatus bool
+	// DeletedUserRetention is how long soft-deleted users are kept before
+	// Service.PurgeDeletedUsers removes them for good. Default 30 days.
+	DeletedUserRetention time.Duration
+	// UserPurgeInterval is how often Service.RunUserPurge purges. Default 1 hour.
+	UserPurgeInterval time.Duration
+	// Roles are the user roles the admin API may assign. Default "user" and "admin".
+	Roles []string
+	// IdentityStore links OAuth logins to users in UserStore. With both set, the first OAuth login
+	// creates the user and its identity, in one transaction when UserStore is a store.Transactor.
+	IdentityStore store.IdentityStorage
+	// MembershipStore enables organization switching (/orgs, /orgs/switch) and the active-org
+	// claims checked by Middleware.RequireOrgRole.
+	MembershipStore store.MembershipStorage
+	// OrganizationStore enables creating organizations (together with MembershipStore) and
+	// adds organization details to GET /orgs.
+	OrganizationStore store.OrganizationStorage
+	// InvitationStore enables inviting users into the active organization (together with
+	// MembershipStore and Mailer). Invitations are accepted at /invitations/accept or by passing
+	// ?invite=<token> to any login route; memberships reference users by ID, so it needs UserStore.
+	InvitationStore store.InvitationStorage
+	// InvitationTTL is how long an invitation stays valid. Default 7 days.
+	InvitationTTL time.Duration
+	// InvitationURL is the page invitation emails link to, with the token in the token query
+	// parameter. Default URL + "/invite".
+	InvitationURL string
+
+	// CredentialStore enables passkey (WebAuthn) routes when set.
+	CredentialStore store.CredentialStorage
+	// ChallengeStore keeps ceremony challenges; defaults to an in-memory store.
+	ChallengeStore store.ChallengeStorage
+
+	// Mailer enables magic-link login (together with UserStore) when set.
+	Mailer mailer.Mailer
+	// MagicLinkTTL is how long an emailed login link stays valid. Default 15 minutes.
+	MagicLinkTTL time.Duration
+
+	// CodeStore enables one-time email code login (together with Mailer and UserStore).
+	CodeStore store.CodeStorage
+	// CodeTTL is how long an emailed code stays valid. Default 10 minutes.
+	CodeTTL time.Duration
+	// CodeMaxAttempts invalidates a code after this many verification attempts. Default 5.
+	CodeMaxAttempts int
+
+	// SessionStore enables refresh tokens; every login then returns a token pair.
+	// Sessions reference users by ID, so it needs logins backed by UserStore.
+	SessionStore store.SessionStorage
+	// RefreshTokenDuration is the refresh token lifetime. Default 30 days.
+	RefreshTokenDuration time.Duration
+	// RevocationStore remembers logged-out tokens and revoked sessions; defaults to an in-memory store.
+	// Use a shared store (e.g. Redis) when running several instances.
+	RevocationStore store.RevocationStorage
+
+	// ClientStore enables the client_credentials grant at POST /token for machine clients,
+	// see Service.CreateClient. Their tokens are accepted by Middleware.Auth. It also keeps the
+	// relying parties of OIDCSigningKey. Confidential clients may revoke (POST /revoke) the tokens
+	// issued to them; those with ScopeIntrospect may introspect (POST /introspect) and revoke
+	// any access token, refresh token or API key.
+	ClientStore store.ClientStorage
+	// ClientTokenDuration is the lifetime of client tokens. Deleting a client stops new
+	// tokens, but issued ones stay valid until they expire. Default 1 hour.
+	ClientTokenDuration time.Duration
+
+	// OIDCSigningKey makes the service an OpenID Connect provider (together with ClientStore and
+	// UserStore) for relying parties created with Service.CreateRelyingParty: it serves
+	// /authorize, the authorization_code grant at /token, /userinfo and the discovery and JWKS
+	// documents under /.well-known. id_tokens are signed with it (RS256); access tokens are
+	// signed like every other user token, carry the granted scopes and have the relying party as
+	// their audience, so only Middleware.ScopedAuth accepts them.
+	OIDCSigningKey *rsa.PrivateKey
+	// OIDCIssuer is the issuer of id_tokens and the base of the advertised endpoints, i.e. where
+	// Handlers are mounted. Default URL + "/auth".
+	OIDCIssuer string
+	// OIDCLoginURL is the login page signed-out users are sent to from /authorize, with the
+	// request to resume in the return_to query parameter. Without it they get a 401.
+	OIDCLoginURL string
+	// OIDCConsent asks the signed-in user to approve a relying party's request. Return true to
+	// issue the code, ErrConsentDenied to refuse, or false after writing a response yourself,
+	// e.g. a consent page that submits back to /authorize. Without it consent is implied.
+	OIDCConsent func(w http.ResponseWriter, r *http.Request, req ConsentRequest) (bool, error)
+	// OIDCCodeTTL is how long an authorization code can be redeemed. Default 1 minute.
+	OIDCCodeTTL time.Duration
+
+	// APIKeyStore enables users' API keys: /api-keys lists, creates and revokes them, and
+	// Middleware.Auth accepts them in the X-API-Key header or as a bearer token.
+	APIKeyStore store.APIKeyStorage
+	// APIKeyScopes are the scopes users may give their API keys at POST /api-keys; other scopes
+	// are refused, so users can't mint keys for routes meant for machine clients. Without it keys
+	// carry no scopes. Service.CreateAPIKey doesn't check it.
+	APIKeyScopes []string
+
+	// LockoutStore keeps failed login counters; defaults to an in-memory store.
+	LockoutStore store.LockoutStorage
+	// LockoutThreshold locks an account after this many failures. Default 5. Failed passkey
+	// logins name no account, so they count only toward the client IP's lock.
+	LockoutThreshold int
+	// LockoutDuration is how long a lock lasts and how long failures are remembered. Default 15 minutes.
+	LockoutDuration time.Duration
+	// OnLockout is called when an account or IP gets locked.
+	OnLockout func(ctx context.Context, e LockoutEvent)
+
+	// TenantStore enables per-tenant providers and signing secrets, chosen by host name or path
+	// prefix. Providers added with Service.Add remain available to every tenant. Logins through a
+	// tenant's providers are limited to emails in its VerifiedDomains.
+	TenantStore store.TenantStorage
+	// TenantReloadInterval is how often Service.WatchTenants reloads TenantStore. Default 1 minute.
+	TenantReloadInterval time.Duration
+	// ProviderFactory builds tenant providers from their configuration. Default DefaultProviderFactory.
+	ProviderFactory func(ctx context.Context, cfg data.ProviderConfig) (provider.Provider, error)
+
+	// AuditSink receives login, logout, refresh and credential events when set. Sinks that
+	// implement audit.Querier also enable GET /admin/audit.
+	AuditSink audit.Sink
+
+	// Hooks run custom logic during logins and token issuance. Returning an error aborts the
+	// flow: a *HookError (see Reject) answers with its status and message, any other error with 500.
+
+	// BeforeLogin runs once a user has authenticated, before a session or token is issued.
+	BeforeLogin func(ctx context.Context, r *http.Request, user token.User) error
+	// AfterLogin runs after the session is created, before the response is written.
+	// Aborting deletes the session.
+	AfterLogin func(ctx context.Context, r *http.Request, user token.User) error
+	// OnUserCreated runs when a passwordless or OAuth login creates a user. Aborting removes
+	// the user again, so it can reject signups, e.g. by email domain. It runs inside the
+	// transaction that creates the user: provisioning must write through tx, as the configured
+	// stores may be locked until it returns. Stores that aren't configured are nil in tx.
+	OnUserCreated func(ctx context.Context, r *http.Request, tx store.Store, user *data.User) error
+	// ClaimsEnricher can change the claims of every user access token before it is signed, e.g. to
+	// add custom claims with token.Key. r is nil for tokens issued through Service.Token.
+	ClaimsEnricher func(ctx context.Context, r *http.Request, claims *token.Claims) error
+	// OnLogout runs before a logout revokes the token and its session. Its error is logged; the
+	// logout goes ahead regardless.
+	OnLogout func(ctx context.Context, r *http.Request, user token.User) error
 }
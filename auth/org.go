@@ -0,0 +1,143 @@
+package auth
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"regexp"
+	"time"
+
+	"auth-go-skd/data"
+	"auth-go-skd/store"
+	"auth-go-skd/token"
+
+	"github.com/google/uuid"
+)
+
+// OrgRoleOwner is the role of the user who creates an organization.
+const OrgRoleOwner = "owner"
+
+var slugPattern = regexp.MustCompile(`^[a-z0-9](?:[a-z0-9-]{0,61}[a-z0-9])?$`)
+
+type orgResponse struct {
+	ID     string `json:"id"`
+	Name   string `json:"name,omitempty"`
+	Slug   string `json:"slug,omitempty"`
+	Role   string `json:"role"`
+	Active bool   `json:"active"`
+}
+
+type createOrgRequest struct {
+	Name string `json:"name"`
+	Slug string `json:"slug"`
+}
+
+type switchOrgRequest struct {
+	OrgID string `json:"org_id"`
+}
+
+// orgClaims sets the active-organization claims from m.
+func orgClaims(m *data.Membership) token.ClaimSetter {
+	return func(c *token.Claims) error {
+		c.OrgID, c.OrgRole = m.OrgID, m.Role
+		return nil
+	}
+}
+
+// listOrgsHandler returns the organizations the current user belongs to.
+func (s *Service) listOrgsHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	memberships, err := s.opts.MembershipStore.ListMembershipsByUser(ctx, User(r).ID)
+	if err != nil {
+		http.Error(w, "failed to list organizations", http.StatusInternalServerError)
+		return
+	}
+
+	var active string
+	if claims, err := token.GetClaims(r); err == nil {
+		active = claims.OrgID
+	}
+
+	resp := make([]orgResponse, 0, len(memberships))
+	for _, m := range memberships {
+		o := orgResponse{ID: m.OrgID, Role: m.Role, Active: m.OrgID == active}
+		if s.opts.OrganizationStore != nil {
+			org, err := s.opts.OrganizationStore.GetOrganization(ctx, m.OrgID)
+			if err != nil {
+				http.Error(w, "failed to list organizations", http.StatusInternalServerError)
+				return
+			}
+			o.Name, o.Slug = org.Name, org.Slug
+		}
+		resp = append(resp, o)
+	}
+	json.NewEncoder(w).Encode(resp)
+}
+
+// createOrgHandler creates an organization owned by the current user.
+func (s *Service) createOrgHandler(w http.ResponseWriter, r *http.Request) {
+	var req createOrgRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Name == "" || !slugPattern.MatchString(req.Slug) {
+		http.Error(w, "invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	now := time.Now()
+	org := &data.Organization{ID: uuid.NewString(), Name: req.Name, Slug: req.Slug, CreatedAt: now, UpdatedAt: now}
+	err := s.inTx(r.Context(), func(tx store.Store) error {
+		if err := tx.CreateOrganization(r.Context(), org); err != nil {
+			return err
+		}
+		return tx.AddMember(r.Context(), &data.Membership{OrgID: org.ID, UserID: User(r).ID, Role: OrgRoleOwner, CreatedAt: now})
+	})
+	if errors.Is(err, data.ErrConflict) {
+		http.Error(w, "slug already taken", http.StatusConflict)
+		return
+	}
+	if err != nil {
+		s.logger.Printf("create organization: %v", err)
+		http.Error(w, "failed to create organization", http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(org)
+}
+
+// switchOrgHandler reissues the access token with another active organization. The refresh
+// session stays the same; pass org_id to /refresh to keep the organization across refreshes.
+func (s *Service) switchOrgHandler(w http.ResponseWriter, r *http.Request) {
+	var req switchOrgRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.OrgID == "" {
+		http.Error(w, "invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	user := User(r)
+	m, err := s.opts.MembershipStore.GetMembership(r.Context(), req.OrgID, user.ID)
+	if errors.Is(err, data.ErrMemberNotFound) {
+		http.Error(w, "not a member of this organization", http.StatusForbidden)
+		return
+	}
+	if err != nil {
+		http.Error(w, "failed to switch organization", http.StatusInternalServerError)
+		return
+	}
+
+	s.respondWithToken(w, r, user, currentSessionID(r), "", orgClaims(m))
+}
+
+// refreshOrgClaims keeps orgID active on a refreshed token while userID is still a member.
+func (s *Service) refreshOrgClaims(r *http.Request, userID, orgID string) []token.ClaimSetter {
+	if orgID == "" || s.opts.MembershipStore == nil {
+		return nil
+	}
+	m, err := s.opts.MembershipStore.GetMembership(r.Context(), orgID, userID)
+	if err != nil {
+		if !errors.Is(err, data.ErrMemberNotFound) {
+			s.logger.Printf("refresh: %v", err)
+		}
+		return nil
+	}
+	return []token.ClaimSetter{orgClaims(m)}
+}
@@ -0,0 +1,101 @@
+package auth
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"auth-go-skd/data"
+	"auth-go-skd/store/memory"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+func TestOrganizations_SwitchAndRequireOrgRole(t *testing.T) {
+	ctx := context.Background()
+	mem := memory.New()
+	hash, _ := bcrypt.GenerateFromPassword([]byte("password"), bcrypt.MinCost)
+	mem.CreateUser(ctx, &data.User{ID: "u1", Email: "a@example.com", PasswordHash: string(hash), Role: "user"})
+	mem.CreateOrganization(ctx, &data.Organization{ID: "other", Name: "Other", Slug: "other"})
+
+	s := New(Opts{
+		URL:               "http://localhost:8080",
+		UserStore:         mem,
+		SessionStore:      mem,
+		MembershipStore:   mem,
+		OrganizationStore: mem,
+	})
+	h, _ := s.Handlers()
+
+	do := func(method, path, body, bearer string) *httptest.ResponseRecorder {
+		return doJSON(t, h, method, path, []byte(body), nil, bearer)
+	}
+	var tokens struct {
+		Token        string `json:"token"`
+		RefreshToken string `json:"refresh_token"`
+	}
+	json.NewDecoder(do(http.MethodPost, "/login", `{"email":"a@example.com","password":"password"}`, "").Body).Decode(&tokens)
+
+	rec := do(http.MethodPost, "/orgs", `{"name":"Acme","slug":"acme"}`, tokens.Token)
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("create org: %d %s", rec.Code, rec.Body)
+	}
+	var org data.Organization
+	json.NewDecoder(rec.Body).Decode(&org)
+	if rec := do(http.MethodPost, "/orgs", `{"name":"Acme 2","slug":"acme"}`, tokens.Token); rec.Code != http.StatusConflict {
+		t.Errorf("duplicate slug: expected 409, got %d", rec.Code)
+	}
+
+	var orgs []orgResponse
+	json.NewDecoder(do(http.MethodGet, "/orgs", "", tokens.Token).Body).Decode(&orgs)
+	if len(orgs) != 1 || orgs[0].ID != org.ID || orgs[0].Role != OrgRoleOwner || orgs[0].Slug != "acme" || orgs[0].Active {
+		t.Fatalf("list orgs: got %+v", orgs)
+	}
+
+	protected := s.Middleware().Auth(s.Middleware().RequireOrgRole(OrgRoleOwner, "admin")(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})))
+	call := func(bearer string) int {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.Header.Set("Authorization", "Bearer "+bearer)
+		rec := httptest.NewRecorder()
+		protected.ServeHTTP(rec, req)
+		return rec.Code
+	}
+	if code := call(tokens.Token); code != http.StatusForbidden {
+		t.Errorf("no active org: expected 403, got %d", code)
+	}
+
+	if rec := do(http.MethodPost, "/orgs/switch", `{"org_id":"other"}`, tokens.Token); rec.Code != http.StatusForbidden {
+		t.Errorf("switch to foreign org: expected 403, got %d", rec.Code)
+	}
+	rec = do(http.MethodPost, "/orgs/switch", `{"org_id":"`+org.ID+`"}`, tokens.Token)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("switch: %d %s", rec.Code, rec.Body)
+	}
+	var switched struct {
+		Token string `json:"token"`
+	}
+	json.NewDecoder(rec.Body).Decode(&switched)
+
+	claims, _ := s.ParseToken(switched.Token)
+	if claims.OrgID != org.ID || claims.OrgRole != OrgRoleOwner {
+		t.Errorf("expected org claims, got %q %q", claims.OrgID, claims.OrgRole)
+	}
+	if original, _ := s.ParseToken(tokens.Token); claims.SessionID != original.SessionID {
+		t.Error("switching should keep the refresh session")
+	}
+	if code := call(switched.Token); code != http.StatusOK {
+		t.Errorf("owner: expected 200, got %d", code)
+	}
+
+	// Refreshing with org_id keeps the organization active
+	rec = do(http.MethodPost, "/refresh", `{"refresh_token":"`+tokens.RefreshToken+`","org_id":"`+org.ID+`"}`, "")
+	if rec.Code != http.StatusOK {
+		t.Fatalf("refresh: %d %s", rec.Code, rec.Body)
+	}
+	json.NewDecoder(rec.Body).Decode(&switched)
+	if claims, _ := s.ParseToken(switched.Token); claims.OrgID != org.ID {
+		t.Errorf("refresh dropped the active org: %+v", claims)
+	}
+}
@@ -0,0 +1,175 @@
+package auth
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/http"
+	"strings"
+
+	"auth-go-skd/audit"
+	"auth-go-skd/data"
+	"auth-go-skd/mailer"
+	"auth-go-skd/store"
+)
+
+const otpDigits = 6
+
+type otpVerifyRequest struct {
+	Email string `json:"email"`
+	Code  string `json:"code"`
+}
+
+func generateCode() (string, error) {
+	n, err := rand.Int(rand.Reader, big.NewInt(1_000_000))
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%0*d", otpDigits, n.Int64()), nil
+}
+
+// hashCode keys the hash with the service secret so a leaked store can't be brute-forced offline.
+func (s *Service) hashCode(email, code string) (string, error) {
+	secret, err := s.secret("")
+	if err != nil {
+		return "", err
+	}
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(email + ":" + code))
+	return hex.EncodeToString(mac.Sum(nil)), nil
+}
+
+func otpKey(email string) string {
+	return "otp:" + email
+}
+
+func (s *Service) otpRequestHandler(w http.ResponseWriter, r *http.Request) {
+	var req magicRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	email := normalizeEmail(req.Email)
+	if email == "" {
+		http.Error(w, "invalid email", http.StatusBadRequest)
+		return
+	}
+
+	if !s.allowMail(w, r, email) {
+		return
+	}
+
+	code, err := generateCode()
+	if err != nil {
+		http.Error(w, "failed to create code", http.StatusInternalServerError)
+		return
+	}
+	codeHash, err := s.hashCode(email, code)
+	if err != nil {
+		http.Error(w, "failed to create code", http.StatusInternalServerError)
+		return
+	}
+
+	// Saving replaces any previous code and resets its attempt counter.
+	if err := s.opts.CodeStore.SaveCode(r.Context(), otpKey(email), codeHash, s.opts.CodeTTL); err != nil {
+		http.Error(w, "failed to store code", http.StatusInternalServerError)
+		return
+	}
+
+	msg := mailer.Message{
+		To:      email,
+		Subject: "Your login code",
+		Body:    fmt.Sprintf("Your login code is %s. It expires in %s.\n", code, s.opts.CodeTTL),
+	}
+	if err := s.opts.Mailer.Send(r.Context(), msg); err != nil {
+		s.logger.Printf("otp: failed to send mail: %v", err)
+		http.Error(w, "failed to send code", http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(w).Encode(map[string]string{"status": "sent"})
+}
+
+func (s *Service) otpVerifyHandler(w http.ResponseWriter, r *http.Request) {
+	var req otpVerifyRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	email := normalizeEmail(req.Email)
+	code := strings.TrimSpace(req.Code)
+	if email == "" || len(code) != otpDigits {
+		http.Error(w, "invalid or expired code", http.StatusUnauthorized)
+		return
+	}
+
+	if !s.checkLockout(w, r, email) {
+		s.auditFailure(r, audit.Login, "otp", "", "locked")
+		return
+	}
+
+	ctx := r.Context()
+	key := otpKey(email)
+
+	// Count the attempt before comparing so concurrent guesses can't exceed the limit.
+	attempts, err := s.opts.CodeStore.IncrCodeAttempts(ctx, key)
+	if err != nil {
+		if !errors.Is(err, data.ErrCodeNotFound) {
+			s.logger.Printf("otp: %v", err)
+		}
+		http.Error(w, "invalid or expired code", http.StatusUnauthorized)
+		return
+	}
+	if attempts > s.opts.CodeMaxAttempts {
+		s.opts.CodeStore.DeleteCode(ctx, key)
+		s.auditFailure(r, audit.Login, "otp", "", "too_many_attempts")
+		http.Error(w, "invalid or expired code", http.StatusUnauthorized)
+		return
+	}
+
+	stored, err := s.opts.CodeStore.GetCode(ctx, key)
+	if err != nil {
+		http.Error(w, "invalid or expired code", http.StatusUnauthorized)
+		return
+	}
+	codeHash, err := s.hashCode(email, code)
+	if err != nil {
+		http.Error(w, "failed to verify code", http.StatusInternalServerError)
+		return
+	}
+	if !hmac.Equal([]byte(stored), []byte(codeHash)) {
+		if attempts == s.opts.CodeMaxAttempts {
+			s.opts.CodeStore.DeleteCode(ctx, key)
+		}
+		s.loginFailed(r, email)
+		s.auditFailure(r, audit.Login, "otp", "", "invalid_code")
+		http.Error(w, "invalid or expired code", http.StatusUnauthorized)
+		return
+	}
+
+	if err := s.opts.CodeStore.DeleteCode(ctx, key); err != nil {
+		http.Error(w, "failed to verify code", http.StatusInternalServerError)
+		return
+	}
+	s.loginSucceeded(r, email)
+
+	var u *data.User
+	err = s.inTx(r.Context(), func(tx store.Store) error {
+		u, err = s.findOrCreateUser(r, tx, email, "")
+		return err
+	})
+	if err != nil {
+		s.writeError(w, err, "failed to load user")
+		return
+	}
+
+	s.authorize(w, r, tokenUser(u), "otp")
+}
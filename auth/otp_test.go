@@ -0,0 +1,97 @@
+package auth
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"regexp"
+	"testing"
+
+	"auth-go-skd/mailer"
+	"auth-go-skd/store/memory"
+	"auth-go-skd/store/redis"
+
+	"github.com/alicebob/miniredis/v2"
+	goredis "github.com/redis/go-redis/v9"
+)
+
+func newOTPService(t *testing.T, sent *[]mailer.Message, opts Opts) *Service {
+	mr := miniredis.RunT(t)
+	client := goredis.NewClient(&goredis.Options{Addr: mr.Addr()})
+	t.Cleanup(func() { client.Close() })
+
+	opts.Secret = "test-secret-key-12345"
+	opts.URL = "http://localhost:8080"
+	rdb := &redis.Redis{Client: client}
+	opts.UserStore = memory.New()
+	opts.SessionStore = rdb
+	opts.CodeStore = rdb
+	opts.Mailer = mailer.Func(func(_ context.Context, msg mailer.Message) error {
+		*sent = append(*sent, msg)
+		return nil
+	})
+	return New(opts)
+}
+
+func TestOTP_RequestAndVerify(t *testing.T) {
+	var sent []mailer.Message
+	s := newOTPService(t, &sent, Opts{})
+	h, _ := s.Handlers()
+
+	if rec := doJSON(t, h, http.MethodPost, "/otp/request", []byte(`{"email":"a@example.com"}`), nil, ""); rec.Code != http.StatusAccepted {
+		t.Fatalf("request: %d %s", rec.Code, rec.Body)
+	}
+	code := regexp.MustCompile(`\d{6}`).FindString(sent[0].Body)
+
+	rec := doJSON(t, h, http.MethodPost, "/otp/verify", []byte(`{"email":"a@example.com","code":"`+code+`"}`), nil, "")
+	if rec.Code != http.StatusOK {
+		t.Fatalf("verify: %d %s", rec.Code, rec.Body)
+	}
+
+	var resp struct {
+		Token        string `json:"token"`
+		RefreshToken string `json:"refresh_token"`
+	}
+	json.NewDecoder(rec.Body).Decode(&resp)
+	if resp.Token == "" || resp.RefreshToken == "" {
+		t.Fatalf("expected token pair, got %+v", resp)
+	}
+
+	// Codes are single-use
+	rec = doJSON(t, h, http.MethodPost, "/otp/verify", []byte(`{"email":"a@example.com","code":"`+code+`"}`), nil, "")
+	if rec.Code != http.StatusUnauthorized {
+		t.Errorf("expected reused code to be rejected, got %d", rec.Code)
+	}
+
+	// The refresh token rotates
+	rec = doJSON(t, h, http.MethodPost, "/refresh", []byte(`{"refresh_token":"`+resp.RefreshToken+`"}`), nil, "")
+	if rec.Code != http.StatusOK {
+		t.Fatalf("refresh: %d %s", rec.Code, rec.Body)
+	}
+	rec = doJSON(t, h, http.MethodPost, "/refresh", []byte(`{"refresh_token":"`+resp.RefreshToken+`"}`), nil, "")
+	if rec.Code != http.StatusUnauthorized {
+		t.Errorf("expected used refresh token to be rejected, got %d", rec.Code)
+	}
+}
+
+func TestOTP_InvalidatedAfterMaxAttempts(t *testing.T) {
+	var sent []mailer.Message
+	s := newOTPService(t, &sent, Opts{LockoutStore: noLockouts{}})
+	h, _ := s.Handlers()
+
+	doJSON(t, h, http.MethodPost, "/otp/request", []byte(`{"email":"a@example.com"}`), nil, "")
+	code := regexp.MustCompile(`\d{6}`).FindString(sent[0].Body)
+
+	wrong := "000000"
+	if code == wrong {
+		wrong = "111111"
+	}
+	for i := 0; i < s.opts.CodeMaxAttempts; i++ {
+		doJSON(t, h, http.MethodPost, "/otp/verify", []byte(`{"email":"a@example.com","code":"`+wrong+`"}`), nil, "")
+	}
+
+	rec := doJSON(t, h, http.MethodPost, "/otp/verify", []byte(`{"email":"a@example.com","code":"`+code+`"}`), nil, "")
+	if rec.Code != http.StatusUnauthorized {
+		t.Errorf("expected code to be invalidated after %d failures, got %d", s.opts.CodeMaxAttempts, rec.Code)
+	}
+}
@@ -0,0 +1,293 @@
+package auth
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"time"
+
+	"auth-go-skd/audit"
+	"auth-go-skd/data"
+	"auth-go-skd/token"
+
+	"github.com/go-webauthn/webauthn/protocol"
+	"github.com/go-webauthn/webauthn/webauthn"
+)
+
+const (
+	passkeyCookie       = "passkey_session"
+	passkeyChallengeTTL = 5 * time.Minute
+)
+
+// newWebAuthn derives the relying party from Opts.URL, e.g. https://app.example.com
+// becomes RP ID "app.example.com" with that URL as the only allowed origin.
+func newWebAuthn(opts Opts) (*webauthn.WebAuthn, error) {
+	u, err := url.Parse(opts.URL)
+	if err != nil || u.Hostname() == "" {
+		return nil, fmt.Errorf("invalid service URL %q for webauthn", opts.URL)
+	}
+
+	name := opts.Issuer
+	if name == "" {
+		name = u.Hostname()
+	}
+
+	return webauthn.New(&webauthn.Config{
+		RPID:          u.Hostname(),
+		RPDisplayName: name,
+		RPOrigins:     []string{u.Scheme + "://" + u.Host},
+	})
+}
+
+// passkeyUser adapts a token user and its stored credentials to webauthn.User.
+type passkeyUser struct {
+	user        token.User
+	credentials []data.Credential
+}
+
+func (u *passkeyUser) WebAuthnID() []byte {
+	return []byte(u.user.ID)
+}
+
+func (u *passkeyUser) WebAuthnName() string {
+	if u.user.Email != "" {
+		return u.user.Email
+	}
+	return u.user.ID
+}
+
+func (u *passkeyUser) WebAuthnDisplayName() string {
+	if u.user.Name != "" {
+		return u.user.Name
+	}
+	return u.WebAuthnName()
+}
+
+func (u *passkeyUser) WebAuthnCredentials() []webauthn.Credential {
+	creds := make([]webauthn.Credential, len(u.credentials))
+	for i, c := range u.credentials {
+		transports := make([]protocol.AuthenticatorTransport, len(c.Transports))
+		for j, t := range c.Transports {
+			transports[j] = protocol.AuthenticatorTransport(t)
+		}
+		creds[i] = webauthn.Credential{
+			ID:              c.ID,
+			PublicKey:       c.PublicKey,
+			AttestationType: c.AttestationType,
+			Transport:       transports,
+			Flags: webauthn.CredentialFlags{
+				BackupEligible: c.BackupEligible,
+				BackupState:    c.BackupState,
+			},
+			Authenticator: webauthn.Authenticator{
+				AAGUID:    c.AAGUID,
+				SignCount: c.SignCount,
+			},
+		}
+	}
+	return creds
+}
+
+func (s *Service) passkeyUser(ctx context.Context, user token.User) (*passkeyUser, error) {
+	creds, err := s.opts.CredentialStore.GetCredentialsByUser(ctx, user.ID)
+	if err != nil {
+		return nil, err
+	}
+	return &passkeyUser{user: user, credentials: creds}, nil
+}
+
+// saveCeremony stores the webauthn session data under a random key kept in a short-lived cookie.
+func (s *Service) saveCeremony(w http.ResponseWriter, r *http.Request, session *webauthn.SessionData) error {
+	raw, err := json.Marshal(session)
+	if err != nil {
+		return err
+	}
+
+	key := generateState()
+	if err := s.challenges.SaveChallenge(r.Context(), key, raw, passkeyChallengeTTL); err != nil {
+		return err
+	}
+
+	http.SetCookie(w, &http.Cookie{
+		Name:     passkeyCookie,
+		Value:    key,
+		Path:     "/",
+		Expires:  time.Now().Add(passkeyChallengeTTL),
+		HttpOnly: true,
+		Secure:   r.TLS != nil || s.opts.URLIsHTTPS,
+		SameSite: http.SameSiteStrictMode,
+	})
+	return nil
+}
+
+// loadCeremony consumes the session data saved by saveCeremony, so each challenge is single-use.
+func (s *Service) loadCeremony(w http.ResponseWriter, r *http.Request) (*webauthn.SessionData, error) {
+	cookie, err := r.Cookie(passkeyCookie)
+	if err != nil {
+		return nil, data.ErrChallengeNotFound
+	}
+
+	http.SetCookie(w, &http.Cookie{
+		Name:     passkeyCookie,
+		Value:    "",
+		Path:     "/",
+		Expires:  time.Unix(0, 0),
+		HttpOnly: true,
+	})
+
+	raw, err := s.challenges.PopChallenge(r.Context(), cookie.Value)
+	if err != nil {
+		return nil, err
+	}
+
+	var session webauthn.SessionData
+	if err := json.Unmarshal(raw, &session); err != nil {
+		return nil, err
+	}
+	return &session, nil
+}
+
+func (s *Service) passkeyRegisterBeginHandler(w http.ResponseWriter, r *http.Request) {
+	user, err := s.passkeyUser(r.Context(), User(r))
+	if err != nil {
+		http.Error(w, "failed to load credentials", http.StatusInternalServerError)
+		return
+	}
+
+	creation, session, err := s.webauthn.BeginRegistration(user,
+		webauthn.WithExclusions(webauthn.Credentials(user.WebAuthnCredentials()).CredentialDescriptors()),
+		webauthn.WithResidentKeyRequirement(protocol.ResidentKeyRequirementRequired),
+	)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("failed to begin registration: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	if err := s.saveCeremony(w, r, session); err != nil {
+		http.Error(w, "failed to store challenge", http.StatusInternalServerError)
+		return
+	}
+
+	json.NewEncoder(w).Encode(creation)
+}
+
+func (s *Service) passkeyRegisterFinishHandler(w http.ResponseWriter, r *http.Request) {
+	session, err := s.loadCeremony(w, r)
+	if err != nil {
+		http.Error(w, "registration challenge expired", http.StatusBadRequest)
+		return
+	}
+
+	user, err := s.passkeyUser(r.Context(), User(r))
+	if err != nil {
+		http.Error(w, "failed to load credentials", http.StatusInternalServerError)
+		return
+	}
+
+	cred, err := s.webauthn.FinishRegistration(user, *session, r)
+	if err != nil {
+		s.auditFailure(r, audit.MFAChange, "passkey", user.user.ID, "invalid_attestation")
+		http.Error(w, fmt.Sprintf("failed to register passkey: %v", err), http.StatusBadRequest)
+		return
+	}
+
+	transports := make([]string, len(cred.Transport))
+	for i, t := range cred.Transport {
+		transports[i] = string(t)
+	}
+
+	now := time.Now()
+	credential := &data.Credential{
+		ID:              cred.ID,
+		UserID:          user.user.ID,
+		PublicKey:       cred.PublicKey,
+		AttestationType: cred.AttestationType,
+		Transports:      transports,
+		AAGUID:          cred.Authenticator.AAGUID,
+		SignCount:       cred.Authenticator.SignCount,
+		BackupEligible:  cred.Flags.BackupEligible,
+		BackupState:     cred.Flags.BackupState,
+		CreatedAt:       now,
+		LastUsedAt:      now,
+	}
+	if err := s.opts.CredentialStore.CreateCredential(r.Context(), credential); err != nil {
+		http.Error(w, "failed to save passkey", http.StatusInternalServerError)
+		return
+	}
+
+	s.audit(r, audit.Event{Type: audit.MFAChange, Provider: "passkey", UserID: user.user.ID, Reason: "passkey_added"})
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(credential)
+}
+
+func (s *Service) passkeyLoginBeginHandler(w http.ResponseWriter, r *http.Request) {
+	assertion, session, err := s.webauthn.BeginDiscoverableLogin()
+	if err != nil {
+		http.Error(w, fmt.Sprintf("failed to begin login: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	if err := s.saveCeremony(w, r, session); err != nil {
+		http.Error(w, "failed to store challenge", http.StatusInternalServerError)
+		return
+	}
+
+	json.NewEncoder(w).Encode(assertion)
+}
+
+// passkeyLoginFinishHandler verifies the assertion. Failures count toward the lockout of the
+// client IP; the account is only known once an assertion succeeds.
+func (s *Service) passkeyLoginFinishHandler(w http.ResponseWriter, r *http.Request) {
+	if !s.checkLockout(w, r, "") {
+		s.auditFailure(r, audit.Login, "passkey", "", "locked")
+		return
+	}
+	session, err := s.loadCeremony(w, r)
+	if err != nil {
+		http.Error(w, "login challenge expired", http.StatusBadRequest)
+		return
+	}
+
+	var found *passkeyUser
+	handler := func(rawID, userHandle []byte) (webauthn.User, error) {
+		stored, err := s.opts.CredentialStore.GetCredentialByID(r.Context(), rawID)
+		if err != nil {
+			return nil, err
+		}
+		if stored.UserID != string(userHandle) {
+			return nil, errors.New("credential does not belong to user handle")
+		}
+		user, err := s.loadUser(r.Context(), stored.UserID)
+		if err != nil {
+			return nil, err
+		}
+		found, err = s.passkeyUser(r.Context(), user)
+		return found, err
+	}
+
+	_, cred, err := s.webauthn.FinishPasskeyLogin(handler, *session, r)
+	if err != nil {
+		s.auditFailure(r, audit.Login, "passkey", "", "invalid_assertion")
+		s.loginFailed(r, "")
+		http.Error(w, "passkey login failed", http.StatusUnauthorized)
+		return
+	}
+
+	// A counter that did not increase indicates a possibly cloned authenticator.
+	if cred.Authenticator.CloneWarning {
+		s.auditFailure(r, audit.Login, "passkey", found.user.ID, "clone_warning")
+		s.loginFailed(r, "")
+		http.Error(w, "passkey login failed", http.StatusUnauthorized)
+		return
+	}
+
+	if err := s.opts.CredentialStore.UpdateCredentialSignCount(r.Context(), cred.ID, cred.Authenticator.SignCount, time.Now()); err != nil {
+		http.Error(w, "failed to update passkey", http.StatusInternalServerError)
+		return
+	}
+
+	s.authorize(w, r, found.user, "passkey")
+}
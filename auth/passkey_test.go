@@ -0,0 +1,224 @@
+package auth
+
+import (
+	"bytes"
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"auth-go-skd/store/memory"
+	"auth-go-skd/token"
+
+	"github.com/go-webauthn/webauthn/protocol/webauthncbor"
+)
+
+// softAuthenticator is a software passkey that produces "none" attestations and ES256 assertions.
+type softAuthenticator struct {
+	origin    string
+	rpID      string
+	key       *ecdsa.PrivateKey
+	credID    []byte
+	userID    []byte
+	signCount uint32
+}
+
+var b64 = base64.RawURLEncoding
+
+func newSoftAuthenticator(t *testing.T, origin, rpID string) *softAuthenticator {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	credID := make([]byte, 16)
+	rand.Read(credID)
+	return &softAuthenticator{origin: origin, rpID: rpID, key: key, credID: credID}
+}
+
+func (a *softAuthenticator) authData(flags byte, attested []byte) []byte {
+	rpHash := sha256.Sum256([]byte(a.rpID))
+	buf := bytes.NewBuffer(rpHash[:])
+	buf.WriteByte(flags)
+	binary.Write(buf, binary.BigEndian, a.signCount)
+	buf.Write(attested)
+	return buf.Bytes()
+}
+
+func (a *softAuthenticator) clientData(typ, challenge string) []byte {
+	raw, _ := json.Marshal(map[string]string{"type": typ, "challenge": challenge, "origin": a.origin})
+	return raw
+}
+
+func (a *softAuthenticator) create(t *testing.T, challenge string, userID []byte) []byte {
+	a.userID = userID
+
+	coseKey, err := webauthncbor.Marshal(map[int]interface{}{
+		1:  2,  // kty: EC2
+		3:  -7, // alg: ES256
+		-1: 1,  // crv: P-256
+		-2: a.key.X.FillBytes(make([]byte, 32)),
+		-3: a.key.Y.FillBytes(make([]byte, 32)),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	attested := bytes.NewBuffer(make([]byte, 16)) // zero AAGUID
+	binary.Write(attested, binary.BigEndian, uint16(len(a.credID)))
+	attested.Write(a.credID)
+	attested.Write(coseKey)
+
+	attObj, err := webauthncbor.Marshal(map[string]interface{}{
+		"fmt":      "none",
+		"attStmt":  map[string]interface{}{},
+		"authData": a.authData(0x45, attested.Bytes()), // UP | UV | AT
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	body, _ := json.Marshal(map[string]interface{}{
+		"id":    b64.EncodeToString(a.credID),
+		"rawId": b64.EncodeToString(a.credID),
+		"type":  "public-key",
+		"response": map[string]string{
+			"clientDataJSON":    b64.EncodeToString(a.clientData("webauthn.create", challenge)),
+			"attestationObject": b64.EncodeToString(attObj),
+		},
+	})
+	return body
+}
+
+func (a *softAuthenticator) get(t *testing.T, challenge string) []byte {
+	a.signCount++
+	authData := a.authData(0x05, nil) // UP | UV
+	clientData := a.clientData("webauthn.get", challenge)
+	clientHash := sha256.Sum256(clientData)
+	digest := sha256.Sum256(append(authData, clientHash[:]...))
+	sig, err := ecdsa.SignASN1(rand.Reader, a.key, digest[:])
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	body, _ := json.Marshal(map[string]interface{}{
+		"id":    b64.EncodeToString(a.credID),
+		"rawId": b64.EncodeToString(a.credID),
+		"type":  "public-key",
+		"response": map[string]string{
+			"clientDataJSON":    b64.EncodeToString(clientData),
+			"authenticatorData": b64.EncodeToString(authData),
+			"signature":         b64.EncodeToString(sig),
+			"userHandle":        b64.EncodeToString(a.userID),
+		},
+	})
+	return body
+}
+
+func doJSON(t *testing.T, h http.Handler, method, path string, body []byte, cookies []*http.Cookie, bearer string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, path, bytes.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	for _, c := range cookies {
+		req.AddCookie(c)
+	}
+	if bearer != "" {
+		req.Header.Set("Authorization", "Bearer "+bearer)
+	}
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	return rec
+}
+
+func jsonBody(s string) *bytes.Reader {
+	return bytes.NewReader([]byte(s))
+}
+
+func challengeOf(t *testing.T, rec *httptest.ResponseRecorder) string {
+	var resp struct {
+		PublicKey struct {
+			Challenge string `json:"challenge"`
+		} `json:"publicKey"`
+	}
+	if err := json.NewDecoder(rec.Body).Decode(&resp); err != nil {
+		t.Fatalf("decode begin response: %v", err)
+	}
+	return resp.PublicKey.Challenge
+}
+
+func TestPasskey_RegisterAndLogin(t *testing.T) {
+	creds := memory.New()
+	s := New(Opts{URL: "http://localhost:8080", CredentialStore: creds})
+	h, _ := s.Handlers()
+
+	user := token.User{ID: "user-123", Name: "Test User", Email: "test@example.com"}
+	jwtStr, err := s.Token(user)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	authn := newSoftAuthenticator(t, "http://localhost:8080", "localhost")
+
+	// Registration ceremony
+	begin := doJSON(t, h, http.MethodPost, "/passkey/register/begin", nil, nil, jwtStr)
+	if begin.Code != http.StatusOK {
+		t.Fatalf("register begin: %d %s", begin.Code, begin.Body)
+	}
+	cookies := begin.Result().Cookies()
+	finish := doJSON(t, h, http.MethodPost, "/passkey/register/finish", authn.create(t, challengeOf(t, begin), []byte(user.ID)), cookies, jwtStr)
+	if finish.Code != http.StatusCreated {
+		t.Fatalf("register finish: %d %s", finish.Code, finish.Body)
+	}
+	if stored, _ := creds.GetCredentialsByUser(context.Background(), user.ID); len(stored) != 1 {
+		t.Fatalf("expected 1 stored credential, got %d", len(stored))
+	}
+
+	// Authentication ceremony
+	begin = doJSON(t, h, http.MethodPost, "/passkey/login/begin", nil, nil, "")
+	if begin.Code != http.StatusOK {
+		t.Fatalf("login begin: %d %s", begin.Code, begin.Body)
+	}
+	cookies = begin.Result().Cookies()
+	challenge := challengeOf(t, begin)
+	finish = doJSON(t, h, http.MethodPost, "/passkey/login/finish", authn.get(t, challenge), cookies, "")
+	if finish.Code != http.StatusOK {
+		t.Fatalf("login finish: %d %s", finish.Code, finish.Body)
+	}
+
+	var resp struct {
+		Token string     `json:"token"`
+		User  token.User `json:"user"`
+	}
+	json.NewDecoder(finish.Body).Decode(&resp)
+	claims, err := s.ParseToken(resp.Token)
+	if err != nil {
+		t.Fatalf("failed to parse issued token: %v", err)
+	}
+	if claims.User.ID != user.ID {
+		t.Errorf("expected user ID %s, got %s", user.ID, claims.User.ID)
+	}
+
+	var jwtCookie bool
+	for _, c := range finish.Result().Cookies() {
+		jwtCookie = jwtCookie || (c.Name == "JWT" && c.Value == resp.Token)
+	}
+	if !jwtCookie {
+		t.Error("expected JWT cookie to be set")
+	}
+
+	stored, _ := creds.GetCredentialByID(context.Background(), authn.credID)
+	if stored.SignCount != 1 {
+		t.Errorf("expected sign count 1, got %d", stored.SignCount)
+	}
+
+	// The challenge is single-use
+	replay := doJSON(t, h, http.MethodPost, "/passkey/login/finish", authn.get(t, challenge), cookies, "")
+	if replay.Code != http.StatusBadRequest {
+		t.Errorf("expected replay to be rejected, got %d", replay.Code)
+	}
+}
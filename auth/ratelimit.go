@@ -0,0 +1,46 @@
+package auth
+
+import (
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+
+	"auth-go-skd/limiter"
+)
+
+// limit wraps a route with Opts.RateLimiter keyed by keys; without a limiter it is a no-op.
+func (s *Service) limit(keys ...limiter.KeyFunc) func(http.Handler) http.Handler {
+	if s.opts.RateLimiter == nil {
+		return func(next http.Handler) http.Handler { return next }
+	}
+	return limiter.Middleware(s.opts.RateLimiter, keys...)
+}
+
+// allowMail enforces the per-address and per-IP quota for login emails, writing a 429 when exceeded.
+func (s *Service) allowMail(w http.ResponseWriter, r *http.Request, email string) bool {
+	for _, check := range []struct {
+		l   limiter.Limiter
+		key string
+	}{
+		{s.mailIPLimit, "mail:ip:" + clientIP(r)},
+		{s.mailEmailLimit, "mail:email:" + email},
+	} {
+		allowed, retryAfter, err := check.l.Allow(r.Context(), check.key)
+		if err == nil && !allowed {
+			w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(retryAfter.Seconds()))))
+			http.Error(w, "too many requests", http.StatusTooManyRequests)
+			return false
+		}
+	}
+	return true
+}
+
+// clientIP returns the remote IP without port. Use chi's RealIP middleware behind proxies.
+func clientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
@@ -1,17 +1,26 @@
 package auth
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"log"
 	"net/http"
+	"strings"
+	"sync/atomic"
 	"time"
 
 	"auth-go-skd/avatar"
+	"auth-go-skd/data"
+	"auth-go-skd/limiter"
 	"auth-go-skd/provider"
+	"auth-go-skd/store"
+	"auth-go-skd/store/memory"
 	"auth-go-skd/token"
 
+	"github.com/go-webauthn/webauthn/webauthn"
 	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
 )
 
 func User(r *http.Request) token.User {
@@ -19,9 +28,16 @@ func User(r *http.Request) token.User {
 }
 
 type Service struct {
-	opts      Opts
-	providers map[string]provider.Provider
-	logger    *log.Logger
+	opts       Opts
+	providers  map[string]provider.Provider
+	logger     *log.Logger
+	webauthn   *webauthn.WebAuthn
+	challenges store.ChallengeStorage
+	tenants    atomic.Pointer[tenantSet]
+	oidcKeyID  string
+
+	mailEmailLimit limiter.Limiter
+	mailIPLimit    limiter.Limiter
 }
 
 func New(opts Opts) *Service {
@@ -36,17 +52,120 @@ func New(opts Opts) *Service {
 		opts.AvatarStore = avatar.NewLocalFS("/tmp/avatars")
 	}
 
-	return &Service{
-		opts:      opts,
-		providers: make(map[string]provider.Provider),
-		logger:    log.Default(),
+	// Single-instance defaults; multi-instance deployments pass shared stores.
+	mem := memory.New()
+	if opts.ChallengeStore == nil {
+		opts.ChallengeStore = mem
+	}
+	if opts.MagicLinkTTL == 0 {
+		opts.MagicLinkTTL = time.Minute * 15
+	}
+	if opts.CodeTTL == 0 {
+		opts.CodeTTL = time.Minute * 10
+	}
+	if opts.CodeMaxAttempts == 0 {
+		opts.CodeMaxAttempts = 5
+	}
+	if opts.RefreshTokenDuration == 0 {
+		opts.RefreshTokenDuration = time.Hour * 24 * 30
+	}
+	if opts.ClientTokenDuration == 0 {
+		opts.ClientTokenDuration = time.Hour
+	}
+	if opts.OIDCIssuer == "" {
+		opts.OIDCIssuer = strings.TrimRight(opts.URL, "/") + "/auth"
+	}
+	if opts.OIDCCodeTTL == 0 {
+		opts.OIDCCodeTTL = time.Minute
+	}
+	if opts.RevocationStore == nil {
+		opts.RevocationStore = mem
+	}
+	if opts.LockoutStore == nil {
+		opts.LockoutStore = mem
+	}
+	if opts.LockoutThreshold == 0 {
+		opts.LockoutThreshold = 5
+	}
+	if opts.LockoutDuration == 0 {
+		opts.LockoutDuration = time.Minute * 15
+	}
+	if opts.MaxTokenSize == 0 {
+		opts.MaxTokenSize = 4000
+	}
+	if opts.DeletedUserRetention == 0 {
+		opts.DeletedUserRetention = time.Hour * 24 * 30
+	}
+	if opts.UserPurgeInterval == 0 {
+		opts.UserPurgeInterval = time.Hour
+	}
+	if len(opts.Roles) == 0 {
+		opts.Roles = []string{"user", "admin"}
+	}
+	if opts.InvitationTTL == 0 {
+		opts.InvitationTTL = time.Hour * 24 * 7
+	}
+	if opts.InvitationURL == "" {
+		opts.InvitationURL = strings.TrimRight(opts.URL, "/") + "/invite"
+	}
+	if opts.TenantReloadInterval == 0 {
+		opts.TenantReloadInterval = time.Minute
+	}
+	if opts.ProviderFactory == nil {
+		opts.ProviderFactory = DefaultProviderFactory
+	}
+	if opts.MailLimiter == nil {
+		opts.MailLimiter = limiter.NewFactory(nil)
+	}
+	if opts.MailPerEmail == 0 {
+		opts.MailPerEmail = 5
+	}
+	if opts.MailPerIP == 0 {
+		opts.MailPerIP = 20
+	}
+
+	s := &Service{
+		opts:           opts,
+		providers:      make(map[string]provider.Provider),
+		logger:         log.Default(),
+		challenges:     opts.ChallengeStore,
+		mailEmailLimit: opts.MailLimiter(opts.MailPerEmail, time.Hour),
+		mailIPLimit:    opts.MailLimiter(opts.MailPerIP, time.Hour),
+	}
+
+	if opts.OIDCSigningKey != nil {
+		s.oidcKeyID = keyID(&opts.OIDCSigningKey.PublicKey)
+	}
+
+	if opts.CredentialStore != nil {
+		wa, err := newWebAuthn(opts)
+		if err != nil {
+			s.logger.Printf("passkeys disabled: %v", err)
+		} else {
+			s.webauthn = wa
+		}
+	}
+
+	if err := s.ReloadTenants(context.Background()); err != nil {
+		s.logger.Printf("load tenants: %v", err)
 	}
+
+	return s
+}
+
+// Token issues an access token for user. extra adds custom claims, see token.Key.
+func (s *Service) Token(user token.User, extra ...token.ClaimSetter) (string, error) {
+	return s.token(nil, user, "", extra...)
 }
 
-func (s *Service) Token(user token.User) (string, error) {
+// token signs an access token for the request r, which may be nil; sessionID links it to the
+// refresh session it was issued with.
+func (s *Service) token(r *http.Request, user token.User, sessionID string, extra ...token.ClaimSetter) (string, error) {
 	claims := token.Claims{
-		User: &user,
+		User:      &user,
+		SessionID: sessionID,
 		RegisteredClaims: jwt.RegisteredClaims{
+			ID:        uuid.NewString(),
 			Issuer:    s.opts.Issuer,
 			ExpiresAt: jwt.NewNumericDate(time.Now().Add(s.opts.TokenDuration)),
 			IssuedAt:  jwt.NewNumericDate(time.Now()),
@@ -54,35 +173,138 @@ func (s *Service) Token(user token.User) (string, error) {
 		},
 	}
 
+	for _, set := range extra {
+		if err := set(&claims); err != nil {
+			return "", err
+		}
+	}
+	if s.opts.ClaimsEnricher != nil {
+		ctx := context.Background()
+		if r != nil {
+			ctx = r.Context()
+		}
+		if err := s.opts.ClaimsEnricher(ctx, r, &claims); err != nil {
+			return "", err
+		}
+	}
+
+	return s.sign(r, claims, user.ID)
+}
+
+// sign signs claims with the key for id on r, enforcing Opts.MaxTokenSize.
+func (s *Service) sign(r *http.Request, claims token.Claims, id string) (string, error) {
 	jwtToken := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
 
-	secret := "secret"
+	secret, err := s.secretFor(r, id)
+	if err != nil {
+		return "", err
+	}
+
+	signed, err := jwtToken.SignedString(secret)
+	if err != nil {
+		return "", err
+	}
+	if len(signed) > s.opts.MaxTokenSize {
+		return "", fmt.Errorf("%w: %d bytes, limit %d", token.ErrTokenTooLarge, len(signed), s.opts.MaxTokenSize)
+	}
+	return signed, nil
+}
+
+// secret returns the HMAC key for id: SecretReader first, then Opts.Secret.
+func (s *Service) secret(id string) ([]byte, error) {
 	if s.opts.SecretReader != nil {
-		var err error
-		secret, err = s.opts.SecretReader(user.ID)
-		if err != nil {
-			return "", err
+		secret, err := s.opts.SecretReader(id)
+		return []byte(secret), err
+	}
+	if s.opts.Secret != "" {
+		return []byte(s.opts.Secret), nil
+	}
+	return []byte("secret"), nil
+}
+
+// loadUser resolves the token user for id, falling back to a bare ID when no UserStore is configured.
+// Blocked and deleted users yield an error.
+func (s *Service) loadUser(ctx context.Context, id string) (token.User, error) {
+	if s.opts.UserStore == nil {
+		return token.User{ID: id}, nil
+	}
+	u, err := s.opts.UserStore.GetUserByID(ctx, id)
+	if err != nil {
+		return token.User{}, err
+	}
+	if err := accountError(u); err != nil {
+		return token.User{}, err
+	}
+	return tokenUser(u), nil
+}
+
+// findOrCreateUser returns the user registered under email, creating a verified one on first login
+// and running Opts.OnUserCreated with tx. Passwordless flows call it only after the caller proved
+// ownership of the address.
+func (s *Service) findOrCreateUser(r *http.Request, tx store.Store, email, name string) (*data.User, error) {
+	ctx := r.Context()
+	u, err := tx.GetUserByEmail(ctx, email)
+	if err == nil {
+		return u, nil
+	}
+	if !errors.Is(err, data.ErrUserNotFound) {
+		return nil, err
+	}
+
+	now := time.Now()
+	u = &data.User{
+		ID:         uuid.NewString(),
+		Email:      email,
+		Name:       name,
+		Role:       "user",
+		IsVerified: true,
+		CreatedAt:  now,
+		UpdatedAt:  now,
+	}
+	if err := tx.CreateUser(ctx, u); err != nil {
+		return nil, err
+	}
+	if s.opts.OnUserCreated != nil {
+		if err := s.opts.OnUserCreated(ctx, r, tx, u); err != nil {
+			// Inside a transaction the rollback removes the user as well.
+			if err := tx.DeleteUser(ctx, u.ID); err != nil {
+				s.logger.Printf("failed to remove rejected user %s: %v", u.ID, err)
+			}
+			return nil, err
 		}
 	}
+	return u, nil
+}
 
-	return jwtToken.SignedString([]byte(secret))
+func tokenUser(u *data.User) token.User {
+	return token.User{
+		ID:    u.ID,
+		Name:  u.Name,
+		Email: u.Email,
+		Attributes: map[string]interface{}{
+			"role": u.Role,
+		},
+	}
 }
 
 func (s *Service) Add(p provider.Provider) {
 	s.providers[p.Name()] = p
 }
 
+// ParseToken validates an access token signed with the service secret. Tokens of a tenant with
+// its own secret are only accepted on that tenant's requests, by the middleware.
 func (s *Service) ParseToken(tokenStr string) (*token.Claims, error) {
+	return s.parseToken(nil, tokenStr)
+}
+
+// parseToken validates an access token presented on r, which may be nil.
+func (s *Service) parseToken(r *http.Request, tokenStr string) (*token.Claims, error) {
 	t, err := jwt.ParseWithClaims(tokenStr, &token.Claims{}, func(token *jwt.Token) (interface{}, error) {
 		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
 			return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
 		}
 
-		if s.opts.SecretReader != nil {
-			secret, err := s.opts.SecretReader("")
-			return []byte(secret), err
-		}
-		return []byte("secret"), nil
+		return s.secretFor(r, "")
 	})
 
 	if err != nil {
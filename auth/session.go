@@ -0,0 +1,296 @@
+package auth
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"time"
+
+	"auth-go-skd/audit"
+	"auth-go-skd/data"
+	"auth-go-skd/store"
+	"auth-go-skd/token"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+)
+
+type refreshRequest struct {
+	RefreshToken string `json:"refresh_token"`
+	// OrgID keeps an organization active on the new token, see switchOrgHandler.
+	OrgID string `json:"org_id,omitempty"`
+}
+
+// hashToken is how refresh tokens are persisted; the plain value only ever goes to the client.
+func hashToken(t string) string {
+	sum := sha256.Sum256([]byte(t))
+	return hex.EncodeToString(sum[:])
+}
+
+// newSession builds a refresh session for userID and returns it with the plain refresh token.
+func (s *Service) newSession(r *http.Request, userID string) (*data.Session, string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return nil, "", err
+	}
+	refreshToken := base64.RawURLEncoding.EncodeToString(b)
+
+	userAgent := r.UserAgent()
+	if len(userAgent) > 255 {
+		userAgent = userAgent[:255]
+	}
+
+	now := time.Now()
+	return &data.Session{
+		ID:           uuid.NewString(),
+		UserID:       userID,
+		RefreshToken: hashToken(refreshToken),
+		UserAgent:    userAgent,
+		ClientIP:     clientIP(r),
+		ExpiresAt:    now.Add(s.opts.RefreshTokenDuration),
+		CreatedAt:    now,
+	}, refreshToken, nil
+}
+
+// createSession stores a new refresh session for userID and returns it with the plain refresh token.
+func (s *Service) createSession(r *http.Request, userID string) (*data.Session, string, error) {
+	session, refreshToken, err := s.newSession(r, userID)
+	if err != nil {
+		return nil, "", err
+	}
+	if err := s.opts.SessionStore.CreateSession(r.Context(), session); err != nil {
+		return nil, "", err
+	}
+	return session, refreshToken, nil
+}
+
+// revokeSession deletes a refresh session and blocks access tokens issued with it
+// for the rest of their lifetime. A session that is already gone is still blocked.
+func (s *Service) revokeSession(ctx context.Context, id string) error {
+	if err := s.opts.SessionStore.DeleteSession(ctx, id); err != nil && !errors.Is(err, data.ErrSessionNotFound) {
+		return err
+	}
+	return s.opts.RevocationStore.Revoke(ctx, id, s.opts.TokenDuration)
+}
+
+// refreshHandler exchanges a refresh token for a new token pair. The user and the new access
+// token are checked before the session is rotated, so a failure leaves the refresh token usable;
+// rotation then deletes the old session, so every refresh token can be used only once.
+func (s *Service) refreshHandler(w http.ResponseWriter, r *http.Request) {
+	var req refreshRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.RefreshToken == "" {
+		http.Error(w, "invalid request body", http.StatusBadRequest)
+		return
+	}
+	ctx := r.Context()
+	oldHash := hashToken(req.RefreshToken)
+
+	invalid := func(err error) {
+		if !errors.Is(err, data.ErrSessionNotFound) {
+			s.logger.Printf("refresh: %v", err)
+		}
+		s.auditFailure(r, audit.Refresh, "", "", "invalid_refresh_token")
+		http.Error(w, "invalid refresh token", http.StatusUnauthorized)
+	}
+
+	old, err := s.opts.SessionStore.GetSessionByRefreshToken(ctx, oldHash)
+	if err == nil && (old.IsBlocked || time.Now().After(old.ExpiresAt)) {
+		err = data.ErrSessionNotFound
+	}
+	if err != nil {
+		invalid(err)
+		return
+	}
+
+	user, err := s.loadUser(ctx, old.UserID)
+	if err != nil {
+		var he *HookError
+		if errors.As(err, &he) {
+			if err := s.revokeSession(ctx, old.ID); err != nil {
+				s.logger.Printf("refresh: %v", err)
+			}
+			s.auditFailure(r, audit.Refresh, "", old.UserID, "account_disabled")
+			s.writeError(w, err, "failed to refresh")
+			return
+		}
+		http.Error(w, "invalid refresh token", http.StatusUnauthorized)
+		return
+	}
+
+	next, refreshToken, err := s.newSession(r, user.ID)
+	if err != nil {
+		http.Error(w, "failed to create session", http.StatusInternalServerError)
+		return
+	}
+	tokenStr, err := s.token(r, user, next.ID, s.refreshOrgClaims(r, user.ID, req.OrgID)...)
+	if err != nil {
+		s.writeError(w, err, "failed to create token")
+		return
+	}
+
+	// A concurrent refresh may have used the token since the lookup; rotation refuses it then.
+	if err := s.rotateSession(ctx, oldHash, next); err != nil {
+		invalid(err)
+		return
+	}
+
+	s.audit(r, audit.Event{Type: audit.Refresh, UserID: user.ID})
+	s.writeToken(w, r, user, tokenStr, refreshToken)
+}
+
+// rotateSession replaces the session behind oldHash with next, atomically when the store
+// implements store.SessionRotator.
+func (s *Service) rotateSession(ctx context.Context, oldHash string, next *data.Session) error {
+	if rotator, ok := s.opts.SessionStore.(store.SessionRotator); ok {
+		_, err := rotator.RotateSession(ctx, oldHash, next)
+		return err
+	}
+
+	old, err := s.opts.SessionStore.GetSessionByRefreshToken(ctx, oldHash)
+	if err != nil {
+		return err
+	}
+	if err := s.opts.SessionStore.DeleteSession(ctx, old.ID); err != nil {
+		return err
+	}
+	if old.IsBlocked || time.Now().After(old.ExpiresAt) {
+		return data.ErrSessionNotFound
+	}
+
+	next.UserID = old.UserID
+	return s.opts.SessionStore.CreateSession(ctx, next)
+}
+
+type sessionResponse struct {
+	ID        string    `json:"id"`
+	UserAgent string    `json:"user_agent"`
+	ClientIP  string    `json:"client_ip"`
+	Device    Device    `json:"device"`
+	Current   bool      `json:"current"`
+	CreatedAt time.Time `json:"created_at"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+// isRevoked reports whether the token was logged out, its session revoked or its user erased.
+// Lookup errors are logged and treated as not revoked.
+func (s *Service) isRevoked(ctx context.Context, claims *token.Claims) bool {
+	ids := []string{claims.ID, claims.SessionID}
+	if claims.User != nil {
+		ids = append(ids, userRevocationID(claims.User.ID))
+	}
+	for _, id := range ids {
+		if id == "" {
+			continue
+		}
+		revoked, err := s.opts.RevocationStore.IsRevoked(ctx, id)
+		if err != nil {
+			s.logger.Printf("revocation check: %v", err)
+			continue
+		}
+		if revoked {
+			return true
+		}
+	}
+	return false
+}
+
+// userRevocationID is the revocation entry that refuses every token of userID, see EraseUser.
+func userRevocationID(userID string) string {
+	return "user:" + userID
+}
+
+// currentSessionID is the session the request's access token was issued with, if any.
+func currentSessionID(r *http.Request) string {
+	claims, err := token.GetClaims(r)
+	if err != nil {
+		return ""
+	}
+	return claims.SessionID
+}
+
+func (s *Service) listSessionsHandler(w http.ResponseWriter, r *http.Request) {
+	sessions, err := s.opts.SessionStore.ListSessionsByUser(r.Context(), User(r).ID)
+	if err != nil {
+		http.Error(w, "failed to list sessions", http.StatusInternalServerError)
+		return
+	}
+
+	current := currentSessionID(r)
+	now := time.Now()
+	resp := make([]sessionResponse, 0, len(sessions))
+	for _, session := range sessions {
+		if session.IsBlocked || now.After(session.ExpiresAt) {
+			continue
+		}
+		resp = append(resp, sessionResponse{
+			ID:        session.ID,
+			UserAgent: session.UserAgent,
+			ClientIP:  session.ClientIP,
+			Device:    parseUserAgent(session.UserAgent),
+			Current:   session.ID == current,
+			CreatedAt: session.CreatedAt,
+			ExpiresAt: session.ExpiresAt,
+		})
+	}
+
+	json.NewEncoder(w).Encode(resp)
+}
+
+func (s *Service) revokeSessionHandler(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "id")
+
+	sessions, err := s.opts.SessionStore.ListSessionsByUser(r.Context(), User(r).ID)
+	if err != nil {
+		http.Error(w, "failed to list sessions", http.StatusInternalServerError)
+		return
+	}
+
+	// Only sessions of the current user can be revoked; others look like they don't exist.
+	for _, session := range sessions {
+		if session.ID != id {
+			continue
+		}
+		if err := s.revokeSession(r.Context(), id); err != nil {
+			http.Error(w, "failed to revoke session", http.StatusInternalServerError)
+			return
+		}
+		s.audit(r, audit.Event{Type: audit.SessionRevoke, UserID: User(r).ID})
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+
+	http.Error(w, "session not found", http.StatusNotFound)
+}
+
+func (s *Service) revokeOtherSessionsHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	userID, current := User(r).ID, currentSessionID(r)
+
+	sessions, err := s.opts.SessionStore.ListSessionsByUser(ctx, userID)
+	if err != nil {
+		http.Error(w, "failed to list sessions", http.StatusInternalServerError)
+		return
+	}
+
+	if err := s.opts.SessionStore.DeleteSessionsByUser(ctx, userID, current); err != nil {
+		http.Error(w, "failed to revoke sessions", http.StatusInternalServerError)
+		return
+	}
+	for _, session := range sessions {
+		if session.ID == current {
+			continue
+		}
+		if err := s.opts.RevocationStore.Revoke(ctx, session.ID, s.opts.TokenDuration); err != nil {
+			s.logger.Printf("revoke sessions: %v", err)
+			http.Error(w, "failed to revoke sessions", http.StatusInternalServerError)
+			return
+		}
+	}
+	s.audit(r, audit.Event{Type: audit.SessionRevoke, UserID: userID, Reason: "other_sessions"})
+	w.WriteHeader(http.StatusNoContent)
+}
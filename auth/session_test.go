@@ -0,0 +1,211 @@
+package auth
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"auth-go-skd/data"
+	"auth-go-skd/store/memory"
+	"auth-go-skd/token"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+func TestSessions_ListAndRevoke(t *testing.T) {
+	users := memory.New()
+	hash, _ := bcrypt.GenerateFromPassword([]byte("password"), bcrypt.MinCost)
+	users.CreateUser(context.Background(), &data.User{ID: "u1", Email: "a@example.com", PasswordHash: string(hash)})
+	sessions := memory.New()
+
+	s := New(Opts{URL: "http://localhost:8080", UserStore: users, SessionStore: sessions})
+	h, _ := s.Handlers()
+
+	login := func(ua string) string {
+		req := httptest.NewRequest(http.MethodPost, "/login", jsonBody(`{"email":"a@example.com","password":"password"}`))
+		req.Header.Set("User-Agent", ua)
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+		if rec.Code != http.StatusOK {
+			t.Fatalf("login: %d %s", rec.Code, rec.Body)
+		}
+		var resp struct {
+			Token string `json:"token"`
+		}
+		json.NewDecoder(rec.Body).Decode(&resp)
+		return resp.Token
+	}
+	call := func(method, path, bearer string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, nil)
+		req.Header.Set("Authorization", "Bearer "+bearer)
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+		return rec
+	}
+
+	desktop := login("Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/120.0.0.0 Safari/537.36")
+	login("Mozilla/5.0 (iPhone; CPU iPhone OS 17_0 like Mac OS X) AppleWebKit/605.1.15 (KHTML, like Gecko) Version/17.0 Mobile/15E148 Safari/604.1")
+	login("curl/8.0")
+
+	var list []sessionResponse
+	json.NewDecoder(call(http.MethodGet, "/sessions", desktop).Body).Decode(&list)
+	if len(list) != 3 {
+		t.Fatalf("expected 3 sessions, got %d", len(list))
+	}
+
+	var current, mobile string
+	for _, sess := range list {
+		if sess.Current {
+			current = sess.ID
+			if sess.Device.Browser != "Chrome" || sess.Device.OS != "Windows" {
+				t.Errorf("unexpected device for current session: %+v", sess.Device)
+			}
+		}
+		if sess.Device.Type == "mobile" {
+			mobile = sess.ID
+		}
+	}
+	if current == "" || mobile == "" {
+		t.Fatalf("expected current and mobile sessions, got %+v", list)
+	}
+
+	if rec := call(http.MethodDelete, "/sessions/"+mobile, desktop); rec.Code != http.StatusNoContent {
+		t.Fatalf("revoke one: %d", rec.Code)
+	}
+	if rec := call(http.MethodDelete, "/sessions/unknown", desktop); rec.Code != http.StatusNotFound {
+		t.Errorf("expected 404 for unknown session, got %d", rec.Code)
+	}
+
+	if rec := call(http.MethodDelete, "/sessions", desktop); rec.Code != http.StatusNoContent {
+		t.Fatalf("revoke others: %d", rec.Code)
+	}
+	remaining, _ := sessions.ListSessionsByUser(context.Background(), "u1")
+	if len(remaining) != 1 || remaining[0].ID != current {
+		t.Errorf("expected only the current session to remain, got %+v", remaining)
+	}
+}
+
+// brokenRevocations fails every revocation, like an unreachable Redis.
+type brokenRevocations struct{ *memory.Memory }
+
+func (brokenRevocations) Revoke(context.Context, string, time.Duration) error {
+	return errors.New("connection refused")
+}
+
+func TestSessions_RevokeOthersReportsErrors(t *testing.T) {
+	mem := memory.New()
+	hash, _ := bcrypt.GenerateFromPassword([]byte("password"), bcrypt.MinCost)
+	mem.CreateUser(context.Background(), &data.User{ID: "u1", Email: "a@example.com", PasswordHash: string(hash)})
+	s := New(Opts{URL: "http://localhost:8080", UserStore: mem, SessionStore: mem, RevocationStore: brokenRevocations{mem}})
+	h, _ := s.Handlers()
+
+	var tokens []string
+	for i := 0; i < 2; i++ {
+		var resp struct {
+			Token string `json:"token"`
+		}
+		json.NewDecoder(doJSON(t, h, http.MethodPost, "/login", []byte(`{"email":"a@example.com","password":"password"}`), nil, "").Body).Decode(&resp)
+		tokens = append(tokens, resp.Token)
+	}
+	if rec := doJSON(t, h, http.MethodDelete, "/sessions", nil, nil, tokens[1]); rec.Code != http.StatusInternalServerError {
+		t.Errorf("expected 500 when revoking fails, got %d", rec.Code)
+	}
+}
+
+func TestParseUserAgent(t *testing.T) {
+	cases := []struct {
+		ua   string
+		want Device
+	}{
+		{"Mozilla/5.0 (Macintosh; Intel Mac OS X 10_15_7) AppleWebKit/605.1.15 (KHTML, like Gecko) Version/17.1 Safari/605.1.15", Device{"Safari", "macOS", "desktop"}},
+		{"Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/120.0.0.0 Safari/537.36 Edg/120.0.0.0", Device{"Edge", "Windows", "desktop"}},
+		{"Mozilla/5.0 (Linux; Android 14; Pixel 8) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/120.0.0.0 Mobile Safari/537.36", Device{"Chrome", "Android", "mobile"}},
+		{"Mozilla/5.0 (iPad; CPU OS 17_0 like Mac OS X) AppleWebKit/605.1.15 (KHTML, like Gecko) Version/17.0 Mobile/15E148 Safari/604.1", Device{"Safari", "iPadOS", "tablet"}},
+		{"Mozilla/5.0 (X11; Linux x86_64; rv:121.0) Gecko/20100101 Firefox/121.0", Device{"Firefox", "Linux", "desktop"}},
+		{"", Device{"Unknown", "Unknown", "desktop"}},
+	}
+	for _, c := range cases {
+		if got := parseUserAgent(c.ua); got != c.want {
+			t.Errorf("parseUserAgent(%q) = %+v, want %+v", c.ua, got, c.want)
+		}
+	}
+}
+
+func TestLogout_RevokesToken(t *testing.T) {
+	users := memory.New()
+	hash, _ := bcrypt.GenerateFromPassword([]byte("password"), bcrypt.MinCost)
+	users.CreateUser(context.Background(), &data.User{ID: "u1", Email: "a@example.com", PasswordHash: string(hash)})
+	sessions := memory.New()
+
+	s := New(Opts{URL: "http://localhost:8080", UserStore: users, SessionStore: sessions})
+	h, _ := s.Handlers()
+
+	rec := doJSON(t, h, http.MethodPost, "/login", []byte(`{"email":"a@example.com","password":"password"}`), nil, "")
+	var resp struct {
+		Token        string `json:"token"`
+		RefreshToken string `json:"refresh_token"`
+	}
+	json.NewDecoder(rec.Body).Decode(&resp)
+
+	if rec := doJSON(t, h, http.MethodPost, "/logout", nil, nil, resp.Token); rec.Code != http.StatusOK {
+		t.Fatalf("logout: %d", rec.Code)
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/sessions", nil)
+	req.Header.Set("Authorization", "Bearer "+resp.Token)
+	rec = httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	if rec.Code != http.StatusUnauthorized {
+		t.Errorf("expected logged-out token to be rejected, got %d", rec.Code)
+	}
+
+	rec = doJSON(t, h, http.MethodPost, "/refresh", []byte(`{"refresh_token":"`+resp.RefreshToken+`"}`), nil, "")
+	if rec.Code != http.StatusUnauthorized {
+		t.Errorf("expected refresh token to be revoked on logout, got %d", rec.Code)
+	}
+}
+
+func TestRefresh_ClaimsFailureKeepsSession(t *testing.T) {
+	users := memory.New()
+	hash, _ := bcrypt.GenerateFromPassword([]byte("password"), bcrypt.MinCost)
+	users.CreateUser(context.Background(), &data.User{ID: "u1", Email: "a@example.com", PasswordHash: string(hash)})
+
+	var failing bool
+	s := New(Opts{
+		URL:          "http://localhost:8080",
+		UserStore:    users,
+		SessionStore: users,
+		ClaimsEnricher: func(context.Context, *http.Request, *token.Claims) error {
+			if failing {
+				return errors.New("claims source unavailable")
+			}
+			return nil
+		},
+	})
+	h, _ := s.Handlers()
+
+	var tokens struct {
+		RefreshToken string `json:"refresh_token"`
+	}
+	json.NewDecoder(doJSON(t, h, http.MethodPost, "/login", []byte(`{"email":"a@example.com","password":"password"}`), nil, "").Body).Decode(&tokens)
+	refresh := func() int {
+		return doJSON(t, h, http.MethodPost, "/refresh", []byte(`{"refresh_token":"`+tokens.RefreshToken+`"}`), nil, "").Code
+	}
+
+	failing = true
+	if code := refresh(); code != http.StatusInternalServerError {
+		t.Fatalf("expected 500 when the claims can't be built, got %d", code)
+	}
+	if sessions, _ := users.ListSessionsByUser(context.Background(), "u1"); len(sessions) != 1 {
+		t.Errorf("a failed refresh should leave only the original session, got %d", len(sessions))
+	}
+
+	failing = false
+	if code := refresh(); code != http.StatusOK {
+		t.Errorf("the refresh token should still work after a failed refresh, got %d", code)
+	}
+}
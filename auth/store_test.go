@@ -0,0 +1,16 @@
+package auth
+
+import (
+	"context"
+	"time"
+)
+
+// noLockouts disables lockout so tests can exercise other limits in isolation.
+type noLockouts struct{}
+
+func (noLockouts) RegisterFailure(context.Context, string, time.Duration) (int, error) { return 0, nil }
+func (noLockouts) SetLockedUntil(context.Context, string, time.Time) error             { return nil }
+func (noLockouts) GetLockedUntil(context.Context, string) (time.Time, error) {
+	return time.Time{}, nil
+}
+func (noLockouts) ResetFailures(context.Context, string) error { return nil }
@@ -0,0 +1,216 @@
+package auth
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+
+	"auth-go-skd/data"
+	"auth-go-skd/provider"
+	"auth-go-skd/provider/github"
+	"auth-go-skd/provider/google"
+	"auth-go-skd/provider/oidc"
+)
+
+// tenant is a loaded data.Tenant with its providers built.
+type tenant struct {
+	cfg       data.Tenant
+	providers map[string]provider.Provider
+	// stale is set when the providers are from an earlier configuration because rebuilding
+	// them failed; the next reload tries again.
+	stale bool
+}
+
+// tenantSet is an immutable snapshot of all tenants, swapped as a whole on reload.
+type tenantSet struct {
+	byID     map[string]*tenant
+	byHost   map[string]*tenant
+	prefixes []*tenant // longest PathPrefix first
+}
+
+// DefaultProviderFactory builds the google, github and oidc providers of a tenant.
+func DefaultProviderFactory(ctx context.Context, cfg data.ProviderConfig) (provider.Provider, error) {
+	switch cfg.Type {
+	case "google":
+		return google.New(cfg.ClientID, cfg.ClientSecret, cfg.RedirectURL), nil
+	case "github":
+		return github.New(cfg.ClientID, cfg.ClientSecret, cfg.RedirectURL), nil
+	case "oidc":
+		name := cfg.Name
+		if name == "" {
+			name = cfg.Type
+		}
+		return oidc.New(ctx, name, cfg.IssuerURL, cfg.ClientID, cfg.ClientSecret, cfg.RedirectURL, cfg.Scopes...)
+	default:
+		return nil, fmt.Errorf("unknown provider type %q", cfg.Type)
+	}
+}
+
+// ReloadTenants replaces the tenant configuration with the current contents of
+// Opts.TenantStore. The stored configuration always applies, but providers are only rebuilt
+// for tenants whose UpdatedAt changed. When they can't be built, e.g. while an issuer is
+// unreachable, the tenant keeps its previous providers until a later reload succeeds, or is
+// left out if it is new.
+func (s *Service) ReloadTenants(ctx context.Context) error {
+	if s.opts.TenantStore == nil {
+		return nil
+	}
+	list, err := s.opts.TenantStore.ListTenants(ctx)
+	if err != nil {
+		return err
+	}
+
+	var prev map[string]*tenant
+	if old := s.tenants.Load(); old != nil {
+		prev = old.byID
+	}
+	set := &tenantSet{byID: make(map[string]*tenant), byHost: make(map[string]*tenant)}
+	for _, cfg := range list {
+		t := &tenant{cfg: cfg}
+		old, ok := prev[cfg.ID]
+		if ok && !old.stale && old.cfg.UpdatedAt.Equal(cfg.UpdatedAt) {
+			t.providers = old.providers
+		} else {
+			t.providers = make(map[string]provider.Provider)
+			if err := s.buildProviders(ctx, t); err != nil {
+				if !ok {
+					s.logger.Printf("tenant %s skipped: %v", cfg.ID, err)
+					continue
+				}
+				s.logger.Printf("tenant %s keeps its previous providers: %v", cfg.ID, err)
+				t.providers, t.stale = old.providers, true
+			}
+		}
+		set.byID[t.cfg.ID] = t
+		for _, host := range t.cfg.Hosts {
+			set.byHost[strings.ToLower(host)] = t
+		}
+		if t.cfg.PathPrefix != "" {
+			set.prefixes = append(set.prefixes, t)
+		}
+	}
+	sort.SliceStable(set.prefixes, func(i, j int) bool {
+		return len(set.prefixes[i].cfg.PathPrefix) > len(set.prefixes[j].cfg.PathPrefix)
+	})
+
+	s.tenants.Store(set)
+	return nil
+}
+
+func (s *Service) buildProviders(ctx context.Context, t *tenant) error {
+	for _, pc := range t.cfg.Providers {
+		name := pc.Name
+		if name == "" {
+			name = pc.Type
+		}
+		p, err := s.opts.ProviderFactory(ctx, pc)
+		if err != nil {
+			return fmt.Errorf("provider %s: %w", name, err)
+		}
+		t.providers[name] = p
+	}
+	return nil
+}
+
+// WatchTenants reloads the tenant configuration every Opts.TenantReloadInterval until ctx is
+// done. Run it in its own goroutine.
+func (s *Service) WatchTenants(ctx context.Context) {
+	ticker := time.NewTicker(s.opts.TenantReloadInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := s.ReloadTenants(ctx); err != nil {
+				s.logger.Printf("reload tenants: %v", err)
+			}
+		}
+	}
+}
+
+// tenantFor returns the tenant serving r, matched by host name first, then by path prefix.
+func (s *Service) tenantFor(r *http.Request) *tenant {
+	set := s.tenants.Load()
+	if set == nil || r == nil {
+		return nil
+	}
+
+	host := r.Host
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	if t, ok := set.byHost[strings.ToLower(host)]; ok {
+		return t
+	}
+	for _, t := range set.prefixes {
+		// Match whole path segments, so "/acme" doesn't claim "/acme-evil".
+		prefix := strings.TrimRight(t.cfg.PathPrefix, "/")
+		if r.URL.Path == prefix || strings.HasPrefix(r.URL.Path, prefix+"/") {
+			return t
+		}
+	}
+	return nil
+}
+
+// authURL is the URL the handlers serving r are mounted at, for links sent by mail: Opts.URL
+// + "/auth", on the tenant's host or under its path prefix when r belongs to a tenant, so the
+// link is checked against the same secret it was signed with.
+func (s *Service) authURL(r *http.Request) string {
+	base := strings.TrimRight(s.opts.URL, "/")
+	t := s.tenantFor(r)
+	if t == nil {
+		return base + "/auth"
+	}
+	host := r.Host
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	if slices.ContainsFunc(t.cfg.Hosts, func(h string) bool { return strings.EqualFold(h, host) }) {
+		if u, err := url.Parse(base); err == nil {
+			u.Host = r.Host
+			base = u.String()
+		}
+		return base + "/auth"
+	}
+	return base + strings.TrimRight(t.cfg.PathPrefix, "/") + "/auth"
+}
+
+// provider looks name up among the providers of r's tenant, then the ones added with Add. The
+// tenant is returned when the provider is one of its own.
+func (s *Service) provider(r *http.Request, name string) (provider.Provider, *tenant, bool) {
+	if t := s.tenantFor(r); t != nil {
+		if p, ok := t.providers[name]; ok {
+			return p, t, true
+		}
+	}
+	p, ok := s.providers[name]
+	return p, nil, ok
+}
+
+// identityProvider is the provider name identities of a tenant's provider are stored under.
+// Tenants run their own issuers, so their subjects get a namespace per tenant.
+func (t *tenant) identityProvider(name string) string {
+	return t.cfg.ID + ":" + name
+}
+
+// verifiedEmail reports whether email is in one of the tenant's verified domains.
+func (t *tenant) verifiedEmail(email string) bool {
+	_, domain, ok := strings.Cut(email, "@")
+	return ok && slices.Contains(t.cfg.VerifiedDomains, strings.ToLower(domain))
+}
+
+// secretFor returns the signing key for tokens issued or checked on r: the tenant's secret
+// when it has one, the service secret otherwise.
+func (s *Service) secretFor(r *http.Request, id string) ([]byte, error) {
+	if t := s.tenantFor(r); t != nil && t.cfg.Secret != "" {
+		return []byte(t.cfg.Secret), nil
+	}
+	return s.secret(id)
+}
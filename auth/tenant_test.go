@@ -0,0 +1,282 @@
+package auth
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strings"
+	"testing"
+
+	"auth-go-skd/data"
+	"auth-go-skd/mailer"
+	"auth-go-skd/provider"
+	"auth-go-skd/store/memory"
+	"auth-go-skd/token"
+
+	"github.com/go-chi/chi/v5"
+)
+
+// fakeFactory builds a fakeProvider whose user ID is the client ID, so tests can tell tenants apart.
+func fakeFactory(_ context.Context, cfg data.ProviderConfig) (provider.Provider, error) {
+	return fakeProvider{user: token.User{ID: cfg.ClientID, Email: cfg.ClientID + "@example.com"}}, nil
+}
+
+func tenantService(t *testing.T, tenants ...data.Tenant) (*Service, *memory.Memory) {
+	t.Helper()
+	mem := memory.New()
+	for _, tn := range tenants {
+		if err := mem.SaveTenant(context.Background(), &tn); err != nil {
+			t.Fatal(err)
+		}
+	}
+	s := New(Opts{URL: "http://localhost:8080", Secret: "global", TenantStore: mem, ProviderFactory: fakeFactory})
+	return s, mem
+}
+
+func TestTenants_Resolve(t *testing.T) {
+	s, _ := tenantService(t,
+		data.Tenant{ID: "acme", Hosts: []string{"acme.example.com"}},
+		data.Tenant{ID: "globex", PathPrefix: "/globex/"},
+		data.Tenant{ID: "globex-eu", PathPrefix: "/globex/eu/"},
+	)
+
+	cases := []struct{ url, want string }{
+		{"http://acme.example.com/login", "acme"},
+		{"http://ACME.example.com:8443/login", "acme"},
+		{"http://localhost/globex/login", "globex"},
+		{"http://localhost/globex/eu/login", "globex-eu"},
+		{"http://localhost/globex", "globex"},
+		{"http://localhost/globex-evil/login", ""},
+		{"http://localhost/globex/europe/login", "globex"},
+		{"http://localhost/login", ""},
+	}
+	for _, c := range cases {
+		got := ""
+		if tn := s.tenantFor(httptest.NewRequest(http.MethodGet, c.url, nil)); tn != nil {
+			got = tn.cfg.ID
+		}
+		if got != c.want {
+			t.Errorf("%s: expected tenant %q, got %q", c.url, c.want, got)
+		}
+	}
+}
+
+func TestTenants_ProviderAndSecret(t *testing.T) {
+	s, _ := tenantService(t,
+		data.Tenant{ID: "acme", Hosts: []string{"acme.example.com"}, Secret: "acme-secret",
+			Providers: []data.ProviderConfig{{Type: "oidc", Name: "fake", ClientID: "acme-user"}}},
+		data.Tenant{ID: "globex", Hosts: []string{"globex.example.com"}, Secret: "globex-secret"},
+	)
+	h, _ := s.Handlers()
+
+	req := httptest.NewRequest(http.MethodGet, "http://acme.example.com/fake/callback?state=st&code=c", nil)
+	req.AddCookie(&http.Cookie{Name: "oauth_state", Value: "st"})
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("callback: %d %s", rec.Code, rec.Body)
+	}
+	var resp struct {
+		Token string     `json:"token"`
+		User  token.User `json:"user"`
+	}
+	json.NewDecoder(rec.Body).Decode(&resp)
+	if resp.User.ID != "acme-user" {
+		t.Fatalf("expected the tenant's provider, got user %q", resp.User.ID)
+	}
+
+	// Another tenant has no such provider
+	req = httptest.NewRequest(http.MethodGet, "http://globex.example.com/fake/login", nil)
+	rec = httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	if rec.Code != http.StatusNotFound {
+		t.Errorf("expected 404 for a provider of another tenant, got %d", rec.Code)
+	}
+
+	protected := s.Middleware().Auth(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	for host, want := range map[string]int{
+		"acme.example.com":   http.StatusOK,
+		"globex.example.com": http.StatusUnauthorized,
+		"localhost":          http.StatusUnauthorized,
+	} {
+		req := httptest.NewRequest(http.MethodGet, "http://"+host+"/me", nil)
+		req.Header.Set("Authorization", "Bearer "+resp.Token)
+		rec := httptest.NewRecorder()
+		protected.ServeHTTP(rec, req)
+		if rec.Code != want {
+			t.Errorf("%s: expected %d, got %d", host, want, rec.Code)
+		}
+	}
+	if _, err := s.ParseToken(resp.Token); err == nil {
+		t.Error("expected a tenant token to fail with the service secret")
+	}
+}
+
+func TestTenants_Identities(t *testing.T) {
+	ctx := context.Background()
+	mem := memory.New()
+	mem.CreateUser(ctx, &data.User{ID: "u1", Email: "shared@example.com", Role: "user"})
+	// Both tenants' issuers return the subject "shared" with the email shared@example.com.
+	fake := []data.ProviderConfig{{Type: "oidc", Name: "fake", ClientID: "shared"}}
+	mem.SaveTenant(ctx, &data.Tenant{ID: "acme", Hosts: []string{"acme.example.com"}, Providers: fake, VerifiedDomains: []string{"example.com"}})
+	mem.SaveTenant(ctx, &data.Tenant{ID: "evil", Hosts: []string{"evil.example.com"}, Providers: fake})
+	s := New(Opts{URL: "http://localhost:8080", UserStore: mem, IdentityStore: mem, TenantStore: mem, ProviderFactory: fakeFactory})
+	h, _ := s.Handlers()
+
+	callback := func(host string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "http://"+host+"/fake/callback?state=st&code=c", nil)
+		req.AddCookie(&http.Cookie{Name: "oauth_state", Value: "st"})
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+		return rec
+	}
+
+	rec := callback("acme.example.com")
+	var resp struct {
+		User token.User `json:"user"`
+	}
+	json.NewDecoder(rec.Body).Decode(&resp)
+	if rec.Code != http.StatusOK || resp.User.ID != "u1" {
+		t.Fatalf("verified domain: expected to link u1, got %d %+v", rec.Code, resp.User)
+	}
+	if _, err := mem.GetIdentityByProvider(ctx, "acme:fake", "shared"); err != nil {
+		t.Errorf("expected the identity under the tenant's namespace: %v", err)
+	}
+
+	if rec := callback("evil.example.com"); rec.Code != http.StatusForbidden {
+		t.Errorf("another tenant's issuer must not reach u1, got %d %s", rec.Code, rec.Body)
+	}
+}
+
+func TestTenants_PathPrefixRoutes(t *testing.T) {
+	s, _ := tenantService(t, data.Tenant{ID: "acme", PathPrefix: "/acme/",
+		Providers: []data.ProviderConfig{{Type: "oidc", Name: "fake", ClientID: "acme-user"}}})
+	h, _ := s.Handlers()
+	r := chi.NewRouter()
+	r.Mount("/acme/auth", h)
+	r.Mount("/auth", h)
+
+	for path, want := range map[string]int{
+		"/acme/auth/fake/login": http.StatusTemporaryRedirect,
+		"/auth/fake/login":      http.StatusNotFound,
+	} {
+		rec := httptest.NewRecorder()
+		r.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, path, nil))
+		if rec.Code != want {
+			t.Errorf("%s: expected %d, got %d", path, want, rec.Code)
+		}
+	}
+}
+
+func TestTenants_Reload(t *testing.T) {
+	s, mem := tenantService(t)
+	ctx := context.Background()
+	req := httptest.NewRequest(http.MethodGet, "http://acme.example.com/fake/login", nil)
+
+	if _, _, ok := s.provider(req, "fake"); ok {
+		t.Fatal("expected no provider before the tenant exists")
+	}
+
+	mem.SaveTenant(ctx, &data.Tenant{ID: "acme", Hosts: []string{"acme.example.com"},
+		Providers: []data.ProviderConfig{{Type: "oidc", Name: "fake", ClientID: "acme-user"}}})
+	if err := s.ReloadTenants(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, ok := s.provider(req, "fake"); !ok {
+		t.Fatal("expected the provider after reloading")
+	}
+
+	mem.DeleteTenant(ctx, "acme")
+	if err := s.ReloadTenants(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if s.tenantFor(req) != nil {
+		t.Error("expected the deleted tenant to be gone after reloading")
+	}
+}
+
+func TestTenants_ReloadKeepsProvidersOnFailure(t *testing.T) {
+	ctx := context.Background()
+	mem := memory.New()
+	acme := data.Tenant{ID: "acme", Hosts: []string{"acme.example.com"}, Secret: "acme-secret",
+		Providers: []data.ProviderConfig{{Type: "oidc", Name: "fake", ClientID: "acme-user"}}}
+	mem.SaveTenant(ctx, &acme)
+
+	builds, down := 0, false
+	s := New(Opts{URL: "http://localhost:8080", Secret: "global", TenantStore: mem,
+		ProviderFactory: func(ctx context.Context, cfg data.ProviderConfig) (provider.Provider, error) {
+			builds++
+			if down {
+				return nil, errors.New("issuer unreachable")
+			}
+			return fakeFactory(ctx, cfg)
+		}})
+	req := httptest.NewRequest(http.MethodGet, "http://acme.example.com/fake/login", nil)
+	reload := func(wantBuilds int) {
+		t.Helper()
+		if err := s.ReloadTenants(ctx); err != nil {
+			t.Fatal(err)
+		}
+		if builds != wantBuilds {
+			t.Errorf("expected %d provider builds, got %d", wantBuilds, builds)
+		}
+	}
+
+	reload(1) // unchanged tenants aren't rebuilt
+
+	down = true
+	acme.Secret = "acme-rotated"
+	mem.SaveTenant(ctx, &acme)
+	reload(2)
+	if tn := s.tenantFor(req); tn == nil || tn.cfg.Secret != "acme-rotated" {
+		t.Fatal("expected the new configuration to apply while the issuer is down")
+	}
+	if _, _, ok := s.provider(req, "fake"); !ok {
+		t.Error("expected the previous providers to stay")
+	}
+
+	reload(3) // failed builds are retried
+	down = false
+	reload(4)
+	reload(4)
+}
+
+func TestTenants_MagicLink(t *testing.T) {
+	var sent []mailer.Message
+	mem := memory.New()
+	mem.SaveTenant(context.Background(), &data.Tenant{ID: "acme", PathPrefix: "/acme/", Secret: "acme-secret"})
+	mem.SaveTenant(context.Background(), &data.Tenant{ID: "globex", Hosts: []string{"globex.example.com"}, Secret: "globex-secret"})
+	s := New(Opts{URL: "http://localhost:8080", Secret: "global", TenantStore: mem, UserStore: mem,
+		Mailer: mailer.Func(func(_ context.Context, msg mailer.Message) error {
+			sent = append(sent, msg)
+			return nil
+		})})
+	h, _ := s.Handlers()
+	r := chi.NewRouter()
+	r.Mount("/acme/auth", h)
+	r.Mount("/auth", h)
+
+	for base, want := range map[string]string{
+		"http://localhost:8080/acme/auth": "http://localhost:8080/acme/auth/magic/verify",
+		"http://globex.example.com/auth":  "http://globex.example.com/auth/magic/verify",
+	} {
+		sent = nil
+		rec := httptest.NewRecorder()
+		r.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, base+"/magic/request", jsonBody(`{"email":"a@example.com"}`)))
+		if rec.Code != http.StatusAccepted || len(sent) != 1 {
+			t.Fatalf("%s: request: %d %s", base, rec.Code, rec.Body)
+		}
+		link := regexp.MustCompile(`http\S+`).FindString(sent[0].Body)
+		if !strings.HasPrefix(link, want+"?") {
+			t.Errorf("%s: expected a link to %s, got %s", base, want, link)
+		}
+		rec = httptest.NewRecorder()
+		r.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, link, nil))
+		if rec.Code != http.StatusOK {
+			t.Errorf("%s: verify: %d %s", base, rec.Code, rec.Body)
+		}
+	}
+}
@@ -0,0 +1,56 @@
+package auth
+
+import (
+	"context"
+
+	"auth-go-skd/store"
+)
+
+// optsStore presents the configured stores as one store.Store. Stores that are not
+// configured are nil, so callers only use the ones their flow requires.
+type optsStore struct {
+	store.UserStorage
+	store.SessionStorage
+	store.IdentityStorage
+	store.CredentialStorage
+	store.OrganizationStorage
+	store.MembershipStorage
+	store.InvitationStorage
+}
+
+// inTx runs fn in one transaction when every configured user, identity, organization,
+// membership and invitation store is the same store.Transactor. Otherwise fn writes to the stores directly
+// and a failure can leave partial writes.
+func (s *Service) inTx(ctx context.Context, fn func(tx store.Store) error) error {
+	var txr store.Transactor
+	for _, st := range []any{s.opts.UserStore, s.opts.IdentityStore, s.opts.OrganizationStore, s.opts.MembershipStore, s.opts.InvitationStore} {
+		if st == nil {
+			continue
+		}
+		if txr == nil {
+			t, ok := st.(store.Transactor)
+			if !ok {
+				return fn(s.optsStore())
+			}
+			txr = t
+		} else if st != any(txr) {
+			return fn(s.optsStore())
+		}
+	}
+	if txr == nil {
+		return fn(s.optsStore())
+	}
+	return txr.WithTx(ctx, fn)
+}
+
+func (s *Service) optsStore() store.Store {
+	return optsStore{
+		UserStorage:         s.opts.UserStore,
+		SessionStorage:      s.opts.SessionStore,
+		IdentityStorage:     s.opts.IdentityStore,
+		CredentialStorage:   s.opts.CredentialStore,
+		OrganizationStorage: s.opts.OrganizationStore,
+		MembershipStorage:   s.opts.MembershipStore,
+		InvitationStorage:   s.opts.InvitationStore,
+	}
+}
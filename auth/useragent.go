@@ -0,0 +1,64 @@
+package auth
+
+import "strings"
+
+// Device is a coarse description of the client that created a session.
+type Device struct {
+	Browser string `json:"browser"`
+	OS      string `json:"os"`
+	Type    string `json:"type"` // desktop, mobile, tablet or bot
+}
+
+// parseUserAgent recognises the common browsers and platforms. Order matters:
+// Edge and Opera also claim to be Chrome, and Chrome also claims to be Safari.
+func parseUserAgent(ua string) Device {
+	d := Device{Browser: "Unknown", OS: "Unknown", Type: "desktop"}
+	l := strings.ToLower(ua)
+
+	switch {
+	case strings.Contains(l, "edg/"), strings.Contains(l, "edge/"):
+		d.Browser = "Edge"
+	case strings.Contains(l, "opr/"), strings.Contains(l, "opera"):
+		d.Browser = "Opera"
+	case strings.Contains(l, "firefox/"), strings.Contains(l, "fxios/"):
+		d.Browser = "Firefox"
+	case strings.Contains(l, "chrome/"), strings.Contains(l, "crios/"):
+		d.Browser = "Chrome"
+	case strings.Contains(l, "safari/"):
+		d.Browser = "Safari"
+	case strings.Contains(l, "curl/"):
+		d.Browser = "curl"
+	case strings.Contains(l, "okhttp"), strings.Contains(l, "dalvik"):
+		d.Browser = "Android App"
+	case strings.Contains(l, "cfnetwork"):
+		d.Browser = "iOS App"
+	}
+
+	switch {
+	case strings.Contains(l, "iphone"), strings.Contains(l, "ipod"):
+		d.OS = "iOS"
+	case strings.Contains(l, "ipad"):
+		d.OS = "iPadOS"
+	case strings.Contains(l, "android"):
+		d.OS = "Android"
+	case strings.Contains(l, "windows"):
+		d.OS = "Windows"
+	case strings.Contains(l, "mac os x"), strings.Contains(l, "macintosh"), strings.Contains(l, "darwin"):
+		d.OS = "macOS"
+	case strings.Contains(l, "cros"):
+		d.OS = "ChromeOS"
+	case strings.Contains(l, "linux"):
+		d.OS = "Linux"
+	}
+
+	switch {
+	case strings.Contains(l, "bot"), strings.Contains(l, "spider"), strings.Contains(l, "crawl"):
+		d.Type = "bot"
+	case strings.Contains(l, "ipad"), strings.Contains(l, "tablet"),
+		d.OS == "Android" && !strings.Contains(l, "mobile"):
+		d.Type = "tablet"
+	case strings.Contains(l, "mobi"), d.OS == "iOS":
+		d.Type = "mobile"
+	}
+	return d
+}
@@ -1,7 +1,9 @@
 package avatar
 
 import (
+	"errors"
 	"io"
+	"io/fs"
 	"os"
 	"path"
 )
@@ -43,3 +45,14 @@ func (l *LocalFS) ID(avatar string) (id string) {
 func (l *LocalFS) Remove(avatar string) error {
 	return os.Remove(path.Join(l.Location, avatar))
 }
+
+func (l *LocalFS) Find(userID string) (avatar string, err error) {
+	avatar = userID + ".image"
+	if _, err := os.Stat(path.Join(l.Location, avatar)); err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return "", nil
+		}
+		return "", err
+	}
+	return avatar, nil
+}
@@ -9,4 +9,6 @@ type Store interface {
 	Get(avatar string) (reader io.ReadCloser, size int64, err error)
 	ID(avatar string) (id string)
 	Remove(avatar string) error
+	// Find returns the avatar Put stored for userID, or "" when there is none.
+	Find(userID string) (avatar string, err error)
 }
@@ -7,8 +7,10 @@ import (
 	"github.com/go-chi/chi/v5"
 	"github.com/go-chi/chi/v5/middleware"
 
+	"auth-go-skd/audit"
 	"auth-go-skd/auth"
 	"auth-go-skd/config"
+	"auth-go-skd/limiter"
 	"auth-go-skd/provider/google"
 )
 
@@ -20,8 +22,10 @@ func main() {
 	}
 
 	service := auth.New(auth.Opts{
-		Secret: "super-secret-key-change-me",
-		URL:    "http://localhost:" + cfg.HTTP.Port,
+		Secret:      "super-secret-key-change-me",
+		URL:         "http://localhost:" + cfg.HTTP.Port,
+		RateLimiter: limiter.New(cfg.Limiter, nil),
+		AuditSink:   audit.NewSlog(nil),
 	})
 
 	service.Add(google.New(
@@ -38,7 +42,7 @@ func main() {
 	r.Mount("/avatar", avatarHandler)
 
 	r.Group(func(r chi.Router) {
-		r.Use(service.Middleware().Auth)
+		r.Use(service.Middleware().UserAuth)
 		r.Get("/private", func(w http.ResponseWriter, r *http.Request) {
 			user := auth.User(r)
 			w.Write([]byte("Hello " + user.Name))
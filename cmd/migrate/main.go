@@ -0,0 +1,65 @@
+// Command migrate applies the embedded Postgres migrations.
+//
+//	go run ./cmd/migrate up         # apply all pending migrations
+//	go run ./cmd/migrate down       # roll back the latest migration
+//	go run ./cmd/migrate to N       # migrate up or down to version N
+//	go run ./cmd/migrate version    # print the current version
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+
+	"auth-go-skd/config"
+	"auth-go-skd/store/postgres"
+)
+
+func main() {
+	if len(os.Args) < 2 {
+		log.Fatal("usage: migrate up|down|to N|version")
+	}
+
+	cfg, err := config.Load()
+	if err != nil {
+		log.Fatalf("failed to load config: %v", err)
+	}
+	cfg.Postgres.AutoMigrate = false
+
+	db, err := postgres.New(cfg.Postgres)
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer db.Close()
+
+	ctx := context.Background()
+	switch os.Args[1] {
+	case "up":
+		err = db.Migrate(ctx)
+	case "down":
+		err = db.MigrateDown(ctx)
+	case "to":
+		if len(os.Args) < 3 {
+			log.Fatal("usage: migrate to N")
+		}
+		version, perr := strconv.ParseUint(os.Args[2], 10, 32)
+		if perr != nil {
+			log.Fatalf("bad version %q", os.Args[2])
+		}
+		err = db.MigrateTo(ctx, uint(version))
+	case "version":
+	default:
+		log.Fatalf("unknown command %q", os.Args[1])
+	}
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	version, err := db.MigrationVersion(ctx)
+	if err != nil {
+		log.Fatal(err)
+	}
+	fmt.Printf("schema version %d\n", version)
+}
@@ -13,6 +13,7 @@ type Config struct {
 	Log      Log      `yaml:"log"`
 	Postgres Postgres `yaml:"postgres"`
 	Redis    Redis    `yaml:"redis"`
+	SQLite   SQLite   `yaml:"sqlite"`
 	Limiter  Limiter  `yaml:"limiter"`
 	OAuth    OAuth    `yaml:"oauth"`
 }
@@ -44,13 +45,14 @@ type Log struct {
 }
 
 type Postgres struct {
-	Host     string `yaml:"host" env:"POSTGRES_HOST" env-default:"localhost"`
-	Port     string `yaml:"port" env:"POSTGRES_PORT" env-default:"5432"`
-	User     string `yaml:"user" env:"POSTGRES_USER" env-default:"postgres"`
-	Password string `yaml:"password" env:"POSTGRES_PASSWORD" env-default:"postgres"`
-	DBName   string `yaml:"dbname" env:"POSTGRES_DB" env-default:"auth_db"`
-	SSLMode  string `yaml:"ssl_mode" env:"POSTGRES_SSL_MODE" env-default:"disable"`
-	PoolSize int    `yaml:"pool_size" env:"POSTGRES_POOL_SIZE" env-default:"10"`
+	Host        string `yaml:"host" env:"POSTGRES_HOST" env-default:"localhost"`
+	Port        string `yaml:"port" env:"POSTGRES_PORT" env-default:"5432"`
+	User        string `yaml:"user" env:"POSTGRES_USER" env-default:"postgres"`
+	Password    string `yaml:"password" env:"POSTGRES_PASSWORD" env-default:"postgres"`
+	DBName      string `yaml:"dbname" env:"POSTGRES_DB" env-default:"auth_db"`
+	SSLMode     string `yaml:"ssl_mode" env:"POSTGRES_SSL_MODE" env-default:"disable"`
+	PoolSize    int    `yaml:"pool_size" env:"POSTGRES_POOL_SIZE" env-default:"10"`
+	AutoMigrate bool   `yaml:"auto_migrate" env:"POSTGRES_AUTO_MIGRATE" env-default:"false"`
 }
 
 type Redis struct {
@@ -59,6 +61,10 @@ type Redis struct {
 	DB       int    `yaml:"db" env:"REDIS_DB" env-default:"0"`
 }
 
+type SQLite struct {
+	Path string `yaml:"path" env:"SQLITE_PATH" env-default:"auth.db"`
+}
+
 type Limiter struct {
 	RPS   int           `yaml:"rps" env:"LIMITER_RPS" env-default:"10"`
 	Burst int           `yaml:"burst" env:"LIMITER_BURST" env-default:"20"`
@@ -0,0 +1,20 @@
+package data
+
+import (
+	"time"
+)
+
+// APIKey is a long-lived personal access token of a user. Only a hash of the key is stored;
+// Prefix is the public part of the key it is looked up by.
+type APIKey struct {
+	ID         string    `json:"id"`
+	UserID     string    `json:"user_id"`
+	Name       string    `json:"name"`
+	Prefix     string    `json:"prefix"`
+	KeyHash    string    `json:"-"`
+	Scopes     []string  `json:"scopes"`
+	ExpiresAt  time.Time `json:"expires_at,omitzero"` // zero means the key doesn't expire
+	LastUsedAt time.Time `json:"last_used_at,omitzero"`
+	LastUsedIP string    `json:"last_used_ip,omitempty"`
+	CreatedAt  time.Time `json:"created_at"`
+}
@@ -0,0 +1,17 @@
+package data
+
+import (
+	"time"
+)
+
+// Client is an OAuth2 client: a machine client of the client_credentials grant or, with
+// RedirectURIs, an OpenID Connect relying party. Only a hash of its secret is stored; public
+// relying parties have none and must use PKCE. Scopes are the most a token issued to it may carry.
+type Client struct {
+	ID           string    `json:"id"`
+	Name         string    `json:"name"`
+	SecretHash   string    `json:"-"`
+	Scopes       []string  `json:"scopes"`
+	RedirectURIs []string  `json:"redirect_uris,omitempty"`
+	CreatedAt    time.Time `json:"created_at"`
+}
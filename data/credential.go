@@ -0,0 +1,20 @@
+package data
+
+import (
+	"time"
+)
+
+// Credential is a WebAuthn public key credential (passkey) registered by a user.
+type Credential struct {
+	ID              []byte    `json:"id"`
+	UserID          string    `json:"user_id"`
+	PublicKey       []byte    `json:"-"`
+	AttestationType string    `json:"attestation_type"`
+	Transports      []string  `json:"transports"`
+	AAGUID          []byte    `json:"aaguid"`
+	SignCount       uint32    `json:"sign_count"`
+	BackupEligible  bool      `json:"backup_eligible"`
+	BackupState     bool      `json:"backup_state"`
+	CreatedAt       time.Time `json:"created_at"`
+	LastUsedAt      time.Time `json:"last_used_at"`
+}
@@ -3,6 +3,19 @@ package data
 import "errors"
 
 var (
-	ErrUserNotFound = errors.New("user not found")
-	ErrInternal     = errors.New("internal error")
+	ErrUserNotFound       = errors.New("user not found")
+	ErrEmailTaken         = errors.New("email already registered")
+	ErrIdentityNotFound   = errors.New("identity not found")
+	ErrCredentialNotFound = errors.New("credential not found")
+	ErrChallengeNotFound  = errors.New("challenge not found or expired")
+	ErrCodeNotFound       = errors.New("code not found or expired")
+	ErrSessionNotFound    = errors.New("session not found")
+	ErrOrgNotFound        = errors.New("organization not found")
+	ErrMemberNotFound     = errors.New("membership not found")
+	ErrTenantNotFound     = errors.New("tenant not found")
+	ErrInviteNotFound     = errors.New("invitation not found")
+	ErrClientNotFound     = errors.New("client not found")
+	ErrAPIKeyNotFound     = errors.New("api key not found")
+	ErrConflict           = errors.New("record already exists")
+	ErrInternal           = errors.New("internal error")
 )
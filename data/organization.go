@@ -0,0 +1,33 @@
+package data
+
+import "time"
+
+// Organization is a tenant; users join it through a Membership.
+type Organization struct {
+	ID        string    `json:"id"`
+	Name      string    `json:"name"`
+	Slug      string    `json:"slug"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// Membership gives a user a role within an organization.
+type Membership struct {
+	OrgID     string    `json:"org_id"`
+	UserID    string    `json:"user_id"`
+	Role      string    `json:"role"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// Invitation offers an email address a role in an organization. It is pending until
+// AcceptedAt is set; revoking deletes it.
+type Invitation struct {
+	ID         string    `json:"id"`
+	OrgID      string    `json:"org_id"`
+	Email      string    `json:"email"`
+	Role       string    `json:"role"`
+	InvitedBy  string    `json:"invited_by"`
+	ExpiresAt  time.Time `json:"expires_at"`
+	AcceptedAt time.Time `json:"accepted_at,omitzero"`
+	CreatedAt  time.Time `json:"created_at"`
+}
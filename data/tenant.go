@@ -0,0 +1,28 @@
+package data
+
+import "time"
+
+// Tenant holds the OAuth clients and signing secret of one customer. Requests are matched
+// to it by host name or, failing that, by path prefix.
+type Tenant struct {
+	ID         string           `json:"id"`
+	Hosts      []string         `json:"hosts"`
+	PathPrefix string           `json:"path_prefix"`
+	Secret     string           `json:"secret"` // HMAC key for the tenant's tokens; empty uses the service secret
+	Providers  []ProviderConfig `json:"providers"`
+	// VerifiedDomains are the email domains the tenant owns. Its providers only log in users
+	// with an email in one of them, since the tenant controls what its issuers claim.
+	VerifiedDomains []string  `json:"verified_domains,omitempty"`
+	UpdatedAt       time.Time `json:"updated_at"`
+}
+
+// ProviderConfig describes an OAuth or OIDC client of a tenant.
+type ProviderConfig struct {
+	Type         string   `json:"type"`           // "google", "github" or "oidc"
+	Name         string   `json:"name,omitempty"` // route name, defaults to Type
+	ClientID     string   `json:"client_id"`
+	ClientSecret string   `json:"client_secret"`
+	RedirectURL  string   `json:"redirect_url"`
+	IssuerURL    string   `json:"issuer_url,omitempty"` // OIDC only
+	Scopes       []string `json:"scopes,omitempty"`     // OIDC only
+}
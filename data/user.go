@@ -5,14 +5,32 @@ import (
 )
 
 type User struct {
-	ID           string    `json:"id"`
-	Email        string    `json:"email"`
-	PasswordHash string    `json:"-"`
-	Name         string    `json:"name,omitempty"`
-	Role         string    `json:"role"`
-	IsVerified   bool      `json:"is_verified"`
-	CreatedAt    time.Time `json:"created_at"`
-	UpdatedAt    time.Time `json:"updated_at"`
+	ID           string `json:"id"`
+	Email        string `json:"email"`
+	PasswordHash string `json:"-"`
+	Name         string `json:"name,omitempty"`
+	Role         string `json:"role"`
+	IsVerified   bool   `json:"is_verified"`
+	// BlockedAt is set while the account is blocked; blocked and deleted users can't log in.
+	BlockedAt     time.Time `json:"blocked_at,omitzero"`
+	BlockedReason string    `json:"blocked_reason,omitempty"`
+	// DeletedAt marks a soft-deleted account, purged for good after a retention window.
+	DeletedAt time.Time `json:"deleted_at,omitzero"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// UserFilter selects users for listing. Zero fields match every user; Limit 0 means no limit.
+type UserFilter struct {
+	Email         string // case-insensitive substring
+	Role          string
+	Verified      *bool
+	Blocked       *bool
+	Deleted       *bool
+	CreatedAfter  time.Time // inclusive
+	CreatedBefore time.Time // exclusive
+	Limit         int
+	Offset        int
 }
 
 type Session struct {
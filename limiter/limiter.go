@@ -0,0 +1,132 @@
+package limiter
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"log"
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"auth-go-skd/config"
+	"auth-go-skd/store/redis"
+	"auth-go-skd/token"
+)
+
+// Limiter decides whether another request for key is allowed.
+// When it is not, retryAfter tells the client how long to back off.
+type Limiter interface {
+	Allow(ctx context.Context, key string) (allowed bool, retryAfter time.Duration, err error)
+}
+
+// Defaults for limiter configs that leave RPS or Burst unset, matching config.Limiter.
+const (
+	defaultRPS   = 10
+	defaultBurst = 20
+)
+
+// New builds a limiter from config: a Redis sliding window when rdb is given (shared by
+// all instances), otherwise an in-memory token bucket. RPS and Burst below 1 fall back to
+// 10 and 20, as a zero rate would make the window infinite.
+func New(cfg config.Limiter, rdb *redis.Redis) Limiter {
+	if cfg.RPS <= 0 {
+		cfg.RPS = defaultRPS
+	}
+	if cfg.Burst <= 0 {
+		cfg.Burst = defaultBurst
+	}
+	if rdb != nil {
+		window := time.Duration(float64(cfg.Burst) / float64(cfg.RPS) * float64(time.Second))
+		return NewRedis(rdb, cfg.Burst, window)
+	}
+	return NewMemory(float64(cfg.RPS), cfg.Burst, cfg.TTL)
+}
+
+// Factory builds a limiter allowing limit requests per key within window.
+type Factory func(limit int, window time.Duration) Limiter
+
+// NewFactory returns a Factory for the backend New picks: Redis sliding windows when rdb is
+// given, otherwise in-memory token buckets.
+func NewFactory(rdb *redis.Redis) Factory {
+	return func(limit int, window time.Duration) Limiter {
+		if rdb != nil {
+			return NewRedis(rdb, limit, window)
+		}
+		return NewMemory(float64(limit)/window.Seconds(), limit, window)
+	}
+}
+
+// KeyFunc extracts a rate limit key from a request. An empty key skips limiting.
+type KeyFunc func(r *http.Request) string
+
+// ByIP keys requests by client IP. Use chi's RealIP middleware behind proxies.
+func ByIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	return "ip:" + host
+}
+
+// ByUser keys requests by the authenticated user; it needs Middleware.Auth in front.
+func ByUser(r *http.Request) string {
+	user, err := token.GetUserInfo(r)
+	if err != nil {
+		return ""
+	}
+	return "user:" + user.ID
+}
+
+// ByEmail keys requests by the "email" field of a JSON body. The body is restored for the next handler.
+func ByEmail(r *http.Request) string {
+	if r.Body == nil {
+		return ""
+	}
+	body, err := io.ReadAll(io.LimitReader(r.Body, 1<<20))
+	r.Body.Close()
+	r.Body = io.NopCloser(bytes.NewReader(body))
+	if err != nil {
+		return ""
+	}
+
+	var req struct {
+		Email string `json:"email"`
+	}
+	if json.Unmarshal(body, &req) != nil || req.Email == "" {
+		return ""
+	}
+	return "email:" + strings.ToLower(strings.TrimSpace(req.Email))
+}
+
+// Middleware rejects requests with 429 and a Retry-After header once any of the keys is over its limit.
+// Limiter errors are logged and the request is let through.
+func Middleware(l Limiter, keys ...KeyFunc) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			prefix := r.URL.Path + "|"
+			for _, keyFn := range keys {
+				key := keyFn(r)
+				if key == "" {
+					continue
+				}
+
+				allowed, retryAfter, err := l.Allow(r.Context(), prefix+key)
+				if err != nil {
+					log.Printf("limiter: %v", err)
+					continue
+				}
+				if !allowed {
+					w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(retryAfter.Seconds()))))
+					http.Error(w, "too many requests", http.StatusTooManyRequests)
+					return
+				}
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
@@ -0,0 +1,121 @@
+package limiter
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"auth-go-skd/config"
+	"auth-go-skd/store/redis"
+
+	"github.com/alicebob/miniredis/v2"
+	goredis "github.com/redis/go-redis/v9"
+)
+
+func TestMemory_TokenBucket(t *testing.T) {
+	l := NewMemory(1, 3, time.Minute)
+	ctx := context.Background()
+
+	for i := 0; i < 3; i++ {
+		if ok, _, _ := l.Allow(ctx, "k"); !ok {
+			t.Fatalf("request %d should be within burst", i+1)
+		}
+	}
+	ok, retryAfter, _ := l.Allow(ctx, "k")
+	if ok {
+		t.Fatal("expected burst to be exhausted")
+	}
+	if retryAfter <= 0 || retryAfter > time.Second {
+		t.Errorf("expected retry after within 1s, got %s", retryAfter)
+	}
+	if ok, _, _ := l.Allow(ctx, "other"); !ok {
+		t.Error("keys must be limited independently")
+	}
+}
+
+func TestRedis_SlidingWindow(t *testing.T) {
+	mr := miniredis.RunT(t)
+	client := goredis.NewClient(&goredis.Options{Addr: mr.Addr()})
+	defer client.Close()
+
+	l := NewRedis(&redis.Redis{Client: client}, 2, time.Minute)
+	ctx := context.Background()
+
+	for i := 0; i < 2; i++ {
+		if ok, _, err := l.Allow(ctx, "k"); !ok || err != nil {
+			t.Fatalf("request %d should be allowed: %v", i+1, err)
+		}
+	}
+	ok, retryAfter, err := l.Allow(ctx, "k")
+	if ok || err != nil {
+		t.Fatalf("expected third request to be rejected: %v", err)
+	}
+	if retryAfter <= 0 || retryAfter > time.Minute {
+		t.Errorf("unexpected retry after %s", retryAfter)
+	}
+}
+
+func TestNew_DefaultsZeroRate(t *testing.T) {
+	mr := miniredis.RunT(t)
+	client := goredis.NewClient(&goredis.Options{Addr: mr.Addr()})
+	defer client.Close()
+
+	l, ok := New(config.Limiter{Burst: 5}, &redis.Redis{Client: client}).(*Redis)
+	if !ok {
+		t.Fatal("expected a Redis limiter")
+	}
+	if l.limit != 5 || l.window != 500*time.Millisecond {
+		t.Errorf("expected 5 requests per 500ms, got %d per %s", l.limit, l.window)
+	}
+}
+
+func TestNewFactory(t *testing.T) {
+	if _, ok := NewFactory(nil)(5, time.Hour).(*Memory); !ok {
+		t.Error("expected a Memory limiter without Redis")
+	}
+
+	mr := miniredis.RunT(t)
+	client := goredis.NewClient(&goredis.Options{Addr: mr.Addr()})
+	defer client.Close()
+
+	l, ok := NewFactory(&redis.Redis{Client: client})(5, time.Hour).(*Redis)
+	if !ok {
+		t.Fatal("expected a Redis limiter")
+	}
+	if l.limit != 5 || l.window != time.Hour {
+		t.Errorf("expected 5 requests per hour, got %d per %s", l.limit, l.window)
+	}
+}
+
+func TestMiddleware(t *testing.T) {
+	h := Middleware(NewMemory(0.1, 1, time.Minute), ByIP, ByEmail)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	}))
+
+	do := func(ip, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/login", strings.NewReader(body))
+		req.RemoteAddr = ip + ":1234"
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+		return rec
+	}
+
+	if rec := do("10.0.0.1", `{"email":"a@example.com"}`); rec.Code != http.StatusNoContent {
+		t.Fatalf("first request: %d", rec.Code)
+	}
+
+	rec := do("10.0.0.1", `{"email":"b@example.com"}`)
+	if rec.Code != http.StatusTooManyRequests {
+		t.Fatalf("expected 429 for same IP, got %d", rec.Code)
+	}
+	if rec.Header().Get("Retry-After") == "" {
+		t.Error("expected Retry-After header")
+	}
+
+	if rec := do("10.0.0.2", `{"email":"A@example.com"}`); rec.Code != http.StatusTooManyRequests {
+		t.Errorf("expected 429 for same email from another IP, got %d", rec.Code)
+	}
+}
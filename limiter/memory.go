@@ -0,0 +1,73 @@
+package limiter
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// Memory is a per-key token bucket kept in process memory. Suitable for single-instance deployments.
+type Memory struct {
+	mu      sync.Mutex
+	rate    float64 // tokens per second
+	burst   float64
+	ttl     time.Duration
+	buckets map[string]*bucket
+	sweep   time.Time
+}
+
+type bucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// NewMemory allows rps requests per second per key with bursts up to burst.
+// Buckets idle for longer than ttl are dropped.
+func NewMemory(rps float64, burst int, ttl time.Duration) *Memory {
+	if ttl <= 0 {
+		ttl = time.Minute * 10
+	}
+	return &Memory{
+		rate:    rps,
+		burst:   float64(burst),
+		ttl:     ttl,
+		buckets: make(map[string]*bucket),
+		sweep:   time.Now(),
+	}
+}
+
+func (m *Memory) Allow(_ context.Context, key string) (bool, time.Duration, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := time.Now()
+	if now.Sub(m.sweep) > m.ttl {
+		for k, b := range m.buckets {
+			if now.Sub(b.last) > m.ttl {
+				delete(m.buckets, k)
+			}
+		}
+		m.sweep = now
+	}
+
+	b, ok := m.buckets[key]
+	if !ok {
+		b = &bucket{tokens: m.burst, last: now}
+		m.buckets[key] = b
+	}
+
+	b.tokens += now.Sub(b.last).Seconds() * m.rate
+	if b.tokens > m.burst {
+		b.tokens = m.burst
+	}
+	b.last = now
+
+	if b.tokens >= 1 {
+		b.tokens--
+		return true, 0, nil
+	}
+	if m.rate <= 0 {
+		return false, m.ttl, nil
+	}
+	return false, time.Duration((1 - b.tokens) / m.rate * float64(time.Second)), nil
+}
@@ -0,0 +1,53 @@
+package limiter
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"auth-go-skd/store/redis"
+
+	"github.com/google/uuid"
+	goredis "github.com/redis/go-redis/v9"
+)
+
+const redisPrefix = "auth:limit:"
+
+// slidingWindow keeps one sorted-set entry per request and returns {allowed, retry_after_ms}.
+var slidingWindow = goredis.NewScript(`
+local now = tonumber(ARGV[1])
+local window = tonumber(ARGV[2])
+local limit = tonumber(ARGV[3])
+
+redis.call('ZREMRANGEBYSCORE', KEYS[1], '-inf', now - window)
+if redis.call('ZCARD', KEYS[1]) < limit then
+	redis.call('ZADD', KEYS[1], now, ARGV[4])
+	redis.call('PEXPIRE', KEYS[1], window)
+	return {1, 0}
+end
+
+local oldest = redis.call('ZRANGE', KEYS[1], 0, 0, 'WITHSCORES')
+return {0, tonumber(oldest[2]) + window - now}
+`)
+
+// Redis is a sliding window log shared by every instance using the same Redis.
+type Redis struct {
+	rdb    *redis.Redis
+	limit  int
+	window time.Duration
+}
+
+// NewRedis allows limit requests per key within any window-long interval.
+func NewRedis(rdb *redis.Redis, limit int, window time.Duration) *Redis {
+	return &Redis{rdb: rdb, limit: limit, window: window}
+}
+
+func (l *Redis) Allow(ctx context.Context, key string) (bool, time.Duration, error) {
+	now := time.Now().UnixMilli()
+	res, err := slidingWindow.Run(ctx, l.rdb.Client, []string{redisPrefix + key},
+		now, l.window.Milliseconds(), l.limit, uuid.NewString()).Int64Slice()
+	if err != nil {
+		return false, 0, fmt.Errorf("sliding window: %w", err)
+	}
+	return res[0] == 1, time.Duration(res[1]) * time.Millisecond, nil
+}
@@ -0,0 +1,75 @@
+package mailer
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/smtp"
+	"strings"
+)
+
+type Message struct {
+	To      string
+	Subject string
+	Body    string
+}
+
+// Mailer delivers transactional emails such as magic links and one-time codes.
+type Mailer interface {
+	Send(ctx context.Context, msg Message) error
+}
+
+type Func func(ctx context.Context, msg Message) error
+
+func (f Func) Send(ctx context.Context, msg Message) error {
+	return f(ctx, msg)
+}
+
+// SMTP sends plain-text mail through an SMTP relay.
+type SMTP struct {
+	Addr string // host:port
+	From string
+	Auth smtp.Auth
+}
+
+func NewSMTP(addr, from, username, password string) *SMTP {
+	host := addr
+	if i := strings.LastIndex(addr, ":"); i > 0 {
+		host = addr[:i]
+	}
+
+	var auth smtp.Auth
+	if username != "" {
+		auth = smtp.PlainAuth("", username, password, host)
+	}
+	return &SMTP{Addr: addr, From: from, Auth: auth}
+}
+
+func (m *SMTP) Send(_ context.Context, msg Message) error {
+	if strings.ContainsAny(msg.To, "\r\n") || strings.ContainsAny(msg.Subject, "\r\n") {
+		return fmt.Errorf("invalid header value")
+	}
+
+	body := "From: " + m.From + "\r\n" +
+		"To: " + msg.To + "\r\n" +
+		"Subject: " + msg.Subject + "\r\n" +
+		"MIME-Version: 1.0\r\n" +
+		"Content-Type: text/plain; charset=UTF-8\r\n\r\n" +
+		msg.Body
+
+	return smtp.SendMail(m.Addr, m.Auth, m.From, []string{msg.To}, []byte(body))
+}
+
+// Log prints messages instead of sending them. Useful for local development only.
+type Log struct {
+	Logger *log.Logger
+}
+
+func (m *Log) Send(_ context.Context, msg Message) error {
+	logger := m.Logger
+	if logger == nil {
+		logger = log.Default()
+	}
+	logger.Printf("mail to=%s subject=%q\n%s", msg.To, msg.Subject, msg.Body)
+	return nil
+}
@@ -1,2 +1,3 @@
 DROP TABLE IF EXISTS identities;
+DROP TABLE IF EXISTS sessions;
 DROP TABLE IF EXISTS users;
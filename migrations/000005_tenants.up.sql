@@ -0,0 +1,8 @@
+CREATE TABLE IF NOT EXISTS tenants (
+    id VARCHAR(255) PRIMARY KEY,
+    hosts TEXT[] NOT NULL DEFAULT '{}',
+    path_prefix VARCHAR(255) NOT NULL DEFAULT '',
+    secret TEXT NOT NULL DEFAULT '',
+    providers JSONB NOT NULL DEFAULT '[]',
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT NOW()
+);
@@ -0,0 +1 @@
+ALTER TABLE tenants ADD COLUMN IF NOT EXISTS verified_domains TEXT[] NOT NULL DEFAULT '{}';
@@ -0,0 +1,2 @@
+ALTER TABLE webauthn_credentials DROP CONSTRAINT IF EXISTS webauthn_credentials_user_id_fkey;
+ALTER TABLE webauthn_credentials ALTER COLUMN user_id TYPE VARCHAR(255);
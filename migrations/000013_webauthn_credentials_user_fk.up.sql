@@ -0,0 +1,4 @@
+DELETE FROM webauthn_credentials c WHERE NOT EXISTS (SELECT 1 FROM users u WHERE u.id::text = c.user_id);
+ALTER TABLE webauthn_credentials ALTER COLUMN user_id TYPE UUID USING user_id::uuid;
+ALTER TABLE webauthn_credentials ADD CONSTRAINT webauthn_credentials_user_id_fkey
+    FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE;
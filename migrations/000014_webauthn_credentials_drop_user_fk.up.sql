@@ -0,0 +1,4 @@
+-- Passkeys may belong to users that aren't kept in this database, so credentials don't
+-- reference users; the store deletes them together with their user instead.
+ALTER TABLE webauthn_credentials DROP CONSTRAINT IF EXISTS webauthn_credentials_user_id_fkey;
+ALTER TABLE webauthn_credentials ALTER COLUMN user_id TYPE VARCHAR(255);
@@ -0,0 +1,8 @@
+// Package migrations embeds the Postgres schema so it can be applied from Go with
+// Postgres.Migrate as well as with the migrate CLI.
+package migrations
+
+import "embed"
+
+//go:embed *.sql
+var FS embed.FS
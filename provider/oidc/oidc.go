@@ -0,0 +1,137 @@
+package oidc
+
+import (
+	"auth-go-skd/token"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"golang.org/x/oauth2"
+)
+
+// Provider is a generic OpenID Connect client. Endpoints come from the issuer's discovery
+// document and the user is read from the userinfo endpoint.
+type Provider struct {
+	Config      *oauth2.Config
+	UserInfoURL string
+	name        string
+}
+
+type discovery struct {
+	Issuer                string `json:"issuer"`
+	AuthorizationEndpoint string `json:"authorization_endpoint"`
+	TokenEndpoint         string `json:"token_endpoint"`
+	UserInfoEndpoint      string `json:"userinfo_endpoint"`
+}
+
+// New fetches issuer's discovery document and returns a provider routed under name.
+// Scopes default to openid, email and profile.
+func New(ctx context.Context, name, issuer, clientID, clientSecret, callbackURL string, scopes ...string) (*Provider, error) {
+	if len(scopes) == 0 {
+		scopes = []string{"openid", "email", "profile"}
+	}
+
+	issuer = strings.TrimSuffix(issuer, "/")
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, issuer+"/.well-known/openid-configuration", nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := httpClient(ctx).Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch discovery document: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("failed to fetch discovery document: %s", resp.Status)
+	}
+
+	var d discovery
+	if err := json.NewDecoder(resp.Body).Decode(&d); err != nil {
+		return nil, fmt.Errorf("failed to decode discovery document: %w", err)
+	}
+	if d.Issuer != issuer {
+		return nil, fmt.Errorf("discovery document is for issuer %q, expected %q", d.Issuer, issuer)
+	}
+	if d.UserInfoEndpoint == "" {
+		return nil, fmt.Errorf("issuer %s has no userinfo endpoint", issuer)
+	}
+
+	return &Provider{
+		Config: &oauth2.Config{
+			ClientID:     clientID,
+			ClientSecret: clientSecret,
+			RedirectURL:  callbackURL,
+			Scopes:       scopes,
+			Endpoint: oauth2.Endpoint{
+				AuthURL:  d.AuthorizationEndpoint,
+				TokenURL: d.TokenEndpoint,
+			},
+		},
+		UserInfoURL: d.UserInfoEndpoint,
+		name:        name,
+	}, nil
+}
+
+// httpClient honours a client set with oauth2.HTTPClient, like the token exchange does.
+func httpClient(ctx context.Context) *http.Client {
+	if c, ok := ctx.Value(oauth2.HTTPClient).(*http.Client); ok {
+		return c
+	}
+	return http.DefaultClient
+}
+
+func (p *Provider) Name() string {
+	return p.name
+}
+
+func (p *Provider) GetAuthURL(state string) string {
+	return p.Config.AuthCodeURL(state)
+}
+
+func (p *Provider) FetchUser(ctx context.Context, code string) (token.User, error) {
+	tok, err := p.Config.Exchange(ctx, code)
+	if err != nil {
+		return token.User{}, fmt.Errorf("failed to exchange token: %w", err)
+	}
+
+	client := p.Config.Client(ctx, tok)
+	resp, err := client.Get(p.UserInfoURL)
+	if err != nil {
+		return token.User{}, fmt.Errorf("failed to get user info: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return token.User{}, fmt.Errorf("failed to get user info: %s", resp.Status)
+	}
+
+	var userInfo struct {
+		Sub           string `json:"sub"`
+		Email         string `json:"email"`
+		EmailVerified *bool  `json:"email_verified"`
+		Name          string `json:"name"`
+		Picture       string `json:"picture"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&userInfo); err != nil {
+		return token.User{}, fmt.Errorf("failed to decode user info: %w", err)
+	}
+	if userInfo.Sub == "" {
+		return token.User{}, fmt.Errorf("user info has no subject")
+	}
+
+	// An address the issuer says is unverified must not be used to link accounts.
+	if userInfo.EmailVerified != nil && !*userInfo.EmailVerified {
+		userInfo.Email = ""
+	}
+
+	return token.User{
+		ID:      userInfo.Sub,
+		Name:    userInfo.Name,
+		Email:   userInfo.Email,
+		Picture: userInfo.Picture,
+		Attributes: map[string]interface{}{
+			"provider": p.name,
+		},
+	}, nil
+}
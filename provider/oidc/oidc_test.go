@@ -0,0 +1,87 @@
+package oidc
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func newIssuer(t *testing.T, userInfo map[string]interface{}) *httptest.Server {
+	t.Helper()
+	mux := http.NewServeMux()
+	srv := httptest.NewServer(mux)
+	t.Cleanup(srv.Close)
+
+	discovery := func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]string{
+			"issuer":                 srv.URL,
+			"authorization_endpoint": srv.URL + "/authorize",
+			"token_endpoint":         srv.URL + "/token",
+			"userinfo_endpoint":      srv.URL + "/userinfo",
+		})
+	}
+	mux.HandleFunc("/.well-known/openid-configuration", discovery)
+	// Served under another path, the document names an issuer that doesn't match
+	mux.HandleFunc("/other/.well-known/openid-configuration", discovery)
+	mux.HandleFunc("/token", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{"access_token": "at", "token_type": "Bearer", "expires_in": 3600})
+	})
+	mux.HandleFunc("/userinfo", func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer at" {
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		json.NewEncoder(w).Encode(userInfo)
+	})
+	return srv
+}
+
+func TestOIDCProvider(t *testing.T) {
+	srv := newIssuer(t, map[string]interface{}{"sub": "abc", "email": "a@acme.example", "email_verified": true, "name": "Alice"})
+
+	p, err := New(context.Background(), "okta", srv.URL, "cid", "secret", "http://localhost/auth/okta/callback")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p.Name() != "okta" {
+		t.Errorf("expected name 'okta', got %s", p.Name())
+	}
+	if url := p.GetAuthURL("st"); !strings.HasPrefix(url, srv.URL+"/authorize?") || !strings.Contains(url, "state=st") {
+		t.Errorf("unexpected auth URL %s", url)
+	}
+
+	user, err := p.FetchUser(context.Background(), "code")
+	if err != nil {
+		t.Fatalf("FetchUser failed: %v", err)
+	}
+	if user.ID != "abc" || user.Email != "a@acme.example" || user.Name != "Alice" || user.Attributes["provider"] != "okta" {
+		t.Errorf("unexpected user %+v", user)
+	}
+}
+
+func TestOIDCProvider_UnverifiedEmail(t *testing.T) {
+	srv := newIssuer(t, map[string]interface{}{"sub": "abc", "email": "a@acme.example", "email_verified": false})
+
+	p, err := New(context.Background(), "okta", srv.URL, "cid", "secret", "http://localhost/callback")
+	if err != nil {
+		t.Fatal(err)
+	}
+	user, err := p.FetchUser(context.Background(), "code")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if user.Email != "" {
+		t.Errorf("unverified email should be dropped, got %q", user.Email)
+	}
+}
+
+func TestOIDCProvider_IssuerMismatch(t *testing.T) {
+	srv := newIssuer(t, nil)
+	if _, err := New(context.Background(), "okta", srv.URL+"/other", "cid", "secret", ""); err == nil {
+		t.Error("expected an error for a discovery document of another issuer")
+	}
+}
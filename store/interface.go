@@ -3,23 +3,177 @@ package store
 import (
 	"auth-go-skd/data"
 	"context"
+	"time"
 )
 
+// UserStorage keeps user accounts. DeleteUser removes a user with their sessions, identities,
+// memberships, API keys and, when the store also keeps credentials, passkeys; soft deletion sets
+// data.User.DeletedAt through UpdateUser instead.
 type UserStorage interface {
 	CreateUser(ctx context.Context, user *data.User) error
 	GetUserByEmail(ctx context.Context, email string) (*data.User, error)
 	GetUserByID(ctx context.Context, id string) (*data.User, error)
+	// UpdateUser writes every field except ID, Email and CreatedAt.
 	UpdateUser(ctx context.Context, user *data.User) error
 	DeleteUser(ctx context.Context, id string) error
+	// ListUsers returns the users matching f, oldest first.
+	ListUsers(ctx context.Context, f data.UserFilter) ([]data.User, error)
+	// CountUsers returns how many users match f, ignoring its Limit and Offset.
+	CountUsers(ctx context.Context, f data.UserFilter) (int, error)
+	// PurgeDeletedUsers deletes the users soft-deleted before the given time, like DeleteUser,
+	// and returns how many there were.
+	PurgeDeletedUsers(ctx context.Context, before time.Time) (int, error)
 }
 
 type SessionStorage interface {
 	CreateSession(ctx context.Context, session *data.Session) error
 	GetSessionByRefreshToken(ctx context.Context, refreshToken string) (*data.Session, error)
 	DeleteSession(ctx context.Context, id string) error
+	ListSessionsByUser(ctx context.Context, userID string) ([]data.Session, error)
+	// DeleteSessionsByUser removes all sessions of userID except exceptID (which may be empty).
+	DeleteSessionsByUser(ctx context.Context, userID, exceptID string) error
 }
 
 type IdentityStorage interface {
 	CreateIdentity(ctx context.Context, identity *data.Identity) error
 	GetIdentityByProvider(ctx context.Context, provider, providerID string) (*data.Identity, error)
+	// ListIdentitiesByUser returns the user's identities, oldest first.
+	ListIdentitiesByUser(ctx context.Context, userID string) ([]data.Identity, error)
+}
+
+// CredentialStorage keeps WebAuthn public keys and their signature counters.
+type CredentialStorage interface {
+	CreateCredential(ctx context.Context, credential *data.Credential) error
+	GetCredentialByID(ctx context.Context, id []byte) (*data.Credential, error)
+	GetCredentialsByUser(ctx context.Context, userID string) ([]data.Credential, error)
+	UpdateCredentialSignCount(ctx context.Context, id []byte, signCount uint32, lastUsedAt time.Time) error
+	// DeleteCredentialsByUser removes all credentials of userID. Credentials don't reference
+	// users, so they may belong to users kept elsewhere; UserStorage.DeleteUser of the same store
+	// removes them too.
+	DeleteCredentialsByUser(ctx context.Context, userID string) error
+}
+
+// OrganizationStorage keeps the tenants of a multi-tenant deployment. Slugs are unique;
+// deleting an organization deletes its memberships.
+type OrganizationStorage interface {
+	CreateOrganization(ctx context.Context, org *data.Organization) error
+	GetOrganization(ctx context.Context, id string) (*data.Organization, error)
+	GetOrganizationBySlug(ctx context.Context, slug string) (*data.Organization, error)
+	DeleteOrganization(ctx context.Context, id string) error
+}
+
+// MembershipStorage keeps per-organization roles. A user is a member of an organization at
+// most once; unknown memberships are reported as data.ErrMemberNotFound.
+type MembershipStorage interface {
+	AddMember(ctx context.Context, m *data.Membership) error
+	GetMembership(ctx context.Context, orgID, userID string) (*data.Membership, error)
+	UpdateMemberRole(ctx context.Context, orgID, userID, role string) error
+	RemoveMember(ctx context.Context, orgID, userID string) error
+	// ListMembershipsByUser returns the user's memberships, oldest first.
+	ListMembershipsByUser(ctx context.Context, userID string) ([]data.Membership, error)
+	// ListMembersByOrg returns the organization's memberships, oldest first.
+	ListMembersByOrg(ctx context.Context, orgID string) ([]data.Membership, error)
+}
+
+// InvitationStorage keeps invitations into organizations. AcceptInvitation marks a pending
+// invitation accepted; accepted, revoked and unknown invitations yield data.ErrInviteNotFound.
+type InvitationStorage interface {
+	CreateInvitation(ctx context.Context, inv *data.Invitation) error
+	GetInvitation(ctx context.Context, id string) (*data.Invitation, error)
+	// ListInvitationsByOrg returns the organization's pending invitations, oldest first.
+	ListInvitationsByOrg(ctx context.Context, orgID string) ([]data.Invitation, error)
+	AcceptInvitation(ctx context.Context, id string, at time.Time) error
+	DeleteInvitation(ctx context.Context, id string) error
+}
+
+// TenantStorage keeps per-tenant configuration. SaveTenant inserts or replaces a tenant and
+// sets its UpdatedAt to the time of the save; services poll ListTenants to pick up changes.
+type TenantStorage interface {
+	SaveTenant(ctx context.Context, tenant *data.Tenant) error
+	ListTenants(ctx context.Context) ([]data.Tenant, error)
+	DeleteTenant(ctx context.Context, id string) error
+}
+
+// ClientStorage keeps machine clients of the client_credentials grant. Client IDs are unique;
+// unknown clients are reported as data.ErrClientNotFound.
+type ClientStorage interface {
+	CreateClient(ctx context.Context, client *data.Client) error
+	GetClient(ctx context.Context, id string) (*data.Client, error)
+	// ListClients returns all clients, oldest first.
+	ListClients(ctx context.Context) ([]data.Client, error)
+	DeleteClient(ctx context.Context, id string) error
+}
+
+// APIKeyStorage keeps users' API keys, looked up by their unique prefix. Deleting a user
+// deletes their keys; unknown keys are reported as data.ErrAPIKeyNotFound.
+type APIKeyStorage interface {
+	CreateAPIKey(ctx context.Context, key *data.APIKey) error
+	GetAPIKeyByPrefix(ctx context.Context, prefix string) (*data.APIKey, error)
+	// ListAPIKeysByUser returns the user's keys, oldest first.
+	ListAPIKeysByUser(ctx context.Context, userID string) ([]data.APIKey, error)
+	// TouchAPIKey records when and from which IP a key was last used.
+	TouchAPIKey(ctx context.Context, id string, at time.Time, ip string) error
+	// DeleteAPIKey deletes the key id if it belongs to userID.
+	DeleteAPIKey(ctx context.Context, userID, id string) error
+}
+
+// ChallengeStorage keeps short-lived ceremony state such as WebAuthn challenges.
+// PopChallenge returns data.ErrChallengeNotFound once the value expired or was consumed.
+type ChallengeStorage interface {
+	SaveChallenge(ctx context.Context, key string, value []byte, ttl time.Duration) error
+	PopChallenge(ctx context.Context, key string) ([]byte, error)
+}
+
+// CodeStorage keeps hashed one-time codes with a TTL and an attempt counter.
+// Missing or expired codes are reported as data.ErrCodeNotFound.
+type CodeStorage interface {
+	SaveCode(ctx context.Context, key, codeHash string, ttl time.Duration) error
+	GetCode(ctx context.Context, key string) (codeHash string, err error)
+	// IncrCodeAttempts atomically bumps and returns the attempt counter of an existing code.
+	IncrCodeAttempts(ctx context.Context, key string) (int, error)
+	DeleteCode(ctx context.Context, key string) error
+}
+
+// LockoutStorage tracks failed login attempts and lock state per key (account or IP).
+type LockoutStorage interface {
+	// RegisterFailure increments the failure counter for key and returns it. The counter
+	// expires window after the first failure.
+	RegisterFailure(ctx context.Context, key string, window time.Duration) (int, error)
+	SetLockedUntil(ctx context.Context, key string, until time.Time) error
+	// GetLockedUntil returns the zero time when key is not locked.
+	GetLockedUntil(ctx context.Context, key string) (time.Time, error)
+	// ResetFailures clears both the counter and any lock for key.
+	ResetFailures(ctx context.Context, key string) error
+}
+
+// SessionRotator is implemented by session stores that can swap a refresh session for
+// a new one atomically. RotateSession deletes the session for oldRefreshToken, fills in
+// next.UserID from it and stores next; it returns the old session. Blocked, expired or
+// unknown tokens yield data.ErrSessionNotFound.
+type SessionRotator interface {
+	RotateSession(ctx context.Context, oldRefreshToken string, next *data.Session) (*data.Session, error)
+}
+
+// RevocationStorage remembers revoked token and session IDs until the tokens would expire anyway.
+type RevocationStorage interface {
+	Revoke(ctx context.Context, id string, ttl time.Duration) error
+	IsRevoked(ctx context.Context, id string) (bool, error)
+}
+
+// Store is the set of persistent storages a transaction spans.
+type Store interface {
+	UserStorage
+	SessionStorage
+	IdentityStorage
+	CredentialStorage
+	OrganizationStorage
+	MembershipStorage
+	InvitationStorage
+}
+
+// Transactor is implemented by stores that can group writes. WithTx runs fn with a Store
+// whose writes are committed when fn returns nil and rolled back otherwise. fn must use
+// tx, not the outer store, for everything that should be part of the transaction.
+type Transactor interface {
+	WithTx(ctx context.Context, fn func(tx Store) error) error
 }
@@ -0,0 +1,89 @@
+package memory
+
+import (
+	"context"
+	"slices"
+	"sort"
+	"time"
+
+	"auth-go-skd/data"
+)
+
+func cloneAPIKey(k data.APIKey) data.APIKey {
+	k.Scopes = slices.Clone(k.Scopes)
+	return k
+}
+
+// APIKeyStorage implementation
+
+func (m *Memory) CreateAPIKey(_ context.Context, key *data.APIKey) error {
+	m.lock()
+	defer m.unlock()
+
+	if _, ok := m.apiKeys[key.ID]; ok {
+		return data.ErrConflict
+	}
+	if _, ok := m.keyPrefixes[key.Prefix]; ok {
+		return data.ErrConflict
+	}
+	m.apiKeys[key.ID] = cloneAPIKey(*key)
+	m.keyPrefixes[key.Prefix] = key.ID
+	return nil
+}
+
+func (m *Memory) GetAPIKeyByPrefix(_ context.Context, prefix string) (*data.APIKey, error) {
+	m.lock()
+	defer m.unlock()
+
+	id, ok := m.keyPrefixes[prefix]
+	if !ok {
+		return nil, data.ErrAPIKeyNotFound
+	}
+	k := cloneAPIKey(m.apiKeys[id])
+	return &k, nil
+}
+
+func (m *Memory) ListAPIKeysByUser(_ context.Context, userID string) ([]data.APIKey, error) {
+	m.lock()
+	defer m.unlock()
+
+	var keys []data.APIKey
+	for _, k := range m.apiKeys {
+		if k.UserID == userID {
+			keys = append(keys, cloneAPIKey(k))
+		}
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if !keys[i].CreatedAt.Equal(keys[j].CreatedAt) {
+			return keys[i].CreatedAt.Before(keys[j].CreatedAt)
+		}
+		return keys[i].ID < keys[j].ID
+	})
+	return keys, nil
+}
+
+func (m *Memory) TouchAPIKey(_ context.Context, id string, at time.Time, ip string) error {
+	m.lock()
+	defer m.unlock()
+
+	k, ok := m.apiKeys[id]
+	if !ok {
+		return data.ErrAPIKeyNotFound
+	}
+	k.LastUsedAt, k.LastUsedIP = at, ip
+	m.apiKeys[id] = k
+	return nil
+}
+
+func (m *Memory) DeleteAPIKey(_ context.Context, userID, id string) error {
+	m.lock()
+	defer m.unlock()
+
+	k, ok := m.apiKeys[id]
+	if !ok || k.UserID != userID {
+		return data.ErrAPIKeyNotFound
+	}
+	delete(m.apiKeys, id)
+	delete(m.keyPrefixes, k.Prefix)
+	return nil
+}
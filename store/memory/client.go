@@ -0,0 +1,68 @@
+package memory
+
+import (
+	"context"
+	"slices"
+	"sort"
+
+	"auth-go-skd/data"
+)
+
+func cloneClient(c data.Client) data.Client {
+	c.Scopes = slices.Clone(c.Scopes)
+	c.RedirectURIs = slices.Clone(c.RedirectURIs)
+	return c
+}
+
+// ClientStorage implementation
+
+func (m *Memory) CreateClient(_ context.Context, client *data.Client) error {
+	m.lock()
+	defer m.unlock()
+
+	if _, ok := m.clients[client.ID]; ok {
+		return data.ErrConflict
+	}
+	m.clients[client.ID] = cloneClient(*client)
+	return nil
+}
+
+func (m *Memory) GetClient(_ context.Context, id string) (*data.Client, error) {
+	m.lock()
+	defer m.unlock()
+
+	c, ok := m.clients[id]
+	if !ok {
+		return nil, data.ErrClientNotFound
+	}
+	c = cloneClient(c)
+	return &c, nil
+}
+
+func (m *Memory) ListClients(_ context.Context) ([]data.Client, error) {
+	m.lock()
+	defer m.unlock()
+
+	clients := make([]data.Client, 0, len(m.clients))
+	for _, c := range m.clients {
+		clients = append(clients, cloneClient(c))
+	}
+	sort.Slice(clients, func(i, j int) bool {
+		if !clients[i].CreatedAt.Equal(clients[j].CreatedAt) {
+			return clients[i].CreatedAt.Before(clients[j].CreatedAt)
+		}
+		return clients[i].ID < clients[j].ID
+	})
+	return clients, nil
+}
+
+func (m *Memory) DeleteClient(_ context.Context, id string) error {
+	m.lock()
+	defer m.unlock()
+
+	if _, ok := m.clients[id]; !ok {
+		return data.ErrClientNotFound
+	}
+	delete(m.clients, id)
+	return nil
+}
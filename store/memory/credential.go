@@ -0,0 +1,86 @@
+package memory
+
+import (
+	"context"
+	"slices"
+	"sort"
+	"time"
+
+	"auth-go-skd/data"
+)
+
+func cloneCredential(c data.Credential) data.Credential {
+	c.ID = slices.Clone(c.ID)
+	c.PublicKey = slices.Clone(c.PublicKey)
+	c.Transports = slices.Clone(c.Transports)
+	c.AAGUID = slices.Clone(c.AAGUID)
+	return c
+}
+
+// CredentialStorage implementation
+
+func (m *Memory) CreateCredential(_ context.Context, credential *data.Credential) error {
+	m.lock()
+	defer m.unlock()
+
+	if _, ok := m.credentials[string(credential.ID)]; ok {
+		return data.ErrConflict
+	}
+	m.credentials[string(credential.ID)] = cloneCredential(*credential)
+	return nil
+}
+
+func (m *Memory) GetCredentialByID(_ context.Context, id []byte) (*data.Credential, error) {
+	m.lock()
+	defer m.unlock()
+
+	c, ok := m.credentials[string(id)]
+	if !ok {
+		return nil, data.ErrCredentialNotFound
+	}
+	c = cloneCredential(c)
+	return &c, nil
+}
+
+// GetCredentialsByUser returns the user's credentials, oldest first.
+func (m *Memory) GetCredentialsByUser(_ context.Context, userID string) ([]data.Credential, error) {
+	m.lock()
+	defer m.unlock()
+
+	var credentials []data.Credential
+	for _, c := range m.credentials {
+		if c.UserID == userID {
+			credentials = append(credentials, cloneCredential(c))
+		}
+	}
+	sort.Slice(credentials, func(i, j int) bool {
+		return credentials[i].CreatedAt.Before(credentials[j].CreatedAt)
+	})
+	return credentials, nil
+}
+
+func (m *Memory) UpdateCredentialSignCount(_ context.Context, id []byte, signCount uint32, lastUsedAt time.Time) error {
+	m.lock()
+	defer m.unlock()
+
+	c, ok := m.credentials[string(id)]
+	if !ok {
+		return data.ErrCredentialNotFound
+	}
+	c.SignCount = signCount
+	c.LastUsedAt = lastUsedAt
+	m.credentials[string(id)] = c
+	return nil
+}
+
+func (m *Memory) DeleteCredentialsByUser(_ context.Context, userID string) error {
+	m.lock()
+	defer m.unlock()
+
+	for id, c := range m.credentials {
+		if c.UserID == userID {
+			delete(m.credentials, id)
+		}
+	}
+	return nil
+}
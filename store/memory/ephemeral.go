@@ -0,0 +1,130 @@
+package memory
+
+import (
+	"context"
+	"slices"
+	"time"
+
+	"auth-go-skd/data"
+)
+
+// ChallengeStorage implementation
+
+func (m *Memory) SaveChallenge(_ context.Context, key string, value []byte, ttl time.Duration) error {
+	m.lock()
+	defer m.unlock()
+
+	sweep(m.challenges, func(e expiring[[]byte]) time.Time { return e.expiresAt })
+	m.challenges[key] = expiring[[]byte]{value: slices.Clone(value), expiresAt: time.Now().Add(ttl)}
+	return nil
+}
+
+func (m *Memory) PopChallenge(_ context.Context, key string) ([]byte, error) {
+	m.lock()
+	defer m.unlock()
+
+	e, ok := m.challenges[key]
+	delete(m.challenges, key)
+	if !ok || time.Now().After(e.expiresAt) {
+		return nil, data.ErrChallengeNotFound
+	}
+	return e.value, nil
+}
+
+// CodeStorage implementation
+
+func (m *Memory) SaveCode(_ context.Context, key, codeHash string, ttl time.Duration) error {
+	m.lock()
+	defer m.unlock()
+
+	sweep(m.codes, func(c code) time.Time { return c.expiresAt })
+	m.codes[key] = code{hash: codeHash, expiresAt: time.Now().Add(ttl)}
+	return nil
+}
+
+// liveCode returns the code under key, dropping it if it has expired.
+func (m *Memory) liveCode(key string) (code, bool) {
+	c, ok := m.codes[key]
+	if ok && time.Now().After(c.expiresAt) {
+		delete(m.codes, key)
+		return code{}, false
+	}
+	return c, ok
+}
+
+func (m *Memory) GetCode(_ context.Context, key string) (string, error) {
+	m.lock()
+	defer m.unlock()
+
+	c, ok := m.liveCode(key)
+	if !ok {
+		return "", data.ErrCodeNotFound
+	}
+	return c.hash, nil
+}
+
+func (m *Memory) IncrCodeAttempts(_ context.Context, key string) (int, error) {
+	m.lock()
+	defer m.unlock()
+
+	c, ok := m.liveCode(key)
+	if !ok {
+		return 0, data.ErrCodeNotFound
+	}
+	c.attempts++
+	m.codes[key] = c
+	return c.attempts, nil
+}
+
+func (m *Memory) DeleteCode(_ context.Context, key string) error {
+	m.lock()
+	defer m.unlock()
+	delete(m.codes, key)
+	return nil
+}
+
+// LockoutStorage implementation
+
+func (m *Memory) RegisterFailure(_ context.Context, key string, window time.Duration) (int, error) {
+	m.lock()
+	defer m.unlock()
+
+	sweep(m.failures, func(e expiring[int]) time.Time { return e.expiresAt })
+
+	now := time.Now()
+	e := m.failures[key]
+	if now.After(e.expiresAt) {
+		e = expiring[int]{expiresAt: now.Add(window)}
+	}
+	e.value++
+	m.failures[key] = e
+	return e.value, nil
+}
+
+func (m *Memory) SetLockedUntil(_ context.Context, key string, until time.Time) error {
+	m.lock()
+	defer m.unlock()
+
+	sweep(m.locked, func(t time.Time) time.Time { return t })
+	m.locked[key] = until
+	return nil
+}
+
+func (m *Memory) GetLockedUntil(_ context.Context, key string) (time.Time, error) {
+	m.lock()
+	defer m.unlock()
+
+	until := m.locked[key]
+	if time.Now().After(until) {
+		return time.Time{}, nil
+	}
+	return until, nil
+}
+
+func (m *Memory) ResetFailures(_ context.Context, key string) error {
+	m.lock()
+	defer m.unlock()
+	delete(m.failures, key)
+	delete(m.locked, key)
+	return nil
+}
@@ -0,0 +1,47 @@
+package memory
+
+import (
+	"context"
+	"sort"
+
+	"auth-go-skd/data"
+)
+
+// IdentityStorage implementation
+
+func (m *Memory) CreateIdentity(_ context.Context, identity *data.Identity) error {
+	m.lock()
+	defer m.unlock()
+
+	key := identityKey{identity.Provider, identity.ProviderID}
+	if _, ok := m.identities[key]; ok {
+		return data.ErrConflict
+	}
+	m.identities[key] = *identity
+	return nil
+}
+
+func (m *Memory) GetIdentityByProvider(_ context.Context, provider, providerID string) (*data.Identity, error) {
+	m.lock()
+	defer m.unlock()
+
+	identity, ok := m.identities[identityKey{provider, providerID}]
+	if !ok {
+		return nil, data.ErrIdentityNotFound
+	}
+	return &identity, nil
+}
+
+func (m *Memory) ListIdentitiesByUser(_ context.Context, userID string) ([]data.Identity, error) {
+	m.lock()
+	defer m.unlock()
+
+	var identities []data.Identity
+	for _, identity := range m.identities {
+		if identity.UserID == userID {
+			identities = append(identities, identity)
+		}
+	}
+	sort.Slice(identities, func(i, j int) bool { return identities[i].CreatedAt.Before(identities[j].CreatedAt) })
+	return identities, nil
+}
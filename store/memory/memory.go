@@ -0,0 +1,112 @@
+// Package memory implements every storage interface in process memory. It is meant for tests
+// and single-instance deployments; nothing survives a restart.
+package memory
+
+import (
+	"sync"
+	"time"
+
+	"auth-go-skd/data"
+)
+
+// sweepThreshold is the size at which expiring maps are swept on write.
+const sweepThreshold = 10000
+
+type memberKey struct {
+	orgID  string
+	userID string
+}
+
+type identityKey struct {
+	provider   string
+	providerID string
+}
+
+type expiring[T any] struct {
+	value     T
+	expiresAt time.Time
+}
+
+type code struct {
+	hash      string
+	attempts  int
+	expiresAt time.Time
+}
+
+// Memory holds all records behind a single lock. Records are copied in and out,
+// so callers never share state with the store.
+type Memory struct {
+	mu sync.Mutex
+	// inTx marks the view handed to a WithTx callback, which runs with mu already held.
+	inTx bool
+
+	users         map[string]data.User
+	emails        map[string]string // email -> user ID
+	sessions      map[string]data.Session
+	refreshTokens map[string]string // refresh token -> session ID
+	identities    map[identityKey]data.Identity
+	credentials   map[string]data.Credential
+	orgs          map[string]data.Organization
+	slugs         map[string]string // slug -> organization ID
+	members       map[memberKey]data.Membership
+	invitations   map[string]data.Invitation
+	tenants       map[string]data.Tenant
+	clients       map[string]data.Client
+	apiKeys       map[string]data.APIKey
+	keyPrefixes   map[string]string // prefix -> API key ID
+
+	challenges map[string]expiring[[]byte]
+	codes      map[string]code
+	failures   map[string]expiring[int]
+	locked     map[string]time.Time
+	revoked    map[string]time.Time
+}
+
+func New() *Memory {
+	return &Memory{
+		users:         make(map[string]data.User),
+		emails:        make(map[string]string),
+		sessions:      make(map[string]data.Session),
+		refreshTokens: make(map[string]string),
+		identities:    make(map[identityKey]data.Identity),
+		credentials:   make(map[string]data.Credential),
+		orgs:          make(map[string]data.Organization),
+		slugs:         make(map[string]string),
+		members:       make(map[memberKey]data.Membership),
+		invitations:   make(map[string]data.Invitation),
+		tenants:       make(map[string]data.Tenant),
+		clients:       make(map[string]data.Client),
+		apiKeys:       make(map[string]data.APIKey),
+		keyPrefixes:   make(map[string]string),
+		challenges:    make(map[string]expiring[[]byte]),
+		codes:         make(map[string]code),
+		failures:      make(map[string]expiring[int]),
+		locked:        make(map[string]time.Time),
+		revoked:       make(map[string]time.Time),
+	}
+}
+
+// sweep drops expired entries once m has grown past sweepThreshold.
+func sweep[K comparable, V any](m map[K]V, expiresAt func(V) time.Time) {
+	if len(m) < sweepThreshold {
+		return
+	}
+	now := time.Now()
+	for k, v := range m {
+		if now.After(expiresAt(v)) {
+			delete(m, k)
+		}
+	}
+}
+
+func (m *Memory) lock() {
+	if !m.inTx {
+		m.mu.Lock()
+	}
+}
+
+func (m *Memory) unlock() {
+	if !m.inTx {
+		m.mu.Unlock()
+	}
+}
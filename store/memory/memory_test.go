@@ -0,0 +1,78 @@
+package memory
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"auth-go-skd/data"
+	"auth-go-skd/store/storetest"
+)
+
+func TestConformance(t *testing.T) {
+	storetest.Run(t, func(t *testing.T) storetest.Backend {
+		m := New()
+		return storetest.Backend{
+			Users:       m,
+			Sessions:    m,
+			Identities:  m,
+			Credentials: m,
+			Orgs:        m,
+			Members:     m,
+			Invitations: m,
+			Tenants:     m,
+			Clients:     m,
+			APIKeys:     m,
+			Challenges:  m,
+			Codes:       m,
+			Lockouts:    m,
+			Revocations: m,
+		}
+	})
+}
+
+func TestRecordsAreCopied(t *testing.T) {
+	m := New()
+	ctx := context.Background()
+
+	c := &data.Credential{ID: []byte("cred"), UserID: "u1", Transports: []string{"usb"}}
+	m.CreateCredential(ctx, c)
+	c.Transports[0] = "changed"
+
+	got, _ := m.GetCredentialByID(ctx, []byte("cred"))
+	got.Transports[0] = "changed again"
+	if again, _ := m.GetCredentialByID(ctx, []byte("cred")); again.Transports[0] != "usb" {
+		t.Errorf("stored credential was modified through a caller's copy: %+v", again)
+	}
+}
+
+func TestExpiry(t *testing.T) {
+	m := New()
+	ctx := context.Background()
+
+	m.SaveCode(ctx, "k", "hash", time.Millisecond)
+	m.SaveChallenge(ctx, "k", []byte("v"), time.Millisecond)
+	m.Revoke(ctx, "jti", time.Millisecond)
+	m.SetLockedUntil(ctx, "acct:a@example.com", time.Now().Add(time.Millisecond))
+	time.Sleep(5 * time.Millisecond)
+
+	if _, err := m.IncrCodeAttempts(ctx, "k"); !errors.Is(err, data.ErrCodeNotFound) {
+		t.Errorf("expected code to expire, got %v", err)
+	}
+	if _, err := m.PopChallenge(ctx, "k"); !errors.Is(err, data.ErrChallengeNotFound) {
+		t.Errorf("expected challenge to expire, got %v", err)
+	}
+	if ok, _ := m.IsRevoked(ctx, "jti"); ok {
+		t.Error("expected revocation to expire")
+	}
+	if until, _ := m.GetLockedUntil(ctx, "acct:a@example.com"); !until.IsZero() {
+		t.Errorf("expected lock to expire, got %s", until)
+	}
+
+	past := &data.Session{ID: "s1", UserID: "u1", RefreshToken: "rt1", ExpiresAt: time.Now().Add(-time.Minute)}
+	m.CreateSession(ctx, past)
+	if list, _ := m.ListSessionsByUser(ctx, "u1"); len(list) != 0 {
+		t.Errorf("expected expired sessions to be hidden, got %+v", list)
+	}
+}
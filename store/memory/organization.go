@@ -0,0 +1,210 @@
+package memory
+
+import (
+	"context"
+	"sort"
+	"time"
+
+	"auth-go-skd/data"
+)
+
+// OrganizationStorage implementation
+
+func (m *Memory) CreateOrganization(_ context.Context, org *data.Organization) error {
+	m.lock()
+	defer m.unlock()
+
+	if _, ok := m.orgs[org.ID]; ok {
+		return data.ErrConflict
+	}
+	if _, ok := m.slugs[org.Slug]; ok {
+		return data.ErrConflict
+	}
+	m.orgs[org.ID] = *org
+	m.slugs[org.Slug] = org.ID
+	return nil
+}
+
+func (m *Memory) GetOrganization(_ context.Context, id string) (*data.Organization, error) {
+	m.lock()
+	defer m.unlock()
+
+	org, ok := m.orgs[id]
+	if !ok {
+		return nil, data.ErrOrgNotFound
+	}
+	return &org, nil
+}
+
+func (m *Memory) GetOrganizationBySlug(_ context.Context, slug string) (*data.Organization, error) {
+	m.lock()
+	defer m.unlock()
+
+	org, ok := m.orgs[m.slugs[slug]]
+	if !ok {
+		return nil, data.ErrOrgNotFound
+	}
+	return &org, nil
+}
+
+func (m *Memory) DeleteOrganization(_ context.Context, id string) error {
+	m.lock()
+	defer m.unlock()
+
+	org, ok := m.orgs[id]
+	if !ok {
+		return data.ErrOrgNotFound
+	}
+	delete(m.orgs, id)
+	delete(m.slugs, org.Slug)
+
+	for key := range m.members {
+		if key.orgID == id {
+			delete(m.members, key)
+		}
+	}
+	for invID, inv := range m.invitations {
+		if inv.OrgID == id {
+			delete(m.invitations, invID)
+		}
+	}
+	return nil
+}
+
+// MembershipStorage implementation
+
+func (m *Memory) AddMember(_ context.Context, membership *data.Membership) error {
+	m.lock()
+	defer m.unlock()
+
+	key := memberKey{membership.OrgID, membership.UserID}
+	if _, ok := m.members[key]; ok {
+		return data.ErrConflict
+	}
+	m.members[key] = *membership
+	return nil
+}
+
+func (m *Memory) GetMembership(_ context.Context, orgID, userID string) (*data.Membership, error) {
+	m.lock()
+	defer m.unlock()
+
+	membership, ok := m.members[memberKey{orgID, userID}]
+	if !ok {
+		return nil, data.ErrMemberNotFound
+	}
+	return &membership, nil
+}
+
+func (m *Memory) UpdateMemberRole(_ context.Context, orgID, userID, role string) error {
+	m.lock()
+	defer m.unlock()
+
+	key := memberKey{orgID, userID}
+	membership, ok := m.members[key]
+	if !ok {
+		return data.ErrMemberNotFound
+	}
+	membership.Role = role
+	m.members[key] = membership
+	return nil
+}
+
+func (m *Memory) RemoveMember(_ context.Context, orgID, userID string) error {
+	m.lock()
+	defer m.unlock()
+
+	key := memberKey{orgID, userID}
+	if _, ok := m.members[key]; !ok {
+		return data.ErrMemberNotFound
+	}
+	delete(m.members, key)
+	return nil
+}
+
+func (m *Memory) ListMembershipsByUser(_ context.Context, userID string) ([]data.Membership, error) {
+	return m.listMembers(func(k memberKey) bool { return k.userID == userID }), nil
+}
+
+func (m *Memory) ListMembersByOrg(_ context.Context, orgID string) ([]data.Membership, error) {
+	return m.listMembers(func(k memberKey) bool { return k.orgID == orgID }), nil
+}
+
+// listMembers returns the memberships whose key matches, oldest first.
+func (m *Memory) listMembers(match func(memberKey) bool) []data.Membership {
+	m.lock()
+	defer m.unlock()
+
+	var members []data.Membership
+	for key, membership := range m.members {
+		if match(key) {
+			members = append(members, membership)
+		}
+	}
+	sort.Slice(members, func(i, j int) bool {
+		return members[i].CreatedAt.Before(members[j].CreatedAt)
+	})
+	return members
+}
+
+// InvitationStorage implementation
+
+func (m *Memory) CreateInvitation(_ context.Context, inv *data.Invitation) error {
+	m.lock()
+	defer m.unlock()
+
+	if _, ok := m.invitations[inv.ID]; ok {
+		return data.ErrConflict
+	}
+	m.invitations[inv.ID] = *inv
+	return nil
+}
+
+func (m *Memory) GetInvitation(_ context.Context, id string) (*data.Invitation, error) {
+	m.lock()
+	defer m.unlock()
+
+	inv, ok := m.invitations[id]
+	if !ok {
+		return nil, data.ErrInviteNotFound
+	}
+	return &inv, nil
+}
+
+func (m *Memory) ListInvitationsByOrg(_ context.Context, orgID string) ([]data.Invitation, error) {
+	m.lock()
+	defer m.unlock()
+
+	var list []data.Invitation
+	for _, inv := range m.invitations {
+		if inv.OrgID == orgID && inv.AcceptedAt.IsZero() {
+			list = append(list, inv)
+		}
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].CreatedAt.Before(list[j].CreatedAt) })
+	return list, nil
+}
+
+func (m *Memory) AcceptInvitation(_ context.Context, id string, at time.Time) error {
+	m.lock()
+	defer m.unlock()
+
+	inv, ok := m.invitations[id]
+	if !ok || !inv.AcceptedAt.IsZero() {
+		return data.ErrInviteNotFound
+	}
+	inv.AcceptedAt = at
+	m.invitations[id] = inv
+	return nil
+}
+
+func (m *Memory) DeleteInvitation(_ context.Context, id string) error {
+	m.lock()
+	defer m.unlock()
+
+	if _, ok := m.invitations[id]; !ok {
+		return data.ErrInviteNotFound
+	}
+	delete(m.invitations, id)
+	return nil
+}
@@ -0,0 +1,127 @@
+package memory
+
+import (
+	"context"
+	"sort"
+	"time"
+
+	"auth-go-skd/data"
+)
+
+// SessionStorage implementation
+
+func (m *Memory) CreateSession(_ context.Context, session *data.Session) error {
+	m.lock()
+	defer m.unlock()
+
+	if _, ok := m.sessions[session.ID]; ok {
+		return data.ErrConflict
+	}
+	m.sessions[session.ID] = *session
+	m.refreshTokens[session.RefreshToken] = session.ID
+	return nil
+}
+
+func (m *Memory) GetSessionByRefreshToken(_ context.Context, refreshToken string) (*data.Session, error) {
+	m.lock()
+	defer m.unlock()
+
+	id, ok := m.refreshTokens[refreshToken]
+	if !ok {
+		return nil, data.ErrSessionNotFound
+	}
+	session := m.sessions[id]
+	return &session, nil
+}
+
+func (m *Memory) DeleteSession(_ context.Context, id string) error {
+	m.lock()
+	defer m.unlock()
+
+	if _, ok := m.sessions[id]; !ok {
+		return data.ErrSessionNotFound
+	}
+	m.deleteSession(id)
+	return nil
+}
+
+func (m *Memory) deleteSession(id string) {
+	if s, ok := m.sessions[id]; ok {
+		delete(m.refreshTokens, s.RefreshToken)
+		delete(m.sessions, id)
+	}
+}
+
+// ListSessionsByUser returns the user's unexpired sessions, newest first.
+func (m *Memory) ListSessionsByUser(_ context.Context, userID string) ([]data.Session, error) {
+	m.lock()
+	defer m.unlock()
+
+	now := time.Now()
+	var sessions []data.Session
+	for _, s := range m.sessions {
+		if s.UserID == userID && s.ExpiresAt.After(now) {
+			sessions = append(sessions, s)
+		}
+	}
+	sort.Slice(sessions, func(i, j int) bool {
+		return sessions[i].CreatedAt.After(sessions[j].CreatedAt)
+	})
+	return sessions, nil
+}
+
+func (m *Memory) DeleteSessionsByUser(_ context.Context, userID, exceptID string) error {
+	m.lock()
+	defer m.unlock()
+
+	for id, s := range m.sessions {
+		if s.UserID == userID && id != exceptID {
+			m.deleteSession(id)
+		}
+	}
+	return nil
+}
+
+// RotateSession implements store.SessionRotator.
+func (m *Memory) RotateSession(_ context.Context, oldRefreshToken string, next *data.Session) (*data.Session, error) {
+	m.lock()
+	defer m.unlock()
+
+	id, ok := m.refreshTokens[oldRefreshToken]
+	if !ok {
+		return nil, data.ErrSessionNotFound
+	}
+	old := m.sessions[id]
+	m.deleteSession(id)
+	if old.IsBlocked || time.Now().After(old.ExpiresAt) {
+		return nil, data.ErrSessionNotFound
+	}
+
+	next.UserID = old.UserID
+	m.sessions[next.ID] = *next
+	m.refreshTokens[next.RefreshToken] = next.ID
+	return &old, nil
+}
+
+// RevocationStorage implementation
+
+func (m *Memory) Revoke(_ context.Context, id string, ttl time.Duration) error {
+	if ttl <= 0 {
+		return nil
+	}
+
+	m.lock()
+	defer m.unlock()
+
+	sweep(m.revoked, func(t time.Time) time.Time { return t })
+	m.revoked[id] = time.Now().Add(ttl)
+	return nil
+}
+
+func (m *Memory) IsRevoked(_ context.Context, id string) (bool, error) {
+	m.lock()
+	defer m.unlock()
+
+	exp, ok := m.revoked[id]
+	return ok && time.Now().Before(exp), nil
+}
@@ -0,0 +1,55 @@
+package memory
+
+import (
+	"context"
+	"slices"
+	"sort"
+	"time"
+
+	"auth-go-skd/data"
+)
+
+func cloneTenant(t data.Tenant) data.Tenant {
+	t.Hosts = slices.Clone(t.Hosts)
+	t.VerifiedDomains = slices.Clone(t.VerifiedDomains)
+	t.Providers = slices.Clone(t.Providers)
+	for i := range t.Providers {
+		t.Providers[i].Scopes = slices.Clone(t.Providers[i].Scopes)
+	}
+	return t
+}
+
+// TenantStorage implementation
+
+func (m *Memory) SaveTenant(_ context.Context, tenant *data.Tenant) error {
+	m.lock()
+	defer m.unlock()
+
+	tenant.UpdatedAt = time.Now()
+	m.tenants[tenant.ID] = cloneTenant(*tenant)
+	return nil
+}
+
+// ListTenants returns all tenants ordered by ID.
+func (m *Memory) ListTenants(_ context.Context) ([]data.Tenant, error) {
+	m.lock()
+	defer m.unlock()
+
+	tenants := make([]data.Tenant, 0, len(m.tenants))
+	for _, t := range m.tenants {
+		tenants = append(tenants, cloneTenant(t))
+	}
+	sort.Slice(tenants, func(i, j int) bool { return tenants[i].ID < tenants[j].ID })
+	return tenants, nil
+}
+
+func (m *Memory) DeleteTenant(_ context.Context, id string) error {
+	m.lock()
+	defer m.unlock()
+
+	if _, ok := m.tenants[id]; !ok {
+		return data.ErrTenantNotFound
+	}
+	delete(m.tenants, id)
+	return nil
+}
@@ -0,0 +1,108 @@
+package memory
+
+import (
+	"context"
+	"maps"
+
+	"auth-go-skd/data"
+	"auth-go-skd/store"
+)
+
+// snapshot is a copy of the persistent records, taken to roll a transaction back.
+type snapshot struct {
+	users         map[string]data.User
+	emails        map[string]string
+	sessions      map[string]data.Session
+	refreshTokens map[string]string
+	identities    map[identityKey]data.Identity
+	credentials   map[string]data.Credential
+	orgs          map[string]data.Organization
+	slugs         map[string]string
+	members       map[memberKey]data.Membership
+	invitations   map[string]data.Invitation
+	apiKeys       map[string]data.APIKey
+	keyPrefixes   map[string]string
+}
+
+func (m *Memory) snapshot() snapshot {
+	return snapshot{
+		users:         maps.Clone(m.users),
+		emails:        maps.Clone(m.emails),
+		sessions:      maps.Clone(m.sessions),
+		refreshTokens: maps.Clone(m.refreshTokens),
+		identities:    maps.Clone(m.identities),
+		credentials:   maps.Clone(m.credentials),
+		orgs:          maps.Clone(m.orgs),
+		slugs:         maps.Clone(m.slugs),
+		members:       maps.Clone(m.members),
+		invitations:   maps.Clone(m.invitations),
+		apiKeys:       maps.Clone(m.apiKeys),
+		keyPrefixes:   maps.Clone(m.keyPrefixes),
+	}
+}
+
+// restore copies s back into the existing maps, which transaction views share.
+func (m *Memory) restore(s snapshot) {
+	replace(m.users, s.users)
+	replace(m.emails, s.emails)
+	replace(m.sessions, s.sessions)
+	replace(m.refreshTokens, s.refreshTokens)
+	replace(m.identities, s.identities)
+	replace(m.credentials, s.credentials)
+	replace(m.orgs, s.orgs)
+	replace(m.slugs, s.slugs)
+	replace(m.members, s.members)
+	replace(m.invitations, s.invitations)
+	replace(m.apiKeys, s.apiKeys)
+	replace(m.keyPrefixes, s.keyPrefixes)
+}
+
+func replace[K comparable, V any](dst, src map[K]V) {
+	clear(dst)
+	maps.Copy(dst, src)
+}
+
+// WithTx implements store.Transactor. The store stays locked while fn runs, so other
+// callers wait for the transaction. Challenges, codes, lockouts and revocations written
+// inside fn are not rolled back.
+func (m *Memory) WithTx(_ context.Context, fn func(tx store.Store) error) error {
+	tx := m
+	if !m.inTx {
+		m.mu.Lock()
+		defer m.mu.Unlock()
+		tx = m.view()
+	}
+
+	snap := m.snapshot()
+	if err := fn(tx); err != nil {
+		m.restore(snap)
+		return err
+	}
+	return nil
+}
+
+// view shares m's maps but skips locking, for use while m.mu is held.
+func (m *Memory) view() *Memory {
+	return &Memory{
+		inTx:          true,
+		users:         m.users,
+		emails:        m.emails,
+		sessions:      m.sessions,
+		refreshTokens: m.refreshTokens,
+		identities:    m.identities,
+		credentials:   m.credentials,
+		orgs:          m.orgs,
+		slugs:         m.slugs,
+		members:       m.members,
+		invitations:   m.invitations,
+		tenants:       m.tenants,
+		clients:       m.clients,
+		apiKeys:       m.apiKeys,
+		keyPrefixes:   m.keyPrefixes,
+		challenges:    m.challenges,
+		codes:         m.codes,
+		failures:      m.failures,
+		locked:        m.locked,
+		revoked:       m.revoked,
+	}
+}
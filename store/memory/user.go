@@ -0,0 +1,179 @@
+package memory
+
+import (
+	"context"
+	"sort"
+	"strings"
+	"time"
+
+	"auth-go-skd/data"
+)
+
+// UserStorage implementation
+
+func (m *Memory) CreateUser(_ context.Context, user *data.User) error {
+	m.lock()
+	defer m.unlock()
+
+	if _, ok := m.emails[user.Email]; ok {
+		return data.ErrEmailTaken
+	}
+	if _, ok := m.users[user.ID]; ok {
+		return data.ErrConflict
+	}
+	m.users[user.ID] = *user
+	m.emails[user.Email] = user.ID
+	return nil
+}
+
+func (m *Memory) GetUserByEmail(_ context.Context, email string) (*data.User, error) {
+	m.lock()
+	defer m.unlock()
+
+	id, ok := m.emails[email]
+	if !ok {
+		return nil, data.ErrUserNotFound
+	}
+	user := m.users[id]
+	return &user, nil
+}
+
+func (m *Memory) GetUserByID(_ context.Context, id string) (*data.User, error) {
+	m.lock()
+	defer m.unlock()
+
+	user, ok := m.users[id]
+	if !ok {
+		return nil, data.ErrUserNotFound
+	}
+	return &user, nil
+}
+
+// UpdateUser changes the same columns as the SQL stores.
+func (m *Memory) UpdateUser(_ context.Context, user *data.User) error {
+	m.lock()
+	defer m.unlock()
+
+	stored, ok := m.users[user.ID]
+	if !ok {
+		return data.ErrUserNotFound
+	}
+	stored.Name = user.Name
+	stored.PasswordHash = user.PasswordHash
+	stored.Role = user.Role
+	stored.IsVerified = user.IsVerified
+	stored.BlockedAt = user.BlockedAt
+	stored.BlockedReason = user.BlockedReason
+	stored.DeletedAt = user.DeletedAt
+	stored.UpdatedAt = user.UpdatedAt
+	m.users[user.ID] = stored
+	return nil
+}
+
+// DeleteUser removes the user with their sessions, identities, memberships and API keys,
+// like the ON DELETE CASCADE in SQL.
+func (m *Memory) DeleteUser(_ context.Context, id string) error {
+	m.lock()
+	defer m.unlock()
+
+	if _, ok := m.users[id]; !ok {
+		return data.ErrUserNotFound
+	}
+	m.deleteUser(id)
+	return nil
+}
+
+func (m *Memory) PurgeDeletedUsers(_ context.Context, before time.Time) (int, error) {
+	m.lock()
+	defer m.unlock()
+
+	n := 0
+	for id, u := range m.users {
+		if !u.DeletedAt.IsZero() && u.DeletedAt.Before(before) {
+			m.deleteUser(id)
+			n++
+		}
+	}
+	return n, nil
+}
+
+func (m *Memory) deleteUser(id string) {
+	user := m.users[id]
+	delete(m.users, id)
+	delete(m.emails, user.Email)
+
+	for sid, s := range m.sessions {
+		if s.UserID == id {
+			m.deleteSession(sid)
+		}
+	}
+	for key, identity := range m.identities {
+		if identity.UserID == id {
+			delete(m.identities, key)
+		}
+	}
+	for key, c := range m.credentials {
+		if c.UserID == id {
+			delete(m.credentials, key)
+		}
+	}
+	for key := range m.members {
+		if key.userID == id {
+			delete(m.members, key)
+		}
+	}
+	for keyID, k := range m.apiKeys {
+		if k.UserID == id {
+			delete(m.apiKeys, keyID)
+			delete(m.keyPrefixes, k.Prefix)
+		}
+	}
+}
+
+func (m *Memory) ListUsers(_ context.Context, f data.UserFilter) ([]data.User, error) {
+	m.lock()
+	defer m.unlock()
+
+	users := m.filterUsers(f)
+	sort.Slice(users, func(i, j int) bool {
+		if !users[i].CreatedAt.Equal(users[j].CreatedAt) {
+			return users[i].CreatedAt.Before(users[j].CreatedAt)
+		}
+		return users[i].ID < users[j].ID
+	})
+
+	if f.Offset >= len(users) {
+		return nil, nil
+	}
+	users = users[f.Offset:]
+	if f.Limit > 0 && f.Limit < len(users) {
+		users = users[:f.Limit]
+	}
+	return users, nil
+}
+
+func (m *Memory) CountUsers(_ context.Context, f data.UserFilter) (int, error) {
+	m.lock()
+	defer m.unlock()
+
+	return len(m.filterUsers(f)), nil
+}
+
+func (m *Memory) filterUsers(f data.UserFilter) []data.User {
+	email := strings.ToLower(f.Email)
+	var users []data.User
+	for _, u := range m.users {
+		switch {
+		case email != "" && !strings.Contains(strings.ToLower(u.Email), email),
+			f.Role != "" && u.Role != f.Role,
+			f.Verified != nil && u.IsVerified != *f.Verified,
+			f.Blocked != nil && u.BlockedAt.IsZero() == *f.Blocked,
+			f.Deleted != nil && u.DeletedAt.IsZero() == *f.Deleted,
+			!f.CreatedAfter.IsZero() && u.CreatedAt.Before(f.CreatedAfter),
+			!f.CreatedBefore.IsZero() && !u.CreatedAt.Before(f.CreatedBefore):
+			continue
+		}
+		users = append(users, u)
+	}
+	return users
+}
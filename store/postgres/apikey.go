@@ -0,0 +1,81 @@
+package postgres
+
+import (
+	"context"
+	"time"
+
+	"auth-go-skd/data"
+
+	"github.com/jackc/pgx/v5"
+)
+
+const apiKeyColumns = `id, user_id, name, prefix, key_hash, scopes, expires_at, last_used_at, last_used_ip, created_at`
+
+// APIKeyStorage implementation
+
+func (p *Postgres) CreateAPIKey(ctx context.Context, k *data.APIKey) error {
+	scopes := k.Scopes
+	if scopes == nil {
+		scopes = []string{}
+	}
+	query := `INSERT INTO api_keys (` + apiKeyColumns + `) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)`
+	_, err := p.db().Exec(ctx, query, k.ID, k.UserID, k.Name, k.Prefix, k.KeyHash, scopes,
+		nullTime(k.ExpiresAt), nullTime(k.LastUsedAt), k.LastUsedIP, k.CreatedAt)
+	return mapConflict(err)
+}
+
+func (p *Postgres) GetAPIKeyByPrefix(ctx context.Context, prefix string) (*data.APIKey, error) {
+	query := `SELECT ` + apiKeyColumns + ` FROM api_keys WHERE prefix = $1`
+	k, err := scanAPIKey(p.db().QueryRow(ctx, query, prefix))
+	if err != nil {
+		return nil, mapNotFound(err, data.ErrAPIKeyNotFound)
+	}
+	return k, nil
+}
+
+func (p *Postgres) ListAPIKeysByUser(ctx context.Context, userID string) ([]data.APIKey, error) {
+	query := `SELECT ` + apiKeyColumns + ` FROM api_keys WHERE user_id = $1 ORDER BY created_at, id`
+	rows, err := p.db().Query(ctx, query, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var keys []data.APIKey
+	for rows.Next() {
+		k, err := scanAPIKey(rows)
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, *k)
+	}
+	return keys, rows.Err()
+}
+
+func (p *Postgres) TouchAPIKey(ctx context.Context, id string, at time.Time, ip string) error {
+	tag, err := p.db().Exec(ctx, `UPDATE api_keys SET last_used_at = $1, last_used_ip = $2 WHERE id = $3`, at, ip, id)
+	return affected(tag, err, data.ErrAPIKeyNotFound)
+}
+
+func (p *Postgres) DeleteAPIKey(ctx context.Context, userID, id string) error {
+	tag, err := p.db().Exec(ctx, `DELETE FROM api_keys WHERE id = $1 AND user_id = $2`, id, userID)
+	return affected(tag, err, data.ErrAPIKeyNotFound)
+}
+
+func scanAPIKey(row pgx.Row) (*data.APIKey, error) {
+	var (
+		k                     data.APIKey
+		expiresAt, lastUsedAt *time.Time
+	)
+	err := row.Scan(&k.ID, &k.UserID, &k.Name, &k.Prefix, &k.KeyHash, &k.Scopes, &expiresAt, &lastUsedAt, &k.LastUsedIP, &k.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+	if expiresAt != nil {
+		k.ExpiresAt = *expiresAt
+	}
+	if lastUsedAt != nil {
+		k.LastUsedAt = *lastUsedAt
+	}
+	return &k, nil
+}
@@ -0,0 +1,42 @@
+package postgres
+
+import (
+	"context"
+
+	"auth-go-skd/audit"
+)
+
+// audit.Sink implementation. Events outlive their users, so user_id has no foreign key.
+
+func (p *Postgres) RecordEvent(ctx context.Context, e audit.Event) error {
+	query := `INSERT INTO audit_events (id, type, user_id, provider, ip, user_agent, outcome, reason, created_at)
+			  VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)`
+	_, err := p.db().Exec(ctx, query, e.ID, e.Type, e.UserID, e.Provider, e.IP, e.UserAgent, e.Outcome, e.Reason, e.Time)
+	return mapConflict(err)
+}
+
+func (p *Postgres) RecentEvents(ctx context.Context, userID string, limit int) ([]audit.Event, error) {
+	query := `SELECT id, type, user_id, provider, ip, user_agent, outcome, reason, created_at
+			  FROM audit_events WHERE user_id = $1 ORDER BY created_at DESC LIMIT $2`
+	rows, err := p.db().Query(ctx, query, userID, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var events []audit.Event
+	for rows.Next() {
+		var e audit.Event
+		if err := rows.Scan(&e.ID, &e.Type, &e.UserID, &e.Provider, &e.IP, &e.UserAgent, &e.Outcome, &e.Reason, &e.Time); err != nil {
+			return nil, err
+		}
+		events = append(events, e)
+	}
+	return events, rows.Err()
+}
+
+func (p *Postgres) EraseUserEvents(ctx context.Context, userID string) error {
+	query := `UPDATE audit_events SET user_id = '', ip = '', user_agent = '' WHERE user_id = $1`
+	_, err := p.db().Exec(ctx, query, userID)
+	return err
+}
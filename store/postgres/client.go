@@ -0,0 +1,66 @@
+package postgres
+
+import (
+	"context"
+
+	"auth-go-skd/data"
+
+	"github.com/jackc/pgx/v5"
+)
+
+const clientColumns = `id, name, secret_hash, scopes, redirect_uris, created_at`
+
+// ClientStorage implementation
+
+func (p *Postgres) CreateClient(ctx context.Context, c *data.Client) error {
+	scopes, redirectURIs := c.Scopes, c.RedirectURIs
+	if scopes == nil {
+		scopes = []string{}
+	}
+	if redirectURIs == nil {
+		redirectURIs = []string{}
+	}
+	query := `INSERT INTO clients (` + clientColumns + `) VALUES ($1, $2, $3, $4, $5, $6)`
+	_, err := p.db().Exec(ctx, query, c.ID, c.Name, c.SecretHash, scopes, redirectURIs, c.CreatedAt)
+	return mapConflict(err)
+}
+
+func (p *Postgres) GetClient(ctx context.Context, id string) (*data.Client, error) {
+	query := `SELECT ` + clientColumns + ` FROM clients WHERE id = $1`
+	c, err := scanClient(p.db().QueryRow(ctx, query, id))
+	if err != nil {
+		return nil, mapNotFound(err, data.ErrClientNotFound)
+	}
+	return c, nil
+}
+
+func (p *Postgres) ListClients(ctx context.Context) ([]data.Client, error) {
+	rows, err := p.db().Query(ctx, `SELECT `+clientColumns+` FROM clients ORDER BY created_at, id`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var clients []data.Client
+	for rows.Next() {
+		c, err := scanClient(rows)
+		if err != nil {
+			return nil, err
+		}
+		clients = append(clients, *c)
+	}
+	return clients, rows.Err()
+}
+
+func (p *Postgres) DeleteClient(ctx context.Context, id string) error {
+	tag, err := p.db().Exec(ctx, `DELETE FROM clients WHERE id = $1`, id)
+	return affected(tag, err, data.ErrClientNotFound)
+}
+
+func scanClient(row pgx.Row) (*data.Client, error) {
+	var c data.Client
+	if err := row.Scan(&c.ID, &c.Name, &c.SecretHash, &c.Scopes, &c.RedirectURIs, &c.CreatedAt); err != nil {
+		return nil, err
+	}
+	return &c, nil
+}
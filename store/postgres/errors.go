@@ -0,0 +1,60 @@
+package postgres
+
+import (
+	"errors"
+	"fmt"
+
+	"auth-go-skd/data"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+// PostgreSQL error codes, see https://www.postgresql.org/docs/current/errcodes-appendix.html.
+const (
+	uniqueViolation           = "23505"
+	invalidTextRepresentation = "22P02"
+)
+
+const usersEmailConstraint = "users_email_key"
+
+// isNoRows reports whether err means the row doesn't exist. A malformed UUID can't match
+// any row either, so it is treated the same way.
+func isNoRows(err error) bool {
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) {
+		return pgErr.Code == invalidTextRepresentation
+	}
+	return errors.Is(err, pgx.ErrNoRows)
+}
+
+// mapNotFound turns a missing row into notFound, wrapping the cause.
+func mapNotFound(err, notFound error) error {
+	if err != nil && isNoRows(err) {
+		return fmt.Errorf("%w: %w", notFound, err)
+	}
+	return err
+}
+
+// mapConflict turns unique violations into data.ErrEmailTaken or data.ErrConflict, wrapping the cause.
+func mapConflict(err error) error {
+	var pgErr *pgconn.PgError
+	if !errors.As(err, &pgErr) || pgErr.Code != uniqueViolation {
+		return err
+	}
+	if pgErr.ConstraintName == usersEmailConstraint {
+		return fmt.Errorf("%w: %w", data.ErrEmailTaken, err)
+	}
+	return fmt.Errorf("%w: %w", data.ErrConflict, err)
+}
+
+// affected returns notFound when an update or delete touched no rows.
+func affected(tag pgconn.CommandTag, err, notFound error) error {
+	if err != nil {
+		return mapNotFound(err, notFound)
+	}
+	if tag.RowsAffected() == 0 {
+		return notFound
+	}
+	return nil
+}
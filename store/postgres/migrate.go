@@ -0,0 +1,244 @@
+package postgres
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"sort"
+	"strconv"
+	"strings"
+
+	"auth-go-skd/migrations"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// migrationLockID is the pg_advisory_lock key held while migrating, so that instances
+// starting together apply each migration once.
+const migrationLockID = 0x61757468676f736b // "authgosk"
+
+type migration struct {
+	version uint
+	name    string
+	up      string
+	down    string
+}
+
+// loadMigrations reads NNNNNN_name.up.sql / .down.sql pairs from fsys, ordered by version.
+func loadMigrations(fsys fs.FS) ([]migration, error) {
+	files, err := fs.Glob(fsys, "*.sql")
+	if err != nil {
+		return nil, err
+	}
+
+	byVersion := make(map[uint]*migration)
+	for _, file := range files {
+		var direction string
+		switch {
+		case strings.HasSuffix(file, ".up.sql"):
+			direction = "up"
+		case strings.HasSuffix(file, ".down.sql"):
+			direction = "down"
+		default:
+			continue
+		}
+
+		prefix, name, ok := strings.Cut(strings.TrimSuffix(file, "."+direction+".sql"), "_")
+		if !ok {
+			return nil, fmt.Errorf("migration %s: expected NNNNNN_name.%s.sql", file, direction)
+		}
+		version, err := strconv.ParseUint(prefix, 10, 32)
+		if err != nil || version == 0 {
+			return nil, fmt.Errorf("migration %s: bad version %q", file, prefix)
+		}
+		script, err := fs.ReadFile(fsys, file)
+		if err != nil {
+			return nil, err
+		}
+
+		m := byVersion[uint(version)]
+		if m == nil {
+			m = &migration{version: uint(version), name: name}
+			byVersion[uint(version)] = m
+		}
+		if direction == "up" {
+			m.up = string(script)
+		} else {
+			m.down = string(script)
+		}
+	}
+
+	list := make([]migration, 0, len(byVersion))
+	for _, m := range byVersion {
+		if m.up == "" {
+			return nil, fmt.Errorf("migration %d_%s: missing up script", m.version, m.name)
+		}
+		list = append(list, *m)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].version < list[j].version })
+	return list, nil
+}
+
+// Migrate applies all pending migrations.
+func (p *Postgres) Migrate(ctx context.Context) error {
+	list, err := loadMigrations(migrations.FS)
+	if err != nil {
+		return err
+	}
+	if len(list) == 0 {
+		return nil
+	}
+	return p.MigrateTo(ctx, list[len(list)-1].version)
+}
+
+// MigrateDown rolls back the most recently applied migration.
+func (p *Postgres) MigrateDown(ctx context.Context) error {
+	list, err := loadMigrations(migrations.FS)
+	if err != nil {
+		return err
+	}
+	current, err := p.MigrationVersion(ctx)
+	if err != nil {
+		return err
+	}
+
+	var target uint
+	for _, m := range list {
+		if m.version < current {
+			target = m.version
+		}
+	}
+	return p.MigrateTo(ctx, target)
+}
+
+// MigrateTo migrates up or down until version is the latest applied migration.
+// Version 0 rolls back everything.
+func (p *Postgres) MigrateTo(ctx context.Context, version uint) error {
+	list, err := loadMigrations(migrations.FS)
+	if err != nil {
+		return err
+	}
+	if version != 0 && !containsVersion(list, version) {
+		return fmt.Errorf("migrate: unknown version %d", version)
+	}
+
+	conn, err := p.Pool.Acquire(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Release()
+
+	// Session-level advisory locks belong to the connection, so lock and unlock on the same one.
+	if _, err := conn.Exec(ctx, `SELECT pg_advisory_lock($1)`, int64(migrationLockID)); err != nil {
+		return fmt.Errorf("migrate: lock: %w", err)
+	}
+	defer conn.Exec(context.Background(), `SELECT pg_advisory_unlock($1)`, int64(migrationLockID))
+
+	// Same table layout as the migrate CLI, so databases migrated with it are picked up where they are.
+	_, err = conn.Exec(ctx, `CREATE TABLE IF NOT EXISTS schema_migrations (version BIGINT NOT NULL PRIMARY KEY, dirty BOOLEAN NOT NULL)`)
+	if err != nil {
+		return err
+	}
+	current, err := migrationVersion(ctx, conn)
+	if err != nil {
+		return err
+	}
+
+	if version >= current {
+		for _, m := range list {
+			if m.version <= current || m.version > version {
+				continue
+			}
+			if err := applyMigration(ctx, conn, m.up, m.version); err != nil {
+				return fmt.Errorf("migrate: %d_%s up: %w", m.version, m.name, err)
+			}
+		}
+		return nil
+	}
+
+	for i := len(list) - 1; i >= 0; i-- {
+		m := list[i]
+		if m.version > current || m.version <= version {
+			continue
+		}
+		if m.down == "" {
+			return fmt.Errorf("migrate: %d_%s has no down script", m.version, m.name)
+		}
+		var prev uint
+		if i > 0 {
+			prev = list[i-1].version
+		}
+		if err := applyMigration(ctx, conn, m.down, prev); err != nil {
+			return fmt.Errorf("migrate: %d_%s down: %w", m.version, m.name, err)
+		}
+	}
+	return nil
+}
+
+// MigrationVersion returns the latest applied migration, or 0 for an empty database.
+func (p *Postgres) MigrationVersion(ctx context.Context) (uint, error) {
+	var exists bool
+	if err := p.Pool.QueryRow(ctx, `SELECT to_regclass('schema_migrations') IS NOT NULL`).Scan(&exists); err != nil {
+		return 0, err
+	}
+	if !exists {
+		return 0, nil
+	}
+	return migrationVersion(ctx, p.Pool)
+}
+
+// querier is satisfied by both *pgxpool.Pool and *pgxpool.Conn.
+type querier interface {
+	QueryRow(ctx context.Context, sql string, args ...any) pgx.Row
+}
+
+func migrationVersion(ctx context.Context, q querier) (uint, error) {
+	var (
+		version int64
+		dirty   bool
+	)
+	err := q.QueryRow(ctx, `SELECT version, dirty FROM schema_migrations LIMIT 1`).Scan(&version, &dirty)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	if dirty {
+		return 0, fmt.Errorf("migrate: database is dirty at version %d, fix it by hand before migrating", version)
+	}
+	return uint(version), nil
+}
+
+// applyMigration runs script and records version in one transaction.
+func applyMigration(ctx context.Context, conn *pgxpool.Conn, script string, version uint) error {
+	tx, err := conn.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	if _, err := tx.Exec(ctx, script); err != nil {
+		return err
+	}
+	if _, err := tx.Exec(ctx, `DELETE FROM schema_migrations`); err != nil {
+		return err
+	}
+	if version > 0 {
+		if _, err := tx.Exec(ctx, `INSERT INTO schema_migrations (version, dirty) VALUES ($1, false)`, int64(version)); err != nil {
+			return err
+		}
+	}
+	return tx.Commit(ctx)
+}
+
+func containsVersion(list []migration, version uint) bool {
+	for _, m := range list {
+		if m.version == version {
+			return true
+		}
+	}
+	return false
+}
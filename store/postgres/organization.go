@@ -0,0 +1,156 @@
+package postgres
+
+import (
+	"context"
+	"time"
+
+	"auth-go-skd/data"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// OrganizationStorage implementation
+
+func (p *Postgres) CreateOrganization(ctx context.Context, org *data.Organization) error {
+	query := `INSERT INTO organizations (id, name, slug, created_at, updated_at) VALUES ($1, $2, $3, $4, $5)`
+	_, err := p.db().Exec(ctx, query, org.ID, org.Name, org.Slug, org.CreatedAt, org.UpdatedAt)
+	return mapConflict(err)
+}
+
+func (p *Postgres) GetOrganization(ctx context.Context, id string) (*data.Organization, error) {
+	return p.getOrganization(ctx, `SELECT id, name, slug, created_at, updated_at FROM organizations WHERE id = $1`, id)
+}
+
+func (p *Postgres) GetOrganizationBySlug(ctx context.Context, slug string) (*data.Organization, error) {
+	return p.getOrganization(ctx, `SELECT id, name, slug, created_at, updated_at FROM organizations WHERE slug = $1`, slug)
+}
+
+func (p *Postgres) getOrganization(ctx context.Context, query, arg string) (*data.Organization, error) {
+	var org data.Organization
+	err := p.db().QueryRow(ctx, query, arg).Scan(&org.ID, &org.Name, &org.Slug, &org.CreatedAt, &org.UpdatedAt)
+	if err != nil {
+		return nil, mapNotFound(err, data.ErrOrgNotFound)
+	}
+	return &org, nil
+}
+
+func (p *Postgres) DeleteOrganization(ctx context.Context, id string) error {
+	tag, err := p.db().Exec(ctx, `DELETE FROM organizations WHERE id = $1`, id)
+	return affected(tag, err, data.ErrOrgNotFound)
+}
+
+// MembershipStorage implementation
+
+func (p *Postgres) AddMember(ctx context.Context, m *data.Membership) error {
+	query := `INSERT INTO memberships (org_id, user_id, role, created_at) VALUES ($1, $2, $3, $4)`
+	_, err := p.db().Exec(ctx, query, m.OrgID, m.UserID, m.Role, m.CreatedAt)
+	return mapConflict(err)
+}
+
+func (p *Postgres) GetMembership(ctx context.Context, orgID, userID string) (*data.Membership, error) {
+	query := `SELECT org_id, user_id, role, created_at FROM memberships WHERE org_id = $1 AND user_id = $2`
+	var m data.Membership
+	err := p.db().QueryRow(ctx, query, orgID, userID).Scan(&m.OrgID, &m.UserID, &m.Role, &m.CreatedAt)
+	if err != nil {
+		return nil, mapNotFound(err, data.ErrMemberNotFound)
+	}
+	return &m, nil
+}
+
+func (p *Postgres) UpdateMemberRole(ctx context.Context, orgID, userID, role string) error {
+	tag, err := p.db().Exec(ctx, `UPDATE memberships SET role = $1 WHERE org_id = $2 AND user_id = $3`, role, orgID, userID)
+	return affected(tag, err, data.ErrMemberNotFound)
+}
+
+func (p *Postgres) RemoveMember(ctx context.Context, orgID, userID string) error {
+	tag, err := p.db().Exec(ctx, `DELETE FROM memberships WHERE org_id = $1 AND user_id = $2`, orgID, userID)
+	return affected(tag, err, data.ErrMemberNotFound)
+}
+
+func (p *Postgres) ListMembershipsByUser(ctx context.Context, userID string) ([]data.Membership, error) {
+	return p.listMembers(ctx, `SELECT org_id, user_id, role, created_at FROM memberships WHERE user_id = $1 ORDER BY created_at`, userID)
+}
+
+func (p *Postgres) ListMembersByOrg(ctx context.Context, orgID string) ([]data.Membership, error) {
+	return p.listMembers(ctx, `SELECT org_id, user_id, role, created_at FROM memberships WHERE org_id = $1 ORDER BY created_at`, orgID)
+}
+
+func (p *Postgres) listMembers(ctx context.Context, query, arg string) ([]data.Membership, error) {
+	rows, err := p.db().Query(ctx, query, arg)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var members []data.Membership
+	for rows.Next() {
+		var m data.Membership
+		if err := rows.Scan(&m.OrgID, &m.UserID, &m.Role, &m.CreatedAt); err != nil {
+			return nil, err
+		}
+		members = append(members, m)
+	}
+	return members, rows.Err()
+}
+
+// InvitationStorage implementation
+
+func (p *Postgres) CreateInvitation(ctx context.Context, inv *data.Invitation) error {
+	query := `INSERT INTO invitations (id, org_id, email, role, invited_by, expires_at, created_at) VALUES ($1, $2, $3, $4, $5, $6, $7)`
+	_, err := p.db().Exec(ctx, query, inv.ID, inv.OrgID, inv.Email, inv.Role, inv.InvitedBy, inv.ExpiresAt, inv.CreatedAt)
+	return mapConflict(err)
+}
+
+func (p *Postgres) GetInvitation(ctx context.Context, id string) (*data.Invitation, error) {
+	query := `SELECT id, org_id, email, role, invited_by, expires_at, accepted_at, created_at FROM invitations WHERE id = $1`
+	inv, err := scanInvitation(p.db().QueryRow(ctx, query, id))
+	if err != nil {
+		return nil, mapNotFound(err, data.ErrInviteNotFound)
+	}
+	return inv, nil
+}
+
+func (p *Postgres) ListInvitationsByOrg(ctx context.Context, orgID string) ([]data.Invitation, error) {
+	query := `SELECT id, org_id, email, role, invited_by, expires_at, accepted_at, created_at
+			  FROM invitations WHERE org_id = $1 AND accepted_at IS NULL ORDER BY created_at`
+	rows, err := p.db().Query(ctx, query, orgID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var invitations []data.Invitation
+	for rows.Next() {
+		inv, err := scanInvitation(rows)
+		if err != nil {
+			return nil, err
+		}
+		invitations = append(invitations, *inv)
+	}
+	return invitations, rows.Err()
+}
+
+func (p *Postgres) AcceptInvitation(ctx context.Context, id string, at time.Time) error {
+	tag, err := p.db().Exec(ctx, `UPDATE invitations SET accepted_at = $1 WHERE id = $2 AND accepted_at IS NULL`, at, id)
+	return affected(tag, err, data.ErrInviteNotFound)
+}
+
+func (p *Postgres) DeleteInvitation(ctx context.Context, id string) error {
+	tag, err := p.db().Exec(ctx, `DELETE FROM invitations WHERE id = $1`, id)
+	return affected(tag, err, data.ErrInviteNotFound)
+}
+
+func scanInvitation(row pgx.Row) (*data.Invitation, error) {
+	var (
+		inv        data.Invitation
+		acceptedAt *time.Time
+	)
+	err := row.Scan(&inv.ID, &inv.OrgID, &inv.Email, &inv.Role, &inv.InvitedBy, &inv.ExpiresAt, &acceptedAt, &inv.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+	if acceptedAt != nil {
+		inv.AcceptedAt = *acceptedAt
+	}
+	return &inv, nil
+}
@@ -6,11 +6,31 @@ import (
 
 	"auth-go-skd/config"
 
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
 	"github.com/jackc/pgx/v5/pgxpool"
 )
 
 type Postgres struct {
 	Pool *pgxpool.Pool
+
+	// tx is set on the Postgres handed to a WithTx callback.
+	tx pgx.Tx
+}
+
+// dbtx is satisfied by both *pgxpool.Pool and pgx.Tx.
+type dbtx interface {
+	Exec(ctx context.Context, sql string, args ...any) (pgconn.CommandTag, error)
+	Query(ctx context.Context, sql string, args ...any) (pgx.Rows, error)
+	QueryRow(ctx context.Context, sql string, args ...any) pgx.Row
+}
+
+// db returns the current transaction, or the pool outside of WithTx.
+func (p *Postgres) db() dbtx {
+	if p.tx != nil {
+		return p.tx
+	}
+	return p.Pool
 }
 
 func New(cfg config.Postgres) (*Postgres, error) {
@@ -33,7 +53,14 @@ func New(cfg config.Postgres) (*Postgres, error) {
 		return nil, fmt.Errorf("unable to ping database: %w", err)
 	}
 
-	return &Postgres{Pool: pool}, nil
+	p := &Postgres{Pool: pool}
+	if cfg.AutoMigrate {
+		if err := p.Migrate(context.Background()); err != nil {
+			pool.Close()
+			return nil, fmt.Errorf("unable to migrate database: %w", err)
+		}
+	}
+	return p, nil
 }
 
 func (p *Postgres) Close() {
@@ -0,0 +1,152 @@
+package postgres
+
+import (
+	"context"
+	"os"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"auth-go-skd/audit"
+	"auth-go-skd/migrations"
+	"auth-go-skd/store/storetest"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// newTestPostgres connects to the database in AUTH_TEST_POSTGRES_DSN, skipping the test
+// when it is unset. The schema is migrated first and tables are emptied after each test.
+func newTestPostgres(t *testing.T) *Postgres {
+	dsn := os.Getenv("AUTH_TEST_POSTGRES_DSN")
+	if dsn == "" {
+		t.Skip("AUTH_TEST_POSTGRES_DSN not set")
+	}
+
+	pool, err := pgxpool.New(context.Background(), dsn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p := &Postgres{Pool: pool}
+	if err := p.Migrate(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	truncate := func() {
+		_, err := pool.Exec(context.Background(), `TRUNCATE users, sessions, identities, webauthn_credentials, audit_events, organizations, memberships, invitations, tenants, clients, api_keys`)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	truncate()
+	t.Cleanup(func() {
+		truncate()
+		p.Close()
+	})
+	return p
+}
+
+func TestConformance(t *testing.T) {
+	storetest.Run(t, func(t *testing.T) storetest.Backend {
+		p := newTestPostgres(t)
+		return storetest.Backend{
+			Users:       p,
+			Sessions:    p,
+			Identities:  p,
+			Credentials: p,
+			Orgs:        p,
+			Members:     p,
+			Invitations: p,
+			Tenants:     p,
+			Clients:     p,
+			APIKeys:     p,
+		}
+	})
+}
+
+func TestAuditEvents(t *testing.T) {
+	p := newTestPostgres(t)
+	ctx := context.Background()
+
+	now := time.Now().Truncate(time.Millisecond)
+	var ids []string
+	for i, outcome := range []audit.Outcome{audit.Success, audit.Failure, audit.Success} {
+		e := audit.Event{ID: uuid.NewString(), Time: now.Add(time.Duration(i) * time.Second), Type: audit.Login,
+			UserID: "u1", Provider: "password", IP: "10.0.0.1", Outcome: outcome}
+		if err := p.RecordEvent(ctx, e); err != nil {
+			t.Fatal(err)
+		}
+		ids = append(ids, e.ID)
+	}
+
+	events, err := p.RecentEvents(ctx, "u1", 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(events) != 2 || events[0].ID != ids[2] || events[1].ID != ids[1] {
+		t.Fatalf("expected the two newest events, got %+v", events)
+	}
+	if events[1].Outcome != audit.Failure || events[1].Provider != "password" {
+		t.Errorf("fields not preserved: %+v", events[1])
+	}
+
+	if err := p.EraseUserEvents(ctx, "u1"); err != nil {
+		t.Fatal(err)
+	}
+	if events, _ := p.RecentEvents(ctx, "u1", 10); len(events) != 0 {
+		t.Errorf("expected the events to be anonymised, got %+v", events)
+	}
+}
+
+func TestLoadMigrations(t *testing.T) {
+	list, err := loadMigrations(migrations.FS)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, m := range list {
+		if m.version != uint(i+1) {
+			t.Errorf("expected version %d, got %d_%s", i+1, m.version, m.name)
+		}
+		if m.down == "" {
+			t.Errorf("%d_%s has no down script", m.version, m.name)
+		}
+	}
+
+	bad := fstest.MapFS{"000001_init.down.sql": {Data: []byte("DROP TABLE x;")}}
+	if _, err := loadMigrations(bad); err == nil {
+		t.Error("expected an error for a migration without up script")
+	}
+}
+
+func TestMigrateUpAndDown(t *testing.T) {
+	p := newTestPostgres(t)
+	ctx := context.Background()
+
+	list, _ := loadMigrations(migrations.FS)
+	latest := list[len(list)-1].version
+	if v, err := p.MigrationVersion(ctx); err != nil || v != latest {
+		t.Fatalf("expected version %d, got %d (%v)", latest, v, err)
+	}
+
+	if err := p.MigrateDown(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if v, _ := p.MigrationVersion(ctx); v != latest-1 {
+		t.Errorf("expected version %d after one step down, got %d", latest-1, v)
+	}
+
+	if err := p.MigrateTo(ctx, 0); err != nil {
+		t.Fatalf("down to 0: %v", err)
+	}
+	var tables int
+	p.Pool.QueryRow(ctx, `SELECT count(*) FROM information_schema.tables WHERE table_schema = current_schema() AND table_name <> 'schema_migrations'`).Scan(&tables)
+	if tables != 0 {
+		t.Errorf("expected every table to be dropped, %d left", tables)
+	}
+
+	if err := p.Migrate(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if err := p.MigrateTo(ctx, latest+1); err == nil {
+		t.Error("expected an error for an unknown version")
+	}
+}
@@ -3,51 +3,188 @@ package postgres
 import (
 	"auth-go-skd/data"
 	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5"
 )
 
 // UserStorage implementation
 
+const userColumns = `id, email, password_hash, name, role, is_verified, blocked_at, blocked_reason, deleted_at, created_at, updated_at`
+
 func (p *Postgres) CreateUser(ctx context.Context, user *data.User) error {
-	query := `INSERT INTO users (id, email, password_hash, name, role, is_verified, created_at, updated_at) 
-			  VALUES ($1, $2, $3, $4, $5, $6, $7, $8)`
-	_, err := p.Pool.Exec(ctx, query, user.ID, user.Email, user.PasswordHash, user.Name, user.Role, user.IsVerified, user.CreatedAt, user.UpdatedAt)
-	return err
+	query := `INSERT INTO users (` + userColumns + `) 
+			  VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11)`
+	_, err := p.db().Exec(ctx, query, user.ID, user.Email, user.PasswordHash, user.Name, user.Role, user.IsVerified,
+		nullTime(user.BlockedAt), user.BlockedReason, nullTime(user.DeletedAt), user.CreatedAt, user.UpdatedAt)
+	return mapConflict(err)
 }
 
 func (p *Postgres) GetUserByEmail(ctx context.Context, email string) (*data.User, error) {
-	query := `SELECT id, email, password_hash, name, role, is_verified, created_at, updated_at FROM users WHERE email = $1`
-	var user data.User
-	err := p.Pool.QueryRow(ctx, query, email).Scan(
-		&user.ID, &user.Email, &user.PasswordHash, &user.Name, &user.Role, &user.IsVerified, &user.CreatedAt, &user.UpdatedAt,
-	)
+	query := `SELECT ` + userColumns + ` FROM users WHERE email = $1`
+	user, err := scanUser(p.db().QueryRow(ctx, query, email))
 	if err != nil {
-		return nil, err
+		return nil, mapNotFound(err, data.ErrUserNotFound)
 	}
-	return &user, nil
+	return user, nil
 }
 
 func (p *Postgres) GetUserByID(ctx context.Context, id string) (*data.User, error) {
-	query := `SELECT id, email, password_hash, name, role, is_verified, created_at, updated_at FROM users WHERE id = $1`
-	var user data.User
-	err := p.Pool.QueryRow(ctx, query, id).Scan(
-		&user.ID, &user.Email, &user.PasswordHash, &user.Name, &user.Role, &user.IsVerified, &user.CreatedAt, &user.UpdatedAt,
-	)
+	query := `SELECT ` + userColumns + ` FROM users WHERE id = $1`
+	user, err := scanUser(p.db().QueryRow(ctx, query, id))
 	if err != nil {
-		return nil, err
+		return nil, mapNotFound(err, data.ErrUserNotFound)
 	}
-	return &user, nil
+	return user, nil
 }
 
 func (p *Postgres) UpdateUser(ctx context.Context, user *data.User) error {
-	query := `UPDATE users SET name=$1, password_hash=$2, updated_at=$3 WHERE id=$4`
-	_, err := p.Pool.Exec(ctx, query, user.Name, user.PasswordHash, user.UpdatedAt, user.ID)
-	return err
+	query := `UPDATE users SET name=$1, password_hash=$2, role=$3, is_verified=$4, blocked_at=$5, blocked_reason=$6, deleted_at=$7, updated_at=$8 WHERE id=$9`
+	tag, err := p.db().Exec(ctx, query, user.Name, user.PasswordHash, user.Role, user.IsVerified,
+		nullTime(user.BlockedAt), user.BlockedReason, nullTime(user.DeletedAt), user.UpdatedAt, user.ID)
+	return affected(tag, err, data.ErrUserNotFound)
 }
 
+// DeleteUser also removes the user's credentials, which don't reference users.
 func (p *Postgres) DeleteUser(ctx context.Context, id string) error {
-	query := `DELETE FROM users WHERE id=$1`
-	_, err := p.Pool.Exec(ctx, query, id)
-	return err
+	return p.inTx(ctx, func(tx *Postgres) error {
+		tag, err := tx.db().Exec(ctx, `DELETE FROM users WHERE id=$1`, id)
+		if err := affected(tag, err, data.ErrUserNotFound); err != nil {
+			return err
+		}
+		_, err = tx.db().Exec(ctx, `DELETE FROM webauthn_credentials WHERE user_id=$1`, id)
+		return err
+	})
+}
+
+// PurgeDeletedUsers also removes the purged users' credentials, like DeleteUser.
+func (p *Postgres) PurgeDeletedUsers(ctx context.Context, before time.Time) (int, error) {
+	var n int64
+	err := p.inTx(ctx, func(tx *Postgres) error {
+		_, err := tx.db().Exec(ctx, `DELETE FROM webauthn_credentials WHERE user_id IN
+			(SELECT id::text FROM users WHERE deleted_at IS NOT NULL AND deleted_at < $1)`, before)
+		if err != nil {
+			return err
+		}
+		tag, err := tx.db().Exec(ctx, `DELETE FROM users WHERE deleted_at IS NOT NULL AND deleted_at < $1`, before)
+		if err != nil {
+			return err
+		}
+		n = tag.RowsAffected()
+		return nil
+	})
+	return int(n), err
+}
+
+func (p *Postgres) ListUsers(ctx context.Context, f data.UserFilter) ([]data.User, error) {
+	where, args := userFilter(f)
+	query := `SELECT ` + userColumns + ` FROM users` + where + ` ORDER BY created_at, id`
+	if f.Limit > 0 {
+		args = append(args, f.Limit)
+		query += fmt.Sprintf(` LIMIT $%d`, len(args))
+	}
+	if f.Offset > 0 {
+		args = append(args, f.Offset)
+		query += fmt.Sprintf(` OFFSET $%d`, len(args))
+	}
+	rows, err := p.db().Query(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var users []data.User
+	for rows.Next() {
+		u, err := scanUser(rows)
+		if err != nil {
+			return nil, err
+		}
+		users = append(users, *u)
+	}
+	return users, rows.Err()
+}
+
+func (p *Postgres) CountUsers(ctx context.Context, f data.UserFilter) (int, error) {
+	where, args := userFilter(f)
+	var n int
+	err := p.db().QueryRow(ctx, `SELECT COUNT(*) FROM users`+where, args...).Scan(&n)
+	return n, err
+}
+
+// userFilter builds the WHERE clause for f.
+func userFilter(f data.UserFilter) (string, []any) {
+	var (
+		conds []string
+		args  []any
+	)
+	add := func(cond string, arg any) {
+		args = append(args, arg)
+		conds = append(conds, fmt.Sprintf(cond, len(args)))
+	}
+	if f.Email != "" {
+		add(`email ILIKE $%d`, "%"+likeEscaper.Replace(f.Email)+"%")
+	}
+	if f.Role != "" {
+		add(`role = $%d`, f.Role)
+	}
+	if f.Verified != nil {
+		add(`is_verified = $%d`, *f.Verified)
+	}
+	if f.Blocked != nil {
+		if *f.Blocked {
+			conds = append(conds, `blocked_at IS NOT NULL`)
+		} else {
+			conds = append(conds, `blocked_at IS NULL`)
+		}
+	}
+	if f.Deleted != nil {
+		if *f.Deleted {
+			conds = append(conds, `deleted_at IS NOT NULL`)
+		} else {
+			conds = append(conds, `deleted_at IS NULL`)
+		}
+	}
+	if !f.CreatedAfter.IsZero() {
+		add(`created_at >= $%d`, f.CreatedAfter)
+	}
+	if !f.CreatedBefore.IsZero() {
+		add(`created_at < $%d`, f.CreatedBefore)
+	}
+	if len(conds) == 0 {
+		return "", nil
+	}
+	return " WHERE " + strings.Join(conds, " AND "), args
+}
+
+// likeEscaper escapes the LIKE wildcards in a literal substring; backslash is the default escape.
+var likeEscaper = strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`)
+
+func scanUser(row pgx.Row) (*data.User, error) {
+	var (
+		u                    data.User
+		blockedAt, deletedAt *time.Time
+	)
+	err := row.Scan(&u.ID, &u.Email, &u.PasswordHash, &u.Name, &u.Role, &u.IsVerified, &blockedAt, &u.BlockedReason, &deletedAt, &u.CreatedAt, &u.UpdatedAt)
+	if err != nil {
+		return nil, err
+	}
+	if blockedAt != nil {
+		u.BlockedAt = *blockedAt
+	}
+	if deletedAt != nil {
+		u.DeletedAt = *deletedAt
+	}
+	return &u, nil
+}
+
+// nullTime stores the zero time as NULL.
+func nullTime(t time.Time) *time.Time {
+	if t.IsZero() {
+		return nil
+	}
+	return &t
 }
 
 // SessionStorage implementation
@@ -55,26 +192,52 @@ func (p *Postgres) DeleteUser(ctx context.Context, id string) error {
 func (p *Postgres) CreateSession(ctx context.Context, session *data.Session) error {
 	query := `INSERT INTO sessions (id, user_id, refresh_token, user_agent, client_ip, is_blocked, expires_at, created_at)
 			  VALUES ($1, $2, $3, $4, $5, $6, $7, $8)`
-	_, err := p.Pool.Exec(ctx, query,
+	_, err := p.db().Exec(ctx, query,
 		session.ID, session.UserID, session.RefreshToken, session.UserAgent, session.ClientIP, session.IsBlocked, session.ExpiresAt, session.CreatedAt)
-	return err
+	return mapConflict(err)
 }
 
 func (p *Postgres) GetSessionByRefreshToken(ctx context.Context, refreshToken string) (*data.Session, error) {
 	query := `SELECT id, user_id, refresh_token, user_agent, client_ip, is_blocked, expires_at, created_at FROM sessions WHERE refresh_token = $1`
 	var s data.Session
-	err := p.Pool.QueryRow(ctx, query, refreshToken).Scan(
+	err := p.db().QueryRow(ctx, query, refreshToken).Scan(
 		&s.ID, &s.UserID, &s.RefreshToken, &s.UserAgent, &s.ClientIP, &s.IsBlocked, &s.ExpiresAt, &s.CreatedAt,
 	)
 	if err != nil {
-		return nil, err
+		return nil, mapNotFound(err, data.ErrSessionNotFound)
 	}
 	return &s, nil
 }
 
 func (p *Postgres) DeleteSession(ctx context.Context, id string) error {
 	query := `DELETE FROM sessions WHERE id=$1`
-	_, err := p.Pool.Exec(ctx, query, id)
+	tag, err := p.db().Exec(ctx, query, id)
+	return affected(tag, err, data.ErrSessionNotFound)
+}
+
+func (p *Postgres) ListSessionsByUser(ctx context.Context, userID string) ([]data.Session, error) {
+	query := `SELECT id, user_id, refresh_token, user_agent, client_ip, is_blocked, expires_at, created_at FROM sessions
+			  WHERE user_id = $1 AND expires_at > NOW() ORDER BY created_at DESC`
+	rows, err := p.db().Query(ctx, query, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var sessions []data.Session
+	for rows.Next() {
+		var s data.Session
+		if err := rows.Scan(&s.ID, &s.UserID, &s.RefreshToken, &s.UserAgent, &s.ClientIP, &s.IsBlocked, &s.ExpiresAt, &s.CreatedAt); err != nil {
+			return nil, err
+		}
+		sessions = append(sessions, s)
+	}
+	return sessions, rows.Err()
+}
+
+func (p *Postgres) DeleteSessionsByUser(ctx context.Context, userID, exceptID string) error {
+	query := `DELETE FROM sessions WHERE user_id=$1 AND ($2 = '' OR id::text <> $2)`
+	_, err := p.db().Exec(ctx, query, userID, exceptID)
 	return err
 }
 
@@ -82,16 +245,103 @@ func (p *Postgres) DeleteSession(ctx context.Context, id string) error {
 
 func (p *Postgres) CreateIdentity(ctx context.Context, identity *data.Identity) error {
 	query := `INSERT INTO identities (id, user_id, provider, provider_id, created_at, last_login) VALUES ($1, $2, $3, $4, $5, $6)`
-	_, err := p.Pool.Exec(ctx, query, identity.ID, identity.UserID, identity.Provider, identity.ProviderID, identity.CreatedAt, identity.LastLogin)
-	return err
+	_, err := p.db().Exec(ctx, query, identity.ID, identity.UserID, identity.Provider, identity.ProviderID, identity.CreatedAt, identity.LastLogin)
+	return mapConflict(err)
 }
 
 func (p *Postgres) GetIdentityByProvider(ctx context.Context, provider, providerID string) (*data.Identity, error) {
 	query := `SELECT id, user_id, provider, provider_id, created_at, last_login FROM identities WHERE provider = $1 AND provider_id = $2`
 	var identity data.Identity
-	err := p.Pool.QueryRow(ctx, query, provider, providerID).Scan(&identity.ID, &identity.UserID, &identity.Provider, &identity.ProviderID, &identity.CreatedAt, &identity.LastLogin)
+	err := p.db().QueryRow(ctx, query, provider, providerID).Scan(&identity.ID, &identity.UserID, &identity.Provider, &identity.ProviderID, &identity.CreatedAt, &identity.LastLogin)
 	if err != nil {
-		return nil, err
+		return nil, mapNotFound(err, data.ErrIdentityNotFound)
 	}
 	return &identity, nil
 }
+
+func (p *Postgres) ListIdentitiesByUser(ctx context.Context, userID string) ([]data.Identity, error) {
+	query := `SELECT id, user_id, provider, provider_id, created_at, last_login FROM identities WHERE user_id = $1 ORDER BY created_at`
+	rows, err := p.db().Query(ctx, query, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var identities []data.Identity
+	for rows.Next() {
+		var identity data.Identity
+		if err := rows.Scan(&identity.ID, &identity.UserID, &identity.Provider, &identity.ProviderID, &identity.CreatedAt, &identity.LastLogin); err != nil {
+			return nil, err
+		}
+		identities = append(identities, identity)
+	}
+	return identities, rows.Err()
+}
+
+// CredentialStorage implementation
+
+func (p *Postgres) CreateCredential(ctx context.Context, c *data.Credential) error {
+	query := `INSERT INTO webauthn_credentials (id, user_id, public_key, attestation_type, transports, aaguid, sign_count, backup_eligible, backup_state, created_at, last_used_at)
+			  VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11)`
+	_, err := p.db().Exec(ctx, query,
+		c.ID, c.UserID, c.PublicKey, c.AttestationType, c.Transports, c.AAGUID, int64(c.SignCount), c.BackupEligible, c.BackupState, c.CreatedAt, c.LastUsedAt)
+	return mapConflict(err)
+}
+
+func (p *Postgres) GetCredentialByID(ctx context.Context, id []byte) (*data.Credential, error) {
+	query := `SELECT id, user_id, public_key, attestation_type, transports, aaguid, sign_count, backup_eligible, backup_state, created_at, last_used_at
+			  FROM webauthn_credentials WHERE id = $1`
+	c, err := scanCredential(p.db().QueryRow(ctx, query, id))
+	if err != nil {
+		return nil, mapNotFound(err, data.ErrCredentialNotFound)
+	}
+	return c, nil
+}
+
+func (p *Postgres) GetCredentialsByUser(ctx context.Context, userID string) ([]data.Credential, error) {
+	query := `SELECT id, user_id, public_key, attestation_type, transports, aaguid, sign_count, backup_eligible, backup_state, created_at, last_used_at
+			  FROM webauthn_credentials WHERE user_id = $1 ORDER BY created_at`
+	rows, err := p.db().Query(ctx, query, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var credentials []data.Credential
+	for rows.Next() {
+		c, err := scanCredential(rows)
+		if err != nil {
+			return nil, err
+		}
+		credentials = append(credentials, *c)
+	}
+	return credentials, rows.Err()
+}
+
+func (p *Postgres) UpdateCredentialSignCount(ctx context.Context, id []byte, signCount uint32, lastUsedAt time.Time) error {
+	query := `UPDATE webauthn_credentials SET sign_count=$1, last_used_at=$2 WHERE id=$3`
+	tag, err := p.db().Exec(ctx, query, int64(signCount), lastUsedAt, id)
+	return affected(tag, err, data.ErrCredentialNotFound)
+}
+
+func (p *Postgres) DeleteCredentialsByUser(ctx context.Context, userID string) error {
+	_, err := p.db().Exec(ctx, `DELETE FROM webauthn_credentials WHERE user_id = $1`, userID)
+	return err
+}
+
+func scanCredential(row pgx.Row) (*data.Credential, error) {
+	var (
+		c         data.Credential
+		signCount int64
+		lastUsed  *time.Time
+	)
+	err := row.Scan(&c.ID, &c.UserID, &c.PublicKey, &c.AttestationType, &c.Transports, &c.AAGUID, &signCount, &c.BackupEligible, &c.BackupState, &c.CreatedAt, &lastUsed)
+	if err != nil {
+		return nil, err
+	}
+	c.SignCount = uint32(signCount)
+	if lastUsed != nil {
+		c.LastUsedAt = *lastUsed
+	}
+	return &c, nil
+}
@@ -0,0 +1,55 @@
+package postgres
+
+import (
+	"context"
+	"time"
+
+	"auth-go-skd/data"
+)
+
+// TenantStorage implementation. Providers are stored as JSONB.
+
+func (p *Postgres) SaveTenant(ctx context.Context, t *data.Tenant) error {
+	query := `INSERT INTO tenants (id, hosts, path_prefix, secret, providers, verified_domains, updated_at) VALUES ($1, $2, $3, $4, $5, $6, $7)
+			  ON CONFLICT (id) DO UPDATE SET hosts = EXCLUDED.hosts, path_prefix = EXCLUDED.path_prefix,
+				secret = EXCLUDED.secret, providers = EXCLUDED.providers, verified_domains = EXCLUDED.verified_domains,
+				updated_at = EXCLUDED.updated_at`
+	hosts := t.Hosts
+	if hosts == nil {
+		hosts = []string{}
+	}
+	providers := t.Providers
+	if providers == nil {
+		providers = []data.ProviderConfig{}
+	}
+	domains := t.VerifiedDomains
+	if domains == nil {
+		domains = []string{}
+	}
+	t.UpdatedAt = time.Now().Truncate(time.Microsecond)
+	_, err := p.db().Exec(ctx, query, t.ID, hosts, t.PathPrefix, t.Secret, providers, domains, t.UpdatedAt)
+	return err
+}
+
+func (p *Postgres) ListTenants(ctx context.Context) ([]data.Tenant, error) {
+	rows, err := p.db().Query(ctx, `SELECT id, hosts, path_prefix, secret, providers, verified_domains, updated_at FROM tenants ORDER BY id`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var tenants []data.Tenant
+	for rows.Next() {
+		var t data.Tenant
+		if err := rows.Scan(&t.ID, &t.Hosts, &t.PathPrefix, &t.Secret, &t.Providers, &t.VerifiedDomains, &t.UpdatedAt); err != nil {
+			return nil, err
+		}
+		tenants = append(tenants, t)
+	}
+	return tenants, rows.Err()
+}
+
+func (p *Postgres) DeleteTenant(ctx context.Context, id string) error {
+	tag, err := p.db().Exec(ctx, `DELETE FROM tenants WHERE id = $1`, id)
+	return affected(tag, err, data.ErrTenantNotFound)
+}
@@ -0,0 +1,68 @@
+package postgres
+
+import (
+	"context"
+	"time"
+
+	"auth-go-skd/data"
+	"auth-go-skd/store"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// WithTx implements store.Transactor. Calls nested inside fn use a savepoint.
+func (p *Postgres) WithTx(ctx context.Context, fn func(tx store.Store) error) error {
+	return p.inTx(ctx, func(tx *Postgres) error { return fn(tx) })
+}
+
+func (p *Postgres) inTx(ctx context.Context, fn func(tx *Postgres) error) error {
+	var (
+		tx  pgx.Tx
+		err error
+	)
+	if p.tx != nil {
+		tx, err = p.tx.Begin(ctx)
+	} else {
+		tx, err = p.Pool.Begin(ctx)
+	}
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	if err := fn(&Postgres{Pool: p.Pool, tx: tx}); err != nil {
+		return err
+	}
+	return tx.Commit(ctx)
+}
+
+// RotateSession implements store.SessionRotator.
+func (p *Postgres) RotateSession(ctx context.Context, oldRefreshToken string, next *data.Session) (*data.Session, error) {
+	var old data.Session
+	expired := false
+	err := p.inTx(ctx, func(tx *Postgres) error {
+		query := `DELETE FROM sessions WHERE refresh_token = $1
+				  RETURNING id, user_id, refresh_token, user_agent, client_ip, is_blocked, expires_at, created_at`
+		err := tx.db().QueryRow(ctx, query, oldRefreshToken).Scan(
+			&old.ID, &old.UserID, &old.RefreshToken, &old.UserAgent, &old.ClientIP, &old.IsBlocked, &old.ExpiresAt, &old.CreatedAt,
+		)
+		if err != nil {
+			return mapNotFound(err, data.ErrSessionNotFound)
+		}
+		if old.IsBlocked || time.Now().After(old.ExpiresAt) {
+			// Commit the delete: a blocked or expired session is gone either way.
+			expired = true
+			return nil
+		}
+
+		next.UserID = old.UserID
+		return tx.CreateSession(ctx, next)
+	})
+	if err != nil {
+		return nil, err
+	}
+	if expired {
+		return nil, data.ErrSessionNotFound
+	}
+	return &old, nil
+}
@@ -0,0 +1,27 @@
+package redis
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"auth-go-skd/data"
+
+	"github.com/redis/go-redis/v9"
+)
+
+const challengePrefix = "auth:challenge:"
+
+// ChallengeStorage implementation
+
+func (r *Redis) SaveChallenge(ctx context.Context, key string, value []byte, ttl time.Duration) error {
+	return r.Client.Set(ctx, challengePrefix+key, value, ttl).Err()
+}
+
+func (r *Redis) PopChallenge(ctx context.Context, key string) ([]byte, error) {
+	value, err := r.Client.GetDel(ctx, challengePrefix+key).Bytes()
+	if errors.Is(err, redis.Nil) {
+		return nil, data.ErrChallengeNotFound
+	}
+	return value, err
+}
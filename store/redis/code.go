@@ -0,0 +1,56 @@
+package redis
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"auth-go-skd/data"
+
+	"github.com/redis/go-redis/v9"
+)
+
+const codePrefix = "auth:code:"
+
+// incrAttempts bumps the counter only while the code exists, so an expired key is never recreated without a TTL.
+var incrAttempts = redis.NewScript(`
+if redis.call('EXISTS', KEYS[1]) == 0 then
+	return -1
+end
+return redis.call('HINCRBY', KEYS[1], 'attempts', 1)
+`)
+
+// CodeStorage implementation
+
+func (r *Redis) SaveCode(ctx context.Context, key, codeHash string, ttl time.Duration) error {
+	_, err := r.Client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.Del(ctx, codePrefix+key)
+		pipe.HSet(ctx, codePrefix+key, "hash", codeHash, "attempts", 0)
+		pipe.Expire(ctx, codePrefix+key, ttl)
+		return nil
+	})
+	return err
+}
+
+func (r *Redis) GetCode(ctx context.Context, key string) (string, error) {
+	codeHash, err := r.Client.HGet(ctx, codePrefix+key, "hash").Result()
+	if errors.Is(err, redis.Nil) {
+		return "", data.ErrCodeNotFound
+	}
+	return codeHash, err
+}
+
+func (r *Redis) IncrCodeAttempts(ctx context.Context, key string) (int, error) {
+	n, err := incrAttempts.Run(ctx, r.Client, []string{codePrefix + key}).Int()
+	if err != nil {
+		return 0, err
+	}
+	if n < 0 {
+		return 0, data.ErrCodeNotFound
+	}
+	return n, nil
+}
+
+func (r *Redis) DeleteCode(ctx context.Context, key string) error {
+	return r.Client.Del(ctx, codePrefix+key).Err()
+}
@@ -0,0 +1,51 @@
+package redis
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+const (
+	failuresPrefix = "auth:failures:"
+	lockedPrefix   = "auth:locked:"
+)
+
+var registerFailure = redis.NewScript(`
+local n = redis.call('INCR', KEYS[1])
+if n == 1 then
+	redis.call('PEXPIRE', KEYS[1], ARGV[1])
+end
+return n
+`)
+
+// LockoutStorage implementation
+
+func (r *Redis) RegisterFailure(ctx context.Context, key string, window time.Duration) (int, error) {
+	return registerFailure.Run(ctx, r.Client, []string{failuresPrefix + key}, window.Milliseconds()).Int()
+}
+
+func (r *Redis) SetLockedUntil(ctx context.Context, key string, until time.Time) error {
+	ttl := time.Until(until)
+	if ttl <= 0 {
+		return nil
+	}
+	return r.Client.Set(ctx, lockedPrefix+key, until.UnixMilli(), ttl).Err()
+}
+
+func (r *Redis) GetLockedUntil(ctx context.Context, key string) (time.Time, error) {
+	ms, err := r.Client.Get(ctx, lockedPrefix+key).Int64()
+	if errors.Is(err, redis.Nil) {
+		return time.Time{}, nil
+	}
+	if err != nil {
+		return time.Time{}, err
+	}
+	return time.UnixMilli(ms), nil
+}
+
+func (r *Redis) ResetFailures(ctx context.Context, key string) error {
+	return r.Client.Del(ctx, failuresPrefix+key, lockedPrefix+key).Err()
+}
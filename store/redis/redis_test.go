@@ -0,0 +1,223 @@
+package redis
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"auth-go-skd/data"
+	"auth-go-skd/store/storetest"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+)
+
+func newTestRedis(t *testing.T) (*Redis, *miniredis.Miniredis) {
+	mr := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	t.Cleanup(func() { client.Close() })
+	return &Redis{Client: client}, mr
+}
+
+func TestCodeStorage(t *testing.T) {
+	r, mr := newTestRedis(t)
+	ctx := context.Background()
+
+	if _, err := r.IncrCodeAttempts(ctx, "a@example.com"); !errors.Is(err, data.ErrCodeNotFound) {
+		t.Fatalf("expected ErrCodeNotFound for missing code, got %v", err)
+	}
+	if mr.Exists(codePrefix + "a@example.com") {
+		t.Fatal("incrementing a missing code must not create it")
+	}
+
+	if err := r.SaveCode(ctx, "a@example.com", "hash-1", time.Minute); err != nil {
+		t.Fatal(err)
+	}
+	for want := 1; want <= 2; want++ {
+		n, err := r.IncrCodeAttempts(ctx, "a@example.com")
+		if err != nil || n != want {
+			t.Fatalf("expected %d attempts, got %d (%v)", want, n, err)
+		}
+	}
+
+	// Saving a new code resets the counter
+	if err := r.SaveCode(ctx, "a@example.com", "hash-2", time.Minute); err != nil {
+		t.Fatal(err)
+	}
+	if n, _ := r.IncrCodeAttempts(ctx, "a@example.com"); n != 1 {
+		t.Errorf("expected counter reset, got %d", n)
+	}
+	if h, err := r.GetCode(ctx, "a@example.com"); err != nil || h != "hash-2" {
+		t.Errorf("expected hash-2, got %q (%v)", h, err)
+	}
+
+	mr.FastForward(2 * time.Minute)
+	if _, err := r.GetCode(ctx, "a@example.com"); !errors.Is(err, data.ErrCodeNotFound) {
+		t.Errorf("expected code to expire, got %v", err)
+	}
+}
+
+func TestChallengeStorage(t *testing.T) {
+	r, _ := newTestRedis(t)
+	ctx := context.Background()
+
+	if err := r.SaveChallenge(ctx, "k", []byte("v"), time.Minute); err != nil {
+		t.Fatal(err)
+	}
+	if v, err := r.PopChallenge(ctx, "k"); err != nil || string(v) != "v" {
+		t.Fatalf("expected v, got %q (%v)", v, err)
+	}
+	if _, err := r.PopChallenge(ctx, "k"); !errors.Is(err, data.ErrChallengeNotFound) {
+		t.Errorf("expected challenge to be single-use, got %v", err)
+	}
+}
+
+func TestLockoutStorage(t *testing.T) {
+	r, mr := newTestRedis(t)
+	ctx := context.Background()
+
+	for want := 1; want <= 3; want++ {
+		if n, err := r.RegisterFailure(ctx, "acct:a@example.com", time.Minute); err != nil || n != want {
+			t.Fatalf("expected %d failures, got %d (%v)", want, n, err)
+		}
+	}
+
+	until := time.Now().Add(time.Minute).Truncate(time.Millisecond)
+	if err := r.SetLockedUntil(ctx, "acct:a@example.com", until); err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := r.GetLockedUntil(ctx, "acct:a@example.com"); !got.Equal(until) {
+		t.Errorf("expected locked until %s, got %s", until, got)
+	}
+
+	if err := r.ResetFailures(ctx, "acct:a@example.com"); err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := r.GetLockedUntil(ctx, "acct:a@example.com"); !got.IsZero() {
+		t.Errorf("expected lock to be cleared, got %s", got)
+	}
+
+	r.RegisterFailure(ctx, "ip:10.0.0.1", time.Minute)
+	mr.FastForward(2 * time.Minute)
+	if n, _ := r.RegisterFailure(ctx, "ip:10.0.0.1", time.Minute); n != 1 {
+		t.Errorf("expected failure window to expire, got %d", n)
+	}
+}
+
+func newTestSession(id, userID, refreshToken string) *data.Session {
+	now := time.Now()
+	return &data.Session{
+		ID:           id,
+		UserID:       userID,
+		RefreshToken: refreshToken,
+		UserAgent:    "test-agent",
+		ClientIP:     "10.0.0.1",
+		ExpiresAt:    now.Add(time.Hour),
+		CreatedAt:    now,
+	}
+}
+
+func TestSessionStorage(t *testing.T) {
+	r, mr := newTestRedis(t)
+	ctx := context.Background()
+
+	for _, s := range []*data.Session{
+		newTestSession("s1", "u1", "rt1"),
+		newTestSession("s2", "u1", "rt2"),
+		newTestSession("s3", "u2", "rt3"),
+	} {
+		if err := r.CreateSession(ctx, s); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	s, err := r.GetSessionByRefreshToken(ctx, "rt1")
+	if err != nil || s.ID != "s1" || s.UserID != "u1" || s.UserAgent != "test-agent" {
+		t.Fatalf("unexpected session %+v (%v)", s, err)
+	}
+	if _, err := r.GetSessionByRefreshToken(ctx, "missing"); !errors.Is(err, data.ErrSessionNotFound) {
+		t.Errorf("expected ErrSessionNotFound, got %v", err)
+	}
+
+	if list, _ := r.ListSessionsByUser(ctx, "u1"); len(list) != 2 {
+		t.Errorf("expected 2 sessions for u1, got %d", len(list))
+	}
+
+	if err := r.DeleteSessionsByUser(ctx, "u1", "s2"); err != nil {
+		t.Fatal(err)
+	}
+	list, _ := r.ListSessionsByUser(ctx, "u1")
+	if len(list) != 1 || list[0].ID != "s2" {
+		t.Errorf("expected only s2 to remain, got %+v", list)
+	}
+	if _, err := r.GetSessionByRefreshToken(ctx, "rt1"); !errors.Is(err, data.ErrSessionNotFound) {
+		t.Errorf("expected refresh token of deleted session to be gone, got %v", err)
+	}
+
+	mr.FastForward(2 * time.Hour)
+	if list, _ := r.ListSessionsByUser(ctx, "u2"); len(list) != 0 {
+		t.Errorf("expected sessions to expire, got %d", len(list))
+	}
+}
+
+func TestRotateSession(t *testing.T) {
+	r, _ := newTestRedis(t)
+	ctx := context.Background()
+
+	r.CreateSession(ctx, newTestSession("s1", "u1", "rt1"))
+
+	next := newTestSession("s2", "", "rt2")
+	old, err := r.RotateSession(ctx, "rt1", next)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if old.ID != "s1" || next.UserID != "u1" {
+		t.Errorf("expected rotation from s1 for u1, got old=%+v next=%+v", old, next)
+	}
+	if s, err := r.GetSessionByRefreshToken(ctx, "rt2"); err != nil || s.UserID != "u1" {
+		t.Errorf("expected new session for u1, got %+v (%v)", s, err)
+	}
+
+	// A refresh token can only be redeemed once
+	if _, err := r.RotateSession(ctx, "rt1", newTestSession("s3", "", "rt3")); !errors.Is(err, data.ErrSessionNotFound) {
+		t.Errorf("expected reuse to fail, got %v", err)
+	}
+
+	blocked := newTestSession("s4", "u1", "rt4")
+	blocked.IsBlocked = true
+	r.CreateSession(ctx, blocked)
+	if _, err := r.RotateSession(ctx, "rt4", newTestSession("s5", "", "rt5")); !errors.Is(err, data.ErrSessionNotFound) {
+		t.Errorf("expected blocked session to be refused, got %v", err)
+	}
+	if list, _ := r.ListSessionsByUser(ctx, "u1"); len(list) != 1 || list[0].ID != "s2" {
+		t.Errorf("expected only s2 to remain, got %+v", list)
+	}
+}
+
+func TestRevocationStorage(t *testing.T) {
+	r, mr := newTestRedis(t)
+	ctx := context.Background()
+
+	r.Revoke(ctx, "jti-1", time.Minute)
+	if ok, _ := r.IsRevoked(ctx, "jti-1"); !ok {
+		t.Error("expected jti-1 to be revoked")
+	}
+	mr.FastForward(2 * time.Minute)
+	if ok, _ := r.IsRevoked(ctx, "jti-1"); ok {
+		t.Error("expected revocation to expire")
+	}
+}
+
+func TestConformance(t *testing.T) {
+	storetest.Run(t, func(t *testing.T) storetest.Backend {
+		r, _ := newTestRedis(t)
+		return storetest.Backend{
+			Sessions:    r,
+			Challenges:  r,
+			Codes:       r,
+			Lockouts:    r,
+			Revocations: r,
+		}
+	})
+}
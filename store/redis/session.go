@@ -0,0 +1,251 @@
+package redis
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"time"
+
+	"auth-go-skd/data"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// Sessions are stored as hashes under sessionPrefix+id, with a lookup key per refresh token
+// and a set of session IDs per user. All three expire with the session.
+const (
+	sessionPrefix      = "auth:session:"
+	refreshTokenPrefix = "auth:session:rt:"
+	userSessionsPrefix = "auth:user:sessions:"
+	revokedPrefix      = "auth:revoked:"
+)
+
+// storeSession writes the session hash, the refresh token lookup and the user index.
+// The index TTL is only ever extended so it outlives the user's newest session.
+const storeSessionLua = `
+local function store_session(sk, rtk, idx, id, fields, ttl)
+	redis.call('DEL', sk)
+	redis.call('HSET', sk, unpack(fields))
+	redis.call('PEXPIRE', sk, ttl)
+	redis.call('SET', rtk, id, 'PX', ttl)
+	redis.call('SADD', idx, id)
+	if redis.call('PTTL', idx) < ttl then
+		redis.call('PEXPIRE', idx, ttl)
+	end
+end
+`
+
+var createSession = redis.NewScript(storeSessionLua + `
+local fields = {}
+for i = 3, #ARGV do fields[#fields + 1] = ARGV[i] end
+store_session(KEYS[1], KEYS[2], KEYS[3], ARGV[1], fields, tonumber(ARGV[2]))
+return 1
+`)
+
+// rotateSession consumes the session behind the old refresh token and stores the replacement
+// for the same user in one step, so a refresh token can never be redeemed twice. The caller
+// looks the old session up first, so every key the script touches is passed in KEYS; the
+// script only proceeds while the token still points at that session.
+// KEYS: old refresh token, old session, user index, new session, new refresh token.
+// ARGV: now, old id, new id, ttl, fields...
+// Returns 1 on success, 0 for unknown and -1 for blocked or expired sessions.
+var rotateSession = redis.NewScript(storeSessionLua + `
+if redis.call('GET', KEYS[1]) ~= ARGV[2] then
+	return 0
+end
+
+local old = redis.call('HMGET', KEYS[2], 'user_id', 'is_blocked', 'expires_at')
+redis.call('DEL', KEYS[1], KEYS[2])
+if not old[1] then
+	return 0
+end
+redis.call('SREM', KEYS[3], ARGV[2])
+
+if old[2] == '1' or tonumber(old[3]) <= tonumber(ARGV[1]) then
+	return -1
+end
+
+local fields = {'user_id', old[1]}
+for i = 5, #ARGV do fields[#fields + 1] = ARGV[i] end
+store_session(KEYS[4], KEYS[5], KEYS[3], ARGV[3], fields, tonumber(ARGV[4]))
+return 1
+`)
+
+func sessionFields(s *data.Session) []interface{} {
+	blocked := "0"
+	if s.IsBlocked {
+		blocked = "1"
+	}
+	return []interface{}{
+		"id", s.ID,
+		"refresh_token", s.RefreshToken,
+		"user_agent", s.UserAgent,
+		"client_ip", s.ClientIP,
+		"is_blocked", blocked,
+		"expires_at", s.ExpiresAt.UnixMilli(),
+		"created_at", s.CreatedAt.UnixMilli(),
+	}
+}
+
+func parseSession(m map[string]string) (*data.Session, error) {
+	if m["id"] == "" {
+		return nil, data.ErrSessionNotFound
+	}
+	expiresAt, err := strconv.ParseInt(m["expires_at"], 10, 64)
+	if err != nil {
+		return nil, err
+	}
+	createdAt, err := strconv.ParseInt(m["created_at"], 10, 64)
+	if err != nil {
+		return nil, err
+	}
+	return &data.Session{
+		ID:           m["id"],
+		UserID:       m["user_id"],
+		RefreshToken: m["refresh_token"],
+		UserAgent:    m["user_agent"],
+		ClientIP:     m["client_ip"],
+		IsBlocked:    m["is_blocked"] == "1",
+		ExpiresAt:    time.UnixMilli(expiresAt),
+		CreatedAt:    time.UnixMilli(createdAt),
+	}, nil
+}
+
+// SessionStorage implementation
+
+func (r *Redis) CreateSession(ctx context.Context, s *data.Session) error {
+	ttl := time.Until(s.ExpiresAt).Milliseconds()
+	if ttl <= 0 {
+		return errors.New("session already expired")
+	}
+
+	args := append([]interface{}{s.ID, ttl, "user_id", s.UserID}, sessionFields(s)...)
+	keys := []string{sessionPrefix + s.ID, refreshTokenPrefix + s.RefreshToken, userSessionsPrefix + s.UserID}
+	return createSession.Run(ctx, r.Client, keys, args...).Err()
+}
+
+func (r *Redis) GetSessionByRefreshToken(ctx context.Context, refreshToken string) (*data.Session, error) {
+	id, err := r.Client.Get(ctx, refreshTokenPrefix+refreshToken).Result()
+	if errors.Is(err, redis.Nil) {
+		return nil, data.ErrSessionNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return r.getSession(ctx, id)
+}
+
+func (r *Redis) getSession(ctx context.Context, id string) (*data.Session, error) {
+	m, err := r.Client.HGetAll(ctx, sessionPrefix+id).Result()
+	if err != nil {
+		return nil, err
+	}
+	return parseSession(m)
+}
+
+func (r *Redis) DeleteSession(ctx context.Context, id string) error {
+	s, err := r.getSession(ctx, id)
+	if err != nil {
+		return err
+	}
+
+	_, err = r.Client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.Del(ctx, sessionPrefix+id, refreshTokenPrefix+s.RefreshToken)
+		pipe.SRem(ctx, userSessionsPrefix+s.UserID, id)
+		return nil
+	})
+	return err
+}
+
+func (r *Redis) ListSessionsByUser(ctx context.Context, userID string) ([]data.Session, error) {
+	ids, err := r.Client.SMembers(ctx, userSessionsPrefix+userID).Result()
+	if err != nil {
+		return nil, err
+	}
+
+	var (
+		sessions []data.Session
+		stale    []interface{}
+	)
+	for _, id := range ids {
+		s, err := r.getSession(ctx, id)
+		if errors.Is(err, data.ErrSessionNotFound) {
+			stale = append(stale, id)
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		sessions = append(sessions, *s)
+	}
+
+	// Expired sessions vanish on their own; drop them from the index as we find them.
+	if len(stale) > 0 {
+		r.Client.SRem(ctx, userSessionsPrefix+userID, stale...)
+	}
+	return sessions, nil
+}
+
+func (r *Redis) DeleteSessionsByUser(ctx context.Context, userID, exceptID string) error {
+	sessions, err := r.ListSessionsByUser(ctx, userID)
+	if err != nil {
+		return err
+	}
+	for _, s := range sessions {
+		if s.ID == exceptID {
+			continue
+		}
+		if err := r.DeleteSession(ctx, s.ID); err != nil && !errors.Is(err, data.ErrSessionNotFound) {
+			return err
+		}
+	}
+	return nil
+}
+
+// RotateSession implements store.SessionRotator.
+func (r *Redis) RotateSession(ctx context.Context, oldRefreshToken string, next *data.Session) (*data.Session, error) {
+	rtKey := refreshTokenPrefix + oldRefreshToken
+	id, err := r.Client.Get(ctx, rtKey).Result()
+	if errors.Is(err, redis.Nil) {
+		return nil, data.ErrSessionNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	userID, err := r.Client.HGet(ctx, sessionPrefix+id, "user_id").Result()
+	if errors.Is(err, redis.Nil) {
+		return nil, data.ErrSessionNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	ttl := time.Until(next.ExpiresAt).Milliseconds()
+	args := append([]interface{}{time.Now().UnixMilli(), id, next.ID, ttl}, sessionFields(next)...)
+	keys := []string{rtKey, sessionPrefix + id, userSessionsPrefix + userID,
+		sessionPrefix + next.ID, refreshTokenPrefix + next.RefreshToken}
+	status, err := rotateSession.Run(ctx, r.Client, keys, args...).Int()
+	if err != nil {
+		return nil, err
+	}
+	if status != 1 {
+		return nil, data.ErrSessionNotFound
+	}
+
+	next.UserID = userID
+	return &data.Session{ID: id, UserID: userID, RefreshToken: oldRefreshToken}, nil
+}
+
+// RevocationStorage implementation
+
+func (r *Redis) Revoke(ctx context.Context, id string, ttl time.Duration) error {
+	if ttl <= 0 {
+		return nil
+	}
+	return r.Client.Set(ctx, revokedPrefix+id, 1, ttl).Err()
+}
+
+func (r *Redis) IsRevoked(ctx context.Context, id string) (bool, error) {
+	n, err := r.Client.Exists(ctx, revokedPrefix+id).Result()
+	return n > 0, err
+}
@@ -0,0 +1,83 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"auth-go-skd/data"
+)
+
+const apiKeyColumns = `id, user_id, name, prefix, key_hash, scopes, expires_at, last_used_at, last_used_ip, created_at`
+
+// APIKeyStorage implementation
+
+func (s *SQLite) CreateAPIKey(ctx context.Context, k *data.APIKey) error {
+	scopes, err := json.Marshal(k.Scopes)
+	if err != nil {
+		return err
+	}
+	query := `INSERT INTO api_keys (` + apiKeyColumns + `) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`
+	_, err = s.conn().ExecContext(ctx, query, k.ID, k.UserID, k.Name, k.Prefix, k.KeyHash, string(scopes),
+		nullMillis(k.ExpiresAt), nullMillis(k.LastUsedAt), k.LastUsedIP, millis(k.CreatedAt))
+	return mapConflict(err)
+}
+
+func (s *SQLite) GetAPIKeyByPrefix(ctx context.Context, prefix string) (*data.APIKey, error) {
+	query := `SELECT ` + apiKeyColumns + ` FROM api_keys WHERE prefix = ?`
+	k, err := scanAPIKey(s.conn().QueryRowContext(ctx, query, prefix))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, fmt.Errorf("%w: %w", data.ErrAPIKeyNotFound, err)
+	}
+	return k, err
+}
+
+func (s *SQLite) ListAPIKeysByUser(ctx context.Context, userID string) ([]data.APIKey, error) {
+	query := `SELECT ` + apiKeyColumns + ` FROM api_keys WHERE user_id = ? ORDER BY created_at, id`
+	rows, err := s.conn().QueryContext(ctx, query, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var keys []data.APIKey
+	for rows.Next() {
+		k, err := scanAPIKey(rows)
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, *k)
+	}
+	return keys, rows.Err()
+}
+
+func (s *SQLite) TouchAPIKey(ctx context.Context, id string, at time.Time, ip string) error {
+	res, err := s.conn().ExecContext(ctx, `UPDATE api_keys SET last_used_at = ?, last_used_ip = ? WHERE id = ?`, millis(at), ip, id)
+	return affected(res, err, data.ErrAPIKeyNotFound)
+}
+
+func (s *SQLite) DeleteAPIKey(ctx context.Context, userID, id string) error {
+	res, err := s.conn().ExecContext(ctx, `DELETE FROM api_keys WHERE id = ? AND user_id = ?`, id, userID)
+	return affected(res, err, data.ErrAPIKeyNotFound)
+}
+
+func scanAPIKey(row scanner) (*data.APIKey, error) {
+	var (
+		k                     data.APIKey
+		scopes                string
+		expiresAt, lastUsedAt sql.NullInt64
+		createdAt             int64
+	)
+	err := row.Scan(&k.ID, &k.UserID, &k.Name, &k.Prefix, &k.KeyHash, &scopes, &expiresAt, &lastUsedAt, &k.LastUsedIP, &createdAt)
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal([]byte(scopes), &k.Scopes); err != nil {
+		return nil, err
+	}
+	k.ExpiresAt, k.LastUsedAt, k.CreatedAt = fromNullMillis(expiresAt), fromNullMillis(lastUsedAt), fromMillis(createdAt)
+	return &k, nil
+}
@@ -0,0 +1,80 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"auth-go-skd/data"
+)
+
+const clientColumns = `id, name, secret_hash, scopes, redirect_uris, created_at`
+
+// ClientStorage implementation
+
+func (s *SQLite) CreateClient(ctx context.Context, c *data.Client) error {
+	scopes, err := json.Marshal(c.Scopes)
+	if err != nil {
+		return err
+	}
+	redirectURIs, err := json.Marshal(c.RedirectURIs)
+	if err != nil {
+		return err
+	}
+	query := `INSERT INTO clients (` + clientColumns + `) VALUES (?, ?, ?, ?, ?, ?)`
+	_, err = s.conn().ExecContext(ctx, query, c.ID, c.Name, c.SecretHash, string(scopes), string(redirectURIs), millis(c.CreatedAt))
+	return mapConflict(err)
+}
+
+func (s *SQLite) GetClient(ctx context.Context, id string) (*data.Client, error) {
+	query := `SELECT ` + clientColumns + ` FROM clients WHERE id = ?`
+	c, err := scanClient(s.conn().QueryRowContext(ctx, query, id))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, fmt.Errorf("%w: %w", data.ErrClientNotFound, err)
+	}
+	return c, err
+}
+
+func (s *SQLite) ListClients(ctx context.Context) ([]data.Client, error) {
+	rows, err := s.conn().QueryContext(ctx, `SELECT `+clientColumns+` FROM clients ORDER BY created_at, id`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var clients []data.Client
+	for rows.Next() {
+		c, err := scanClient(rows)
+		if err != nil {
+			return nil, err
+		}
+		clients = append(clients, *c)
+	}
+	return clients, rows.Err()
+}
+
+func (s *SQLite) DeleteClient(ctx context.Context, id string) error {
+	res, err := s.conn().ExecContext(ctx, `DELETE FROM clients WHERE id = ?`, id)
+	return affected(res, err, data.ErrClientNotFound)
+}
+
+func scanClient(row scanner) (*data.Client, error) {
+	var (
+		c                    data.Client
+		scopes, redirectURIs string
+		createdAt            int64
+	)
+	if err := row.Scan(&c.ID, &c.Name, &c.SecretHash, &scopes, &redirectURIs, &createdAt); err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal([]byte(scopes), &c.Scopes); err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal([]byte(redirectURIs), &c.RedirectURIs); err != nil {
+		return nil, err
+	}
+	c.CreatedAt = fromMillis(createdAt)
+	return &c, nil
+}
@@ -0,0 +1,148 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"auth-go-skd/data"
+)
+
+// Expired challenges, codes and revocations are never read back; they are purged on the next write to their table.
+
+// ChallengeStorage implementation
+
+func (s *SQLite) SaveChallenge(ctx context.Context, key string, value []byte, ttl time.Duration) error {
+	now := time.Now()
+	if _, err := s.conn().ExecContext(ctx, `DELETE FROM challenges WHERE expires_at <= ?`, millis(now)); err != nil {
+		return err
+	}
+	query := `INSERT INTO challenges (key, value, expires_at) VALUES (?, ?, ?)
+			  ON CONFLICT (key) DO UPDATE SET value = excluded.value, expires_at = excluded.expires_at`
+	_, err := s.conn().ExecContext(ctx, query, key, value, millis(now.Add(ttl)))
+	return err
+}
+
+func (s *SQLite) PopChallenge(ctx context.Context, key string) ([]byte, error) {
+	var (
+		value     []byte
+		expiresAt int64
+	)
+	err := s.conn().QueryRowContext(ctx, `DELETE FROM challenges WHERE key = ? RETURNING value, expires_at`, key).Scan(&value, &expiresAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, fmt.Errorf("%w: %w", data.ErrChallengeNotFound, err)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if time.Now().After(fromMillis(expiresAt)) {
+		return nil, data.ErrChallengeNotFound
+	}
+	return value, nil
+}
+
+// CodeStorage implementation
+
+func (s *SQLite) SaveCode(ctx context.Context, key, codeHash string, ttl time.Duration) error {
+	now := time.Now()
+	if _, err := s.conn().ExecContext(ctx, `DELETE FROM codes WHERE expires_at <= ?`, millis(now)); err != nil {
+		return err
+	}
+	query := `INSERT INTO codes (key, hash, attempts, expires_at) VALUES (?, ?, 0, ?)
+			  ON CONFLICT (key) DO UPDATE SET hash = excluded.hash, attempts = 0, expires_at = excluded.expires_at`
+	_, err := s.conn().ExecContext(ctx, query, key, codeHash, millis(now.Add(ttl)))
+	return err
+}
+
+func (s *SQLite) GetCode(ctx context.Context, key string) (string, error) {
+	var codeHash string
+	err := s.conn().QueryRowContext(ctx, `SELECT hash FROM codes WHERE key = ? AND expires_at > ?`, key, millis(time.Now())).Scan(&codeHash)
+	if errors.Is(err, sql.ErrNoRows) {
+		return "", fmt.Errorf("%w: %w", data.ErrCodeNotFound, err)
+	}
+	return codeHash, err
+}
+
+func (s *SQLite) IncrCodeAttempts(ctx context.Context, key string) (int, error) {
+	var attempts int
+	query := `UPDATE codes SET attempts = attempts + 1 WHERE key = ? AND expires_at > ? RETURNING attempts`
+	err := s.conn().QueryRowContext(ctx, query, key, millis(time.Now())).Scan(&attempts)
+	if errors.Is(err, sql.ErrNoRows) {
+		return 0, fmt.Errorf("%w: %w", data.ErrCodeNotFound, err)
+	}
+	return attempts, err
+}
+
+func (s *SQLite) DeleteCode(ctx context.Context, key string) error {
+	_, err := s.conn().ExecContext(ctx, `DELETE FROM codes WHERE key = ?`, key)
+	return err
+}
+
+// LockoutStorage implementation
+
+func (s *SQLite) RegisterFailure(ctx context.Context, key string, window time.Duration) (int, error) {
+	now := millis(time.Now())
+	if _, err := s.conn().ExecContext(ctx, `DELETE FROM login_failures WHERE window_expires_at <= ?1 AND locked_until <= ?1`, now); err != nil {
+		return 0, err
+	}
+
+	// A failure after the window has passed starts a new window.
+	query := `INSERT INTO login_failures (key, failures, window_expires_at) VALUES (?1, 1, ?2 + ?3)
+			  ON CONFLICT (key) DO UPDATE SET
+				failures = CASE WHEN window_expires_at <= ?2 THEN 1 ELSE failures + 1 END,
+				window_expires_at = CASE WHEN window_expires_at <= ?2 THEN ?2 + ?3 ELSE window_expires_at END
+			  RETURNING failures`
+	var failures int
+	err := s.conn().QueryRowContext(ctx, query, key, now, window.Milliseconds()).Scan(&failures)
+	return failures, err
+}
+
+func (s *SQLite) SetLockedUntil(ctx context.Context, key string, until time.Time) error {
+	query := `INSERT INTO login_failures (key, locked_until) VALUES (?, ?)
+			  ON CONFLICT (key) DO UPDATE SET locked_until = excluded.locked_until`
+	_, err := s.conn().ExecContext(ctx, query, key, millis(until))
+	return err
+}
+
+func (s *SQLite) GetLockedUntil(ctx context.Context, key string) (time.Time, error) {
+	var until int64
+	err := s.conn().QueryRowContext(ctx, `SELECT locked_until FROM login_failures WHERE key = ? AND locked_until > ?`,
+		key, millis(time.Now())).Scan(&until)
+	if errors.Is(err, sql.ErrNoRows) {
+		return time.Time{}, nil
+	}
+	if err != nil {
+		return time.Time{}, err
+	}
+	return fromMillis(until), nil
+}
+
+func (s *SQLite) ResetFailures(ctx context.Context, key string) error {
+	_, err := s.conn().ExecContext(ctx, `DELETE FROM login_failures WHERE key = ?`, key)
+	return err
+}
+
+// RevocationStorage implementation
+
+func (s *SQLite) Revoke(ctx context.Context, id string, ttl time.Duration) error {
+	if ttl <= 0 {
+		return nil
+	}
+	now := time.Now()
+	if _, err := s.conn().ExecContext(ctx, `DELETE FROM revocations WHERE expires_at <= ?`, millis(now)); err != nil {
+		return err
+	}
+	query := `INSERT INTO revocations (id, expires_at) VALUES (?, ?)
+			  ON CONFLICT (id) DO UPDATE SET expires_at = MAX(expires_at, excluded.expires_at)`
+	_, err := s.conn().ExecContext(ctx, query, id, millis(now.Add(ttl)))
+	return err
+}
+
+func (s *SQLite) IsRevoked(ctx context.Context, id string) (bool, error) {
+	var revoked bool
+	err := s.conn().QueryRowContext(ctx, `SELECT EXISTS (SELECT 1 FROM revocations WHERE id = ? AND expires_at > ?)`,
+		id, millis(time.Now())).Scan(&revoked)
+	return revoked, err
+}
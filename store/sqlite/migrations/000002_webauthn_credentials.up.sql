@@ -0,0 +1,16 @@
+-- Mirrors migrations/000002_webauthn_credentials.up.sql. Transports are a JSON array.
+CREATE TABLE IF NOT EXISTS webauthn_credentials (
+    id BLOB PRIMARY KEY,
+    user_id TEXT NOT NULL,
+    public_key BLOB NOT NULL,
+    attestation_type TEXT NOT NULL DEFAULT '',
+    transports TEXT NOT NULL DEFAULT '[]',
+    aaguid BLOB,
+    sign_count INTEGER NOT NULL DEFAULT 0,
+    backup_eligible INTEGER NOT NULL DEFAULT 0,
+    backup_state INTEGER NOT NULL DEFAULT 0,
+    created_at INTEGER NOT NULL,
+    last_used_at INTEGER
+);
+
+CREATE INDEX idx_webauthn_credentials_user_id ON webauthn_credentials(user_id);
@@ -0,0 +1,29 @@
+-- Short-lived state that the Postgres deployment keeps in Redis.
+CREATE TABLE IF NOT EXISTS challenges (
+    key TEXT PRIMARY KEY,
+    value BLOB NOT NULL,
+    expires_at INTEGER NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS codes (
+    key TEXT PRIMARY KEY,
+    hash TEXT NOT NULL,
+    attempts INTEGER NOT NULL DEFAULT 0,
+    expires_at INTEGER NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS login_failures (
+    key TEXT PRIMARY KEY,
+    failures INTEGER NOT NULL DEFAULT 0,
+    window_expires_at INTEGER NOT NULL DEFAULT 0,
+    locked_until INTEGER NOT NULL DEFAULT 0
+);
+
+CREATE TABLE IF NOT EXISTS revocations (
+    id TEXT PRIMARY KEY,
+    expires_at INTEGER NOT NULL
+);
+
+CREATE INDEX idx_challenges_expires_at ON challenges(expires_at);
+CREATE INDEX idx_codes_expires_at ON codes(expires_at);
+CREATE INDEX idx_revocations_expires_at ON revocations(expires_at);
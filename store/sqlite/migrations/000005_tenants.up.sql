@@ -0,0 +1,9 @@
+-- Mirrors migrations/000005_tenants.up.sql. Hosts and providers are JSON arrays.
+CREATE TABLE IF NOT EXISTS tenants (
+    id TEXT PRIMARY KEY,
+    hosts TEXT NOT NULL DEFAULT '[]',
+    path_prefix TEXT NOT NULL DEFAULT '',
+    secret TEXT NOT NULL DEFAULT '',
+    providers TEXT NOT NULL DEFAULT '[]',
+    updated_at INTEGER NOT NULL
+);
@@ -0,0 +1,13 @@
+-- Mirrors migrations/000006_invitations.up.sql.
+CREATE TABLE IF NOT EXISTS invitations (
+    id TEXT PRIMARY KEY,
+    org_id TEXT NOT NULL REFERENCES organizations(id) ON DELETE CASCADE,
+    email TEXT NOT NULL,
+    role TEXT NOT NULL,
+    invited_by TEXT NOT NULL,
+    expires_at INTEGER NOT NULL,
+    accepted_at INTEGER,
+    created_at INTEGER NOT NULL
+);
+
+CREATE INDEX idx_invitations_org_id ON invitations(org_id);
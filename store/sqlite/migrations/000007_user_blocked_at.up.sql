@@ -0,0 +1,2 @@
+-- Mirrors migrations/000007_user_blocked_at.up.sql.
+ALTER TABLE users ADD COLUMN blocked_at INTEGER;
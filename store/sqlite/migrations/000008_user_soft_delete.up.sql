@@ -0,0 +1,5 @@
+-- Mirrors migrations/000008_user_soft_delete.up.sql.
+ALTER TABLE users ADD COLUMN blocked_reason TEXT NOT NULL DEFAULT '';
+ALTER TABLE users ADD COLUMN deleted_at INTEGER;
+
+CREATE INDEX idx_users_deleted_at ON users(deleted_at) WHERE deleted_at IS NOT NULL;
@@ -0,0 +1,8 @@
+-- Mirrors migrations/000009_clients.up.sql. Scopes are a JSON array.
+CREATE TABLE IF NOT EXISTS clients (
+    id TEXT PRIMARY KEY,
+    name TEXT NOT NULL DEFAULT '',
+    secret_hash TEXT NOT NULL,
+    scopes TEXT NOT NULL DEFAULT '[]',
+    created_at INTEGER NOT NULL
+);
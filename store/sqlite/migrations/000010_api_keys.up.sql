@@ -0,0 +1,15 @@
+-- Mirrors migrations/000010_api_keys.up.sql. Scopes are a JSON array.
+CREATE TABLE IF NOT EXISTS api_keys (
+    id TEXT PRIMARY KEY,
+    user_id TEXT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    name TEXT NOT NULL DEFAULT '',
+    prefix TEXT UNIQUE NOT NULL,
+    key_hash TEXT NOT NULL,
+    scopes TEXT NOT NULL DEFAULT '[]',
+    expires_at INTEGER,
+    last_used_at INTEGER,
+    last_used_ip TEXT NOT NULL DEFAULT '',
+    created_at INTEGER NOT NULL
+);
+
+CREATE INDEX idx_api_keys_user_id ON api_keys(user_id);
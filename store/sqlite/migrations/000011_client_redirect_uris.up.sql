@@ -0,0 +1,2 @@
+-- Mirrors migrations/000011_client_redirect_uris.up.sql. Redirect URIs are a JSON array.
+ALTER TABLE clients ADD COLUMN redirect_uris TEXT NOT NULL DEFAULT '[]';
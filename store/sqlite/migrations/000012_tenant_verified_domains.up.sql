@@ -0,0 +1,2 @@
+-- Mirrors migrations/000012_tenant_verified_domains.up.sql. Domains are a JSON array.
+ALTER TABLE tenants ADD COLUMN verified_domains TEXT NOT NULL DEFAULT '[]';
@@ -0,0 +1,22 @@
+-- Mirrors migrations/000014_webauthn_credentials_drop_user_fk.up.sql. SQLite can't drop a
+-- foreign key, so the table is rebuilt without it.
+CREATE TABLE webauthn_credentials_new (
+    id BLOB PRIMARY KEY,
+    user_id TEXT NOT NULL,
+    public_key BLOB NOT NULL,
+    attestation_type TEXT NOT NULL DEFAULT '',
+    transports TEXT NOT NULL DEFAULT '[]',
+    aaguid BLOB,
+    sign_count INTEGER NOT NULL DEFAULT 0,
+    backup_eligible INTEGER NOT NULL DEFAULT 0,
+    backup_state INTEGER NOT NULL DEFAULT 0,
+    created_at INTEGER NOT NULL,
+    last_used_at INTEGER
+);
+
+INSERT INTO webauthn_credentials_new SELECT * FROM webauthn_credentials;
+
+DROP TABLE webauthn_credentials;
+ALTER TABLE webauthn_credentials_new RENAME TO webauthn_credentials;
+
+CREATE INDEX idx_webauthn_credentials_user_id ON webauthn_credentials(user_id);
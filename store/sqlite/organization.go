@@ -0,0 +1,174 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"auth-go-skd/data"
+)
+
+// OrganizationStorage implementation
+
+func (s *SQLite) CreateOrganization(ctx context.Context, org *data.Organization) error {
+	query := `INSERT INTO organizations (id, name, slug, created_at, updated_at) VALUES (?, ?, ?, ?, ?)`
+	_, err := s.conn().ExecContext(ctx, query, org.ID, org.Name, org.Slug, millis(org.CreatedAt), millis(org.UpdatedAt))
+	return mapConflict(err)
+}
+
+func (s *SQLite) GetOrganization(ctx context.Context, id string) (*data.Organization, error) {
+	return s.getOrganization(ctx, `SELECT id, name, slug, created_at, updated_at FROM organizations WHERE id = ?`, id)
+}
+
+func (s *SQLite) GetOrganizationBySlug(ctx context.Context, slug string) (*data.Organization, error) {
+	return s.getOrganization(ctx, `SELECT id, name, slug, created_at, updated_at FROM organizations WHERE slug = ?`, slug)
+}
+
+func (s *SQLite) getOrganization(ctx context.Context, query string, arg string) (*data.Organization, error) {
+	var (
+		org                  data.Organization
+		createdAt, updatedAt int64
+	)
+	err := s.conn().QueryRowContext(ctx, query, arg).Scan(&org.ID, &org.Name, &org.Slug, &createdAt, &updatedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, fmt.Errorf("%w: %w", data.ErrOrgNotFound, err)
+	}
+	if err != nil {
+		return nil, err
+	}
+	org.CreatedAt, org.UpdatedAt = fromMillis(createdAt), fromMillis(updatedAt)
+	return &org, nil
+}
+
+func (s *SQLite) DeleteOrganization(ctx context.Context, id string) error {
+	res, err := s.conn().ExecContext(ctx, `DELETE FROM organizations WHERE id = ?`, id)
+	return affected(res, err, data.ErrOrgNotFound)
+}
+
+// MembershipStorage implementation
+
+func (s *SQLite) AddMember(ctx context.Context, m *data.Membership) error {
+	query := `INSERT INTO memberships (org_id, user_id, role, created_at) VALUES (?, ?, ?, ?)`
+	_, err := s.conn().ExecContext(ctx, query, m.OrgID, m.UserID, m.Role, millis(m.CreatedAt))
+	return mapConflict(err)
+}
+
+func (s *SQLite) GetMembership(ctx context.Context, orgID, userID string) (*data.Membership, error) {
+	query := `SELECT org_id, user_id, role, created_at FROM memberships WHERE org_id = ? AND user_id = ?`
+	m, err := scanMembership(s.conn().QueryRowContext(ctx, query, orgID, userID))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, fmt.Errorf("%w: %w", data.ErrMemberNotFound, err)
+	}
+	return m, err
+}
+
+func (s *SQLite) UpdateMemberRole(ctx context.Context, orgID, userID, role string) error {
+	res, err := s.conn().ExecContext(ctx, `UPDATE memberships SET role = ? WHERE org_id = ? AND user_id = ?`, role, orgID, userID)
+	return affected(res, err, data.ErrMemberNotFound)
+}
+
+func (s *SQLite) RemoveMember(ctx context.Context, orgID, userID string) error {
+	res, err := s.conn().ExecContext(ctx, `DELETE FROM memberships WHERE org_id = ? AND user_id = ?`, orgID, userID)
+	return affected(res, err, data.ErrMemberNotFound)
+}
+
+func (s *SQLite) ListMembershipsByUser(ctx context.Context, userID string) ([]data.Membership, error) {
+	return s.listMembers(ctx, `SELECT org_id, user_id, role, created_at FROM memberships WHERE user_id = ? ORDER BY created_at`, userID)
+}
+
+func (s *SQLite) ListMembersByOrg(ctx context.Context, orgID string) ([]data.Membership, error) {
+	return s.listMembers(ctx, `SELECT org_id, user_id, role, created_at FROM memberships WHERE org_id = ? ORDER BY created_at`, orgID)
+}
+
+func (s *SQLite) listMembers(ctx context.Context, query, arg string) ([]data.Membership, error) {
+	rows, err := s.conn().QueryContext(ctx, query, arg)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var members []data.Membership
+	for rows.Next() {
+		m, err := scanMembership(rows)
+		if err != nil {
+			return nil, err
+		}
+		members = append(members, *m)
+	}
+	return members, rows.Err()
+}
+
+func scanMembership(row scanner) (*data.Membership, error) {
+	var (
+		m         data.Membership
+		createdAt int64
+	)
+	if err := row.Scan(&m.OrgID, &m.UserID, &m.Role, &createdAt); err != nil {
+		return nil, err
+	}
+	m.CreatedAt = fromMillis(createdAt)
+	return &m, nil
+}
+
+// InvitationStorage implementation
+
+func (s *SQLite) CreateInvitation(ctx context.Context, inv *data.Invitation) error {
+	query := `INSERT INTO invitations (id, org_id, email, role, invited_by, expires_at, accepted_at, created_at) VALUES (?, ?, ?, ?, ?, ?, ?, ?)`
+	_, err := s.conn().ExecContext(ctx, query, inv.ID, inv.OrgID, inv.Email, inv.Role, inv.InvitedBy,
+		millis(inv.ExpiresAt), nullMillis(inv.AcceptedAt), millis(inv.CreatedAt))
+	return mapConflict(err)
+}
+
+func (s *SQLite) GetInvitation(ctx context.Context, id string) (*data.Invitation, error) {
+	query := `SELECT id, org_id, email, role, invited_by, expires_at, accepted_at, created_at FROM invitations WHERE id = ?`
+	inv, err := scanInvitation(s.conn().QueryRowContext(ctx, query, id))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, fmt.Errorf("%w: %w", data.ErrInviteNotFound, err)
+	}
+	return inv, err
+}
+
+func (s *SQLite) ListInvitationsByOrg(ctx context.Context, orgID string) ([]data.Invitation, error) {
+	query := `SELECT id, org_id, email, role, invited_by, expires_at, accepted_at, created_at
+			  FROM invitations WHERE org_id = ? AND accepted_at IS NULL ORDER BY created_at`
+	rows, err := s.conn().QueryContext(ctx, query, orgID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var invitations []data.Invitation
+	for rows.Next() {
+		inv, err := scanInvitation(rows)
+		if err != nil {
+			return nil, err
+		}
+		invitations = append(invitations, *inv)
+	}
+	return invitations, rows.Err()
+}
+
+func (s *SQLite) AcceptInvitation(ctx context.Context, id string, at time.Time) error {
+	res, err := s.conn().ExecContext(ctx, `UPDATE invitations SET accepted_at = ? WHERE id = ? AND accepted_at IS NULL`, millis(at), id)
+	return affected(res, err, data.ErrInviteNotFound)
+}
+
+func (s *SQLite) DeleteInvitation(ctx context.Context, id string) error {
+	res, err := s.conn().ExecContext(ctx, `DELETE FROM invitations WHERE id = ?`, id)
+	return affected(res, err, data.ErrInviteNotFound)
+}
+
+func scanInvitation(row scanner) (*data.Invitation, error) {
+	var (
+		inv                  data.Invitation
+		expiresAt, createdAt int64
+		acceptedAt           sql.NullInt64
+	)
+	if err := row.Scan(&inv.ID, &inv.OrgID, &inv.Email, &inv.Role, &inv.InvitedBy, &expiresAt, &acceptedAt, &createdAt); err != nil {
+		return nil, err
+	}
+	inv.ExpiresAt, inv.AcceptedAt, inv.CreatedAt = fromMillis(expiresAt), fromNullMillis(acceptedAt), fromMillis(createdAt)
+	return &inv, nil
+}
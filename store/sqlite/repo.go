@@ -0,0 +1,402 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"auth-go-skd/data"
+)
+
+type scanner interface {
+	Scan(dest ...any) error
+}
+
+// UserStorage implementation
+
+const userColumns = `id, email, password_hash, name, role, is_verified, blocked_at, blocked_reason, deleted_at, created_at, updated_at`
+
+func (s *SQLite) CreateUser(ctx context.Context, user *data.User) error {
+	query := `INSERT INTO users (` + userColumns + `) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`
+	_, err := s.conn().ExecContext(ctx, query, user.ID, user.Email, user.PasswordHash, user.Name, user.Role, user.IsVerified,
+		nullMillis(user.BlockedAt), user.BlockedReason, nullMillis(user.DeletedAt), millis(user.CreatedAt), millis(user.UpdatedAt))
+	if isUnique(err) && strings.Contains(err.Error(), "users.email") {
+		return fmt.Errorf("%w: %w", data.ErrEmailTaken, err)
+	}
+	return mapConflict(err)
+}
+
+func (s *SQLite) GetUserByEmail(ctx context.Context, email string) (*data.User, error) {
+	query := `SELECT ` + userColumns + ` FROM users WHERE email = ?`
+	return scanUser(s.conn().QueryRowContext(ctx, query, email))
+}
+
+func (s *SQLite) GetUserByID(ctx context.Context, id string) (*data.User, error) {
+	query := `SELECT ` + userColumns + ` FROM users WHERE id = ?`
+	return scanUser(s.conn().QueryRowContext(ctx, query, id))
+}
+
+func (s *SQLite) UpdateUser(ctx context.Context, user *data.User) error {
+	query := `UPDATE users SET name=?, password_hash=?, role=?, is_verified=?, blocked_at=?, blocked_reason=?, deleted_at=?, updated_at=? WHERE id=?`
+	res, err := s.conn().ExecContext(ctx, query, user.Name, user.PasswordHash, user.Role, user.IsVerified,
+		nullMillis(user.BlockedAt), user.BlockedReason, nullMillis(user.DeletedAt), millis(user.UpdatedAt), user.ID)
+	return affected(res, err, data.ErrUserNotFound)
+}
+
+// DeleteUser also removes the user's credentials, which don't reference users.
+func (s *SQLite) DeleteUser(ctx context.Context, id string) error {
+	return s.inTx(ctx, func(tx *SQLite) error {
+		res, err := tx.conn().ExecContext(ctx, `DELETE FROM users WHERE id=?`, id)
+		if err := affected(res, err, data.ErrUserNotFound); err != nil {
+			return err
+		}
+		_, err = tx.conn().ExecContext(ctx, `DELETE FROM webauthn_credentials WHERE user_id=?`, id)
+		return err
+	})
+}
+
+// PurgeDeletedUsers also removes the purged users' credentials, like DeleteUser.
+func (s *SQLite) PurgeDeletedUsers(ctx context.Context, before time.Time) (int, error) {
+	var n int64
+	err := s.inTx(ctx, func(tx *SQLite) error {
+		_, err := tx.conn().ExecContext(ctx, `DELETE FROM webauthn_credentials WHERE user_id IN
+			(SELECT id FROM users WHERE deleted_at IS NOT NULL AND deleted_at < ?)`, millis(before))
+		if err != nil {
+			return err
+		}
+		res, err := tx.conn().ExecContext(ctx, `DELETE FROM users WHERE deleted_at IS NOT NULL AND deleted_at < ?`, millis(before))
+		if err != nil {
+			return err
+		}
+		n, err = res.RowsAffected()
+		return err
+	})
+	return int(n), err
+}
+
+func (s *SQLite) ListUsers(ctx context.Context, f data.UserFilter) ([]data.User, error) {
+	where, args := userFilter(f)
+	query := `SELECT ` + userColumns + ` FROM users` + where + ` ORDER BY created_at, id LIMIT ? OFFSET ?`
+	limit := f.Limit
+	if limit <= 0 {
+		limit = -1
+	}
+	rows, err := s.conn().QueryContext(ctx, query, append(args, limit, f.Offset)...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var users []data.User
+	for rows.Next() {
+		u, err := scanUser(rows)
+		if err != nil {
+			return nil, err
+		}
+		users = append(users, *u)
+	}
+	return users, rows.Err()
+}
+
+func (s *SQLite) CountUsers(ctx context.Context, f data.UserFilter) (int, error) {
+	where, args := userFilter(f)
+	var n int
+	err := s.conn().QueryRowContext(ctx, `SELECT COUNT(*) FROM users`+where, args...).Scan(&n)
+	return n, err
+}
+
+// userFilter builds the WHERE clause for f.
+func userFilter(f data.UserFilter) (string, []any) {
+	var (
+		conds []string
+		args  []any
+	)
+	if f.Email != "" {
+		conds = append(conds, `email LIKE ? ESCAPE '\'`)
+		args = append(args, "%"+likeEscaper.Replace(f.Email)+"%")
+	}
+	if f.Role != "" {
+		conds = append(conds, `role = ?`)
+		args = append(args, f.Role)
+	}
+	if f.Verified != nil {
+		conds = append(conds, `is_verified = ?`)
+		args = append(args, *f.Verified)
+	}
+	if f.Blocked != nil {
+		if *f.Blocked {
+			conds = append(conds, `blocked_at IS NOT NULL`)
+		} else {
+			conds = append(conds, `blocked_at IS NULL`)
+		}
+	}
+	if f.Deleted != nil {
+		if *f.Deleted {
+			conds = append(conds, `deleted_at IS NOT NULL`)
+		} else {
+			conds = append(conds, `deleted_at IS NULL`)
+		}
+	}
+	if !f.CreatedAfter.IsZero() {
+		conds = append(conds, `created_at >= ?`)
+		args = append(args, millis(f.CreatedAfter))
+	}
+	if !f.CreatedBefore.IsZero() {
+		conds = append(conds, `created_at < ?`)
+		args = append(args, millis(f.CreatedBefore))
+	}
+	if len(conds) == 0 {
+		return "", nil
+	}
+	return " WHERE " + strings.Join(conds, " AND "), args
+}
+
+// likeEscaper escapes the LIKE wildcards in a literal substring.
+var likeEscaper = strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`)
+
+func scanUser(row scanner) (*data.User, error) {
+	var (
+		u                    data.User
+		createdAt, updatedAt int64
+		blockedAt, deletedAt sql.NullInt64
+	)
+	err := row.Scan(&u.ID, &u.Email, &u.PasswordHash, &u.Name, &u.Role, &u.IsVerified, &blockedAt, &u.BlockedReason, &deletedAt, &createdAt, &updatedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, fmt.Errorf("%w: %w", data.ErrUserNotFound, err)
+	}
+	if err != nil {
+		return nil, err
+	}
+	u.BlockedAt = fromNullMillis(blockedAt)
+	u.DeletedAt = fromNullMillis(deletedAt)
+	u.CreatedAt = fromMillis(createdAt)
+	u.UpdatedAt = fromMillis(updatedAt)
+	return &u, nil
+}
+
+// SessionStorage implementation
+
+const sessionColumns = `id, user_id, refresh_token, user_agent, client_ip, is_blocked, expires_at, created_at`
+
+func (s *SQLite) CreateSession(ctx context.Context, session *data.Session) error {
+	query := `INSERT INTO sessions (` + sessionColumns + `) VALUES (?, ?, ?, ?, ?, ?, ?, ?)`
+	_, err := s.conn().ExecContext(ctx, query, session.ID, session.UserID, session.RefreshToken, session.UserAgent, session.ClientIP,
+		session.IsBlocked, millis(session.ExpiresAt), millis(session.CreatedAt))
+	return mapConflict(err)
+}
+
+func (s *SQLite) GetSessionByRefreshToken(ctx context.Context, refreshToken string) (*data.Session, error) {
+	query := `SELECT ` + sessionColumns + ` FROM sessions WHERE refresh_token = ?`
+	return scanSession(s.conn().QueryRowContext(ctx, query, refreshToken))
+}
+
+func (s *SQLite) DeleteSession(ctx context.Context, id string) error {
+	res, err := s.conn().ExecContext(ctx, `DELETE FROM sessions WHERE id=?`, id)
+	return affected(res, err, data.ErrSessionNotFound)
+}
+
+func (s *SQLite) ListSessionsByUser(ctx context.Context, userID string) ([]data.Session, error) {
+	query := `SELECT ` + sessionColumns + ` FROM sessions WHERE user_id = ? AND expires_at > ? ORDER BY created_at DESC`
+	rows, err := s.conn().QueryContext(ctx, query, userID, millis(time.Now()))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var sessions []data.Session
+	for rows.Next() {
+		session, err := scanSession(rows)
+		if err != nil {
+			return nil, err
+		}
+		sessions = append(sessions, *session)
+	}
+	return sessions, rows.Err()
+}
+
+func (s *SQLite) DeleteSessionsByUser(ctx context.Context, userID, exceptID string) error {
+	_, err := s.conn().ExecContext(ctx, `DELETE FROM sessions WHERE user_id=? AND id <> ?`, userID, exceptID)
+	return err
+}
+
+// RotateSession implements store.SessionRotator.
+func (s *SQLite) RotateSession(ctx context.Context, oldRefreshToken string, next *data.Session) (*data.Session, error) {
+	var old *data.Session
+	err := s.inTx(ctx, func(tx *SQLite) error {
+		query := `DELETE FROM sessions WHERE refresh_token = ? RETURNING ` + sessionColumns
+		var err error
+		old, err = scanSession(tx.conn().QueryRowContext(ctx, query, oldRefreshToken))
+		if err != nil {
+			return err
+		}
+		if old.IsBlocked || time.Now().After(old.ExpiresAt) {
+			// Commit the delete: a blocked or expired session is gone either way.
+			old = nil
+			return nil
+		}
+		next.UserID = old.UserID
+		return tx.CreateSession(ctx, next)
+	})
+	if err != nil {
+		return nil, err
+	}
+	if old == nil {
+		return nil, data.ErrSessionNotFound
+	}
+	return old, nil
+}
+
+func scanSession(row scanner) (*data.Session, error) {
+	var (
+		session              data.Session
+		expiresAt, createdAt int64
+	)
+	err := row.Scan(&session.ID, &session.UserID, &session.RefreshToken, &session.UserAgent, &session.ClientIP,
+		&session.IsBlocked, &expiresAt, &createdAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, fmt.Errorf("%w: %w", data.ErrSessionNotFound, err)
+	}
+	if err != nil {
+		return nil, err
+	}
+	session.ExpiresAt = fromMillis(expiresAt)
+	session.CreatedAt = fromMillis(createdAt)
+	return &session, nil
+}
+
+// IdentityStorage implementation
+
+func (s *SQLite) CreateIdentity(ctx context.Context, identity *data.Identity) error {
+	query := `INSERT INTO identities (id, user_id, provider, provider_id, created_at, last_login) VALUES (?, ?, ?, ?, ?, ?)`
+	_, err := s.conn().ExecContext(ctx, query, identity.ID, identity.UserID, identity.Provider, identity.ProviderID,
+		millis(identity.CreatedAt), nullMillis(identity.LastLogin))
+	return mapConflict(err)
+}
+
+func (s *SQLite) GetIdentityByProvider(ctx context.Context, provider, providerID string) (*data.Identity, error) {
+	query := `SELECT id, user_id, provider, provider_id, created_at, last_login FROM identities WHERE provider = ? AND provider_id = ?`
+	var (
+		identity  data.Identity
+		createdAt int64
+		lastLogin sql.NullInt64
+	)
+	err := s.conn().QueryRowContext(ctx, query, provider, providerID).Scan(
+		&identity.ID, &identity.UserID, &identity.Provider, &identity.ProviderID, &createdAt, &lastLogin)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, fmt.Errorf("%w: %w", data.ErrIdentityNotFound, err)
+	}
+	if err != nil {
+		return nil, err
+	}
+	identity.CreatedAt = fromMillis(createdAt)
+	identity.LastLogin = fromNullMillis(lastLogin)
+	return &identity, nil
+}
+
+func (s *SQLite) ListIdentitiesByUser(ctx context.Context, userID string) ([]data.Identity, error) {
+	query := `SELECT id, user_id, provider, provider_id, created_at, last_login FROM identities WHERE user_id = ? ORDER BY created_at`
+	rows, err := s.conn().QueryContext(ctx, query, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var identities []data.Identity
+	for rows.Next() {
+		var (
+			identity  data.Identity
+			createdAt int64
+			lastLogin sql.NullInt64
+		)
+		if err := rows.Scan(&identity.ID, &identity.UserID, &identity.Provider, &identity.ProviderID, &createdAt, &lastLogin); err != nil {
+			return nil, err
+		}
+		identity.CreatedAt = fromMillis(createdAt)
+		identity.LastLogin = fromNullMillis(lastLogin)
+		identities = append(identities, identity)
+	}
+	return identities, rows.Err()
+}
+
+// CredentialStorage implementation
+
+const credentialColumns = `id, user_id, public_key, attestation_type, transports, aaguid, sign_count, backup_eligible, backup_state, created_at, last_used_at`
+
+func (s *SQLite) CreateCredential(ctx context.Context, c *data.Credential) error {
+	transports, err := json.Marshal(c.Transports)
+	if err != nil {
+		return err
+	}
+	query := `INSERT INTO webauthn_credentials (` + credentialColumns + `) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`
+	_, err = s.conn().ExecContext(ctx, query, c.ID, c.UserID, c.PublicKey, c.AttestationType, string(transports), c.AAGUID,
+		int64(c.SignCount), c.BackupEligible, c.BackupState, millis(c.CreatedAt), nullMillis(c.LastUsedAt))
+	return mapConflict(err)
+}
+
+func (s *SQLite) GetCredentialByID(ctx context.Context, id []byte) (*data.Credential, error) {
+	query := `SELECT ` + credentialColumns + ` FROM webauthn_credentials WHERE id = ?`
+	c, err := scanCredential(s.conn().QueryRowContext(ctx, query, id))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, fmt.Errorf("%w: %w", data.ErrCredentialNotFound, err)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+func (s *SQLite) GetCredentialsByUser(ctx context.Context, userID string) ([]data.Credential, error) {
+	query := `SELECT ` + credentialColumns + ` FROM webauthn_credentials WHERE user_id = ? ORDER BY created_at`
+	rows, err := s.conn().QueryContext(ctx, query, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var credentials []data.Credential
+	for rows.Next() {
+		c, err := scanCredential(rows)
+		if err != nil {
+			return nil, err
+		}
+		credentials = append(credentials, *c)
+	}
+	return credentials, rows.Err()
+}
+
+func (s *SQLite) UpdateCredentialSignCount(ctx context.Context, id []byte, signCount uint32, lastUsedAt time.Time) error {
+	query := `UPDATE webauthn_credentials SET sign_count=?, last_used_at=? WHERE id=?`
+	res, err := s.conn().ExecContext(ctx, query, int64(signCount), nullMillis(lastUsedAt), id)
+	return affected(res, err, data.ErrCredentialNotFound)
+}
+
+func (s *SQLite) DeleteCredentialsByUser(ctx context.Context, userID string) error {
+	_, err := s.conn().ExecContext(ctx, `DELETE FROM webauthn_credentials WHERE user_id = ?`, userID)
+	return err
+}
+
+func scanCredential(row scanner) (*data.Credential, error) {
+	var (
+		c          data.Credential
+		transports string
+		signCount  int64
+		createdAt  int64
+		lastUsed   sql.NullInt64
+	)
+	err := row.Scan(&c.ID, &c.UserID, &c.PublicKey, &c.AttestationType, &transports, &c.AAGUID, &signCount,
+		&c.BackupEligible, &c.BackupState, &createdAt, &lastUsed)
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal([]byte(transports), &c.Transports); err != nil {
+		return nil, err
+	}
+	c.SignCount = uint32(signCount)
+	c.CreatedAt = fromMillis(createdAt)
+	c.LastUsedAt = fromNullMillis(lastUsed)
+	return &c, nil
+}
@@ -0,0 +1,206 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"embed"
+	"errors"
+	"fmt"
+	"io/fs"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"auth-go-skd/config"
+	"auth-go-skd/data"
+	"auth-go-skd/store"
+
+	"modernc.org/sqlite"
+	sqlite3 "modernc.org/sqlite/lib"
+)
+
+//go:embed migrations/*.up.sql
+var migrations embed.FS
+
+type SQLite struct {
+	DB *sql.DB
+
+	// tx is set on the SQLite handed to a WithTx callback.
+	tx *sql.Tx
+}
+
+// dbtx is satisfied by both *sql.DB and *sql.Tx.
+type dbtx interface {
+	ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error)
+	QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error)
+	QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row
+}
+
+// conn returns the current transaction, or the database outside of WithTx.
+func (s *SQLite) conn() dbtx {
+	if s.tx != nil {
+		return s.tx
+	}
+	return s.DB
+}
+
+// New opens the database file at cfg.Path, creating it if needed, and applies pending migrations.
+func New(cfg config.SQLite) (*SQLite, error) {
+	dsn := "file:" + cfg.Path + "?" + url.Values{
+		"_pragma": {"foreign_keys(1)", "busy_timeout(5000)", "journal_mode(WAL)"},
+	}.Encode()
+
+	db, err := sql.Open("sqlite", dsn)
+	if err != nil {
+		return nil, fmt.Errorf("unable to open database: %w", err)
+	}
+	// SQLite allows one writer at a time; a single connection avoids SQLITE_BUSY between our own queries.
+	db.SetMaxOpenConns(1)
+
+	s := &SQLite{DB: db}
+	if err := s.Migrate(context.Background()); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("unable to migrate database: %w", err)
+	}
+	return s, nil
+}
+
+func (s *SQLite) Close() {
+	if s.DB != nil {
+		s.DB.Close()
+	}
+}
+
+// Migrate applies the embedded migrations that have not run yet, each in its own transaction.
+func (s *SQLite) Migrate(ctx context.Context) error {
+	if _, err := s.DB.ExecContext(ctx, `CREATE TABLE IF NOT EXISTS schema_migrations (version INTEGER PRIMARY KEY)`); err != nil {
+		return err
+	}
+
+	files, err := fs.Glob(migrations, "migrations/*.up.sql")
+	if err != nil {
+		return err
+	}
+	sort.Strings(files)
+
+	for _, name := range files {
+		base := strings.TrimPrefix(name, "migrations/")
+		version, err := strconv.Atoi(strings.SplitN(base, "_", 2)[0])
+		if err != nil {
+			return fmt.Errorf("migration %s: bad version: %w", base, err)
+		}
+
+		var applied bool
+		err = s.DB.QueryRowContext(ctx, `SELECT EXISTS (SELECT 1 FROM schema_migrations WHERE version = ?)`, version).Scan(&applied)
+		if err != nil {
+			return err
+		}
+		if applied {
+			continue
+		}
+
+		script, err := migrations.ReadFile(name)
+		if err != nil {
+			return err
+		}
+		if err := s.inTx(ctx, func(tx *SQLite) error {
+			if _, err := tx.conn().ExecContext(ctx, string(script)); err != nil {
+				return err
+			}
+			_, err := tx.conn().ExecContext(ctx, `INSERT INTO schema_migrations (version) VALUES (?)`, version)
+			return err
+		}); err != nil {
+			return fmt.Errorf("migration %s: %w", base, err)
+		}
+	}
+	return nil
+}
+
+// WithTx implements store.Transactor. Calls nested inside fn use a savepoint.
+// The database has a single connection, so fn must not use the outer store.
+func (s *SQLite) WithTx(ctx context.Context, fn func(tx store.Store) error) error {
+	return s.inTx(ctx, func(tx *SQLite) error { return fn(tx) })
+}
+
+func (s *SQLite) inTx(ctx context.Context, fn func(tx *SQLite) error) error {
+	if s.tx != nil {
+		if _, err := s.tx.ExecContext(ctx, `SAVEPOINT nested`); err != nil {
+			return err
+		}
+		if err := fn(s); err != nil {
+			s.tx.ExecContext(ctx, `ROLLBACK TO nested`)
+			s.tx.ExecContext(ctx, `RELEASE nested`)
+			return err
+		}
+		_, err := s.tx.ExecContext(ctx, `RELEASE nested`)
+		return err
+	}
+
+	tx, err := s.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	if err := fn(&SQLite{DB: s.DB, tx: tx}); err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
+
+// Timestamps are stored as Unix milliseconds; the zero time is stored as NULL.
+
+func millis(t time.Time) int64 {
+	return t.UnixMilli()
+}
+
+func nullMillis(t time.Time) sql.NullInt64 {
+	if t.IsZero() {
+		return sql.NullInt64{}
+	}
+	return sql.NullInt64{Int64: t.UnixMilli(), Valid: true}
+}
+
+func fromMillis(ms int64) time.Time {
+	return time.UnixMilli(ms)
+}
+
+func fromNullMillis(ms sql.NullInt64) time.Time {
+	if !ms.Valid {
+		return time.Time{}
+	}
+	return time.UnixMilli(ms.Int64)
+}
+
+// isUnique reports whether err is a UNIQUE or PRIMARY KEY violation.
+func isUnique(err error) bool {
+	var e *sqlite.Error
+	if !errors.As(err, &e) {
+		return false
+	}
+	return e.Code() == sqlite3.SQLITE_CONSTRAINT_UNIQUE || e.Code() == sqlite3.SQLITE_CONSTRAINT_PRIMARYKEY
+}
+
+// mapConflict turns constraint violations into data.ErrConflict, wrapping the cause.
+func mapConflict(err error) error {
+	if isUnique(err) {
+		return fmt.Errorf("%w: %w", data.ErrConflict, err)
+	}
+	return err
+}
+
+// affected returns notFound when res touched no rows.
+func affected(res sql.Result, err error, notFound error) error {
+	if err != nil {
+		return err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return notFound
+	}
+	return nil
+}
@@ -0,0 +1,86 @@
+package sqlite
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"auth-go-skd/config"
+	"auth-go-skd/data"
+	"auth-go-skd/store/storetest"
+)
+
+func newTestSQLite(t *testing.T, path string) *SQLite {
+	s, err := New(config.SQLite{Path: path})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(s.Close)
+	return s
+}
+
+func TestConformance(t *testing.T) {
+	storetest.Run(t, func(t *testing.T) storetest.Backend {
+		s := newTestSQLite(t, filepath.Join(t.TempDir(), "auth.db"))
+		return storetest.Backend{
+			Users:       s,
+			Sessions:    s,
+			Identities:  s,
+			Credentials: s,
+			Orgs:        s,
+			Members:     s,
+			Invitations: s,
+			Tenants:     s,
+			Clients:     s,
+			APIKeys:     s,
+			Challenges:  s,
+			Codes:       s,
+			Lockouts:    s,
+			Revocations: s,
+		}
+	})
+}
+
+func TestMigrateIsIdempotent(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "auth.db")
+	ctx := context.Background()
+
+	s := newTestSQLite(t, path)
+	if err := s.Migrate(ctx); err != nil {
+		t.Fatalf("second migrate: %v", err)
+	}
+	u := &data.User{ID: "u1", Email: "a@example.com", Role: "user", CreatedAt: time.Now(), UpdatedAt: time.Now()}
+	if err := s.CreateUser(ctx, u); err != nil {
+		t.Fatal(err)
+	}
+	s.Close()
+
+	// Reopening keeps the data and doesn't re-run migrations
+	s = newTestSQLite(t, path)
+	if _, err := s.GetUserByEmail(ctx, "a@example.com"); err != nil {
+		t.Errorf("expected user to survive reopen, got %v", err)
+	}
+}
+
+func TestForeignKeys(t *testing.T) {
+	s := newTestSQLite(t, filepath.Join(t.TempDir(), "auth.db"))
+	ctx := context.Background()
+
+	session := &data.Session{ID: "s1", UserID: "missing", RefreshToken: "rt", ExpiresAt: time.Now().Add(time.Hour), CreatedAt: time.Now()}
+	if err := s.CreateSession(ctx, session); err == nil {
+		t.Fatal("expected session for unknown user to be rejected")
+	}
+
+	u := &data.User{ID: "u1", Email: "a@example.com", CreatedAt: time.Now(), UpdatedAt: time.Now()}
+	s.CreateUser(ctx, u)
+	session.UserID = "u1"
+	if err := s.CreateSession(ctx, session); err != nil {
+		t.Fatal(err)
+	}
+	s.DeleteUser(ctx, "u1")
+	if _, err := s.GetSessionByRefreshToken(ctx, "rt"); !errors.Is(err, data.ErrSessionNotFound) {
+		t.Errorf("expected sessions to be deleted with their user, got %v", err)
+	}
+}
@@ -0,0 +1,70 @@
+package sqlite
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"auth-go-skd/data"
+)
+
+// TenantStorage implementation
+
+func (s *SQLite) SaveTenant(ctx context.Context, t *data.Tenant) error {
+	hosts, err := json.Marshal(t.Hosts)
+	if err != nil {
+		return err
+	}
+	providers, err := json.Marshal(t.Providers)
+	if err != nil {
+		return err
+	}
+	domains, err := json.Marshal(t.VerifiedDomains)
+	if err != nil {
+		return err
+	}
+	t.UpdatedAt = time.Now().Truncate(time.Millisecond)
+	query := `INSERT INTO tenants (id, hosts, path_prefix, secret, providers, verified_domains, updated_at) VALUES (?, ?, ?, ?, ?, ?, ?)
+			  ON CONFLICT (id) DO UPDATE SET hosts = excluded.hosts, path_prefix = excluded.path_prefix,
+				secret = excluded.secret, providers = excluded.providers, verified_domains = excluded.verified_domains,
+				updated_at = excluded.updated_at`
+	_, err = s.conn().ExecContext(ctx, query, t.ID, string(hosts), t.PathPrefix, t.Secret, string(providers), string(domains), millis(t.UpdatedAt))
+	return err
+}
+
+func (s *SQLite) ListTenants(ctx context.Context) ([]data.Tenant, error) {
+	rows, err := s.conn().QueryContext(ctx, `SELECT id, hosts, path_prefix, secret, providers, verified_domains, updated_at FROM tenants ORDER BY id`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var tenants []data.Tenant
+	for rows.Next() {
+		var (
+			t                         data.Tenant
+			hosts, providers, domains string
+			updatedAt                 int64
+		)
+		if err := rows.Scan(&t.ID, &hosts, &t.PathPrefix, &t.Secret, &providers, &domains, &updatedAt); err != nil {
+			return nil, err
+		}
+		if err := json.Unmarshal([]byte(hosts), &t.Hosts); err != nil {
+			return nil, err
+		}
+		if err := json.Unmarshal([]byte(providers), &t.Providers); err != nil {
+			return nil, err
+		}
+		if err := json.Unmarshal([]byte(domains), &t.VerifiedDomains); err != nil {
+			return nil, err
+		}
+		t.UpdatedAt = fromMillis(updatedAt)
+		tenants = append(tenants, t)
+	}
+	return tenants, rows.Err()
+}
+
+func (s *SQLite) DeleteTenant(ctx context.Context, id string) error {
+	res, err := s.conn().ExecContext(ctx, `DELETE FROM tenants WHERE id = ?`, id)
+	return affected(res, err, data.ErrTenantNotFound)
+}
@@ -0,0 +1,1011 @@
+// Package storetest is a conformance suite for the storage interfaces in package store.
+// Every backend runs it from its own tests so they all behave the same way.
+package storetest
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"auth-go-skd/data"
+	"auth-go-skd/store"
+
+	"github.com/google/uuid"
+)
+
+// Backend is the set of storages under test. Nil fields are skipped, so a backend
+// only fills in what it implements.
+type Backend struct {
+	Users       store.UserStorage
+	Sessions    store.SessionStorage
+	Identities  store.IdentityStorage
+	Credentials store.CredentialStorage
+	Orgs        store.OrganizationStorage
+	Members     store.MembershipStorage
+	Invitations store.InvitationStorage
+	Tenants     store.TenantStorage
+	Clients     store.ClientStorage
+	APIKeys     store.APIKeyStorage
+	Challenges  store.ChallengeStorage
+	Codes       store.CodeStorage
+	Lockouts    store.LockoutStorage
+	Revocations store.RevocationStorage
+}
+
+// Run runs the suite. newBackend is called once per subtest and must return empty storages.
+func Run(t *testing.T, newBackend func(t *testing.T) Backend) {
+	tests := []struct {
+		name string
+		run  func(t *testing.T, b Backend)
+		skip func(b Backend) bool
+	}{
+		{"Users", testUsers, func(b Backend) bool { return b.Users == nil }},
+		{"ListUsers", testListUsers, func(b Backend) bool { return b.Users == nil }},
+		{"PurgeDeletedUsers", testPurgeDeletedUsers, func(b Backend) bool { return b.Users == nil }},
+		{"Sessions", testSessions, func(b Backend) bool { return b.Sessions == nil }},
+		{"RotateSession", testRotateSession, func(b Backend) bool {
+			_, ok := b.Sessions.(store.SessionRotator)
+			return !ok
+		}},
+		{"Identities", testIdentities, func(b Backend) bool { return b.Identities == nil }},
+		{"Transactions", testTransactions, func(b Backend) bool {
+			_, ok := b.Users.(store.Transactor)
+			return !ok || b.Identities == nil
+		}},
+		{"Credentials", testCredentials, func(b Backend) bool { return b.Credentials == nil }},
+		{"Organizations", testOrganizations, func(b Backend) bool { return b.Orgs == nil }},
+		{"Memberships", testMemberships, func(b Backend) bool { return b.Orgs == nil || b.Members == nil }},
+		{"Invitations", testInvitations, func(b Backend) bool { return b.Orgs == nil || b.Invitations == nil }},
+		{"Tenants", testTenants, func(b Backend) bool { return b.Tenants == nil }},
+		{"Clients", testClients, func(b Backend) bool { return b.Clients == nil }},
+		{"APIKeys", testAPIKeys, func(b Backend) bool { return b.APIKeys == nil }},
+		{"Challenges", testChallenges, func(b Backend) bool { return b.Challenges == nil }},
+		{"Codes", testCodes, func(b Backend) bool { return b.Codes == nil }},
+		{"Lockouts", testLockouts, func(b Backend) bool { return b.Lockouts == nil }},
+		{"Revocations", testRevocations, func(b Backend) bool { return b.Revocations == nil }},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b := newBackend(t)
+			if tt.skip(b) {
+				t.Skip("not implemented by this backend")
+			}
+			tt.run(t, b)
+		})
+	}
+}
+
+func newUser(email string) *data.User {
+	now := time.Now().Truncate(time.Millisecond)
+	return &data.User{
+		ID:         uuid.NewString(),
+		Email:      email,
+		Name:       "Test User",
+		Role:       "user",
+		IsVerified: true,
+		CreatedAt:  now,
+		UpdatedAt:  now,
+	}
+}
+
+// userID returns the ID of a stored user when the backend has users, so foreign keys hold.
+func userID(t *testing.T, b Backend) string {
+	t.Helper()
+	u := newUser(uuid.NewString() + "@example.com")
+	if b.Users != nil {
+		if err := b.Users.CreateUser(context.Background(), u); err != nil {
+			t.Fatalf("create user: %v", err)
+		}
+	}
+	return u.ID
+}
+
+func newSession(userID, refreshToken string, createdAt time.Time) *data.Session {
+	return &data.Session{
+		ID:           uuid.NewString(),
+		UserID:       userID,
+		RefreshToken: refreshToken,
+		UserAgent:    "test-agent",
+		ClientIP:     "10.0.0.1",
+		ExpiresAt:    createdAt.Add(time.Hour),
+		CreatedAt:    createdAt,
+	}
+}
+
+func testUsers(t *testing.T, b Backend) {
+	ctx := context.Background()
+
+	u := newUser("a@example.com")
+	if err := b.Users.CreateUser(ctx, u); err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := b.Users.GetUserByEmail(ctx, "a@example.com")
+	if err != nil || got.ID != u.ID || got.Name != u.Name || got.Role != u.Role || !got.IsVerified {
+		t.Fatalf("GetUserByEmail: got %+v (%v)", got, err)
+	}
+	if got, err := b.Users.GetUserByID(ctx, u.ID); err != nil || got.Email != u.Email {
+		t.Fatalf("GetUserByID: got %+v (%v)", got, err)
+	}
+
+	if _, err := b.Users.GetUserByEmail(ctx, "missing@example.com"); !errors.Is(err, data.ErrUserNotFound) {
+		t.Errorf("GetUserByEmail of unknown address: expected ErrUserNotFound, got %v", err)
+	}
+	if _, err := b.Users.GetUserByID(ctx, uuid.NewString()); !errors.Is(err, data.ErrUserNotFound) {
+		t.Errorf("GetUserByID of unknown ID: expected ErrUserNotFound, got %v", err)
+	}
+
+	if err := b.Users.CreateUser(ctx, newUser("a@example.com")); !errors.Is(err, data.ErrEmailTaken) {
+		t.Errorf("duplicate email: expected ErrEmailTaken, got %v", err)
+	}
+
+	u.Name = "Renamed"
+	u.PasswordHash = "hash"
+	u.Role = "admin"
+	u.IsVerified = false
+	u.BlockedAt = u.UpdatedAt.Add(time.Minute)
+	u.BlockedReason = "spam"
+	u.DeletedAt = u.UpdatedAt.Add(time.Minute)
+	u.UpdatedAt = u.UpdatedAt.Add(time.Minute)
+	if err := b.Users.UpdateUser(ctx, u); err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := b.Users.GetUserByID(ctx, u.ID); got.Name != "Renamed" || got.PasswordHash != "hash" || got.Role != "admin" ||
+		got.IsVerified || !got.BlockedAt.Equal(u.BlockedAt) || got.BlockedReason != "spam" || !got.DeletedAt.Equal(u.DeletedAt) {
+		t.Errorf("UpdateUser: got %+v", got)
+	}
+	u.BlockedAt, u.BlockedReason, u.DeletedAt = time.Time{}, "", time.Time{}
+	if err := b.Users.UpdateUser(ctx, u); err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := b.Users.GetUserByID(ctx, u.ID); !got.BlockedAt.IsZero() || got.BlockedReason != "" || !got.DeletedAt.IsZero() {
+		t.Errorf("UpdateUser: expected the block and deletion to be lifted, got %+v", got)
+	}
+	if err := b.Users.UpdateUser(ctx, newUser("missing@example.com")); !errors.Is(err, data.ErrUserNotFound) {
+		t.Errorf("UpdateUser of unknown user: expected ErrUserNotFound, got %v", err)
+	}
+
+	if err := b.Users.DeleteUser(ctx, u.ID); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := b.Users.GetUserByID(ctx, u.ID); !errors.Is(err, data.ErrUserNotFound) {
+		t.Errorf("deleted user: expected ErrUserNotFound, got %v", err)
+	}
+	if err := b.Users.DeleteUser(ctx, u.ID); !errors.Is(err, data.ErrUserNotFound) {
+		t.Errorf("DeleteUser twice: expected ErrUserNotFound, got %v", err)
+	}
+
+	// The address is free again once the user is gone
+	if err := b.Users.CreateUser(ctx, newUser("a@example.com")); err != nil {
+		t.Errorf("re-register deleted email: %v", err)
+	}
+}
+
+func testSessions(t *testing.T, b Backend) {
+	ctx := context.Background()
+	u1, u2 := userID(t, b), userID(t, b)
+
+	now := time.Now().Truncate(time.Millisecond)
+	s1 := newSession(u1, "rt1", now.Add(-time.Minute))
+	s2 := newSession(u1, "rt2", now)
+	s3 := newSession(u2, "rt3", now)
+	for _, s := range []*data.Session{s1, s2, s3} {
+		if err := b.Sessions.CreateSession(ctx, s); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	got, err := b.Sessions.GetSessionByRefreshToken(ctx, "rt1")
+	if err != nil || got.ID != s1.ID || got.UserID != u1 || got.UserAgent != "test-agent" || got.ClientIP != "10.0.0.1" {
+		t.Fatalf("GetSessionByRefreshToken: got %+v (%v)", got, err)
+	}
+	if !got.ExpiresAt.Equal(s1.ExpiresAt) {
+		t.Errorf("expected expiry %s, got %s", s1.ExpiresAt, got.ExpiresAt)
+	}
+	if _, err := b.Sessions.GetSessionByRefreshToken(ctx, "missing"); !errors.Is(err, data.ErrSessionNotFound) {
+		t.Errorf("unknown refresh token: expected ErrSessionNotFound, got %v", err)
+	}
+
+	if list, err := b.Sessions.ListSessionsByUser(ctx, u1); err != nil || len(list) != 2 {
+		t.Errorf("expected 2 sessions for u1, got %d (%v)", len(list), err)
+	}
+
+	if err := b.Sessions.DeleteSessionsByUser(ctx, u1, s2.ID); err != nil {
+		t.Fatal(err)
+	}
+	list, _ := b.Sessions.ListSessionsByUser(ctx, u1)
+	if len(list) != 1 || list[0].ID != s2.ID {
+		t.Errorf("expected only s2 to remain, got %+v", list)
+	}
+	if _, err := b.Sessions.GetSessionByRefreshToken(ctx, "rt1"); !errors.Is(err, data.ErrSessionNotFound) {
+		t.Errorf("refresh token of deleted session: expected ErrSessionNotFound, got %v", err)
+	}
+
+	if err := b.Sessions.DeleteSession(ctx, s3.ID); err != nil {
+		t.Fatal(err)
+	}
+	if list, _ := b.Sessions.ListSessionsByUser(ctx, u2); len(list) != 0 {
+		t.Errorf("expected no sessions for u2, got %+v", list)
+	}
+	if err := b.Sessions.DeleteSession(ctx, s3.ID); !errors.Is(err, data.ErrSessionNotFound) {
+		t.Errorf("DeleteSession twice: expected ErrSessionNotFound, got %v", err)
+	}
+}
+
+func testRotateSession(t *testing.T, b Backend) {
+	ctx := context.Background()
+	rotator := b.Sessions.(store.SessionRotator)
+	uid := userID(t, b)
+	now := time.Now().Truncate(time.Millisecond)
+
+	s1 := newSession(uid, "rt1", now)
+	if err := b.Sessions.CreateSession(ctx, s1); err != nil {
+		t.Fatal(err)
+	}
+
+	next := newSession("", "rt2", now)
+	old, err := rotator.RotateSession(ctx, "rt1", next)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if old.ID != s1.ID || next.UserID != uid {
+		t.Errorf("expected rotation from s1 for %s, got old=%+v next=%+v", uid, old, next)
+	}
+	if got, err := b.Sessions.GetSessionByRefreshToken(ctx, "rt2"); err != nil || got.UserID != uid {
+		t.Errorf("expected new session for %s, got %+v (%v)", uid, got, err)
+	}
+
+	// A refresh token can only be redeemed once
+	if _, err := rotator.RotateSession(ctx, "rt1", newSession("", "rt3", now)); !errors.Is(err, data.ErrSessionNotFound) {
+		t.Errorf("reused refresh token: expected ErrSessionNotFound, got %v", err)
+	}
+
+	blocked := newSession(uid, "rt4", now)
+	blocked.IsBlocked = true
+	if err := b.Sessions.CreateSession(ctx, blocked); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := rotator.RotateSession(ctx, "rt4", newSession("", "rt5", now)); !errors.Is(err, data.ErrSessionNotFound) {
+		t.Errorf("blocked session: expected ErrSessionNotFound, got %v", err)
+	}
+	if list, _ := b.Sessions.ListSessionsByUser(ctx, uid); len(list) != 1 || list[0].ID != next.ID {
+		t.Errorf("expected only the rotated session to remain, got %+v", list)
+	}
+}
+
+func testListUsers(t *testing.T, b Backend) {
+	ctx := context.Background()
+	start := time.Now().Truncate(time.Millisecond)
+
+	var users []*data.User
+	for i, email := range []string{"ann@example.com", "bob@example.org", "cat@example.com", "dan_x@example.com"} {
+		u := newUser(email)
+		u.CreatedAt = start.Add(time.Duration(i) * time.Minute)
+		u.UpdatedAt = u.CreatedAt
+		if i%2 == 1 {
+			u.Role, u.IsVerified = "admin", false
+		}
+		if i == 2 {
+			u.BlockedAt = start
+		}
+		if i == 3 {
+			u.DeletedAt = start
+		}
+		if err := b.Users.CreateUser(ctx, u); err != nil {
+			t.Fatal(err)
+		}
+		users = append(users, u)
+	}
+	yes, no := true, false
+
+	cases := []struct {
+		name string
+		f    data.UserFilter
+		want []int
+	}{
+		{"all", data.UserFilter{}, []int{0, 1, 2, 3}},
+		{"page", data.UserFilter{Limit: 2, Offset: 1}, []int{1, 2}},
+		{"past the end", data.UserFilter{Offset: 10}, nil},
+		{"email", data.UserFilter{Email: "EXAMPLE.COM"}, []int{0, 2, 3}},
+		{"email wildcard is literal", data.UserFilter{Email: "_"}, []int{3}},
+		{"role", data.UserFilter{Role: "admin"}, []int{1, 3}},
+		{"verified", data.UserFilter{Verified: &yes}, []int{0, 2}},
+		{"unverified", data.UserFilter{Verified: &no}, []int{1, 3}},
+		{"blocked", data.UserFilter{Blocked: &yes}, []int{2}},
+		{"not deleted", data.UserFilter{Deleted: &no}, []int{0, 1, 2}},
+		{"created range", data.UserFilter{CreatedAfter: start.Add(time.Minute), CreatedBefore: start.Add(3 * time.Minute)}, []int{1, 2}},
+		{"combined", data.UserFilter{Email: ".com", Role: "admin"}, []int{3}},
+	}
+	for _, c := range cases {
+		list, err := b.Users.ListUsers(ctx, c.f)
+		if err != nil {
+			t.Fatalf("%s: %v", c.name, err)
+		}
+		var got []int
+		for _, u := range list {
+			for i, want := range users {
+				if u.ID == want.ID {
+					got = append(got, i)
+				}
+			}
+		}
+		if fmt.Sprint(got) != fmt.Sprint(c.want) {
+			t.Errorf("%s: expected users %v, got %v", c.name, c.want, got)
+		}
+
+		count, err := b.Users.CountUsers(ctx, c.f)
+		wantCount := len(c.want)
+		if c.f.Limit > 0 || c.f.Offset > 0 {
+			wantCount = len(users)
+		}
+		if err != nil || count != wantCount {
+			t.Errorf("%s: expected count %d, got %d (%v)", c.name, wantCount, count, err)
+		}
+	}
+}
+
+func testPurgeDeletedUsers(t *testing.T, b Backend) {
+	ctx := context.Background()
+	now := time.Now().Truncate(time.Millisecond)
+
+	active, recent, old := newUser("active@example.com"), newUser("recent@example.com"), newUser("old@example.com")
+	recent.DeletedAt = now.Add(-time.Hour)
+	old.DeletedAt = now.Add(-48 * time.Hour)
+	for _, u := range []*data.User{active, recent, old} {
+		if err := b.Users.CreateUser(ctx, u); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if b.Sessions != nil {
+		if err := b.Sessions.CreateSession(ctx, newSession(old.ID, "old-token", now)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if b.Credentials != nil {
+		c := &data.Credential{ID: []byte("old-cred"), UserID: old.ID, PublicKey: []byte("pk"), CreatedAt: now}
+		if err := b.Credentials.CreateCredential(ctx, c); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	n, err := b.Users.PurgeDeletedUsers(ctx, now.Add(-24*time.Hour))
+	if err != nil || n != 1 {
+		t.Fatalf("PurgeDeletedUsers: expected 1, got %d (%v)", n, err)
+	}
+	if _, err := b.Users.GetUserByID(ctx, old.ID); !errors.Is(err, data.ErrUserNotFound) {
+		t.Errorf("purged user: expected ErrUserNotFound, got %v", err)
+	}
+	for _, u := range []*data.User{active, recent} {
+		if _, err := b.Users.GetUserByID(ctx, u.ID); err != nil {
+			t.Errorf("%s should be kept: %v", u.Email, err)
+		}
+	}
+	if b.Sessions != nil {
+		if _, err := b.Sessions.GetSessionByRefreshToken(ctx, "old-token"); !errors.Is(err, data.ErrSessionNotFound) {
+			t.Errorf("sessions should be purged with their user, got %v", err)
+		}
+	}
+	if b.Credentials != nil {
+		if _, err := b.Credentials.GetCredentialByID(ctx, []byte("old-cred")); !errors.Is(err, data.ErrCredentialNotFound) {
+			t.Errorf("credentials should be purged with their user, got %v", err)
+		}
+	}
+}
+
+func testIdentities(t *testing.T, b Backend) {
+	ctx := context.Background()
+	uid := userID(t, b)
+
+	now := time.Now().Truncate(time.Millisecond)
+	identity := &data.Identity{ID: uuid.NewString(), UserID: uid, Provider: "google", ProviderID: "g-1", CreatedAt: now, LastLogin: now}
+	if err := b.Identities.CreateIdentity(ctx, identity); err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := b.Identities.GetIdentityByProvider(ctx, "google", "g-1")
+	if err != nil || got.ID != identity.ID || got.UserID != uid {
+		t.Fatalf("GetIdentityByProvider: got %+v (%v)", got, err)
+	}
+	if _, err := b.Identities.GetIdentityByProvider(ctx, "github", "g-1"); !errors.Is(err, data.ErrIdentityNotFound) {
+		t.Errorf("unknown identity: expected ErrIdentityNotFound, got %v", err)
+	}
+
+	dup := &data.Identity{ID: uuid.NewString(), UserID: uid, Provider: "google", ProviderID: "g-1", CreatedAt: now, LastLogin: now}
+	if err := b.Identities.CreateIdentity(ctx, dup); !errors.Is(err, data.ErrConflict) {
+		t.Errorf("duplicate (provider, provider_id): expected ErrConflict, got %v", err)
+	}
+
+	// The same provider ID under another provider is a different identity
+	other := &data.Identity{ID: uuid.NewString(), UserID: uid, Provider: "github", ProviderID: "g-1", CreatedAt: now, LastLogin: now}
+	if err := b.Identities.CreateIdentity(ctx, other); err != nil {
+		t.Errorf("same provider ID under another provider: %v", err)
+	}
+
+	if list, err := b.Identities.ListIdentitiesByUser(ctx, uid); err != nil || len(list) != 2 {
+		t.Errorf("ListIdentitiesByUser: got %+v (%v)", list, err)
+	}
+	if list, err := b.Identities.ListIdentitiesByUser(ctx, uuid.NewString()); err != nil || len(list) != 0 {
+		t.Errorf("ListIdentitiesByUser of unknown user: got %+v (%v)", list, err)
+	}
+
+	if b.Users != nil {
+		if err := b.Users.DeleteUser(ctx, uid); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := b.Identities.GetIdentityByProvider(ctx, "google", "g-1"); !errors.Is(err, data.ErrIdentityNotFound) {
+			t.Errorf("identities should be deleted with their user, got %v", err)
+		}
+	}
+}
+
+func testTransactions(t *testing.T, b Backend) {
+	ctx := context.Background()
+	txr := b.Users.(store.Transactor)
+	now := time.Now().Truncate(time.Millisecond)
+
+	// A failing callback rolls back every write made through tx
+	failed := errors.New("abort")
+	rolledBack := newUser("rollback@example.com")
+	err := txr.WithTx(ctx, func(tx store.Store) error {
+		if err := tx.CreateUser(ctx, rolledBack); err != nil {
+			return err
+		}
+		identity := &data.Identity{ID: uuid.NewString(), UserID: rolledBack.ID, Provider: "google", ProviderID: "tx-1", CreatedAt: now, LastLogin: now}
+		if err := tx.CreateIdentity(ctx, identity); err != nil {
+			return err
+		}
+		if _, err := tx.GetUserByID(ctx, rolledBack.ID); err != nil {
+			t.Errorf("tx should see its own writes: %v", err)
+		}
+		return failed
+	})
+	if !errors.Is(err, failed) {
+		t.Fatalf("WithTx should return the callback error, got %v", err)
+	}
+	if _, err := b.Users.GetUserByID(ctx, rolledBack.ID); !errors.Is(err, data.ErrUserNotFound) {
+		t.Errorf("rolled back user: expected ErrUserNotFound, got %v", err)
+	}
+	if _, err := b.Identities.GetIdentityByProvider(ctx, "google", "tx-1"); !errors.Is(err, data.ErrIdentityNotFound) {
+		t.Errorf("rolled back identity: expected ErrIdentityNotFound, got %v", err)
+	}
+
+	// A failing nested call undoes only its own writes
+	committed := newUser("commit@example.com")
+	err = txr.WithTx(ctx, func(tx store.Store) error {
+		if err := tx.CreateUser(ctx, committed); err != nil {
+			return err
+		}
+		nested := tx.(store.Transactor).WithTx(ctx, func(tx store.Store) error {
+			identity := &data.Identity{ID: uuid.NewString(), UserID: committed.ID, Provider: "google", ProviderID: "tx-2", CreatedAt: now, LastLogin: now}
+			if err := tx.CreateIdentity(ctx, identity); err != nil {
+				return err
+			}
+			return failed
+		})
+		if !errors.Is(nested, failed) {
+			t.Errorf("nested WithTx should return the callback error, got %v", nested)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := b.Users.GetUserByID(ctx, committed.ID); err != nil {
+		t.Errorf("committed user: %v", err)
+	}
+	if _, err := b.Identities.GetIdentityByProvider(ctx, "google", "tx-2"); !errors.Is(err, data.ErrIdentityNotFound) {
+		t.Errorf("nested rollback: expected ErrIdentityNotFound, got %v", err)
+	}
+}
+
+func testCredentials(t *testing.T, b Backend) {
+	ctx := context.Background()
+	uid := userID(t, b)
+
+	now := time.Now().Truncate(time.Millisecond)
+	c1 := &data.Credential{
+		ID: []byte("cred-1"), UserID: uid, PublicKey: []byte("pk-1"), AttestationType: "none",
+		Transports: []string{"internal"}, AAGUID: make([]byte, 16), SignCount: 1, CreatedAt: now,
+	}
+	c2 := &data.Credential{ID: []byte("cred-2"), UserID: uid, PublicKey: []byte("pk-2"), CreatedAt: now.Add(time.Second)}
+	for _, c := range []*data.Credential{c1, c2} {
+		if err := b.Credentials.CreateCredential(ctx, c); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	got, err := b.Credentials.GetCredentialByID(ctx, []byte("cred-1"))
+	if err != nil || got.UserID != uid || !bytes.Equal(got.PublicKey, c1.PublicKey) || got.SignCount != 1 ||
+		len(got.Transports) != 1 || got.Transports[0] != "internal" {
+		t.Fatalf("GetCredentialByID: got %+v (%v)", got, err)
+	}
+	if _, err := b.Credentials.GetCredentialByID(ctx, []byte("missing")); !errors.Is(err, data.ErrCredentialNotFound) {
+		t.Errorf("unknown credential: expected ErrCredentialNotFound, got %v", err)
+	}
+
+	list, err := b.Credentials.GetCredentialsByUser(ctx, uid)
+	if err != nil || len(list) != 2 || string(list[0].ID) != "cred-1" {
+		t.Errorf("expected both credentials oldest first, got %+v (%v)", list, err)
+	}
+
+	if err := b.Credentials.UpdateCredentialSignCount(ctx, []byte("cred-1"), 7, now.Add(time.Minute)); err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := b.Credentials.GetCredentialByID(ctx, []byte("cred-1")); got.SignCount != 7 || !got.LastUsedAt.Equal(now.Add(time.Minute)) {
+		t.Errorf("UpdateCredentialSignCount: got %+v", got)
+	}
+
+	if err := b.Credentials.DeleteCredentialsByUser(ctx, uid); err != nil {
+		t.Fatal(err)
+	}
+	if list, _ := b.Credentials.GetCredentialsByUser(ctx, uid); len(list) != 0 {
+		t.Errorf("expected no credentials after DeleteCredentialsByUser, got %d", len(list))
+	}
+
+	// Passkeys may belong to users kept outside the store
+	external := &data.Credential{ID: []byte("cred-external"), UserID: "external-user", PublicKey: []byte("pk"), CreatedAt: now}
+	if err := b.Credentials.CreateCredential(ctx, external); err != nil {
+		t.Errorf("credential of a user outside the store: %v", err)
+	}
+
+	if b.Users != nil {
+		c := &data.Credential{ID: []byte("cred-3"), UserID: uid, PublicKey: []byte("pk-3"), CreatedAt: now}
+		if err := b.Credentials.CreateCredential(ctx, c); err != nil {
+			t.Fatal(err)
+		}
+		if err := b.Users.DeleteUser(ctx, uid); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := b.Credentials.GetCredentialByID(ctx, c.ID); !errors.Is(err, data.ErrCredentialNotFound) {
+			t.Errorf("credential of a deleted user: expected ErrCredentialNotFound, got %v", err)
+		}
+	}
+}
+
+func newOrg(slug string) *data.Organization {
+	now := time.Now().Truncate(time.Millisecond)
+	return &data.Organization{ID: uuid.NewString(), Name: "Org " + slug, Slug: slug, CreatedAt: now, UpdatedAt: now}
+}
+
+func testOrganizations(t *testing.T, b Backend) {
+	ctx := context.Background()
+
+	org := newOrg("acme")
+	if err := b.Orgs.CreateOrganization(ctx, org); err != nil {
+		t.Fatal(err)
+	}
+	if err := b.Orgs.CreateOrganization(ctx, newOrg("acme")); !errors.Is(err, data.ErrConflict) {
+		t.Errorf("duplicate slug: expected ErrConflict, got %v", err)
+	}
+
+	got, err := b.Orgs.GetOrganization(ctx, org.ID)
+	if err != nil || got.Slug != "acme" || got.Name != org.Name || !got.CreatedAt.Equal(org.CreatedAt) {
+		t.Fatalf("GetOrganization: got %+v (%v)", got, err)
+	}
+	if got, err := b.Orgs.GetOrganizationBySlug(ctx, "acme"); err != nil || got.ID != org.ID {
+		t.Errorf("GetOrganizationBySlug: got %+v (%v)", got, err)
+	}
+	if _, err := b.Orgs.GetOrganizationBySlug(ctx, "nope"); !errors.Is(err, data.ErrOrgNotFound) {
+		t.Errorf("unknown slug: expected ErrOrgNotFound, got %v", err)
+	}
+	if _, err := b.Orgs.GetOrganization(ctx, uuid.NewString()); !errors.Is(err, data.ErrOrgNotFound) {
+		t.Errorf("unknown ID: expected ErrOrgNotFound, got %v", err)
+	}
+
+	if err := b.Orgs.DeleteOrganization(ctx, org.ID); err != nil {
+		t.Fatal(err)
+	}
+	if err := b.Orgs.DeleteOrganization(ctx, org.ID); !errors.Is(err, data.ErrOrgNotFound) {
+		t.Errorf("second delete: expected ErrOrgNotFound, got %v", err)
+	}
+	// The slug is free again
+	if err := b.Orgs.CreateOrganization(ctx, newOrg("acme")); err != nil {
+		t.Errorf("reusing a deleted slug: %v", err)
+	}
+}
+
+func testMemberships(t *testing.T, b Backend) {
+	ctx := context.Background()
+	uid := userID(t, b)
+	now := time.Now().Truncate(time.Millisecond)
+
+	first, second := newOrg("first"), newOrg("second")
+	for _, org := range []*data.Organization{first, second} {
+		if err := b.Orgs.CreateOrganization(ctx, org); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := b.Members.AddMember(ctx, &data.Membership{OrgID: first.ID, UserID: uid, Role: "owner", CreatedAt: now}); err != nil {
+		t.Fatal(err)
+	}
+	if err := b.Members.AddMember(ctx, &data.Membership{OrgID: second.ID, UserID: uid, Role: "member", CreatedAt: now.Add(time.Second)}); err != nil {
+		t.Fatal(err)
+	}
+	if err := b.Members.AddMember(ctx, &data.Membership{OrgID: first.ID, UserID: uid, Role: "member", CreatedAt: now}); !errors.Is(err, data.ErrConflict) {
+		t.Errorf("duplicate membership: expected ErrConflict, got %v", err)
+	}
+
+	m, err := b.Members.GetMembership(ctx, first.ID, uid)
+	if err != nil || m.Role != "owner" || !m.CreatedAt.Equal(now) {
+		t.Fatalf("GetMembership: got %+v (%v)", m, err)
+	}
+	if _, err := b.Members.GetMembership(ctx, first.ID, uuid.NewString()); !errors.Is(err, data.ErrMemberNotFound) {
+		t.Errorf("unknown membership: expected ErrMemberNotFound, got %v", err)
+	}
+
+	list, err := b.Members.ListMembershipsByUser(ctx, uid)
+	if err != nil || len(list) != 2 || list[0].OrgID != first.ID || list[1].OrgID != second.ID {
+		t.Fatalf("ListMembershipsByUser: expected oldest first, got %+v (%v)", list, err)
+	}
+
+	if err := b.Members.UpdateMemberRole(ctx, second.ID, uid, "admin"); err != nil {
+		t.Fatal(err)
+	}
+	if m, _ := b.Members.GetMembership(ctx, second.ID, uid); m == nil || m.Role != "admin" {
+		t.Errorf("UpdateMemberRole: got %+v", m)
+	}
+	if err := b.Members.UpdateMemberRole(ctx, second.ID, uuid.NewString(), "admin"); !errors.Is(err, data.ErrMemberNotFound) {
+		t.Errorf("updating unknown membership: expected ErrMemberNotFound, got %v", err)
+	}
+
+	if err := b.Members.RemoveMember(ctx, second.ID, uid); err != nil {
+		t.Fatal(err)
+	}
+	if err := b.Members.RemoveMember(ctx, second.ID, uid); !errors.Is(err, data.ErrMemberNotFound) {
+		t.Errorf("second remove: expected ErrMemberNotFound, got %v", err)
+	}
+
+	// Deleting the organization removes its memberships
+	if err := b.Orgs.DeleteOrganization(ctx, first.ID); err != nil {
+		t.Fatal(err)
+	}
+	if list, _ := b.Members.ListMembersByOrg(ctx, first.ID); len(list) != 0 {
+		t.Errorf("memberships should be deleted with their organization, got %+v", list)
+	}
+
+	if b.Users != nil {
+		if err := b.Members.AddMember(ctx, &data.Membership{OrgID: second.ID, UserID: uid, Role: "member", CreatedAt: now}); err != nil {
+			t.Fatal(err)
+		}
+		if err := b.Users.DeleteUser(ctx, uid); err != nil {
+			t.Fatal(err)
+		}
+		if list, _ := b.Members.ListMembersByOrg(ctx, second.ID); len(list) != 0 {
+			t.Errorf("memberships should be deleted with their user, got %+v", list)
+		}
+	}
+}
+
+func testInvitations(t *testing.T, b Backend) {
+	ctx := context.Background()
+	now := time.Now().Truncate(time.Millisecond)
+
+	org := newOrg("acme")
+	if err := b.Orgs.CreateOrganization(ctx, org); err != nil {
+		t.Fatal(err)
+	}
+	newInvite := func(email string, created time.Time) *data.Invitation {
+		return &data.Invitation{ID: uuid.NewString(), OrgID: org.ID, Email: email, Role: "member",
+			InvitedBy: uuid.NewString(), ExpiresAt: now.Add(time.Hour), CreatedAt: created}
+	}
+
+	first, second := newInvite("a@example.com", now), newInvite("b@example.com", now.Add(time.Second))
+	for _, inv := range []*data.Invitation{second, first} {
+		if err := b.Invitations.CreateInvitation(ctx, inv); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := b.Invitations.CreateInvitation(ctx, first); !errors.Is(err, data.ErrConflict) {
+		t.Errorf("duplicate ID: expected ErrConflict, got %v", err)
+	}
+
+	got, err := b.Invitations.GetInvitation(ctx, first.ID)
+	if err != nil || got.Email != first.Email || got.Role != "member" || got.InvitedBy != first.InvitedBy ||
+		!got.ExpiresAt.Equal(first.ExpiresAt) || !got.AcceptedAt.IsZero() {
+		t.Fatalf("GetInvitation: got %+v (%v)", got, err)
+	}
+	if _, err := b.Invitations.GetInvitation(ctx, uuid.NewString()); !errors.Is(err, data.ErrInviteNotFound) {
+		t.Errorf("unknown ID: expected ErrInviteNotFound, got %v", err)
+	}
+
+	list, err := b.Invitations.ListInvitationsByOrg(ctx, org.ID)
+	if err != nil || len(list) != 2 || list[0].ID != first.ID {
+		t.Fatalf("ListInvitationsByOrg: expected oldest first, got %+v (%v)", list, err)
+	}
+
+	// Accepting is single-use and hides the invitation from the pending list
+	if err := b.Invitations.AcceptInvitation(ctx, first.ID, now); err != nil {
+		t.Fatal(err)
+	}
+	if err := b.Invitations.AcceptInvitation(ctx, first.ID, now); !errors.Is(err, data.ErrInviteNotFound) {
+		t.Errorf("second accept: expected ErrInviteNotFound, got %v", err)
+	}
+	if got, _ := b.Invitations.GetInvitation(ctx, first.ID); got == nil || !got.AcceptedAt.Equal(now) {
+		t.Errorf("accepted invitation: got %+v", got)
+	}
+	if list, _ := b.Invitations.ListInvitationsByOrg(ctx, org.ID); len(list) != 1 || list[0].ID != second.ID {
+		t.Errorf("pending invitations: got %+v", list)
+	}
+
+	if err := b.Invitations.DeleteInvitation(ctx, second.ID); err != nil {
+		t.Fatal(err)
+	}
+	if err := b.Invitations.DeleteInvitation(ctx, second.ID); !errors.Is(err, data.ErrInviteNotFound) {
+		t.Errorf("second delete: expected ErrInviteNotFound, got %v", err)
+	}
+	if err := b.Invitations.AcceptInvitation(ctx, second.ID, now); !errors.Is(err, data.ErrInviteNotFound) {
+		t.Errorf("accepting a revoked invitation: expected ErrInviteNotFound, got %v", err)
+	}
+
+	// Deleting the organization removes its invitations
+	if err := b.Orgs.DeleteOrganization(ctx, org.ID); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := b.Invitations.GetInvitation(ctx, first.ID); !errors.Is(err, data.ErrInviteNotFound) {
+		t.Errorf("invitations should be deleted with their organization, got %v", err)
+	}
+}
+
+func testTenants(t *testing.T, b Backend) {
+	ctx := context.Background()
+	now := time.Now().Truncate(time.Millisecond)
+
+	acme := &data.Tenant{
+		ID:         "acme",
+		Hosts:      []string{"auth.acme.example", "login.acme.example"},
+		PathPrefix: "/t/acme",
+		Secret:     "acme-secret",
+		Providers: []data.ProviderConfig{
+			{Type: "google", ClientID: "gid", ClientSecret: "gsecret", RedirectURL: "https://auth.acme.example/auth/google/callback"},
+			{Type: "oidc", Name: "okta", ClientID: "oid", IssuerURL: "https://acme.okta.example", Scopes: []string{"openid", "email"}},
+		},
+		VerifiedDomains: []string{"acme.example"},
+		UpdatedAt:       now.Add(-time.Hour),
+	}
+	if err := b.Tenants.SaveTenant(ctx, acme); err != nil {
+		t.Fatal(err)
+	}
+	if err := b.Tenants.SaveTenant(ctx, &data.Tenant{ID: "beta", UpdatedAt: now}); err != nil {
+		t.Fatal(err)
+	}
+
+	list, err := b.Tenants.ListTenants(ctx)
+	if err != nil || len(list) != 2 || list[0].ID != "acme" || list[1].ID != "beta" {
+		t.Fatalf("ListTenants: got %+v (%v)", list, err)
+	}
+	got := list[0]
+	if acme.UpdatedAt.Before(now) {
+		t.Errorf("SaveTenant should set UpdatedAt, got %s", acme.UpdatedAt)
+	}
+	if len(got.Hosts) != 2 || got.PathPrefix != "/t/acme" || got.Secret != "acme-secret" || !got.UpdatedAt.Equal(acme.UpdatedAt) ||
+		len(got.VerifiedDomains) != 1 || got.VerifiedDomains[0] != "acme.example" || len(list[1].VerifiedDomains) != 0 {
+		t.Errorf("tenant fields not preserved: %+v", got)
+	}
+	if len(got.Providers) != 2 || got.Providers[0].ClientSecret != "gsecret" || got.Providers[1].Name != "okta" ||
+		got.Providers[1].IssuerURL != "https://acme.okta.example" || len(got.Providers[1].Scopes) != 2 {
+		t.Errorf("providers not preserved: %+v", got.Providers)
+	}
+
+	// Saving again replaces the tenant
+	saved := acme.UpdatedAt
+	acme.Hosts = []string{"auth.acme.example"}
+	acme.Providers = nil
+	if err := b.Tenants.SaveTenant(ctx, acme); err != nil {
+		t.Fatal(err)
+	}
+	if list, _ := b.Tenants.ListTenants(ctx); len(list) != 2 || len(list[0].Hosts) != 1 || len(list[0].Providers) != 0 ||
+		list[0].UpdatedAt.Before(saved) {
+		t.Errorf("SaveTenant should replace the tenant, got %+v", list)
+	}
+
+	if err := b.Tenants.DeleteTenant(ctx, "beta"); err != nil {
+		t.Fatal(err)
+	}
+	if err := b.Tenants.DeleteTenant(ctx, "beta"); !errors.Is(err, data.ErrTenantNotFound) {
+		t.Errorf("second delete: expected ErrTenantNotFound, got %v", err)
+	}
+}
+
+func testClients(t *testing.T, b Backend) {
+	ctx := context.Background()
+	now := time.Now().Truncate(time.Millisecond)
+
+	worker := &data.Client{ID: "worker", Name: "Worker", SecretHash: "hash-1", Scopes: []string{"reports:read", "reports:write"},
+		RedirectURIs: []string{"https://app.example/callback"}, CreatedAt: now}
+	if err := b.Clients.CreateClient(ctx, worker); err != nil {
+		t.Fatal(err)
+	}
+	if err := b.Clients.CreateClient(ctx, &data.Client{ID: "billing", SecretHash: "hash-2", CreatedAt: now.Add(time.Second)}); err != nil {
+		t.Fatal(err)
+	}
+	if err := b.Clients.CreateClient(ctx, &data.Client{ID: "worker", SecretHash: "hash-3", CreatedAt: now}); !errors.Is(err, data.ErrConflict) {
+		t.Errorf("duplicate ID: expected ErrConflict, got %v", err)
+	}
+
+	got, err := b.Clients.GetClient(ctx, "worker")
+	if err != nil || got.Name != "Worker" || got.SecretHash != "hash-1" || len(got.Scopes) != 2 || got.Scopes[1] != "reports:write" ||
+		len(got.RedirectURIs) != 1 || got.RedirectURIs[0] != "https://app.example/callback" || !got.CreatedAt.Equal(now) {
+		t.Fatalf("GetClient: got %+v (%v)", got, err)
+	}
+	if _, err := b.Clients.GetClient(ctx, "missing"); !errors.Is(err, data.ErrClientNotFound) {
+		t.Errorf("unknown client: expected ErrClientNotFound, got %v", err)
+	}
+
+	list, err := b.Clients.ListClients(ctx)
+	if err != nil || len(list) != 2 || list[0].ID != "worker" || list[1].ID != "billing" || len(list[1].Scopes) != 0 || len(list[1].RedirectURIs) != 0 {
+		t.Errorf("ListClients: expected both clients oldest first, got %+v (%v)", list, err)
+	}
+
+	if err := b.Clients.DeleteClient(ctx, "billing"); err != nil {
+		t.Fatal(err)
+	}
+	if err := b.Clients.DeleteClient(ctx, "billing"); !errors.Is(err, data.ErrClientNotFound) {
+		t.Errorf("second delete: expected ErrClientNotFound, got %v", err)
+	}
+}
+
+func testAPIKeys(t *testing.T, b Backend) {
+	ctx := context.Background()
+	uid, other := userID(t, b), userID(t, b)
+	now := time.Now().Truncate(time.Millisecond)
+
+	first := &data.APIKey{ID: uuid.NewString(), UserID: uid, Name: "ci", Prefix: "pfx1", KeyHash: "hash-1",
+		Scopes: []string{"repo:read"}, ExpiresAt: now.Add(time.Hour), CreatedAt: now}
+	second := &data.APIKey{ID: uuid.NewString(), UserID: uid, Name: "backup", Prefix: "pfx2", KeyHash: "hash-2", CreatedAt: now.Add(time.Second)}
+	for _, k := range []*data.APIKey{first, second, {ID: uuid.NewString(), UserID: other, Prefix: "pfx3", KeyHash: "hash-3", CreatedAt: now}} {
+		if err := b.APIKeys.CreateAPIKey(ctx, k); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := b.APIKeys.CreateAPIKey(ctx, &data.APIKey{ID: uuid.NewString(), UserID: uid, Prefix: "pfx1", KeyHash: "x", CreatedAt: now}); !errors.Is(err, data.ErrConflict) {
+		t.Errorf("duplicate prefix: expected ErrConflict, got %v", err)
+	}
+
+	got, err := b.APIKeys.GetAPIKeyByPrefix(ctx, "pfx1")
+	if err != nil || got.ID != first.ID || got.UserID != uid || got.Name != "ci" || got.KeyHash != "hash-1" ||
+		len(got.Scopes) != 1 || !got.ExpiresAt.Equal(first.ExpiresAt) || !got.LastUsedAt.IsZero() {
+		t.Fatalf("GetAPIKeyByPrefix: got %+v (%v)", got, err)
+	}
+	if got, _ := b.APIKeys.GetAPIKeyByPrefix(ctx, "pfx2"); got == nil || !got.ExpiresAt.IsZero() || len(got.Scopes) != 0 {
+		t.Errorf("expected a key without expiry or scopes, got %+v", got)
+	}
+	if _, err := b.APIKeys.GetAPIKeyByPrefix(ctx, "missing"); !errors.Is(err, data.ErrAPIKeyNotFound) {
+		t.Errorf("unknown prefix: expected ErrAPIKeyNotFound, got %v", err)
+	}
+
+	list, err := b.APIKeys.ListAPIKeysByUser(ctx, uid)
+	if err != nil || len(list) != 2 || list[0].ID != first.ID || list[1].ID != second.ID {
+		t.Errorf("ListAPIKeysByUser: expected the user's keys oldest first, got %+v (%v)", list, err)
+	}
+
+	if err := b.APIKeys.TouchAPIKey(ctx, first.ID, now.Add(time.Minute), "10.0.0.9"); err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := b.APIKeys.GetAPIKeyByPrefix(ctx, "pfx1"); !got.LastUsedAt.Equal(now.Add(time.Minute)) || got.LastUsedIP != "10.0.0.9" {
+		t.Errorf("TouchAPIKey: got %+v", got)
+	}
+
+	if err := b.APIKeys.DeleteAPIKey(ctx, other, first.ID); !errors.Is(err, data.ErrAPIKeyNotFound) {
+		t.Errorf("deleting another user's key: expected ErrAPIKeyNotFound, got %v", err)
+	}
+	if err := b.APIKeys.DeleteAPIKey(ctx, uid, first.ID); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := b.APIKeys.GetAPIKeyByPrefix(ctx, "pfx1"); !errors.Is(err, data.ErrAPIKeyNotFound) {
+		t.Errorf("deleted key: expected ErrAPIKeyNotFound, got %v", err)
+	}
+
+	if b.Users != nil {
+		if err := b.Users.DeleteUser(ctx, uid); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := b.APIKeys.GetAPIKeyByPrefix(ctx, "pfx2"); !errors.Is(err, data.ErrAPIKeyNotFound) {
+			t.Errorf("keys should be deleted with their user, got %v", err)
+		}
+	}
+}
+
+func testChallenges(t *testing.T, b Backend) {
+	ctx := context.Background()
+
+	if err := b.Challenges.SaveChallenge(ctx, "k", []byte("v"), time.Minute); err != nil {
+		t.Fatal(err)
+	}
+	if v, err := b.Challenges.PopChallenge(ctx, "k"); err != nil || string(v) != "v" {
+		t.Fatalf("expected v, got %q (%v)", v, err)
+	}
+	if _, err := b.Challenges.PopChallenge(ctx, "k"); !errors.Is(err, data.ErrChallengeNotFound) {
+		t.Errorf("expected challenge to be single-use, got %v", err)
+	}
+	if _, err := b.Challenges.PopChallenge(ctx, "missing"); !errors.Is(err, data.ErrChallengeNotFound) {
+		t.Errorf("unknown challenge: expected ErrChallengeNotFound, got %v", err)
+	}
+}
+
+func testCodes(t *testing.T, b Backend) {
+	ctx := context.Background()
+
+	if _, err := b.Codes.IncrCodeAttempts(ctx, "a@example.com"); !errors.Is(err, data.ErrCodeNotFound) {
+		t.Fatalf("missing code: expected ErrCodeNotFound, got %v", err)
+	}
+	if _, err := b.Codes.GetCode(ctx, "a@example.com"); !errors.Is(err, data.ErrCodeNotFound) {
+		t.Fatalf("incrementing a missing code must not create it, got %v", err)
+	}
+
+	if err := b.Codes.SaveCode(ctx, "a@example.com", "hash-1", time.Minute); err != nil {
+		t.Fatal(err)
+	}
+	for want := 1; want <= 2; want++ {
+		if n, err := b.Codes.IncrCodeAttempts(ctx, "a@example.com"); err != nil || n != want {
+			t.Fatalf("expected %d attempts, got %d (%v)", want, n, err)
+		}
+	}
+
+	// Saving a new code resets the counter
+	if err := b.Codes.SaveCode(ctx, "a@example.com", "hash-2", time.Minute); err != nil {
+		t.Fatal(err)
+	}
+	if n, _ := b.Codes.IncrCodeAttempts(ctx, "a@example.com"); n != 1 {
+		t.Errorf("expected counter reset, got %d", n)
+	}
+	if h, err := b.Codes.GetCode(ctx, "a@example.com"); err != nil || h != "hash-2" {
+		t.Errorf("expected hash-2, got %q (%v)", h, err)
+	}
+
+	if err := b.Codes.DeleteCode(ctx, "a@example.com"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := b.Codes.GetCode(ctx, "a@example.com"); !errors.Is(err, data.ErrCodeNotFound) {
+		t.Errorf("deleted code: expected ErrCodeNotFound, got %v", err)
+	}
+}
+
+func testLockouts(t *testing.T, b Backend) {
+	ctx := context.Background()
+
+	for want := 1; want <= 3; want++ {
+		if n, err := b.Lockouts.RegisterFailure(ctx, "acct:a@example.com", time.Minute); err != nil || n != want {
+			t.Fatalf("expected %d failures, got %d (%v)", want, n, err)
+		}
+	}
+	if got, err := b.Lockouts.GetLockedUntil(ctx, "acct:a@example.com"); err != nil || !got.IsZero() {
+		t.Errorf("expected no lock yet, got %s (%v)", got, err)
+	}
+
+	until := time.Now().Add(time.Minute).Truncate(time.Millisecond)
+	if err := b.Lockouts.SetLockedUntil(ctx, "acct:a@example.com", until); err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := b.Lockouts.GetLockedUntil(ctx, "acct:a@example.com"); !got.Equal(until) {
+		t.Errorf("expected locked until %s, got %s", until, got)
+	}
+
+	if err := b.Lockouts.ResetFailures(ctx, "acct:a@example.com"); err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := b.Lockouts.GetLockedUntil(ctx, "acct:a@example.com"); !got.IsZero() {
+		t.Errorf("expected lock to be cleared, got %s", got)
+	}
+	if n, _ := b.Lockouts.RegisterFailure(ctx, "acct:a@example.com", time.Minute); n != 1 {
+		t.Errorf("expected failures to be reset, got %d", n)
+	}
+}
+
+func testRevocations(t *testing.T, b Backend) {
+	ctx := context.Background()
+
+	if err := b.Revocations.Revoke(ctx, "jti-1", time.Minute); err != nil {
+		t.Fatal(err)
+	}
+	if ok, err := b.Revocations.IsRevoked(ctx, "jti-1"); err != nil || !ok {
+		t.Errorf("expected jti-1 to be revoked (%v)", err)
+	}
+	if ok, _ := b.Revocations.IsRevoked(ctx, "jti-2"); ok {
+		t.Error("expected jti-2 not to be revoked")
+	}
+}
@@ -0,0 +1,78 @@
+package token
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+)
+
+// ErrTokenTooLarge is returned when a signed token exceeds the configured size limit.
+var ErrTokenTooLarge = errors.New("token too large")
+
+// Key is a typed handle for a custom claim stored in Claims.Custom under its name.
+// Declare keys once and share them between the code issuing tokens and the handlers
+// reading them:
+//
+//	var TenantID = token.NewKey[string]("tenant_id")
+type Key[T any] struct {
+	name string
+}
+
+func NewKey[T any](name string) Key[T] {
+	return Key[T]{name: name}
+}
+
+func (k Key[T]) Name() string {
+	return k.name
+}
+
+// Set stores v in c, replacing any previous value.
+func (k Key[T]) Set(c *Claims, v T) error {
+	raw, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Errorf("claim %s: %w", k.name, err)
+	}
+	if c.Custom == nil {
+		c.Custom = make(map[string]json.RawMessage)
+	}
+	c.Custom[k.name] = raw
+	return nil
+}
+
+// Get returns the claim's value and whether it is present. A value that does not decode
+// into T is an error.
+func (k Key[T]) Get(c Claims) (T, bool, error) {
+	var v T
+	raw, ok := c.Custom[k.name]
+	if !ok {
+		return v, false, nil
+	}
+	if err := json.Unmarshal(raw, &v); err != nil {
+		return v, false, fmt.Errorf("claim %s: %w", k.name, err)
+	}
+	return v, true, nil
+}
+
+// FromRequest reads the claim from the claims the auth middleware stored on r. It reports
+// false when the request is unauthenticated or the claim is missing or malformed.
+func (k Key[T]) FromRequest(r *http.Request) (T, bool) {
+	var zero T
+	claims, err := GetClaims(r)
+	if err != nil {
+		return zero, false
+	}
+	v, ok, err := k.Get(claims)
+	if err != nil {
+		return zero, false
+	}
+	return v, ok
+}
+
+// With returns a ClaimSetter that sets the claim to v, for Service.Token.
+func (k Key[T]) With(v T) ClaimSetter {
+	return func(c *Claims) error { return k.Set(c, v) }
+}
+
+// ClaimSetter adds claims to a token before it is signed.
+type ClaimSetter func(c *Claims) error
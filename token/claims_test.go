@@ -0,0 +1,57 @@
+package token
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+	"testing"
+)
+
+type flags struct {
+	Beta  bool     `json:"beta"`
+	Roles []string `json:"roles"`
+}
+
+func TestKey_RoundTrip(t *testing.T) {
+	tenant := NewKey[string]("tenant_id")
+	features := NewKey[flags]("features")
+
+	var c Claims
+	if err := tenant.Set(&c, "acme"); err != nil {
+		t.Fatal(err)
+	}
+	if err := features.With(flags{Beta: true, Roles: []string{"owner"}})(&c); err != nil {
+		t.Fatal(err)
+	}
+
+	// Claims travel as JSON inside the token
+	raw, err := json.Marshal(c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var parsed Claims
+	if err := json.Unmarshal(raw, &parsed); err != nil {
+		t.Fatal(err)
+	}
+
+	if v, ok, err := tenant.Get(parsed); err != nil || !ok || v != "acme" {
+		t.Errorf("tenant: got %q, %v, %v", v, ok, err)
+	}
+	if v, ok, err := features.Get(parsed); err != nil || !ok || !v.Beta || len(v.Roles) != 1 {
+		t.Errorf("features: got %+v, %v, %v", v, ok, err)
+	}
+	if _, ok, err := NewKey[string]("missing").Get(parsed); ok || err != nil {
+		t.Errorf("missing claim: got %v, %v", ok, err)
+	}
+	if _, _, err := NewKey[int]("tenant_id").Get(parsed); err == nil {
+		t.Error("expected an error reading a string claim as int")
+	}
+
+	r := httptest.NewRequest("GET", "/", nil)
+	if _, ok := tenant.FromRequest(r); ok {
+		t.Error("expected no claim on an unauthenticated request")
+	}
+	r = SetClaims(r, parsed)
+	if v, ok := tenant.FromRequest(r); !ok || v != "acme" {
+		t.Errorf("FromRequest: got %q, %v", v, ok)
+	}
+}
@@ -2,15 +2,21 @@ package token
 
 import (
 	"context"
+	"encoding/json"
 	"errors"
 	"net/http"
+	"slices"
+	"strings"
 
 	"github.com/golang-jwt/jwt/v5"
 )
 
 type contextKey string
 
-const userKey contextKey = "user"
+const (
+	userKey   contextKey = "user"
+	claimsKey contextKey = "claims"
+)
 
 type SecretFunc func(id string) (string, error)
 
@@ -23,11 +29,35 @@ type User struct {
 	Attributes map[string]interface{} `json:"attrs,omitempty"`
 }
 
+const (
+	// SubjectClient is the subject type of tokens issued to machine clients with the
+	// client_credentials grant. Their Subject is the client ID and they carry no User.
+	SubjectClient = "client"
+	// SubjectAPIKey marks claims resolved from a user's API key. They carry the key's User,
+	// its ID as ID and its scopes.
+	SubjectAPIKey = "api_key"
+)
+
 type Claims struct {
-	User *User `json:"user,omitempty"`
+	User      *User  `json:"user,omitempty"`
+	SessionID string `json:"sid,omitempty"`
+	// SubjectType is SubjectClient or SubjectAPIKey, and empty for user tokens.
+	SubjectType string `json:"sub_type,omitempty"`
+	// Scope lists the granted scopes, space-separated as in OAuth2.
+	Scope string `json:"scope,omitempty"`
+	// OrgID and OrgRole describe the organization the user is currently acting in.
+	OrgID   string `json:"org,omitempty"`
+	OrgRole string `json:"org_role,omitempty"`
+	// Custom holds app-specific claims by name; use a Key to read and write them.
+	Custom map[string]json.RawMessage `json:"ext,omitempty"`
 	jwt.RegisteredClaims
 }
 
+// HasScope reports whether scope is one of the granted scopes.
+func (c Claims) HasScope(scope string) bool {
+	return slices.Contains(strings.Fields(c.Scope), scope)
+}
+
 type ValidatorFunc func(token string, claims Claims) bool
 
 type Validator interface {
@@ -57,3 +87,16 @@ func MustGetUserInfo(r *http.Request) User {
 	}
 	return user
 }
+
+// SetClaims stores the parsed token claims, e.g. to look up the current session ID.
+func SetClaims(r *http.Request, claims Claims) *http.Request {
+	ctx := context.WithValue(r.Context(), claimsKey, claims)
+	return r.WithContext(ctx)
+}
+
+func GetClaims(r *http.Request) (Claims, error) {
+	if claims, ok := r.Context().Value(claimsKey).(Claims); ok {
+		return claims, nil
+	}
+	return Claims{}, errors.New("claims not found in context")
+}